@@ -5,11 +5,19 @@
 package main
 
 import (
+	"errors"
+	"locknote/internal/attachments"
+	"locknote/internal/backup"
+	"locknote/internal/core"
 	"locknote/internal/database"
 	"locknote/internal/notebooks"
 	"locknote/internal/notes"
 	"locknote/internal/smartviews"
+	locksync "locknote/internal/sync"
 	"locknote/internal/tags"
+	"net/url"
+	"path/filepath"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -79,6 +87,16 @@ func (a *App) RestoreNoteFromHistory(noteID, historyID string) (*notes.Note, err
 	return a.core.Notes().RestoreFromHistory(noteID, historyID)
 }
 
+func (a *App) SearchNotes(query string, opts notes.SearchOptions) (*notes.SearchResult, error) {
+	a.UpdateActivity()
+	return a.core.Notes().Search(query, opts)
+}
+
+func (a *App) RebuildSearchIndex() (int, error) {
+	a.UpdateActivity()
+	return a.core.Notes().RebuildSearchIndex()
+}
+
 func (a *App) CreateTag(name, color string) (*tags.Tag, error) {
 	a.UpdateActivity()
 	return a.core.Tags().Create(name, color)
@@ -114,23 +132,61 @@ func (a *App) GetSettings() (*database.Settings, error) {
 }
 
 func (a *App) UpdateSettings(autoLockMinutes int, lockOnMinimize, lockOnSleep bool) error {
-	settings := &database.Settings{
-		AutoLockMinutes: autoLockMinutes,
-		LockOnMinimize:  lockOnMinimize,
-		LockOnSleep:     lockOnSleep,
+	settings, err := a.core.GetSettings()
+	if err != nil {
+		return err
 	}
+	settings.AutoLockMinutes = autoLockMinutes
+	settings.LockOnMinimize = lockOnMinimize
+	settings.LockOnSleep = lockOnSleep
 	return a.core.UpdateSettings(settings)
 }
 
+// UpdateBackupSchedule 更新定时备份设置，intervalHours 为 0 或 dir 为空时关闭
+func (a *App) UpdateBackupSchedule(intervalHours int, dir string, keepDaily, keepWeekly int) error {
+	a.UpdateActivity()
+	return a.core.UpdateBackupSchedule(intervalHours, dir, keepDaily, keepWeekly)
+}
+
+// ChooseBackupDirectory 选择定时备份目录，用户取消时返回空字符串
+func (a *App) ChooseBackupDirectory() (string, error) {
+	a.UpdateActivity()
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "选择定时备份目录",
+		CanCreateDirectories: true,
+	})
+}
+
+// RunScheduledBackup 立即按定时备份设置备份一次
+func (a *App) RunScheduledBackup() (*backup.ScheduledResult, error) {
+	a.UpdateActivity()
+	return a.core.RunScheduledBackup()
+}
+
+var backupFileFilters = []runtime.FileFilter{
+	{DisplayName: "LockNote 备份", Pattern: "*.locknote"},
+	{DisplayName: "旧版 ZIP 备份", Pattern: "*.zip"},
+}
+
 func (a *App) CreateBackup() (string, error) {
+	return a.createBackup("")
+}
+
+// CreateBackupWithPassphrase 用单独的备份口令创建备份，恢复时只需要该口令
+func (a *App) CreateBackupWithPassphrase(passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", errors.New("备份口令不能为空")
+	}
+	return a.createBackup(passphrase)
+}
+
+func (a *App) createBackup(passphrase string) (string, error) {
 	a.UpdateActivity()
 
 	savePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
 		Title:           "保存备份文件",
-		DefaultFilename: "LockNote.app-backup.zip",
-		Filters: []runtime.FileFilter{
-			{DisplayName: "ZIP 文件", Pattern: "*.zip"},
-		},
+		DefaultFilename: "LockNote-backup.locknote",
+		Filters:         backupFileFilters[:1],
 	})
 	if err != nil {
 		return "", err
@@ -139,7 +195,11 @@ func (a *App) CreateBackup() (string, error) {
 		return "", nil
 	}
 
-	err = a.core.Backup().CreateBackup(savePath)
+	if passphrase != "" {
+		err = a.core.Backup().CreateBackupWithPassphrase(savePath, passphrase)
+	} else {
+		err = a.core.Backup().CreateBackup(savePath)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -147,42 +207,179 @@ func (a *App) CreateBackup() (string, error) {
 	return savePath, nil
 }
 
-func (a *App) RestoreBackup() error {
+// VerifyBackup 选择备份文件并校验其完整性，不恢复任何内容。
+// passphrase 为空时使用当前数据密钥；用户取消选择时返回 nil。
+func (a *App) VerifyBackup(passphrase string) (*backup.BackupInfo, error) {
 	a.UpdateActivity()
 
 	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "选择备份文件",
-		Filters: []runtime.FileFilter{
-			{DisplayName: "ZIP 文件", Pattern: "*.zip"},
-		},
+		Title:   "选择要校验的备份文件",
+		Filters: backupFileFilters,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if openPath == "" {
-		return nil
+		return nil, nil
 	}
 
-	return a.core.Backup().RestoreBackup(openPath)
+	if passphrase != "" {
+		return a.core.Backup().VerifyBackupWithKey(openPath, backup.Key{Passphrase: passphrase})
+	}
+	return a.core.Backup().VerifyBackup(openPath)
 }
 
-func (a *App) ImportBackupWithKey(dataKey string) (int, error) {
+// RestoreBackup 恢复备份。备份来自其他数据密钥时恢复后处于锁定状态，需要用备份时的主密码解锁
+func (a *App) RestoreBackup() (*core.RestoreResult, error) {
+	return a.restoreBackup("")
+}
+
+// RestoreBackupWithPassphrase 恢复用单独备份口令加密的备份
+func (a *App) RestoreBackupWithPassphrase(passphrase string) (*core.RestoreResult, error) {
+	if passphrase == "" {
+		return nil, errors.New("备份口令不能为空")
+	}
+	return a.restoreBackup(passphrase)
+}
+
+func (a *App) restoreBackup(passphrase string) (*core.RestoreResult, error) {
 	a.UpdateActivity()
 
 	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "选择要导入的备份文件",
-		Filters: []runtime.FileFilter{
-			{DisplayName: "ZIP 文件", Pattern: "*.zip"},
-		},
+		Title:   "选择备份文件",
+		Filters: backupFileFilters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if openPath == "" {
+		return nil, nil
+	}
+
+	var result *core.RestoreResult
+	if passphrase != "" {
+		result, err = a.core.RestoreBackupWithKey(openPath, backup.Key{Passphrase: passphrase})
+	} else {
+		result, err = a.core.RestoreBackup(openPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 已打开的附件属于替换前的数据
+	a.cleanupOpenedAttachments()
+	if !result.Unlocked {
+		runtime.EventsEmit(a.ctx, "app:locked")
+	}
+	return result, nil
+}
+
+// OpenBackupNotes 选择备份文件并以只读方式打开，列出其中的笔记及与当前数据的差异。
+// dataKey 为备份数据的恢复密钥，为空时使用当前数据密钥；用户取消选择时返回 nil
+func (a *App) OpenBackupNotes(passphrase, dataKey string) ([]*core.BackupNote, error) {
+	a.UpdateActivity()
+
+	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "选择备份文件",
+		Filters: backupFileFilters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if openPath == "" {
+		return nil, nil
+	}
+
+	view, err := a.core.OpenBackup(openPath, passphrase, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	a.backupViewMu.Lock()
+	a.backupView = view
+	a.backupViewMu.Unlock()
+
+	return a.core.BackupNotes(view)
+}
+
+func (a *App) openedBackup() (*core.BackupView, error) {
+	a.backupViewMu.Lock()
+	defer a.backupViewMu.Unlock()
+	if a.backupView == nil {
+		return nil, errors.New("没有打开的备份")
+	}
+	return a.backupView, nil
+}
+
+// GetBackupNote 返回已打开备份中的一篇笔记，用于预览
+func (a *App) GetBackupNote(id string) (*notes.Note, error) {
+	a.UpdateActivity()
+	view, err := a.openedBackup()
+	if err != nil {
+		return nil, err
+	}
+	return view.Get(id)
+}
+
+// RestoreNotesFromBackup 把已打开备份中选中的笔记恢复到当前数据，overwrite 时覆盖 ID 相同的笔记
+func (a *App) RestoreNotesFromBackup(ids []string, overwrite bool) (*core.NotesRestoreResult, error) {
+	a.UpdateActivity()
+	view, err := a.openedBackup()
+	if err != nil {
+		return nil, err
+	}
+	mode := core.RestoreAsCopy
+	if overwrite {
+		mode = core.RestoreOverwrite
+	}
+	return a.core.RestoreNotesFromBackup(view, ids, mode)
+}
+
+// CloseBackupNotes 关闭已打开的备份并删除解压出的临时数据
+func (a *App) CloseBackupNotes() {
+	a.backupViewMu.Lock()
+	view := a.backupView
+	a.backupView = nil
+	a.backupViewMu.Unlock()
+	if view != nil {
+		view.Close()
+	}
+}
+
+// SyncWithFolder 与共享文件夹（如网盘目录）双向同步，用户取消选择时返回 nil
+func (a *App) SyncWithFolder() (*locksync.Report, error) {
+	a.UpdateActivity()
+
+	dir, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "选择同步文件夹",
+		CanCreateDirectories: true,
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if dir == "" {
+		return nil, nil
+	}
+
+	return a.core.Sync().Sync(locksync.NewFolderTransport(dir))
+}
+
+// ImportBackupWithKey 选择备份文件，把其中的笔记合并到当前数据。
+// dataKey 为备份数据的恢复密钥，为空时使用当前数据密钥；用户取消选择时返回 nil
+func (a *App) ImportBackupWithKey(dataKey string) (*core.ImportReport, error) {
+	a.UpdateActivity()
+
+	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "选择要导入的备份文件",
+		Filters: backupFileFilters,
+	})
+	if err != nil {
+		return nil, err
 	}
 	if openPath == "" {
-		return 0, nil
+		return nil, nil
 	}
 
-	return a.core.Notes().ImportFromBackup(openPath, dataKey)
+	return a.core.ImportFromBackup(openPath, "", dataKey)
 }
 
 func (a *App) ExportNoteAsMarkdown(noteID string) (string, error) {
@@ -216,6 +413,96 @@ func (a *App) ExportNoteAsMarkdown(noteID string) (string, error) {
 	return savePath, nil
 }
 
+// ExportNoteAsHTML 把笔记导出为嵌入图片的 HTML 文档，可以在浏览器中打开或打印为 PDF
+func (a *App) ExportNoteAsHTML(noteID string) (string, error) {
+	a.UpdateActivity()
+
+	note, err := a.core.Notes().Get(noteID)
+	if err != nil {
+		return "", err
+	}
+
+	savePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "导出笔记为 HTML",
+		DefaultFilename: note.Title + ".html",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "HTML 文件", Pattern: "*.html"},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if savePath == "" {
+		return "", nil
+	}
+
+	doc, err := a.core.NoteHTML(noteID)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(savePath, doc); err != nil {
+		return "", err
+	}
+
+	return savePath, nil
+}
+
+// ExportHTML 把笔记以明文导出为带目录的单个 HTML 文件，需要再次输入主密码；用户取消选择时返回 nil
+func (a *App) ExportHTML(password string, opts core.ExportOptions) (*core.ExportResult, error) {
+	a.UpdateActivity()
+
+	dest, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "导出为 HTML（未加密）",
+		DefaultFilename: "locknote-export-" + time.Now().Format("20060102-150405") + ".html",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "HTML 文件", Pattern: "*.html"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dest == "" {
+		return nil, nil
+	}
+
+	return a.core.ExportHTML(password, dest, opts)
+}
+
+// ExportMarkdown 把笔记导出为明文 Markdown 目录树或 zip，需要再次输入主密码。
+// 导出目录为所选文件夹下新建的 locknote-export-<时间> 子目录；用户取消选择时返回 nil
+func (a *App) ExportMarkdown(password string, opts core.ExportOptions) (*core.ExportResult, error) {
+	a.UpdateActivity()
+
+	stamp := time.Now().Format("20060102-150405")
+	var dest string
+	var err error
+	if opts.Zip {
+		dest, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title:           "导出为 Markdown（未加密）",
+			DefaultFilename: "locknote-export-" + stamp + ".zip",
+			Filters: []runtime.FileFilter{
+				{DisplayName: "Zip 文件", Pattern: "*.zip"},
+			},
+		})
+	} else {
+		dest, err = runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:                "选择导出位置（未加密）",
+			CanCreateDirectories: true,
+		})
+		if dest != "" {
+			dest = filepath.Join(dest, "locknote-export-"+stamp)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dest == "" {
+		return nil, nil
+	}
+
+	return a.core.ExportMarkdown(password, dest, opts)
+}
+
 func (a *App) ImportMarkdown() (*notes.Note, error) {
 	a.UpdateActivity()
 
@@ -241,6 +528,146 @@ func (a *App) ImportMarkdown() (*notes.Note, error) {
 	return a.core.Notes().Create(title, string(content))
 }
 
+// ImportMarkdownFolder 选择 Obsidian、Logseq 或普通 Markdown 文件夹并导入其中的笔记，用户取消选择时返回 nil
+func (a *App) ImportMarkdownFolder() (*core.MarkdownImportReport, error) {
+	a.UpdateActivity()
+
+	dir, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择要导入的 Markdown 文件夹",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, nil
+	}
+
+	return a.core.ImportMarkdownDir(dir)
+}
+
+// ImportEvernote 选择 Evernote 导出的 .enex 文件并导入其中的笔记，笔记本名为文件名。
+// dryRun 时只检查与计数，不写入任何数据；用户取消选择时返回 nil
+func (a *App) ImportEvernote(dryRun bool) (*core.ExternalImportReport, error) {
+	a.UpdateActivity()
+
+	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择 Evernote 导出文件",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Evernote 导出文件", Pattern: "*.enex"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if openPath == "" {
+		return nil, nil
+	}
+
+	return a.core.ImportENEX(openPath, dryRun)
+}
+
+// ImportJoplin 选择 Joplin 导出的 .jex 文件并导入其中的笔记。
+// dryRun 时只检查与计数，不写入任何数据；用户取消选择时返回 nil
+func (a *App) ImportJoplin(dryRun bool) (*core.ExternalImportReport, error) {
+	a.UpdateActivity()
+
+	openPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择 Joplin 导出文件",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Joplin 导出文件", Pattern: "*.jex"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if openPath == "" {
+		return nil, nil
+	}
+
+	return a.core.ImportJEX(openPath, dryRun)
+}
+
+// Attachment APIs
+
+func (a *App) AddAttachments(noteID string) ([]*attachments.Attachment, error) {
+	a.UpdateActivity()
+
+	paths, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "添加附件",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	added := make([]*attachments.Attachment, 0, len(paths))
+	for _, p := range paths {
+		att, err := a.core.Attachments().AddFile(noteID, p)
+		if err != nil {
+			return added, err
+		}
+		added = append(added, att)
+	}
+	return added, nil
+}
+
+func (a *App) ListAttachments(noteID string) ([]*attachments.Attachment, error) {
+	a.UpdateActivity()
+	return a.core.Attachments().List(noteID)
+}
+
+func (a *App) ExportAttachment(id string) (string, error) {
+	a.UpdateActivity()
+
+	att, err := a.core.Attachments().Get(id)
+	if err != nil {
+		return "", err
+	}
+
+	savePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "导出附件",
+		DefaultFilename: att.Filename,
+	})
+	if err != nil {
+		return "", err
+	}
+	if savePath == "" {
+		return "", nil
+	}
+
+	if err := a.core.Attachments().Export(id, savePath); err != nil {
+		return "", err
+	}
+	return savePath, nil
+}
+
+// OpenAttachment 把附件解密到临时目录并用系统默认程序打开，锁定或退出时清理
+func (a *App) OpenAttachment(id string) error {
+	a.UpdateActivity()
+
+	att, err := a.core.Attachments().Get(id)
+	if err != nil {
+		return err
+	}
+
+	dir, err := a.openedAttachmentsDir()
+	if err != nil {
+		return err
+	}
+
+	destPath := filepath.Join(dir, att.ID+"-"+filepath.Base(att.Filename))
+	if err := a.core.Attachments().Export(id, destPath); err != nil {
+		return err
+	}
+
+	runtime.BrowserOpenURL(a.ctx, (&url.URL{Scheme: "file", Path: filepath.ToSlash(destPath)}).String())
+	return nil
+}
+
+func (a *App) RemoveAttachment(id string) error {
+	a.UpdateActivity()
+	return a.core.Attachments().Remove(id)
+}
+
 func writeFileAtomic(path string, data []byte) error {
 	tempPath := path + ".tmp"
 	if err := writeFile(tempPath, data); err != nil {
@@ -293,6 +720,28 @@ func (a *App) SetNotebookPinned(id string, pinned bool) error {
 	return a.core.Notebooks().SetPinned(id, pinned)
 }
 
+// ProtectNotebook 为笔记本设置单独的密码，其中的笔记改用笔记本密钥加密
+func (a *App) ProtectNotebook(id, password string) error {
+	a.UpdateActivity()
+	return a.core.ProtectNotebook(id, password)
+}
+
+// UnprotectNotebook 验证笔记本密码后取消保护
+func (a *App) UnprotectNotebook(id, password string) error {
+	a.UpdateActivity()
+	return a.core.UnprotectNotebook(id, password)
+}
+
+func (a *App) UnlockNotebook(id, password string) error {
+	a.UpdateActivity()
+	return a.core.Notebooks().Unlock(id, password)
+}
+
+func (a *App) LockNotebook(id string) {
+	a.UpdateActivity()
+	a.core.Notebooks().Lock(id)
+}
+
 func (a *App) SetNoteNotebook(noteID string, notebookID *string) error {
 	a.UpdateActivity()
 	return a.core.Notes().SetNotebook(noteID, notebookID)
@@ -354,3 +803,8 @@ func (a *App) GetSmartView(id string) (*smartviews.SmartView, error) {
 	a.UpdateActivity()
 	return a.core.SmartViews().Get(id)
 }
+
+func (a *App) ResolveSmartView(id string, limit, offset int) (*notes.ListResult, error) {
+	a.UpdateActivity()
+	return a.core.SmartViews().Resolve(id, limit, offset)
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"locknote/internal/backup"
 	"locknote/internal/core"
 	"os"
 	"path/filepath"
@@ -24,6 +25,10 @@ type App struct {
 	windowWatcherOnce sync.Once
 	watcherStop       chan struct{}
 	lastMinimized     bool
+	openedDir         string
+	openedMu          sync.Mutex
+	backupView        *core.BackupView
+	backupViewMu      sync.Mutex
 }
 
 func NewApp() *App {
@@ -57,11 +62,30 @@ func (a *App) startup(ctx context.Context) {
 
 	// 设置锁定回调，用于发送桌面端事件
 	a.core.SetLockCallback(func() {
+		a.cleanupOpenedAttachments()
 		if a.ctx != nil {
 			runtime.EventsEmit(a.ctx, "app:locked")
 		}
 	})
 
+	// 受保护的笔记本空闲后自动锁定，通知前端隐藏其中的笔记
+	a.core.SetNotebookLockCallback(func(id string) {
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "notebook:locked", id)
+		}
+	})
+
+	// 系统休眠或锁屏时按 LockOnSleep 设置锁定
+	a.core.StartPowerMonitor(core.NewSystemPowerSource())
+
+	// 定时备份，每次运行后通知前端
+	a.core.SetBackupCallback(func(result *backup.ScheduledResult) {
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, "backup:scheduled", result)
+		}
+	})
+	a.core.StartBackupScheduler()
+
 	runtime.EventsOn(a.ctx, "frontend:ready", func(optionalData ...interface{}) {
 		a.startWindowWatcherOnce()
 	})
@@ -79,6 +103,7 @@ func (a *App) startWindowWatcherOnce() {
 
 func (a *App) shutdown(ctx context.Context) {
 	a.stopWindowWatcher()
+	a.cleanupOpenedAttachments()
 	if a.core != nil {
 		a.core.Close()
 	}
@@ -119,6 +144,7 @@ func (a *App) checkWindowState() {
 			settings, _ := a.core.GetSettings()
 			if settings != nil && settings.LockOnMinimize {
 				a.core.Lock()
+				a.cleanupOpenedAttachments()
 				runtime.EventsEmit(a.ctx, "app:locked")
 			}
 		}
@@ -133,20 +159,65 @@ func (a *App) IsFirstRun() bool {
 	return a.core.IsFirstRun()
 }
 
-func (a *App) SetupPassword(password, hint, displayKey string) (*core.SetupResult, error) {
-	return a.core.SetupPassword(password, hint, displayKey)
+// SetupPassword 初始化主密码，keyfile 不为空时解锁还需要该密钥文件
+func (a *App) SetupPassword(password, hint, displayKey, keyfile string) (*core.SetupResult, error) {
+	return a.core.SetupPassword(password, hint, displayKey, keyfile)
 }
 
 func (a *App) VerifyDataKey(displayKey string) (bool, error) {
 	return a.core.VerifyDataKey(displayKey)
 }
 
-func (a *App) Unlock(password string) (bool, error) {
-	return a.core.Unlock(password)
+func (a *App) Unlock(password, keyfile string) (bool, error) {
+	return a.core.Unlock(password, keyfile)
+}
+
+// GetUnlockThrottle 返回连续失败次数与再次尝试前需要等待的秒数
+func (a *App) GetUnlockThrottle() (*core.UnlockThrottleStatus, error) {
+	return a.core.UnlockThrottle()
+}
+
+// SetWipeAfterFailures 设置连续失败 n 次后清除全部数据，n 为 0 时关闭
+func (a *App) SetWipeAfterFailures(n int) error {
+	a.UpdateActivity()
+	return a.core.SetWipeAfterFailures(n)
+}
+
+func (a *App) RequiresKeyfile() (bool, error) {
+	return a.core.RequiresKeyfile()
+}
+
+// SelectKeyfile 选择密钥文件，返回其路径；用户取消时返回空字符串
+func (a *App) SelectKeyfile() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择密钥文件",
+	})
+}
+
+// GenerateKeyfile 选择保存位置并生成随机的密钥文件，返回其路径；用户取消时返回空字符串
+func (a *App) GenerateKeyfile() (string, error) {
+	savePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "保存密钥文件",
+		DefaultFilename: "locknote.key",
+	})
+	if err != nil || savePath == "" {
+		return "", err
+	}
+	if err := a.core.GenerateKeyfile(savePath); err != nil {
+		return "", err
+	}
+	return savePath, nil
+}
+
+// SetKeyfile 设置、更换或取消（keyfile 为空）解锁所需的密钥文件
+func (a *App) SetKeyfile(password, keyfile string) error {
+	a.UpdateActivity()
+	return a.core.SetKeyfile(password, keyfile)
 }
 
 func (a *App) Lock() {
 	a.core.Lock()
+	a.cleanupOpenedAttachments()
 }
 
 func (a *App) IsUnlocked() bool {
@@ -165,6 +236,56 @@ func (a *App) ResetPasswordWithDataKey(displayKey, newPassword, newHint string)
 	return a.core.ResetPasswordWithDataKey(displayKey, newPassword, newHint)
 }
 
+func (a *App) RotateDataKey(password string) (*core.RotateResult, error) {
+	return a.core.RotateDataKey(password)
+}
+
+// TakeRotatedDataKey 返回解锁时自动完成密钥更换后生成的新恢复密钥（只返回一次）
+func (a *App) TakeRotatedDataKey() string {
+	return a.core.TakeRotatedDataKey()
+}
+
+// IsDatabaseEncrypted 返回数据库是否已整体加密
+func (a *App) IsDatabaseEncrypted() bool {
+	return a.core.IsDatabaseEncrypted()
+}
+
+// DatabaseEncryptionAvailable 返回当前版本是否支持整库加密
+func (a *App) DatabaseEncryptionAvailable() bool {
+	return a.core.DatabaseEncryptionAvailable()
+}
+
+// EnableDatabaseEncryption 把数据库转换为整体加密（需要主密码，开启后不能关闭）
+func (a *App) EnableDatabaseEncryption(password string) error {
+	return a.core.EncryptDatabase(password)
+}
+
+// VerifyData 检查数据目录的完整性
+func (a *App) VerifyData() (*core.VerifyReport, error) {
+	return a.core.Verify()
+}
+
+// RepairData 按选项修复数据目录，无法修复的内容移入隔离目录
+func (a *App) RepairData(opts core.RepairOptions) (*core.VerifyReport, error) {
+	return a.core.Repair(opts)
+}
+
+// LastRestore 返回最近一次恢复备份的信息，可用于回滚
+func (a *App) LastRestore() (*core.RestoreInfo, error) {
+	return a.core.LastRestore()
+}
+
+// RollbackRestore 撤销最近一次恢复，换回恢复前的数据，之后需要重新解锁
+func (a *App) RollbackRestore() error {
+	a.cleanupOpenedAttachments()
+	return a.core.RollbackRestore()
+}
+
+// DiscardRestoreSnapshot 确认恢复结果，删除恢复前的数据快照
+func (a *App) DiscardRestoreSnapshot() error {
+	return a.core.DiscardRestoreSnapshot()
+}
+
 func (a *App) UpdateActivity() {
 	a.core.UpdateActivity()
 }
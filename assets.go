@@ -0,0 +1,105 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"io"
+	"locknote/internal/attachments"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// attachmentURLPrefix 是编辑器预览中 attachment://<id> 链接被改写后的路径
+const attachmentURLPrefix = "/attachment/"
+
+// attachmentHandler 处理内嵌资源中不存在的请求，用于在预览中显示解密后的附件。
+// 单独定义类型而不是让 App 实现 http.Handler，避免 ServeHTTP 被绑定到前端。
+type attachmentHandler struct {
+	app *App
+}
+
+func (h *attachmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a := h.app
+	if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, attachmentURLPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if a.core == nil || !a.core.IsUnlocked() {
+		http.Error(w, "locked", http.StatusForbidden)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, attachmentURLPrefix)
+	rc, att, err := a.core.Attachments().Open(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer rc.Close()
+
+	setAttachmentHeaders(w.Header(), att)
+	w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+	io.Copy(w, rc)
+}
+
+// inlineImageTypes 是可以在预览中直接显示的附件类型。附件可能来自导入或同步，
+// HTML、SVG 等能够执行脚本的类型在应用的源下打开会获得前端绑定，因此一律作为下载返回
+var inlineImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+	"image/avif": true,
+}
+
+// setAttachmentHeaders 按附件类型设置响应头：只有 inlineImageTypes 中的图片内联显示，
+// 其余按 application/octet-stream 下载，并禁止内容执行脚本
+func setAttachmentHeaders(h http.Header, att *attachments.Attachment) {
+	mediaType, _, err := mime.ParseMediaType(att.Mime)
+	if err == nil && inlineImageTypes[mediaType] {
+		h.Set("Content-Type", mediaType)
+		h.Set("Content-Disposition", "inline")
+	} else {
+		h.Set("Content-Type", "application/octet-stream")
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(att.Filename)})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		h.Set("Content-Disposition", disposition)
+	}
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+}
+
+func (a *App) openedAttachmentsDir() (string, error) {
+	a.openedMu.Lock()
+	defer a.openedMu.Unlock()
+
+	if a.openedDir == "" {
+		dir, err := os.MkdirTemp("", "locknote-open-*")
+		if err != nil {
+			return "", err
+		}
+		a.openedDir = dir
+	}
+	return a.openedDir, nil
+}
+
+// cleanupOpenedAttachments 删除为“打开附件”而解密出的临时明文文件
+func (a *App) cleanupOpenedAttachments() {
+	a.openedMu.Lock()
+	defer a.openedMu.Unlock()
+
+	if a.openedDir != "" {
+		os.RemoveAll(a.openedDir)
+		a.openedDir = ""
+	}
+}
@@ -0,0 +1,55 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"locknote/internal/attachments"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSetAttachmentHeaders(t *testing.T) {
+	tests := []struct {
+		mime        string
+		contentType string
+		inline      bool
+	}{
+		{"image/png", "image/png", true},
+		{"image/jpeg", "image/jpeg", true},
+		{"IMAGE/GIF", "image/gif", true},
+		{"image/webp; charset=binary", "image/webp", true},
+		{"image/svg+xml", "application/octet-stream", false},
+		{"text/html", "application/octet-stream", false},
+		{"text/html; charset=utf-8", "application/octet-stream", false},
+		{"application/xhtml+xml", "application/octet-stream", false},
+		{"application/pdf", "application/octet-stream", false},
+		{"text/plain", "application/octet-stream", false},
+		{"", "application/octet-stream", false},
+		{"not a mime type", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mime, func(t *testing.T) {
+			h := http.Header{}
+			setAttachmentHeaders(h, &attachments.Attachment{Filename: "../evil \"name\".html", Mime: tt.mime})
+
+			if got := h.Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			disposition := h.Get("Content-Disposition")
+			if tt.inline != (disposition == "inline") {
+				t.Fatalf("Content-Disposition = %q, inline %v", disposition, tt.inline)
+			}
+			if !tt.inline && (!strings.HasPrefix(disposition, "attachment;") || strings.Contains(disposition, "..")) {
+				t.Fatalf("Content-Disposition = %q", disposition)
+			}
+			if h.Get("X-Content-Type-Options") != "nosniff" {
+				t.Fatal("missing X-Content-Type-Options")
+			}
+			if csp := h.Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") || !strings.Contains(csp, "sandbox") {
+				t.Fatalf("Content-Security-Policy = %q", csp)
+			}
+		})
+	}
+}
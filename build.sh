@@ -2,10 +2,11 @@
 set -euo pipefail
 
 # Usage:
-#   ./build.sh [platform] [arch] [--clean] [--debug]
+#   ./build.sh [platform] [arch] [--clean] [--debug] [--sqlcipher]
 # Examples:
 #   ./build.sh darwin arm64
 #   ./build.sh windows amd64 --clean
+#   ./build.sh linux amd64 --sqlcipher
 #   ./build.sh all
 
 ROOT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
@@ -14,14 +15,16 @@ PLATFORM="${1:-darwin}"
 ARCH="${2:-}" 
 CLEAN=false
 DEBUG=false
+SQLCIPHER=false
 
 for arg in "$@"; do
   case "$arg" in
     --clean) CLEAN=true ;;
     --debug) DEBUG=true ;;
+    --sqlcipher) SQLCIPHER=true ;;
     -h|--help)
       cat <<EOF
-Usage: ./build.sh [platform] [arch] [--clean] [--debug]
+Usage: ./build.sh [platform] [arch] [--clean] [--debug] [--sqlcipher]
 
 platform:
   darwin | windows | linux | all
@@ -32,6 +35,9 @@ arch (optional):
 flags:
   --clean   pass -clean to wails build
   --debug   pass -debug to wails build
+  --sqlcipher
+            build with -tags sqlcipher to support whole-database encryption
+            (requires cgo and a C compiler for the target platform)
 
 Notes:
 - Icon: this script syncs icons/favicon-512x512.png -> build/appicon.png
@@ -77,6 +83,9 @@ build_one() {
   if $DEBUG; then
     args+=("-debug")
   fi
+  if $SQLCIPHER; then
+    args+=("-tags" "sqlcipher")
+  fi
 
   if [[ -n "$p" ]]; then
     if [[ -n "$a" ]]; then
@@ -0,0 +1,1886 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"locknote/internal/backup"
+	"locknote/internal/core"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"locknote/internal/notes"
+	locksync "locknote/internal/sync"
+	"locknote/internal/tags"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+type commandFunc func(c *cli, args []string) error
+
+var commands = map[string]commandFunc{
+	"ls":         cmdList,
+	"cat":        cmdCat,
+	"new":        cmdNew,
+	"edit":       cmdEdit,
+	"rm":         cmdRemove,
+	"tag":        cmdTag,
+	"notebook":   cmdNotebook,
+	"history":    cmdHistory,
+	"backup":     cmdBackup,
+	"export":     cmdExport,
+	"export-all": cmdExportAll,
+	"import":     cmdImport,
+	"sync":       cmdSync,
+	"rotate-key": cmdRotateKey,
+	"encrypt-db": cmdEncryptDB,
+	"keyfile":    cmdKeyfile,
+	"verify":     cmdVerify,
+}
+
+// stringList 是可重复的字符串参数，例如 --tag a --tag b
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// newFlagSet 创建子命令参数集，子命令后也可以使用 --json
+func (c *cli) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.BoolVar(&c.json, "json", c.json, "以 JSON 输出")
+	return fs
+}
+
+func requireArgs(fs *flag.FlagSet, n int, usage string) error {
+	if fs.NArg() != n {
+		return fmt.Errorf("用法: locknote-cli %s %s", fs.Name(), usage)
+	}
+	return nil
+}
+
+// ============ 名称与 ID 解析 ============
+
+// resolveNoteID 接受完整 ID 或唯一前缀（包括回收站中的笔记）
+func (c *cli) resolveNoteID(ref string) (string, error) {
+	active, err := c.core.Notes().List()
+	if err != nil {
+		return "", err
+	}
+	deleted, err := c.core.Notes().ListDeleted()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, n := range append(active, deleted...) {
+		if n.ID == ref {
+			return n.ID, nil
+		}
+		if strings.HasPrefix(n.ID, ref) {
+			matches = append(matches, n.ID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("笔记不存在: %s", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("笔记 ID 前缀不唯一: %s", ref)
+	}
+}
+
+// resolveTag 接受标签 ID、唯一 ID 前缀或完整名称
+func (c *cli) resolveTag(ref string) (*tags.Tag, error) {
+	list, err := c.core.Tags().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*tags.Tag
+	for _, t := range list {
+		if t.ID == ref || t.Name == ref {
+			return t, nil
+		}
+		if strings.HasPrefix(t.ID, ref) {
+			matches = append(matches, t)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("标签不存在或不唯一: %s", ref)
+}
+
+// resolveNotebook 接受笔记本 ID、唯一 ID 前缀或完整名称
+func (c *cli) resolveNotebook(ref string) (*notebooks.Notebook, error) {
+	list, err := c.core.Notebooks().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*notebooks.Notebook
+	for _, nb := range list {
+		if nb.ID == ref || nb.Name == ref {
+			return nb, nil
+		}
+		if strings.HasPrefix(nb.ID, ref) {
+			matches = append(matches, nb)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("笔记本不存在或不唯一: %s", ref)
+}
+
+// unlockNotebook 笔记本受保护且已锁定时提示输入笔记本密码并解锁
+func (c *cli) unlockNotebook(nb *notebooks.Notebook) error {
+	if !nb.Locked {
+		return nil
+	}
+	password, err := promptPassword(fmt.Sprintf("笔记本“%s”的密码: ", nb.Name))
+	if err != nil {
+		return err
+	}
+	return c.core.Notebooks().Unlock(nb.ID, password)
+}
+
+// getNote 读取笔记，所在的笔记本已锁定时先提示解锁
+func (c *cli) getNote(id string) (*notes.Note, error) {
+	note, err := c.core.Notes().Get(id)
+	if err != nil || !note.Locked || note.NotebookID == nil {
+		return note, err
+	}
+	nb, err := c.core.Notebooks().Get(*note.NotebookID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.unlockNotebook(nb); err != nil {
+		return nil, err
+	}
+	return c.core.Notes().Get(id)
+}
+
+// ============ 笔记 ============
+
+func cmdList(c *cli, args []string) error {
+	fs := c.newFlagSet("ls")
+	notebookRef := fs.String("notebook", "", "只列出指定笔记本中的笔记")
+	tagRef := fs.String("tag", "", "只列出带有指定标签的笔记")
+	showDeleted := fs.Bool("deleted", false, "列出回收站中的笔记")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	var list []*notes.Note
+	var err error
+	if *showDeleted {
+		list, err = c.core.Notes().ListDeleted()
+	} else {
+		list, err = c.core.Notes().List()
+	}
+	if err != nil {
+		return err
+	}
+
+	if *notebookRef != "" {
+		nb, err := c.resolveNotebook(*notebookRef)
+		if err != nil {
+			return err
+		}
+		filtered := list[:0]
+		for _, n := range list {
+			if n.NotebookID != nil && *n.NotebookID == nb.ID {
+				filtered = append(filtered, n)
+			}
+		}
+		list = filtered
+	}
+
+	if *tagRef != "" {
+		tag, err := c.resolveTag(*tagRef)
+		if err != nil {
+			return err
+		}
+		filtered := list[:0]
+		for _, n := range list {
+			for _, t := range n.Tags {
+				if t.ID == tag.ID {
+					filtered = append(filtered, n)
+					break
+				}
+			}
+		}
+		list = filtered
+	}
+
+	if c.json {
+		return printJSON(list)
+	}
+
+	t := newTable("ID", "UPDATED", "TITLE", "TAGS")
+	for _, n := range list {
+		title := truncate(n.Title, titleMaxRunes)
+		if n.Locked {
+			title = "[已锁定]"
+		}
+		if n.Pinned {
+			title = "* " + title
+		}
+		tagNames := make([]string, len(n.Tags))
+		for i, tag := range n.Tags {
+			tagNames[i] = tag.Name
+		}
+		t.row(shortID(n.ID), formatLocal(n.UpdatedAt), title, strings.Join(tagNames, ","))
+	}
+	t.flush()
+	return nil
+}
+
+func cmdCat(c *cli, args []string) error {
+	fs := c.newFlagSet("cat")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "<笔记ID>"); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	id, err := c.resolveNoteID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	note, err := c.getNote(id)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return printJSON(note)
+	}
+	fmt.Print(formatNoteMarkdown(note.Title, note.Content))
+	return nil
+}
+
+// formatNoteMarkdown 与桌面端“导出为 Markdown”使用相同格式
+func formatNoteMarkdown(title, content string) string {
+	s := "# " + title + "\n\n" + content
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// parseNoteMarkdown 是 formatNoteMarkdown 的逆操作：首行 "# " 为标题，其余为正文；
+// 没有标题行时使用第一行非空文本作为标题，正文保持原样
+func parseNoteMarkdown(text string) (title, content string) {
+	text = strings.TrimLeft(text, "\r\n")
+	first, rest, _ := strings.Cut(text, "\n")
+	first = strings.TrimRight(first, "\r")
+
+	if strings.HasPrefix(first, "# ") {
+		title = strings.TrimSpace(strings.TrimPrefix(first, "# "))
+		content = strings.TrimPrefix(strings.TrimPrefix(rest, "\r"), "\n")
+		return title, strings.TrimRight(content, "\r\n")
+	}
+
+	return strings.TrimSpace(first), strings.TrimRight(text, "\r\n")
+}
+
+func cmdNew(c *cli, args []string) error {
+	fs := c.newFlagSet("new")
+	title := fs.String("title", "", "标题（默认取正文第一行）")
+	notebookRef := fs.String("notebook", "", "放入指定笔记本")
+	var tagRefs stringList
+	fs.Var(&tagRefs, "tag", "添加标签，可重复")
+	allowDiskTemp := fs.Bool("allow-disk-temp", false, "没有内存文件系统时允许编辑器的临时文件写入磁盘")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 0, "[--title T] [--notebook ID] [--tag ID] [--allow-disk-temp]"); err != nil {
+		return err
+	}
+
+	// 先读取标准输入，避免密码提示与管道输入混在一起
+	var text, tempDir string
+	stdinIsTerminal := term.IsTerminal(int(os.Stdin.Fd()))
+	if !stdinIsTerminal {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	} else {
+		dir, err := secureTempDir(*allowDiskTemp)
+		if err != nil {
+			return err
+		}
+		tempDir = dir
+	}
+
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	if stdinIsTerminal {
+		initial := ""
+		if *title != "" {
+			initial = formatNoteMarkdown(*title, "")
+		}
+		edited, err := editText(tempDir, initial)
+		if err != nil {
+			return err
+		}
+		text = edited
+	}
+
+	// 指定了 --title 时，只有与之相同的标题行才从正文中去掉
+	parsedTitle, content := parseNoteMarkdown(text)
+	if *title == "" {
+		*title = parsedTitle
+	} else if parsedTitle != *title {
+		content = strings.TrimRight(text, "\r\n")
+	}
+	if *title == "" && content == "" {
+		return errors.New("内容为空，未创建笔记")
+	}
+
+	var notebookID *string
+	if *notebookRef != "" {
+		nb, err := c.resolveNotebook(*notebookRef)
+		if err != nil {
+			return err
+		}
+		if err := c.unlockNotebook(nb); err != nil {
+			return err
+		}
+		notebookID = &nb.ID
+	}
+	var tagIDs []string
+	for _, ref := range tagRefs {
+		tag, err := c.resolveTag(ref)
+		if err != nil {
+			return err
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	note, err := c.core.Notes().Create(*title, content)
+	if err != nil {
+		return err
+	}
+	if notebookID != nil {
+		if err := c.core.Notes().SetNotebook(note.ID, notebookID); err != nil {
+			return err
+		}
+	}
+	for _, tagID := range tagIDs {
+		if err := c.core.Tags().AddToNote(note.ID, tagID); err != nil {
+			return err
+		}
+	}
+
+	if note, err = c.core.Notes().Get(note.ID); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(note)
+	}
+	fmt.Println(note.ID)
+	return nil
+}
+
+func cmdEdit(c *cli, args []string) error {
+	fs := c.newFlagSet("edit")
+	allowDiskTemp := fs.Bool("allow-disk-temp", false, "没有内存文件系统时允许编辑器的临时文件写入磁盘")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "[--allow-disk-temp] <笔记ID>"); err != nil {
+		return err
+	}
+	tempDir, err := secureTempDir(*allowDiskTemp)
+	if err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	id, err := c.resolveNoteID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	note, err := c.getNote(id)
+	if err != nil {
+		return err
+	}
+
+	original := formatNoteMarkdown(note.Title, note.Content)
+	edited, err := editText(tempDir, original)
+	if err != nil {
+		return err
+	}
+
+	if edited != original {
+		title, content := parseNoteMarkdown(edited)
+		if note, err = c.core.Notes().Update(id, title, content); err != nil {
+			return err
+		}
+	} else if !c.json {
+		fmt.Fprintln(os.Stderr, "未修改")
+		return nil
+	}
+
+	if c.json {
+		return printJSON(note)
+	}
+	fmt.Println(note.ID)
+	return nil
+}
+
+func cmdRemove(c *cli, args []string) error {
+	fs := c.newFlagSet("rm")
+	purge := fs.Bool("purge", false, "永久删除（包括历史版本与附件）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "[--purge] <笔记ID>"); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	id, err := c.resolveNoteID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *purge {
+		err = c.core.Notes().Delete(id)
+	} else {
+		err = c.core.Notes().SoftDelete(id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return printJSON(map[string]interface{}{"id": id, "purged": *purge})
+	}
+	fmt.Println(id)
+	return nil
+}
+
+func cmdExport(c *cli, args []string) error {
+	fs := c.newFlagSet("export")
+	output := fs.String("o", "", "输出文件（默认标准输出）")
+	asHTML := fs.Bool("html", false, "导出为嵌入图片的 HTML 文档")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "[-o 文件] [--html] <笔记ID>"); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	id, err := c.resolveNoteID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	note, err := c.getNote(id)
+	if err != nil {
+		return err
+	}
+
+	format := "markdown"
+	data := []byte(formatNoteMarkdown(note.Title, note.Content))
+	if *asHTML {
+		format = "html"
+		if data, err = c.core.NoteHTML(id); err != nil {
+			return err
+		}
+	}
+	if *output == "" {
+		if c.json {
+			return printJSON(map[string]string{"id": note.ID, format: string(data)})
+		}
+		os.Stdout.Write(data)
+		return nil
+	}
+
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(map[string]string{"id": note.ID, "path": *output})
+	}
+	fmt.Println(*output)
+	return nil
+}
+
+// ============ 标签 ============
+
+// cmdExportAll 把全部笔记（或一个笔记本、标签、智能视图中的笔记）导出为明文 Markdown 目录或 zip，
+// 或带目录的单个 HTML 文件
+func cmdExportAll(c *cli, args []string) error {
+	fs := c.newFlagSet("export-all")
+	notebookRef := fs.String("notebook", "", "只导出指定笔记本中的笔记")
+	tagRef := fs.String("tag", "", "只导出带有指定标签的笔记")
+	smartView := fs.String("smart-view", "", "只导出智能视图中的笔记（ID）")
+	withAttachments := fs.Bool("attachments", false, "同时导出附件")
+	asZip := fs.Bool("zip", false, "导出为单个 zip 文件")
+	asHTML := fs.Bool("html", false, "导出为单个 HTML 文件，--attachments 时嵌入图片")
+	yes := fs.Bool("yes", false, "确认导出未加密的明文")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "[--notebook ID] [--tag ID] [--smart-view ID] [--attachments] [--zip|--html] --yes <目录|zip文件|html文件>"); err != nil {
+		return err
+	}
+	if *asZip && *asHTML {
+		return errors.New("--zip 与 --html 只能选择一个")
+	}
+	if !*yes {
+		return errors.New("导出的文件未加密，任何能访问它们的人都能读取笔记内容；确认后请加上 --yes")
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.core.IsFirstRun() {
+		return errors.New("尚未设置主密码，请先在桌面端完成初始化")
+	}
+
+	// 解锁与导出都需要密码，只读取一次
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := c.unlockWith(password); err != nil {
+		return err
+	}
+
+	opts := core.ExportOptions{SmartViewID: *smartView, Attachments: *withAttachments, Zip: *asZip}
+	if *notebookRef != "" {
+		nb, err := c.resolveNotebook(*notebookRef)
+		if err != nil {
+			return err
+		}
+		opts.NotebookID = nb.ID
+	}
+	if *tagRef != "" {
+		t, err := c.resolveTag(*tagRef)
+		if err != nil {
+			return err
+		}
+		opts.TagID = t.ID
+	}
+
+	var result *core.ExportResult
+	if *asHTML {
+		result, err = c.core.ExportHTML(password, fs.Arg(0), opts)
+	} else {
+		result, err = c.core.ExportMarkdown(password, fs.Arg(0), opts)
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(result)
+	}
+	fmt.Printf("已导出 %d 篇笔记、%d 个附件到 %s\n", result.Notes, result.Attachments, result.Path)
+	if result.Locked > 0 {
+		fmt.Fprintf(os.Stderr, "%d 篇笔记所在的笔记本已锁定，未导出\n", result.Locked)
+	}
+	fmt.Fprintln(os.Stderr, "警告：导出的文件未加密，使用后请妥善保管或彻底删除")
+	return nil
+}
+
+// cmdImport 从 Markdown 文件夹（Obsidian、Logseq）、Evernote 的 .enex 或 Joplin 的 .jex 文件导入笔记
+func cmdImport(c *cli, args []string) error {
+	fs := c.newFlagSet("import")
+	dryRun := fs.Bool("dry-run", false, "只检查与计数，不写入任何数据（仅 .enex 与 .jex）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "[--dry-run] <目录|文件.enex|文件.jex>"); err != nil {
+		return err
+	}
+	source := fs.Arg(0)
+	ext := strings.ToLower(filepath.Ext(source))
+	if *dryRun && ext != ".enex" && ext != ".jex" {
+		return errors.New("--dry-run 只支持 .enex 与 .jex 文件")
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	switch ext {
+	case ".enex", ".jex":
+		var report *core.ExternalImportReport
+		var err error
+		if ext == ".enex" {
+			report, err = c.core.ImportENEX(source, *dryRun)
+		} else {
+			report, err = c.core.ImportJEX(source, *dryRun)
+		}
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(report)
+		}
+		for _, issue := range report.Issues {
+			fmt.Fprintf(os.Stderr, "%-8s %s: %s\n", issue.Kind, issue.Item, issue.Error)
+		}
+		verb := "已导入"
+		if report.DryRun {
+			verb = "试运行：将导入"
+		}
+		fmt.Printf("%s %d 篇笔记、%d 个附件，新建 %d 个笔记本、%d 个标签；%d 个问题\n",
+			verb, report.Notes, report.Attachments, report.NotebooksCreated, report.TagsCreated, len(report.Issues))
+		return nil
+	}
+
+	report, err := c.core.ImportMarkdownDir(source)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(report)
+	}
+
+	for _, rel := range report.Duplicates {
+		fmt.Printf("跳过 %s：已有相同的笔记\n", rel)
+	}
+	for rel, links := range report.Unresolved {
+		fmt.Printf("%s：找不到链接目标 %s\n", rel, strings.Join(links, " "))
+	}
+	for rel, reason := range report.Failed {
+		fmt.Fprintf(os.Stderr, "导入 %s 失败: %s\n", rel, reason)
+	}
+	fmt.Printf("已导入 %d 篇笔记、%d 个附件，新建 %d 个笔记本、%d 个标签；跳过 %d 篇重复，%d 篇失败\n",
+		len(report.Imported), report.Attachments, report.NotebooksCreated, report.TagsCreated,
+		len(report.Duplicates), len(report.Failed))
+	return nil
+}
+
+func cmdTag(c *cli, args []string) error {
+	if len(args) == 0 {
+		args = []string{"ls"}
+	}
+	sub, args := args[0], args[1:]
+
+	fs := c.newFlagSet("tag " + sub)
+	color := fs.String("color", "", "标签颜色")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "ls":
+		list, err := c.core.Tags().List()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(list)
+		}
+		t := newTable("ID", "NAME", "COLOR")
+		for _, tag := range list {
+			t.row(shortID(tag.ID), tag.Name, tag.Color)
+		}
+		t.flush()
+		return nil
+
+	case "new":
+		if err := requireArgs(fs, 1, "<名称> [--color C]"); err != nil {
+			return err
+		}
+		tag, err := c.core.Tags().Create(fs.Arg(0), *color)
+		if err != nil {
+			return err
+		}
+		return c.printResult(tag, tag.ID)
+
+	case "rm":
+		if err := requireArgs(fs, 1, "<标签>"); err != nil {
+			return err
+		}
+		tag, err := c.resolveTag(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := c.core.Tags().Delete(tag.ID); err != nil {
+			return err
+		}
+		return c.printResult(tag, tag.ID)
+
+	case "add", "remove":
+		if err := requireArgs(fs, 2, "<笔记ID> <标签>"); err != nil {
+			return err
+		}
+		noteID, err := c.resolveNoteID(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		tag, err := c.resolveTag(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if sub == "add" {
+			err = c.core.Tags().AddToNote(noteID, tag.ID)
+		} else {
+			err = c.core.Tags().RemoveFromNote(noteID, tag.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(map[string]string{"noteId": noteID, "tagId": tag.ID})
+		}
+		return nil
+	}
+
+	return fmt.Errorf("未知的 tag 子命令: %s", sub)
+}
+
+// ============ 笔记本 ============
+
+func cmdNotebook(c *cli, args []string) error {
+	if len(args) == 0 {
+		args = []string{"ls"}
+	}
+	sub, args := args[0], args[1:]
+
+	fs := c.newFlagSet("notebook " + sub)
+	icon := fs.String("icon", "", "笔记本图标")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "ls":
+		list, err := c.core.Notebooks().List()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(list)
+		}
+		t := newTable("ID", "NAME", "ICON", "PROTECTED")
+		for _, nb := range list {
+			protected := ""
+			switch {
+			case nb.Locked:
+				protected = "locked"
+			case nb.Protected:
+				protected = "unlocked"
+			}
+			t.row(shortID(nb.ID), nb.Name, nb.Icon, protected)
+		}
+		t.flush()
+		return nil
+
+	case "new":
+		if err := requireArgs(fs, 1, "<名称> [--icon I]"); err != nil {
+			return err
+		}
+		nb, err := c.core.Notebooks().Create(fs.Arg(0), *icon)
+		if err != nil {
+			return err
+		}
+		return c.printResult(nb, nb.ID)
+
+	case "rm":
+		if err := requireArgs(fs, 1, "<笔记本>"); err != nil {
+			return err
+		}
+		nb, err := c.resolveNotebook(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := c.core.Notebooks().Delete(nb.ID); err != nil {
+			return err
+		}
+		return c.printResult(nb, nb.ID)
+
+	case "protect":
+		if err := requireArgs(fs, 1, "<笔记本>"); err != nil {
+			return err
+		}
+		nb, err := c.resolveNotebook(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		password, err := promptPassword(fmt.Sprintf("笔记本“%s”的密码: ", nb.Name))
+		if err != nil {
+			return err
+		}
+		if !nb.Protected {
+			again, err := promptPassword("再次输入笔记本密码: ")
+			if err != nil {
+				return err
+			}
+			if again != password {
+				return errors.New("两次输入的密码不一致")
+			}
+		}
+		if err := c.core.ProtectNotebook(nb.ID, password); err != nil {
+			return err
+		}
+		if nb, err = c.core.Notebooks().Get(nb.ID); err != nil {
+			return err
+		}
+		return c.printResult(nb, nb.ID)
+
+	case "unprotect":
+		if err := requireArgs(fs, 1, "<笔记本>"); err != nil {
+			return err
+		}
+		nb, err := c.resolveNotebook(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		password, err := promptPassword(fmt.Sprintf("笔记本“%s”的密码: ", nb.Name))
+		if err != nil {
+			return err
+		}
+		if err := c.core.UnprotectNotebook(nb.ID, password); err != nil {
+			return err
+		}
+		if nb, err = c.core.Notebooks().Get(nb.ID); err != nil {
+			return err
+		}
+		return c.printResult(nb, nb.ID)
+
+	case "move":
+		if err := requireArgs(fs, 2, "<笔记ID> <笔记本|->"); err != nil {
+			return err
+		}
+		noteID, err := c.resolveNoteID(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if _, err := c.getNote(noteID); err != nil {
+			return err
+		}
+		var notebookID *string
+		if fs.Arg(1) != "-" {
+			nb, err := c.resolveNotebook(fs.Arg(1))
+			if err != nil {
+				return err
+			}
+			if err := c.unlockNotebook(nb); err != nil {
+				return err
+			}
+			notebookID = &nb.ID
+		}
+		if err := c.core.Notes().SetNotebook(noteID, notebookID); err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(map[string]interface{}{"noteId": noteID, "notebookId": notebookID})
+		}
+		return nil
+	}
+
+	return fmt.Errorf("未知的 notebook 子命令: %s", sub)
+}
+
+// printResult 输出新建、修改或删除的对象：JSON 模式下输出完整对象，否则只输出 ID
+func (c *cli) printResult(v interface{}, id string) error {
+	if c.json {
+		return printJSON(v)
+	}
+	fmt.Println(id)
+	return nil
+}
+
+// ============ 历史版本 ============
+
+func cmdHistory(c *cli, args []string) error {
+	fs := c.newFlagSet("history")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.Arg(0) == "restore" {
+		if fs.NArg() != 3 {
+			return errors.New("用法: locknote-cli history restore <笔记ID> <历史ID>")
+		}
+		if err := c.unlock(); err != nil {
+			return err
+		}
+		noteID, err := c.resolveNoteID(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if _, err := c.getNote(noteID); err != nil {
+			return err
+		}
+		historyID, err := c.resolveHistoryID(noteID, fs.Arg(2))
+		if err != nil {
+			return err
+		}
+		note, err := c.core.Notes().RestoreFromHistory(noteID, historyID)
+		if err != nil {
+			return err
+		}
+		return c.printResult(note, note.ID)
+	}
+
+	if err := requireArgs(fs, 1, "<笔记ID> | restore <笔记ID> <历史ID>"); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+	noteID, err := c.resolveNoteID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := c.getNote(noteID); err != nil {
+		return err
+	}
+	history, err := c.core.Notes().GetHistory(noteID)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return printJSON(history)
+	}
+	t := newTable("ID", "SAVED", "TITLE")
+	for _, h := range history {
+		t.row(shortID(h.ID), formatLocal(h.CreatedAt), truncate(h.Title, titleMaxRunes))
+	}
+	t.flush()
+	return nil
+}
+
+func (c *cli) resolveHistoryID(noteID, ref string) (string, error) {
+	history, err := c.core.Notes().GetHistory(noteID)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, h := range history {
+		if h.ID == ref {
+			return h.ID, nil
+		}
+		if strings.HasPrefix(h.ID, ref) {
+			matches = append(matches, h.ID)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("历史版本不存在或不唯一: %s", ref)
+}
+
+// ============ 备份 ============
+
+func cmdBackup(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: locknote-cli backup create|verify|restore [--passphrase] [--yes] <文件> | rollback | discard-snapshot | schedule | repo | notes")
+	}
+	sub, args := args[0], args[1:]
+
+	switch sub {
+	case "rollback", "discard-snapshot":
+		return cmdRestoreSnapshot(c, sub, args)
+	case "schedule":
+		return cmdBackupSchedule(c, args)
+	case "repo":
+		return cmdBackupRepo(c, args)
+	case "notes":
+		return cmdBackupNotes(c, args)
+	}
+
+	fs := c.newFlagSet("backup " + sub)
+	usePassphrase := fs.Bool("passphrase", false, "使用单独的备份口令（环境变量 "+backupPassphraseEnv+" 或终端输入），而不是数据密钥")
+	yes := fs.Bool("yes", false, "确认替换当前数据")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 1, "[--passphrase] <文件>"); err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+
+	if err := c.open(); err != nil {
+		return err
+	}
+
+	switch sub {
+	case "create":
+		if *usePassphrase {
+			passphrase, err := readBackupPassphrase(true)
+			if err != nil {
+				return err
+			}
+			if err := c.core.Backup().CreateBackupWithPassphrase(path, passphrase); err != nil {
+				return err
+			}
+		} else {
+			if err := c.unlock(); err != nil {
+				return err
+			}
+			if err := c.core.Backup().CreateBackup(path); err != nil {
+				return err
+			}
+		}
+
+	case "verify":
+		key, err := c.backupKey(path, *usePassphrase)
+		if err != nil {
+			return err
+		}
+		var info *backup.BackupInfo
+		if key != nil {
+			info, err = c.core.Backup().VerifyBackupWithKey(path, *key)
+		} else {
+			info, err = c.core.Backup().VerifyBackup(path)
+		}
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(info)
+		}
+		fmt.Printf("%s: 格式 %s，%d 项，共 %d 字节，校验通过\n", path, info.Format, info.Entries, info.Size)
+		return nil
+
+	case "restore":
+		if !*yes {
+			return errors.New("恢复备份会替换当前数据（原数据另存为快照），请使用 --yes 确认")
+		}
+		key, err := c.backupKey(path, *usePassphrase)
+		if err != nil {
+			return err
+		}
+		var result *core.RestoreResult
+		if key != nil {
+			result, err = c.core.RestoreBackupWithKey(path, *key)
+		} else {
+			result, err = c.core.RestoreBackup(path)
+		}
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(result)
+		}
+		fmt.Printf("已恢复 %s，恢复前的数据保存在 %s\n", path, result.Snapshot)
+		if !result.Unlocked {
+			fmt.Println("备份来自其他数据密钥，请使用备份时的主密码解锁；无法解锁时可运行 backup rollback 撤销恢复")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("未知的 backup 子命令: %s", sub)
+	}
+
+	if c.json {
+		return printJSON(map[string]string{"path": path})
+	}
+	fmt.Println(path)
+	return nil
+}
+
+// cmdRestoreSnapshot 撤销最近一次恢复，或确认恢复结果并删除恢复前的快照
+func cmdRestoreSnapshot(c *cli, sub string, args []string) error {
+	fs := c.newFlagSet("backup " + sub)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 0, ""); err != nil {
+		return err
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+
+	info, err := c.core.LastRestore()
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return errors.New("没有最近一次恢复留下的数据快照")
+	}
+
+	if sub == "rollback" {
+		err = c.core.RollbackRestore()
+	} else {
+		err = c.core.DiscardRestoreSnapshot()
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return printJSON(info)
+	}
+	if sub == "rollback" {
+		fmt.Printf("已撤销对 %s 的恢复\n", info.Source)
+	} else {
+		fmt.Printf("已删除恢复前的数据快照 %s\n", info.Snapshot)
+	}
+	return nil
+}
+
+// cmdBackupSchedule 查看或修改定时备份设置，--run 立即备份一次（可用于系统计划任务）
+func cmdBackupSchedule(c *cli, args []string) error {
+	fs := c.newFlagSet("backup schedule")
+	interval := fs.Int("interval", -1, "备份间隔（小时），0 表示关闭")
+	dir := fs.String("dir", "", "备份目录")
+	keepDaily := fs.Int("keep-daily", -1, "保留最近几天每天的最新备份")
+	keepWeekly := fs.Int("keep-weekly", -1, "保留最近几周每周的最新备份")
+	off := fs.Bool("off", false, "关闭定时备份")
+	run := fs.Bool("run", false, "立即按设置备份一次")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 0, "[--interval H] [--dir 目录] [--keep-daily N] [--keep-weekly N] [--off] [--run]"); err != nil {
+		return err
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+
+	settings, err := c.core.GetSettings()
+	if err != nil {
+		return err
+	}
+	changed := false
+	set := func(dst *int, v int) {
+		if v >= 0 {
+			*dst = v
+			changed = true
+		}
+	}
+	set(&settings.BackupIntervalHours, *interval)
+	set(&settings.BackupKeepDaily, *keepDaily)
+	set(&settings.BackupKeepWeekly, *keepWeekly)
+	if *dir != "" {
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			return err
+		}
+		settings.BackupDir = abs
+		changed = true
+	}
+	if *off {
+		settings.BackupIntervalHours = 0
+		changed = true
+	}
+	if changed {
+		if err := c.core.UpdateBackupSchedule(settings.BackupIntervalHours, settings.BackupDir,
+			settings.BackupKeepDaily, settings.BackupKeepWeekly); err != nil {
+			return err
+		}
+	}
+
+	if *run {
+		// 命令行进程不常驻，先解锁以取得备份密钥
+		if err := c.unlock(); err != nil {
+			return err
+		}
+		result, err := c.core.RunScheduledBackup()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(result)
+		}
+		if result.Skipped == backup.SkipUnchanged {
+			fmt.Println("数据自上次备份以来没有变化，已跳过")
+		} else {
+			fmt.Println(result.Path)
+		}
+		for _, name := range result.Removed {
+			fmt.Printf("已删除旧备份 %s\n", name)
+		}
+		return nil
+	}
+
+	if c.json {
+		return printJSON(map[string]interface{}{
+			"intervalHours": settings.BackupIntervalHours,
+			"dir":           settings.BackupDir,
+			"keepDaily":     settings.BackupKeepDaily,
+			"keepWeekly":    settings.BackupKeepWeekly,
+		})
+	}
+	if settings.BackupIntervalHours <= 0 || settings.BackupDir == "" {
+		fmt.Println("定时备份: 已关闭")
+	} else {
+		fmt.Printf("定时备份: 每 %d 小时\n", settings.BackupIntervalHours)
+	}
+	fmt.Printf("备份目录: %s\n保留策略: 最近 %d 天每天一份，最近 %d 周每周一份\n",
+		settings.BackupDir, settings.BackupKeepDaily, settings.BackupKeepWeekly)
+	return nil
+}
+
+// cmdBackupRepo 管理去重的备份仓库：每个快照只写入有变化的数据块
+func cmdBackupRepo(c *cli, args []string) error {
+	const repoUsage = "用法: locknote-cli backup repo init|snapshot|ls|check|prune|restore [--passphrase] <仓库目录> [快照ID]"
+	if len(args) == 0 {
+		return errors.New(repoUsage)
+	}
+	sub, args := args[0], args[1:]
+
+	fs := c.newFlagSet("backup repo " + sub)
+	usePassphrase := fs.Bool("passphrase", false, "仓库使用单独的备份口令（环境变量 "+backupPassphraseEnv+" 或终端输入）")
+	keepDaily := fs.Int("keep-daily", 7, "prune: 保留最近几天每天的最新快照")
+	keepWeekly := fs.Int("keep-weekly", 4, "prune: 保留最近几周每周的最新快照")
+	yes := fs.Bool("yes", false, "restore: 确认替换当前数据")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	nargs := 1
+	if sub == "restore" {
+		nargs = 2
+	}
+	if fs.NArg() != nargs {
+		return errors.New(repoUsage)
+	}
+	dir := fs.Arg(0)
+
+	if err := c.open(); err != nil {
+		return err
+	}
+
+	if sub == "init" {
+		if *usePassphrase {
+			passphrase, err := readBackupPassphrase(true)
+			if err != nil {
+				return err
+			}
+			if err := backup.InitRepository(dir, backup.Key{Passphrase: passphrase}); err != nil {
+				return err
+			}
+		} else {
+			if err := c.unlock(); err != nil {
+				return err
+			}
+			if err := c.core.Backup().InitRepository(dir); err != nil {
+				return err
+			}
+		}
+		fmt.Println(dir)
+		return nil
+	}
+
+	var repo *backup.Repository
+	var err error
+	if *usePassphrase {
+		passphrase, perr := readBackupPassphrase(false)
+		if perr != nil {
+			return perr
+		}
+		repo, err = backup.OpenRepository(dir, backup.Key{Passphrase: passphrase})
+	} else {
+		if err := c.unlock(); err != nil {
+			return err
+		}
+		repo, err = c.core.Backup().OpenRepository(dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "snapshot":
+		info, err := c.core.Backup().BackupToRepository(repo)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(info)
+		}
+		fmt.Printf("快照 %s: %d 个文件，%d 个未变化，新写入 %d 块共 %d 字节\n",
+			info.ID, info.Files, info.Reused, info.NewChunks, info.NewBytes)
+
+	case "ls":
+		snaps, err := repo.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(snaps)
+		}
+		for _, snap := range snaps {
+			fmt.Printf("%s  %s  %d 个文件  %d 字节\n", snap.ID, snap.CreatedAt, snap.Files, snap.Size)
+		}
+
+	case "check":
+		result, err := repo.Check()
+		if err != nil {
+			return err
+		}
+		if c.json {
+			if err := printJSON(result); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("%d 个快照，%d 个数据块，%d 个未被引用\n", result.Snapshots, result.Chunks, result.Unreferenced)
+			for _, id := range result.Missing {
+				fmt.Printf("缺失: %s\n", id)
+			}
+			for _, id := range result.Corrupted {
+				fmt.Printf("损坏: %s\n", id)
+			}
+		}
+		if !result.OK() {
+			return errors.New("备份仓库检查未通过")
+		}
+
+	case "prune":
+		result, err := repo.Prune(backup.RetentionPolicy{KeepDaily: *keepDaily, KeepWeekly: *keepWeekly})
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(result)
+		}
+		fmt.Printf("删除 %d 个快照、%d 个数据块，释放 %d 字节\n", len(result.Snapshots), result.Chunks, result.Bytes)
+
+	case "restore":
+		if !*yes {
+			return errors.New("恢复快照会替换当前数据（原数据另存为快照），请使用 --yes 确认")
+		}
+		id, err := repo.ResolveSnapshot(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		result, err := c.core.RestoreRepositorySnapshot(repo, id)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(result)
+		}
+		fmt.Printf("已恢复快照 %s，恢复前的数据保存在 %s\n", id, result.Snapshot)
+		if !result.Unlocked {
+			fmt.Println("快照来自其他数据密钥，请使用当时的主密码解锁；无法解锁时可运行 backup rollback 撤销恢复")
+		}
+
+	default:
+		return errors.New(repoUsage)
+	}
+	return nil
+}
+
+// cmdBackupNotes 浏览备份中的笔记，把选中的笔记或全部笔记合并到当前数据，不替换其他内容
+func cmdBackupNotes(c *cli, args []string) error {
+	const notesUsage = "用法: locknote-cli backup notes ls|import|restore [--passphrase] [--recovery-key] [--overwrite] <文件> [笔记ID...]"
+	if len(args) == 0 {
+		return errors.New(notesUsage)
+	}
+	sub, args := args[0], args[1:]
+
+	fs := c.newFlagSet("backup notes " + sub)
+	usePassphrase := fs.Bool("passphrase", false, "备份使用单独的备份口令（环境变量 "+backupPassphraseEnv+" 或终端输入）")
+	useRecoveryKey := fs.Bool("recovery-key", false, "备份来自其他数据密钥，使用它的恢复密钥（环境变量 "+recoveryKeyEnv+" 或终端输入）")
+	overwrite := fs.Bool("overwrite", false, "restore: 覆盖 ID 相同的笔记，而不是作为新笔记恢复")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if ((sub == "ls" || sub == "import") && fs.NArg() != 1) || (sub == "restore" && fs.NArg() < 2) {
+		return errors.New(notesUsage)
+	}
+	path := fs.Arg(0)
+
+	if err := c.open(); err != nil {
+		return err
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	var passphrase, recoveryKey string
+	var err error
+	if *usePassphrase {
+		if passphrase, err = readBackupPassphrase(false); err != nil {
+			return err
+		}
+	}
+	if *useRecoveryKey {
+		if recoveryKey, err = readRecoveryKey(); err != nil {
+			return err
+		}
+	}
+
+	if sub == "import" {
+		report, err := c.core.ImportFromBackup(path, passphrase, recoveryKey)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(report)
+		}
+		fmt.Printf("导入 %d 篇笔记（其中 %d 篇 ID 冲突，以新 ID 导入），跳过已存在的 %d 篇\n",
+			len(report.Imported), len(report.Copies), len(report.Duplicates))
+		fmt.Printf("历史版本 %d 个，附件 %d 个；新建标签 %d 个、笔记本 %d 个、智能视图 %d 个\n",
+			report.History, report.Attachments, report.TagsCreated, report.NotebooksCreated, report.SmartViewsCreated)
+		for id, reason := range report.Failed {
+			fmt.Printf("%s 导入失败: %s\n", shortID(id), reason)
+		}
+		return nil
+	}
+
+	view, err := c.core.OpenBackup(path, passphrase, recoveryKey)
+	if err != nil {
+		return err
+	}
+	defer view.Close()
+
+	list, err := c.core.BackupNotes(view)
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "ls":
+		if c.json {
+			return printJSON(list)
+		}
+		for _, n := range list {
+			line := fmt.Sprintf("%s  %-13s  %s", shortID(n.ID), n.Status, n.Title)
+			if n.Notebook != "" {
+				line += "  [" + n.Notebook + "]"
+			}
+			if len(n.Tags) > 0 {
+				line += "  #" + strings.Join(n.Tags, " #")
+			}
+			if n.DeletedAt != nil {
+				line += "  (回收站)"
+			}
+			fmt.Println(line)
+		}
+
+	case "restore":
+		var ids []string
+		for _, ref := range fs.Args()[1:] {
+			id, err := resolveBackupNoteID(list, ref)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		mode := core.RestoreAsCopy
+		if *overwrite {
+			mode = core.RestoreOverwrite
+		}
+		result, err := c.core.RestoreNotesFromBackup(view, ids, mode)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return printJSON(result)
+		}
+		for _, id := range ids {
+			if newID, ok := result.Restored[id]; ok {
+				fmt.Printf("%s -> %s\n", shortID(id), shortID(newID))
+			} else {
+				fmt.Printf("%s 恢复失败: %s\n", shortID(id), result.Failed[id])
+			}
+		}
+		if len(result.Failed) > 0 {
+			return fmt.Errorf("%d 篇笔记恢复失败", len(result.Failed))
+		}
+
+	default:
+		return errors.New(notesUsage)
+	}
+	return nil
+}
+
+// resolveBackupNoteID 在备份的笔记中按完整 ID 或唯一前缀查找
+func resolveBackupNoteID(list []*core.BackupNote, ref string) (string, error) {
+	var matches []string
+	for _, n := range list {
+		if n.ID == ref {
+			return n.ID, nil
+		}
+		if strings.HasPrefix(n.ID, ref) {
+			matches = append(matches, n.ID)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("备份中没有该笔记: %s", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("笔记 ID 前缀不唯一: %s", ref)
+	}
+}
+
+const recoveryKeyEnv = "LOCKNOTE_RECOVERY_KEY"
+
+// readRecoveryKey 读取环境变量或在终端提示输入恢复密钥
+func readRecoveryKey() (string, error) {
+	if key, ok := os.LookupEnv(recoveryKeyEnv); ok {
+		return key, nil
+	}
+	key, err := promptPassword("恢复密钥: ")
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", errors.New("恢复密钥不能为空")
+	}
+	return key, nil
+}
+
+const backupPassphraseEnv = "LOCKNOTE_BACKUP_PASSPHRASE"
+
+// backupKey 返回打开备份所用的密钥：使用 --passphrase 时读取备份口令；旧版 zip 备份不需要密钥；
+// 返回 nil 表示已解锁，使用当前数据密钥
+func (c *cli) backupKey(path string, usePassphrase bool) (*backup.Key, error) {
+	if usePassphrase {
+		passphrase, err := readBackupPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		return &backup.Key{Passphrase: passphrase}, nil
+	}
+
+	isArchive, err := backup.IsArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isArchive {
+		return &backup.Key{}, nil
+	}
+	header, err := backup.ReadHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	if header.KeySource == backup.KeySourcePassphrase {
+		return nil, errors.New("该备份使用单独的口令加密，请加上 --passphrase")
+	}
+	return nil, c.unlock()
+}
+
+// readBackupPassphrase 读取环境变量或在终端提示输入备份口令，confirm 时要求输入两次
+func readBackupPassphrase(confirm bool) (string, error) {
+	if passphrase, ok := os.LookupEnv(backupPassphraseEnv); ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := promptPassword("备份口令: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("备份口令不能为空")
+	}
+	if confirm {
+		again, err := promptPassword("再次输入备份口令: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("两次输入的备份口令不一致")
+		}
+	}
+	return passphrase, nil
+}
+
+// ============ 同步 ============
+
+func cmdSync(c *cli, args []string) error {
+	serve := len(args) > 0 && args[0] == "serve"
+	if serve {
+		args = args[1:]
+	}
+
+	fs := c.newFlagSet("sync")
+	addr := fs.String("addr", "127.0.0.1:7788", "serve 监听的地址")
+	token := fs.String("token", os.Getenv("LOCKNOTE_SYNC_TOKEN"), "HTTP 同步使用的访问令牌")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if serve {
+		if err := requireArgs(fs, 0, "serve [--addr 地址] --token T"); err != nil {
+			return err
+		}
+		if *token == "" {
+			return errors.New("sync serve 需要访问令牌，请使用 --token 或 LOCKNOTE_SYNC_TOKEN 指定")
+		}
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	if serve {
+		fmt.Fprintf(os.Stderr, "同步服务监听 %s，按 Ctrl+C 停止\n", *addr)
+		return http.ListenAndServe(*addr, locksync.NewHandler(c.core.Sync(), *token))
+	}
+
+	if err := requireArgs(fs, 1, "[--token T] <目录|http://地址> | sync serve"); err != nil {
+		return err
+	}
+	target := fs.Arg(0)
+
+	var remote locksync.Transport
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		remote = locksync.NewHTTPTransport(target, *token)
+	} else {
+		remote = locksync.NewFolderTransport(target)
+	}
+
+	report, err := c.core.Sync().Sync(remote)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(report)
+	}
+	fmt.Printf("拉取 %d，推送 %d，冲突 %d，跳过 %d\n", report.Pulled, report.Pushed, report.Conflicts, report.Skipped)
+	if report.Rejected > 0 {
+		fmt.Fprintf(os.Stderr, "%d 条远端记录无法通过校验，未应用（可能被篡改，或由旧版本写入）\n", report.Rejected)
+	}
+	return nil
+}
+
+// ============ 更换数据密钥 ============
+
+func cmdRotateKey(c *cli, args []string) error {
+	fs := c.newFlagSet("rotate-key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 0, ""); err != nil {
+		return err
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.core.IsFirstRun() {
+		return errors.New("尚未设置主密码，请先在桌面端完成初始化")
+	}
+
+	// 解锁与更换密钥都需要密码，只读取一次
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := c.unlockWith(password); err != nil {
+		return err
+	}
+
+	result, err := c.core.RotateDataKey(password)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(result)
+	}
+	fmt.Printf("新的恢复密钥: %s\n请妥善保存，旧的恢复密钥已失效。\n", result.DataKey)
+	fmt.Fprintf(os.Stderr, "已重新加密 %d 条笔记、%d 个历史版本、%d 个附件", result.Notes, result.History, result.Attachments)
+	if result.Skipped > 0 {
+		fmt.Fprintf(os.Stderr, "，跳过 %d 个已损坏的对象", result.Skipped)
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
+
+// ============ 整库加密 ============
+
+func cmdEncryptDB(c *cli, args []string) error {
+	fs := c.newFlagSet("encrypt-db")
+	yes := fs.Bool("yes", false, "确认开启整库加密")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 0, "--yes"); err != nil {
+		return err
+	}
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.core.IsDatabaseEncrypted() {
+		fmt.Println("数据库已经整体加密")
+		return nil
+	}
+	if !c.core.DatabaseEncryptionAvailable() {
+		return database.ErrCipherUnavailable
+	}
+	if !*yes {
+		return errors.New("开启后不能关闭，且只有支持整库加密的版本才能打开这份数据；确认后请加上 --yes")
+	}
+	if c.core.IsFirstRun() {
+		return errors.New("尚未设置主密码，请先在桌面端完成初始化")
+	}
+
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := c.unlockWith(password); err != nil {
+		return err
+	}
+	if err := c.core.EncryptDatabase(password); err != nil {
+		return err
+	}
+	fmt.Println("数据库已整体加密")
+	return nil
+}
+
+// ============ 密钥文件 ============
+
+func cmdKeyfile(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法: locknote-cli keyfile new <文件> | set <文件> | remove")
+	}
+	sub, args := args[0], args[1:]
+
+	fs := c.newFlagSet("keyfile " + sub)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var path string
+	switch sub {
+	case "new":
+		if err := requireArgs(fs, 1, "<文件>"); err != nil {
+			return err
+		}
+		if err := c.open(); err != nil {
+			return err
+		}
+		if err := c.core.GenerateKeyfile(fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Println(fs.Arg(0))
+		fmt.Fprintln(os.Stderr, "已生成密钥文件，请另外备份一份；使用 keyfile set 后丢失它将只能用恢复密钥重置密码")
+		return nil
+	case "set":
+		if err := requireArgs(fs, 1, "<文件>"); err != nil {
+			return err
+		}
+		path = fs.Arg(0)
+	case "remove":
+		if err := requireArgs(fs, 0, ""); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("未知的 keyfile 子命令: %s", sub)
+	}
+
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.core.IsFirstRun() {
+		return errors.New("尚未设置主密码，请先在桌面端完成初始化")
+	}
+
+	// 解锁与设置密钥文件都需要密码，只读取一次
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := c.unlockWith(password); err != nil {
+		return err
+	}
+	if err := c.core.SetKeyfile(password, path); err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println("已取消密钥文件，解锁只需要主密码")
+	} else {
+		fmt.Println("已设置密钥文件，之后解锁需要主密码与该文件")
+	}
+	return nil
+}
+
+// ============ 完整性检查 ============
+
+func cmdVerify(c *cli, args []string) error {
+	fs := c.newFlagSet("verify")
+	repair := fs.Bool("repair", false, "修复可以修复的问题，并隔离残留与孤立的文件")
+	undecryptable := fs.Bool("quarantine-undecryptable", false, "与 --repair 一起使用：隔离无法解密且无法从历史版本恢复的笔记、历史版本与附件")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireArgs(fs, 0, "[--repair [--quarantine-undecryptable]]"); err != nil {
+		return err
+	}
+	if *undecryptable && !*repair {
+		return errors.New("--quarantine-undecryptable 需要与 --repair 一起使用")
+	}
+	if err := c.unlock(); err != nil {
+		return err
+	}
+
+	var report *core.VerifyReport
+	var err error
+	if *repair {
+		report, err = c.core.Repair(core.RepairOptions{
+			TempFiles:     true,
+			OrphanFiles:   true,
+			DanglingRows:  true,
+			Undecryptable: *undecryptable,
+			Rebuild:       true,
+		})
+	} else {
+		report, err = c.core.Verify()
+	}
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return printJSON(report)
+	}
+
+	for _, issue := range report.Issues {
+		target := issue.Path
+		if target == "" {
+			target = issue.ID
+		}
+		line := fmt.Sprintf("%-16s %-10s %s", issue.Kind, issue.Object, target)
+		if issue.Detail != "" {
+			line += "  " + issue.Detail
+		}
+		if issue.Action != "" {
+			line += "  [" + issue.Action + "]"
+		}
+		fmt.Println(line)
+	}
+	fmt.Fprintf(os.Stderr, "检查了 %d 条笔记、%d 个历史版本、%d 个附件、%d 个文件，发现 %d 个问题\n",
+		report.Notes, report.History, report.Attachments, report.Files, len(report.Issues))
+	if report.QuarantineDir != "" {
+		fmt.Fprintf(os.Stderr, "已隔离的文件与记录保存在 %s\n", report.QuarantineDir)
+	}
+	return nil
+}
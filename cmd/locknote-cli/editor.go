@@ -0,0 +1,122 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const allowDiskTempEnv = "LOCKNOTE_ALLOW_DISK_TEMP"
+
+// secureTempDir 返回编辑器临时文件所在的目录，优先选择内存文件系统，避免明文落到磁盘。
+// 没有可用的内存文件系统时，只有 allowDisk 或环境变量 LOCKNOTE_ALLOW_DISK_TEMP 允许才使用系统临时目录，并输出警告
+func secureTempDir(allowDisk bool) (string, error) {
+	candidates := []string{}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, dir)
+	}
+	if runtime.GOOS == "linux" {
+		candidates = append(candidates, "/dev/shm")
+	}
+	if ok, _ := strconv.ParseBool(os.Getenv(allowDiskTempEnv)); ok {
+		allowDisk = true
+	}
+
+	dir, onDisk, err := chooseTempDir(candidates, allowDisk)
+	if err != nil {
+		return "", err
+	}
+	if onDisk {
+		fmt.Fprintf(os.Stderr, "警告: 没有可用的内存文件系统，编辑中的笔记将以明文写入磁盘上的 %s\n", dir)
+	}
+	return dir, nil
+}
+
+// chooseTempDir 返回 candidates 中第一个存在的目录；都不存在时，allowDisk 为 true 则返回系统临时目录，
+// onDisk 表示返回的是磁盘上的目录
+func chooseTempDir(candidates []string, allowDisk bool) (dir string, onDisk bool, err error) {
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, false, nil
+		}
+	}
+	if !allowDisk {
+		return "", false, fmt.Errorf("没有可用的内存文件系统，编辑器的临时文件会以明文写入磁盘；确认接受请使用 --allow-disk-temp 或设置 %s=1", allowDiskTempEnv)
+	}
+	return os.TempDir(), true, nil
+}
+
+// editText 把文本写入 tempDir 中的临时文件并用 $VISUAL/$EDITOR 打开，返回编辑后的内容；
+// 临时文件在返回前被覆写并删除
+func editText(tempDir, initial string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		} else {
+			editor = "vi"
+		}
+	}
+
+	dir, err := os.MkdirTemp(tempDir, "locknote-edit-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.CreateTemp(dir, "note-*.md")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	defer shredFile(path)
+
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// $EDITOR 可能带参数，例如 "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.New("编辑器退出异常: " + err.Error())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// shredFile 用随机数据覆写文件后删除
+func shredFile(path string) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		if info, err := f.Stat(); err == nil {
+			io.CopyN(f, rand.Reader, info.Size())
+			f.Sync()
+		}
+		f.Close()
+	}
+	os.Remove(path)
+}
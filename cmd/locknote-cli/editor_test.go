@@ -0,0 +1,63 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChooseTempDir(t *testing.T) {
+	memory := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name       string
+		candidates []string
+		allowDisk  bool
+		wantDir    string
+		wantOnDisk bool
+		wantErr    bool
+	}{
+		{name: "first existing candidate", candidates: []string{missing, memory}, wantDir: memory},
+		{name: "candidate preferred over disk", candidates: []string{memory}, allowDisk: true, wantDir: memory},
+		{name: "no candidate refused", candidates: []string{missing}, wantErr: true},
+		{name: "no candidates refused", wantErr: true},
+		{name: "disk allowed", candidates: []string{missing}, allowDisk: true, wantDir: os.TempDir(), wantOnDisk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, onDisk, err := chooseTempDir(tt.candidates, tt.allowDisk)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", dir)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir != tt.wantDir || onDisk != tt.wantOnDisk {
+				t.Fatalf("got %q, %v, want %q, %v", dir, onDisk, tt.wantDir, tt.wantOnDisk)
+			}
+		})
+	}
+}
+
+func TestSecureTempDirEnvOptIn(t *testing.T) {
+	if _, err := os.Stat("/dev/shm"); err == nil {
+		t.Skip("/dev/shm is available")
+	}
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	t.Setenv(allowDiskTempEnv, "")
+	if _, err := secureTempDir(false); err == nil {
+		t.Fatal("expected an error without opting in")
+	}
+	t.Setenv(allowDiskTempEnv, "1")
+	if dir, err := secureTempDir(false); err != nil || dir != os.TempDir() {
+		t.Fatalf("secureTempDir = %q, %v", dir, err)
+	}
+}
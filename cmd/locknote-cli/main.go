@@ -0,0 +1,189 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"locknote/internal/core"
+	"os"
+	"path/filepath"
+)
+
+const usage = `用法: locknote-cli [全局选项] <命令> [参数]
+
+全局选项:
+  --data-dir DIR      数据目录（默认 ~/.locknote，或环境变量 LOCKNOTE_DATA_DIR）
+  --password-fd N     从文件描述符 N 读取主密码（否则读取 LOCKNOTE_PASSWORD 或在终端提示输入）
+  --keyfile FILE      解锁需要的密钥文件（或环境变量 LOCKNOTE_KEYFILE）
+  --json              以 JSON 输出
+
+命令:
+  ls [--notebook ID] [--tag ID] [--deleted]   列出笔记
+  cat <笔记ID>                                输出笔记内容
+  new [--title T] [--notebook ID] [--tag ID]  新建笔记（标准输入非终端时读取正文，否则打开 $EDITOR）
+  edit <笔记ID>                               用 $EDITOR 编辑笔记
+                                              编辑器的临时文件放在内存文件系统中；没有时需要 --allow-disk-temp
+                                              或 LOCKNOTE_ALLOW_DISK_TEMP=1 才允许写入磁盘
+  rm [--purge] <笔记ID>                       删除笔记（默认移入回收站）
+  tag ls | new <名称> [--color C] | rm <ID> | add <笔记ID> <ID> | remove <笔记ID> <ID>
+  notebook ls | new <名称> [--icon I] | rm <ID> | move <笔记ID> <ID|->
+  notebook protect|unprotect <ID>             为笔记本设置或取消单独的密码，访问其中的笔记时提示输入
+  history <笔记ID> | history restore <笔记ID> <历史ID>
+  backup create|verify|restore [--passphrase] <文件>  创建、校验或恢复加密备份
+  backup rollback | discard-snapshot          撤销最近一次恢复，或删除恢复前的数据快照
+  backup schedule [--interval H] [--dir D] [--keep-daily N] [--keep-weekly N] [--off] [--run]
+                                              查看或修改定时备份设置，--run 立即备份一次
+  backup repo init|snapshot|ls|check|prune|restore [--passphrase] <目录> [快照ID]
+                                              管理只写入变化部分的去重备份仓库
+  backup notes ls|import|restore [--passphrase] [--recovery-key] [--overwrite] <文件> [笔记ID...]
+                                              浏览备份中的笔记，导入全部或只恢复选中的笔记
+  export <笔记ID> [-o 文件] [--html]           导出为 Markdown，或嵌入图片的 HTML 文档
+  export-all [--notebook ID] [--tag ID] [--smart-view ID] [--attachments] [--zip|--html] --yes <目录|zip文件|html文件>
+                                              把笔记导出为明文 Markdown 目录树、zip 或带目录的 HTML（需要主密码）
+  import [--dry-run] <目录|文件.enex|文件.jex>
+                                              从 Markdown 文件夹（Obsidian、Logseq）、Evernote 或 Joplin 导出文件导入笔记
+  sync [--token T] <目录|http://地址>          与共享文件夹或另一台设备同步
+  sync serve [--addr 地址] --token T           通过 HTTP 提供本机数据供另一台设备同步
+  rotate-key                                  生成新的恢复密钥并重新加密所有数据
+  encrypt-db --yes                            整体加密数据库，笔记的时间、数量等元数据也不再以明文保存
+  keyfile new <文件> | set <文件> | remove      生成随机密钥文件，或设置、取消解锁时除主密码外还需要的密钥文件
+  verify [--repair]                           检查数据目录的完整性，--repair 修复并隔离无法修复的文件
+
+笔记 ID 可以使用唯一的前缀。
+`
+
+// cli 保存一次命令行调用的全局状态
+type cli struct {
+	dataDir    string
+	passwordFD int
+	keyfile    string
+	json       bool
+	core       *core.Core
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "locknote-cli:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	c := &cli{}
+
+	fs := flag.NewFlagSet("locknote-cli", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	fs.StringVar(&c.dataDir, "data-dir", defaultDataDir(), "")
+	fs.IntVar(&c.passwordFD, "password-fd", -1, "")
+	fs.StringVar(&c.keyfile, "keyfile", os.Getenv("LOCKNOTE_KEYFILE"), "")
+	fs.BoolVar(&c.json, "json", false, "")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("缺少命令")
+	}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	handler, ok := commands[cmd]
+	if !ok {
+		if cmd == "help" {
+			fs.Usage()
+			return nil
+		}
+		return fmt.Errorf("未知命令: %s", cmd)
+	}
+
+	defer c.close()
+	return handler(c, cmdArgs)
+}
+
+// defaultDataDir 与桌面端使用相同的数据目录
+func defaultDataDir() string {
+	if dir := os.Getenv("LOCKNOTE_DATA_DIR"); dir != "" {
+		return dir
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = "."
+	}
+	dataDir := filepath.Join(homeDir, ".locknote")
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		legacyDir := filepath.Join(homeDir, ".notebase")
+		if _, err := os.Stat(legacyDir); err == nil {
+			return legacyDir
+		}
+	}
+	return dataDir
+}
+
+// open 打开数据目录，不解锁
+func (c *cli) open() error {
+	if c.core != nil {
+		return nil
+	}
+	if _, err := os.Stat(c.dataDir); err != nil {
+		return fmt.Errorf("数据目录不存在: %s", c.dataDir)
+	}
+
+	lc, err := core.New(c.dataDir)
+	if err != nil {
+		return err
+	}
+	c.core = lc
+	return nil
+}
+
+// unlock 打开数据目录并使用主密码解锁
+func (c *cli) unlock() error {
+	if err := c.open(); err != nil {
+		return err
+	}
+	if c.core.IsUnlocked() {
+		return nil
+	}
+	if c.core.IsFirstRun() {
+		return errors.New("尚未设置主密码，请先在桌面端完成初始化")
+	}
+
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	return c.unlockWith(password)
+}
+
+func (c *cli) unlockWith(password string) error {
+	ok, err := c.core.Unlock(password, c.keyfile)
+	if errors.Is(err, core.ErrKeyfileRequired) {
+		return errors.New("需要密钥文件，请使用 --keyfile 或 LOCKNOTE_KEYFILE 指定")
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("密码错误")
+	}
+
+	// 解锁时完成了上次中断的数据密钥更换
+	if key := c.core.TakeRotatedDataKey(); key != "" {
+		fmt.Fprintf(os.Stderr, "已完成上次中断的数据密钥更换，新的恢复密钥: %s\n请妥善保存，旧的恢复密钥已失效。\n", key)
+	}
+	return nil
+}
+
+func (c *cli) close() {
+	if c.core != nil {
+		c.core.Close()
+		c.core = nil
+	}
+}
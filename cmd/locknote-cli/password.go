@@ -0,0 +1,59 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const passwordEnv = "LOCKNOTE_PASSWORD"
+
+// readPassword 依次尝试 --password-fd、环境变量 LOCKNOTE_PASSWORD 和终端提示
+func (c *cli) readPassword() (string, error) {
+	if c.passwordFD >= 0 {
+		f := os.NewFile(uintptr(c.passwordFD), "password-fd")
+		if f == nil {
+			return "", fmt.Errorf("无效的文件描述符: %d", c.passwordFD)
+		}
+		defer f.Close()
+
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("读取密码失败: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if password, ok := os.LookupEnv(passwordEnv); ok {
+		return password, nil
+	}
+
+	return promptPassword("主密码: ")
+}
+
+// promptPassword 在控制终端上提示输入密码，标准输入被重定向时也能使用
+func promptPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("没有可用的终端，请使用 --password-fd 或 " + passwordEnv)
+		}
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	password, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	return string(password), err
+}
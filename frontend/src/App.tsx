@@ -6,6 +6,7 @@ import { useStore } from './store';
 import { LockScreen } from './components/LockScreen';
 import { MainLayout } from './components/MainLayout';
 import { SetupScreen } from './components/SetupScreen';
+import { reloadNotebookData } from './components/NotebookPasswordDialog';
 import * as App from '../wailsjs/go/main/App';
 import { EventsEmit, EventsOn } from '../wailsjs/runtime/runtime';
 
@@ -184,9 +185,17 @@ function AppRoot() {
     const offLocked = EventsOn('app:locked', () => {
       useStore.getState().setUnlocked(false);
     });
+    // 受保护的笔记本空闲后自动锁定，刷新列表以隐藏其中的笔记
+    const offNotebookLocked = EventsOn('notebook:locked', () => {
+      if (!useStore.getState().isUnlocked) return;
+      reloadNotebookData().catch((error) => {
+        console.error('Failed to reload notebooks:', error);
+      });
+    });
 
     return () => {
       offLocked();
+      offNotebookLocked();
     };
   }, []);
 
@@ -1,17 +1,26 @@
 import { useState, useEffect } from 'react';
-import { Download, Upload, FileText, AlertCircle, Check, Key } from 'lucide-react';
+import { Download, Upload, FileText, AlertCircle, Check, Key, FolderOutput, FolderInput } from 'lucide-react';
 import { useStore } from '../store';
 import { formatMessage, useI18n } from '../i18n';
 import * as App from '../../wailsjs/go/main/App';
+import { core } from '../../wailsjs/go/models';
 
 export function BackupView() {
-  const { setNotes } = useStore();
+  const { setNotes, notebooks } = useStore();
   const { t } = useI18n();
   const [loading, setLoading] = useState<string | null>(null);
   const [message, setMessage] = useState<{ type: 'success' | 'error'; text: string } | null>(null);
   const [showRestoreConfirm, setShowRestoreConfirm] = useState(false);
   const [showImportDialog, setShowImportDialog] = useState(false);
   const [importKey, setImportKey] = useState('');
+  const [showExportDialog, setShowExportDialog] = useState(false);
+  const [exportPassword, setExportPassword] = useState('');
+  const [exportNotebookId, setExportNotebookId] = useState('');
+  const [exportAttachments, setExportAttachments] = useState(true);
+  const [exportZip, setExportZip] = useState(false);
+  const [exportFormat, setExportFormat] = useState<'markdown' | 'html'>('markdown');
+  const [externalDryRun, setExternalDryRun] = useState(true);
+  const [importIssues, setImportIssues] = useState<core.ImportIssue[]>([]);
 
   useEffect(() => {
     if (!showRestoreConfirm) return;
@@ -54,7 +63,14 @@ export function BackupView() {
     setMessage(null);
 
     try {
-      await App.RestoreBackup();
+      const result = await App.RestoreBackup();
+      if (!result) {
+        return;
+      }
+      if (!result.unlocked) {
+        // 备份来自其他数据密钥，已切换到锁定界面
+        return;
+      }
       const notesList = await App.ListNotes();
       setNotes(notesList || []);
       setMessage({ type: 'success', text: t.backup.restoreSuccess });
@@ -83,6 +99,65 @@ export function BackupView() {
     }
   };
 
+  const handleImportFolder = async () => {
+    setLoading('importFolder');
+    setMessage(null);
+
+    try {
+      const report = await App.ImportMarkdownFolder();
+      if (report) {
+        const notesList = await App.ListNotes();
+        setNotes(notesList || []);
+        setMessage({
+          type: 'success',
+          text: formatMessage(t.backup.importedFolderCount, {
+            count: Object.keys(report.imported || {}).length,
+            attachments: report.attachments,
+            duplicates: (report.duplicates || []).length,
+            failed: Object.keys(report.failed || {}).length,
+          }),
+        });
+      }
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.backup.importFailed}：${String(error)}` });
+    } finally {
+      setLoading(null);
+    }
+  };
+
+  const handleImportExternal = async (source: 'evernote' | 'joplin') => {
+    setLoading(source);
+    setMessage(null);
+    setImportIssues([]);
+
+    try {
+      const report = source === 'evernote'
+        ? await App.ImportEvernote(externalDryRun)
+        : await App.ImportJoplin(externalDryRun);
+      if (report) {
+        if (!report.dryRun) {
+          const notesList = await App.ListNotes();
+          setNotes(notesList || []);
+        }
+        setImportIssues(report.issues || []);
+        setMessage({
+          type: 'success',
+          text: formatMessage(report.dryRun ? t.backup.externalDryRunResult : t.backup.externalImportResult, {
+            count: report.notes,
+            attachments: report.attachments,
+            notebooks: report.notebooksCreated,
+            tags: report.tagsCreated,
+            issues: (report.issues || []).length,
+          }),
+        });
+      }
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.backup.importFailed}：${String(error)}` });
+    } finally {
+      setLoading(null);
+    }
+  };
+
   const handleImportWithKey = async () => {
     if (!importKey.trim()) {
       setMessage({ type: 'error', text: t.backup.dataKeyRequired });
@@ -94,11 +169,18 @@ export function BackupView() {
     setMessage(null);
 
     try {
-      const count = await App.ImportBackupWithKey(importKey.trim());
-      if (count > 0) {
+      const report = await App.ImportBackupWithKey(importKey.trim());
+      if (report) {
         const notesList = await App.ListNotes();
         setNotes(notesList || []);
-        setMessage({ type: 'success', text: formatMessage(t.backup.importedCount, { count }) });
+        setMessage({
+          type: 'success',
+          text: formatMessage(t.backup.importedCount, {
+            count: Object.keys(report.imported || {}).length,
+            duplicates: (report.duplicates || []).length,
+            failed: Object.keys(report.failed || {}).length,
+          }),
+        });
       }
     } catch (error) {
       setMessage({ type: 'error', text: `${t.backup.importFailed}：${String(error)}` });
@@ -108,6 +190,50 @@ export function BackupView() {
     }
   };
 
+  const closeExportDialog = () => {
+    setShowExportDialog(false);
+    setExportPassword('');
+  };
+
+  const handleExportVault = async () => {
+    if (!exportPassword) {
+      setMessage({ type: 'error', text: t.backup.exportPasswordRequired });
+      return;
+    }
+
+    const password = exportPassword;
+    closeExportDialog();
+    setLoading('exportVault');
+    setMessage(null);
+
+    try {
+      const opts = {
+        notebookId: exportNotebookId,
+        tagId: '',
+        smartViewId: '',
+        attachments: exportAttachments,
+        zip: exportFormat === 'markdown' && exportZip,
+      };
+      const result = exportFormat === 'html'
+        ? await App.ExportHTML(password, opts)
+        : await App.ExportMarkdown(password, opts);
+      if (result) {
+        setMessage({
+          type: 'success',
+          text: formatMessage(t.backup.exportedCount, {
+            count: result.notes,
+            attachments: result.attachments,
+            path: result.path,
+          }) + (result.locked ? formatMessage(t.backup.exportLockedSkipped, { count: result.locked }) : ''),
+        });
+      }
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.backup.exportFailed}：${String(error)}` });
+    } finally {
+      setLoading(null);
+    }
+  };
+
   return (
     <div className="flex-1 flex flex-col bg-white">
       <div className="p-6 border-b border-gray-100">
@@ -135,6 +261,19 @@ export function BackupView() {
           </div>
         )}
 
+        {importIssues.length > 0 && (
+          <div className="mb-6 p-4 rounded-xl bg-yellow-50 border border-yellow-200">
+            <h4 className="font-medium text-yellow-800 mb-2">{t.backup.importIssuesTitle}</h4>
+            <ul className="text-sm text-yellow-700 space-y-1 max-h-48 overflow-y-auto">
+              {importIssues.map((issue, i) => (
+                <li key={i}>
+                  <span className="font-medium">{issue.item}</span>：{issue.error}
+                </li>
+              ))}
+            </ul>
+          </div>
+        )}
+
         <div className="grid gap-6 md:grid-cols-2">
           <div className="p-6 border border-gray-200 rounded-xl">
             <div className="flex items-center gap-3 mb-4">
@@ -200,6 +339,13 @@ export function BackupView() {
             >
               {loading === 'import' ? t.common.loading : t.backup.importMarkdown}
             </button>
+            <button
+              onClick={handleImportFolder}
+              disabled={loading !== null}
+              className="w-full mt-2 py-3 border border-purple-600 text-purple-600 rounded-lg font-medium hover:bg-purple-50 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
+            >
+              {loading === 'importFolder' ? t.common.loading : t.backup.importFolder}
+            </button>
           </div>
 
           <div className="p-6 border border-gray-200 rounded-xl">
@@ -223,6 +369,64 @@ export function BackupView() {
               {loading === 'importWithKey' ? t.common.loading : t.backup.importBackup}
             </button>
           </div>
+
+          <div className="p-6 border border-gray-200 rounded-xl">
+            <div className="flex items-center gap-3 mb-4">
+              <div className="w-12 h-12 bg-sky-100 rounded-xl flex items-center justify-center">
+                <FolderInput className="w-6 h-6 text-sky-600" />
+              </div>
+              <div>
+                <h3 className="font-semibold text-gray-800">{t.backup.importExternal}</h3>
+                <p className="text-sm text-gray-500">{t.backup.importExternalDesc}</p>
+              </div>
+            </div>
+            <label className="flex items-center gap-2 text-sm text-gray-600 mb-4">
+              <input
+                type="checkbox"
+                checked={externalDryRun}
+                onChange={(e) => setExternalDryRun(e.target.checked)}
+              />
+              {t.backup.dryRun}
+            </label>
+            <div className="grid grid-cols-2 gap-2">
+              <button
+                onClick={() => handleImportExternal('evernote')}
+                disabled={loading !== null}
+                className="py-3 bg-sky-600 text-white rounded-lg font-medium hover:bg-sky-700 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
+              >
+                {loading === 'evernote' ? t.common.loading : t.backup.importEvernote}
+              </button>
+              <button
+                onClick={() => handleImportExternal('joplin')}
+                disabled={loading !== null}
+                className="py-3 bg-sky-600 text-white rounded-lg font-medium hover:bg-sky-700 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
+              >
+                {loading === 'joplin' ? t.common.loading : t.backup.importJoplin}
+              </button>
+            </div>
+          </div>
+
+          <div className="p-6 border border-gray-200 rounded-xl">
+            <div className="flex items-center gap-3 mb-4">
+              <div className="w-12 h-12 bg-orange-100 rounded-xl flex items-center justify-center">
+                <FolderOutput className="w-6 h-6 text-orange-600" />
+              </div>
+              <div>
+                <h3 className="font-semibold text-gray-800">{t.backup.exportVault}</h3>
+                <p className="text-sm text-gray-500">{t.backup.exportVaultDesc}</p>
+              </div>
+            </div>
+            <p className="text-sm text-red-600 mb-4">
+              {t.backup.exportWarning}
+            </p>
+            <button
+              onClick={() => setShowExportDialog(true)}
+              disabled={loading !== null}
+              className="w-full py-3 bg-orange-600 text-white rounded-lg font-medium hover:bg-orange-700 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
+            >
+              {loading === 'exportVault' ? t.common.loading : t.backup.exportVault}
+            </button>
+          </div>
         </div>
 
         <div className="mt-8 p-4 bg-yellow-50 border border-yellow-200 rounded-xl">
@@ -302,6 +506,91 @@ export function BackupView() {
           </div>
         </div>
       )}
+
+      {showExportDialog && (
+        <div
+          className="fixed inset-0 z-50 flex items-center justify-center bg-black/30"
+          onClick={closeExportDialog}
+        >
+          <div
+            className="w-[420px] bg-white rounded-xl shadow-xl border border-gray-200 p-4"
+            onClick={(e) => e.stopPropagation()}
+          >
+            <div className="text-sm font-semibold text-gray-900">{t.backup.exportVault}</div>
+            <div className="mt-2 p-3 text-sm text-red-700 bg-red-50 border border-red-200 rounded-lg flex items-start gap-2">
+              <AlertCircle className="w-4 h-4 flex-shrink-0 mt-0.5" />
+              <span>{t.backup.exportWarning}</span>
+            </div>
+            <div className="mt-4 space-y-3">
+              <label className="block text-sm text-gray-600">
+                {t.backup.exportScope}
+                <select
+                  value={exportNotebookId}
+                  onChange={(e) => setExportNotebookId(e.target.value)}
+                  className="mt-1 w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-orange-500/50"
+                >
+                  <option value="">{t.backup.exportAllNotes}</option>
+                  {notebooks.map((nb) => (
+                    <option key={nb.id} value={nb.id}>{nb.name}</option>
+                  ))}
+                </select>
+              </label>
+              <label className="block text-sm text-gray-600">
+                {t.backup.exportFormat}
+                <select
+                  value={exportFormat}
+                  onChange={(e) => setExportFormat(e.target.value as 'markdown' | 'html')}
+                  className="mt-1 w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-orange-500/50"
+                >
+                  <option value="markdown">{t.backup.exportFormatMarkdown}</option>
+                  <option value="html">{t.backup.exportFormatHTML}</option>
+                </select>
+              </label>
+              <label className="flex items-center gap-2 text-sm text-gray-600">
+                <input
+                  type="checkbox"
+                  checked={exportAttachments}
+                  onChange={(e) => setExportAttachments(e.target.checked)}
+                />
+                {exportFormat === 'html' ? t.backup.exportEmbedImages : t.backup.exportAttachments}
+              </label>
+              {exportFormat === 'markdown' && (
+                <label className="flex items-center gap-2 text-sm text-gray-600">
+                  <input
+                    type="checkbox"
+                    checked={exportZip}
+                    onChange={(e) => setExportZip(e.target.checked)}
+                  />
+                  {t.backup.exportZip}
+                </label>
+              )}
+              <input
+                type="password"
+                value={exportPassword}
+                onChange={(e) => setExportPassword(e.target.value)}
+                onKeyDown={(e) => e.key === 'Enter' && handleExportVault()}
+                placeholder={t.backup.exportPasswordPlaceholder}
+                className="w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-orange-500/50"
+                autoFocus
+              />
+            </div>
+            <div className="mt-4 flex justify-end gap-2">
+              <button
+                className="px-3 py-2 text-sm rounded-lg border border-gray-200 hover:bg-gray-50"
+                onClick={closeExportDialog}
+              >
+                {t.common.cancel}
+              </button>
+              <button
+                className="px-3 py-2 text-sm rounded-lg bg-orange-600 text-white hover:bg-orange-700"
+                onClick={handleExportVault}
+              >
+                {t.common.confirm}
+              </button>
+            </div>
+          </div>
+        </div>
+      )}
     </div>
   );
 }
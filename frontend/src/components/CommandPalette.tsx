@@ -154,9 +154,9 @@ export function CommandPalette() {
                 >
                   <FileText className="w-4 h-4 text-gray-400" />
                   <div className="flex-1 min-w-0">
-                    <div className="text-gray-700 truncate">{note.title || t.noteList.untitled}</div>
+                    <div className="text-gray-700 truncate">{note.locked ? t.noteList.lockedNote : note.title || t.noteList.untitled}</div>
                     <div className="text-xs text-gray-400 truncate">
-                      {note.content?.substring(0, 60) || t.noteList.noContent}
+                      {note.locked ? t.noteList.lockedNoteDesc : note.content?.substring(0, 60) || t.noteList.noContent}
                     </div>
                   </div>
                 </button>
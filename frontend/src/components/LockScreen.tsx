@@ -1,13 +1,13 @@
-import { useState } from 'react';
-import { Lock, Eye, EyeOff, AlertCircle, HelpCircle, Key } from 'lucide-react';
+import { useState, useEffect } from 'react';
+import { Lock, Eye, EyeOff, AlertCircle, HelpCircle, Key, FileKey } from 'lucide-react';
 import { useStore } from '../store';
-import { useI18n } from '../i18n';
+import { formatMessage, useI18n } from '../i18n';
 import * as App from '../../wailsjs/go/main/App';
 
 type Mode = 'unlock' | 'forgot' | 'reset';
 
 export function LockScreen() {
-  const { setUnlocked } = useStore();
+  const { setUnlocked, setFirstRun } = useStore();
   const { t } = useI18n();
   const [mode, setMode] = useState<Mode>('unlock');
   const [password, setPassword] = useState('');
@@ -16,27 +16,69 @@ export function LockScreen() {
   const [loading, setLoading] = useState(false);
   const [hint, setHint] = useState('');
   const [showHint, setShowHint] = useState(false);
+  const [keyfileRequired, setKeyfileRequired] = useState(false);
+  const [keyfile, setKeyfile] = useState('');
+  const [retryAfter, setRetryAfter] = useState(0);
+  const [attemptsLeft, setAttemptsLeft] = useState(0);
 
   const [dataKey, setDataKey] = useState('');
   const [newPassword, setNewPassword] = useState('');
   const [confirmPassword, setConfirmPassword] = useState('');
   const [newHint, setNewHint] = useState('');
 
+  // refreshThrottle 读取连续失败的等待时间；数据因失败过多被清除时回到初始化界面
+  const refreshThrottle = async () => {
+    try {
+      if (await App.IsFirstRun()) {
+        setFirstRun(true);
+        return;
+      }
+      const status = await App.GetUnlockThrottle();
+      setRetryAfter(status.retryAfterSeconds);
+      setAttemptsLeft(status.wipeAfterFailures > 0 ? status.wipeAfterFailures - status.failures : 0);
+    } catch {
+      // 忽略，解锁时会再次返回错误
+    }
+  };
+
+  useEffect(() => {
+    App.RequiresKeyfile().then(setKeyfileRequired).catch(() => {});
+    refreshThrottle();
+  }, []);
+
+  useEffect(() => {
+    if (retryAfter <= 0) return;
+    const timer = setTimeout(() => setRetryAfter(retryAfter - 1), 1000);
+    return () => clearTimeout(timer);
+  }, [retryAfter]);
+
+  const fileName = (path: string) => path.split(/[\\/]/).pop() || path;
+
+  const handleSelectKeyfile = async () => {
+    try {
+      const path = await App.SelectKeyfile();
+      if (path) setKeyfile(path);
+    } catch (err) {
+      setError(String(err));
+    }
+  };
+
   const handleUnlock = async () => {
     setError('');
     setLoading(true);
 
     try {
-      const success = await App.Unlock(password);
+      const success = await App.Unlock(password, keyfile);
       if (success) {
         setUnlocked(true);
       } else {
-        setError(t.auth.wrongPassword);
+        setError(keyfileRequired ? t.auth.wrongPasswordOrKeyfile : t.auth.wrongPassword);
       }
     } catch (err) {
       setError(`${t.auth.unlockFailed}：${String(err)}`);
     } finally {
       setLoading(false);
+      refreshThrottle();
     }
   };
 
@@ -72,15 +114,23 @@ export function LockScreen() {
       setError(`${t.auth.resetFailed}：${String(err)}`);
     } finally {
       setLoading(false);
+      refreshThrottle();
     }
   };
 
   const handleKeyDown = (e: React.KeyboardEvent) => {
-    if (e.key === 'Enter' && mode === 'unlock' && password) {
+    if (e.key === 'Enter' && mode === 'unlock' && password && (!keyfileRequired || keyfile) && retryAfter <= 0) {
       handleUnlock();
     }
   };
 
+  const throttleNotice = (retryAfter > 0 || attemptsLeft > 0) && (
+    <div className="bg-yellow-50 border border-yellow-200 rounded-lg p-3 text-sm text-yellow-700 space-y-1">
+      {retryAfter > 0 && <div>{formatMessage(t.auth.throttled, { seconds: retryAfter })}</div>}
+      {attemptsLeft > 0 && <div>{formatMessage(t.auth.wipeWarning, { count: attemptsLeft })}</div>}
+    </div>
+  );
+
   return (
     <div className="h-screen flex items-center justify-center bg-background backdrop-blur-sm">
       <div className="w-full max-w-md p-8 bg-white rounded-2xl shadow-lg border border-primary-100">
@@ -120,6 +170,25 @@ export function LockScreen() {
               </div>
             </div>
 
+            {keyfileRequired && (
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-1">{t.auth.keyfile}</label>
+                <div className="flex gap-2">
+                  <div className="flex-1 px-4 py-3 border border-gray-200 rounded-lg text-sm text-gray-600 truncate" title={keyfile}>
+                    {keyfile ? fileName(keyfile) : t.auth.keyfileNone}
+                  </div>
+                  <button
+                    type="button"
+                    onClick={handleSelectKeyfile}
+                    className="px-4 py-3 border border-gray-200 rounded-lg hover:bg-gray-50 transition-colors flex items-center gap-2 text-gray-600"
+                  >
+                    <FileKey className="w-5 h-5" />
+                    {t.auth.keyfileSelect}
+                  </button>
+                </div>
+              </div>
+            )}
+
             {showHint && hint && (
               <div className="bg-blue-50 border border-blue-200 rounded-lg p-3 text-sm text-blue-700">
                 <span className="font-medium">{t.auth.hint}：</span> {hint}
@@ -132,10 +201,11 @@ export function LockScreen() {
                 {error}
               </div>
             )}
+            {throttleNotice}
 
             <button
               onClick={handleUnlock}
-              disabled={loading || !password}
+              disabled={loading || !password || (keyfileRequired && !keyfile) || retryAfter > 0}
               className="w-full py-3 bg-accent text-white rounded-lg font-medium hover:bg-primary-600 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
             >
               {loading ? t.common.loading : t.auth.unlock}
@@ -238,10 +308,11 @@ export function LockScreen() {
                 {error}
               </div>
             )}
+            {throttleNotice}
 
             <button
               onClick={handleResetPassword}
-              disabled={loading || [...dataKey].length < 5 || [...dataKey].length > 32 || !newPassword || !confirmPassword}
+              disabled={loading || retryAfter > 0 || [...dataKey].length < 5 || [...dataKey].length > 32 || !newPassword || !confirmPassword}
               className="w-full py-3 bg-accent text-white rounded-lg font-medium hover:bg-primary-600 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
             >
               {loading ? t.common.loading : t.auth.resetPassword}
@@ -1,20 +1,30 @@
 import { useState, useEffect, useCallback, useRef } from 'react';
-import { Eye, Edit3, Columns, Tag, History, Download, X, Plus, Check } from 'lucide-react';
-import ReactMarkdown from 'react-markdown';
+import { Eye, Edit3, Columns, Tag, History, Download, FileCode, X, Plus, Check, Lock } from 'lucide-react';
+import ReactMarkdown, { defaultUrlTransform } from 'react-markdown';
 import remarkGfm from 'remark-gfm';
 import { useStore, EditorMode } from '../store';
 import { useI18n } from '../i18n';
 import { notes, tags } from '../../wailsjs/go/models';
 import * as App from '../../wailsjs/go/main/App';
+import { NotebookPasswordDialog } from './NotebookPasswordDialog';
+
+// attachment://<id> 链接由 Go 端的资源处理器解密后提供，note://<id> 链接在应用内打开对应笔记
+const attachmentUrlTransform = (url: string) => {
+  if (url.startsWith('attachment://')) return `/attachment/${url.slice('attachment://'.length)}`;
+  if (url.startsWith('note://')) return url;
+  return defaultUrlTransform(url);
+};
 
 export function NoteEditor() {
   const {
     selectedNote,
     setSelectedNote,
+    setSelectedNoteId,
     editorMode,
     setEditorMode,
     tags: allTags,
     setNotes,
+    notebooks,
   } = useStore();
 
   const { t, language } = useI18n();
@@ -26,6 +36,7 @@ export function NoteEditor() {
   const [showHistory, setShowHistory] = useState(false);
   const [history, setHistory] = useState<notes.Note[]>([]);
   const [confirmRestoreId, setConfirmRestoreId] = useState<string | null>(null);
+  const [showUnlockDialog, setShowUnlockDialog] = useState(false);
   const saveTimeoutRef = useRef<ReturnType<typeof setTimeout> | null>(null);
   const tagMenuContainerRef = useRef<HTMLDivElement | null>(null);
 
@@ -103,7 +114,7 @@ export function NoteEditor() {
   }, [selectedNote, title, content, setSelectedNote, setNotes]);
 
   useEffect(() => {
-    if (!selectedNote) return;
+    if (!selectedNote || selectedNote.locked) return;
 
     if (saveTimeoutRef.current) {
       clearTimeout(saveTimeoutRef.current);
@@ -181,11 +192,13 @@ export function NoteEditor() {
     }
   };
 
-  const handleExport = async () => {
+  const handleExport = async (format: 'markdown' | 'html') => {
     if (!selectedNote) return;
 
     try {
-      const path = await App.ExportNoteAsMarkdown(selectedNote.id);
+      const path = format === 'html'
+        ? await App.ExportNoteAsHTML(selectedNote.id)
+        : await App.ExportNoteAsMarkdown(selectedNote.id);
       if (path) {
         alert(`${t.common.success}：${path}`);
       }
@@ -215,6 +228,34 @@ export function NoteEditor() {
     );
   }
 
+  if (selectedNote.locked) {
+    const lockedNotebook = notebooks.find((nb) => nb.id === selectedNote.notebookId);
+    return (
+      <div className="flex-1 flex items-center justify-center bg-gray-50">
+        <div className="text-center text-gray-400">
+          <Lock className="w-12 h-12 mx-auto mb-4 opacity-50" />
+          <p>{t.editor.lockedNote}</p>
+          <p className="text-sm mt-1">{t.editor.lockedNoteTip}</p>
+          {lockedNotebook && (
+            <button
+              onClick={() => setShowUnlockDialog(true)}
+              className="mt-4 px-4 py-2 text-sm rounded-lg bg-accent text-white hover:bg-primary-600"
+            >
+              {t.noteList.unlockNotebook}
+            </button>
+          )}
+        </div>
+        {showUnlockDialog && lockedNotebook && (
+          <NotebookPasswordDialog
+            notebook={lockedNotebook}
+            mode="unlock"
+            onClose={() => setShowUnlockDialog(false)}
+          />
+        )}
+      </div>
+    );
+  }
+
   return (
     <div className="flex-1 flex flex-col bg-white">
       <div className="flex items-center justify-between px-6 py-3 border-b border-gray-100">
@@ -306,12 +347,20 @@ export function NoteEditor() {
           </button>
 
           <button
-            onClick={handleExport}
+            onClick={() => handleExport('markdown')}
             className="p-2 rounded-lg text-gray-500 hover:bg-gray-100 transition-colors"
             title={t.editor.export}
           >
             <Download className="w-4 h-4" />
           </button>
+
+          <button
+            onClick={() => handleExport('html')}
+            className="p-2 rounded-lg text-gray-500 hover:bg-gray-100 transition-colors"
+            title={t.editor.exportHTML}
+          >
+            <FileCode className="w-4 h-4" />
+          </button>
         </div>
       </div>
 
@@ -340,7 +389,40 @@ export function NoteEditor() {
               <h1 className="text-2xl font-bold text-gray-800">{title || t.noteList.untitled}</h1>
             </div>
             <div className="flex-1 px-6 py-4 markdown-preview overflow-y-auto">
-              <ReactMarkdown remarkPlugins={[remarkGfm]}>{content || `*${t.noteList.noContent}*`}</ReactMarkdown>
+              <ReactMarkdown
+                remarkPlugins={[remarkGfm]}
+                urlTransform={attachmentUrlTransform}
+                components={{
+                  a: ({ href, title, children }) =>
+                    href?.startsWith('note://') ? (
+                      <a
+                        href={href}
+                        onClick={(e) => {
+                          e.preventDefault();
+                          setSelectedNoteId(href.slice('note://'.length));
+                        }}
+                      >
+                        {children}
+                      </a>
+                    ) : href?.startsWith('/attachment/') ? (
+                      // 附件不在应用内打开，交给系统默认程序
+                      <a
+                        href={href}
+                        title={title}
+                        onClick={(e) => {
+                          e.preventDefault();
+                          App.OpenAttachment(href.slice('/attachment/'.length)).catch((error) =>
+                            console.error('Failed to open attachment:', error),
+                          );
+                        }}
+                      >
+                        {children}
+                      </a>
+                    ) : (
+                      <a href={href} title={title}>{children}</a>
+                    ),
+                }}
+              >{content || `*${t.noteList.noContent}*`}</ReactMarkdown>
             </div>
           </div>
         )}
@@ -1,10 +1,11 @@
 import { useEffect, useRef, useState, type MouseEvent, type DragEvent } from 'react';
-import { Plus, Pin, MoreVertical, Trash2, X, ChevronDown, FolderInput, Folder, FolderOpen, Book, Tag, Check, ChevronRight, Edit2 } from 'lucide-react';
+import { Plus, Pin, MoreVertical, Trash2, X, ChevronDown, FolderInput, Folder, FolderOpen, Book, Tag, Check, ChevronRight, Edit2, Lock, Unlock } from 'lucide-react';
 import { useVirtualizer } from '@tanstack/react-virtual';
 import { useStore } from '../store';
 import { formatMessage, useI18n } from '../i18n';
 import { notes } from '../../wailsjs/go/models';
 import * as App from '../../wailsjs/go/main/App';
+import { NotebookPasswordDialog, NotebookPasswordMode, reloadNotebookData } from './NotebookPasswordDialog';
 
 export function NoteList() {
   const {
@@ -27,6 +28,7 @@ export function NoteList() {
     notebooks,
     currentView,
     expandedNotebooks,
+    expandNotebook,
     toggleNotebookExpand,
   } = useStore();
 
@@ -43,6 +45,7 @@ export function NoteList() {
   const [editingNotebookName, setEditingNotebookName] = useState('');
   const [dragOverNotebookId, setDragOverNotebookId] = useState<string | null>(null);
   const [confirmDeleteNotebookId, setConfirmDeleteNotebookId] = useState<string | null>(null);
+  const [passwordDialog, setPasswordDialog] = useState<{ notebook: typeof notebooks[0]; mode: NotebookPasswordMode } | null>(null);
   const [confirmBatchDelete, setConfirmBatchDelete] = useState(false);
   const [dragOverNoteId, setDragOverNoteId] = useState<string | null>(null);
   const [dragOverPosition, setDragOverPosition] = useState<'before' | 'after' | null>(null);
@@ -588,6 +591,31 @@ export function NoteList() {
     setNotebookMenuOpen(null);
   };
 
+  const handleNotebookPassword = (nb: typeof notebooks[0], mode: NotebookPasswordMode) => {
+    setNotebookMenuOpen(null);
+    setPasswordDialog({ notebook: nb, mode });
+  };
+
+  const handleLockNotebook = async (nb: typeof notebooks[0]) => {
+    setNotebookMenuOpen(null);
+    try {
+      await App.LockNotebook(nb.id);
+      await reloadNotebookData();
+    } catch (error) {
+      console.error('Failed to lock notebook:', error);
+    }
+  };
+
+  const handleNotebookHeaderClick = (nb: typeof notebooks[0]) => {
+    // 展开锁定的笔记本时先要求解锁，取消后只显示占位
+    if (nb.locked && !expandedNotebooks.has(nb.id)) {
+      expandNotebook(nb.id);
+      setPasswordDialog({ notebook: nb, mode: 'unlock' });
+      return;
+    }
+    toggleNotebookExpand(nb.id);
+  };
+
   const getNotesForNotebook = (notebookId: string) => {
     return sortedNotes.filter((note) => note.notebookId === notebookId);
   };
@@ -635,12 +663,13 @@ export function NoteList() {
             <div className="flex-1 min-w-0">
               <div className="flex items-center gap-2">
                 {note.pinned && <Pin className="w-3 h-3 text-accent flex-shrink-0" />}
+                {note.locked && <Lock className="w-3 h-3 text-gray-400 flex-shrink-0" />}
                 <h3 className="font-medium text-gray-800 truncate">
-                  {note.title || t.noteList.untitled}
+                  {note.locked ? t.noteList.lockedNote : note.title || t.noteList.untitled}
                 </h3>
               </div>
               <p className="text-sm text-gray-500 mt-1 line-clamp-2">
-                {note.content?.substring(0, 100) || t.noteList.noContent}
+                {note.locked ? t.noteList.lockedNoteDesc : note.content?.substring(0, 100) || t.noteList.noContent}
               </p>
               <div className="flex items-center gap-2 mt-2">
                 <span className="text-xs text-gray-400">{formatDate(note.updatedAt)}</span>
@@ -885,7 +914,7 @@ export function NoteList() {
                     className={`flex items-center justify-between px-4 py-3 cursor-pointer hover:bg-gray-50 border-b border-gray-100 ${
                       isNotebookDragOver ? 'bg-blue-50' : ''
                     }`}
-                    onClick={() => toggleNotebookExpand(nb.id)}
+                    onClick={() => handleNotebookHeaderClick(nb)}
                   >
                     <div className="flex items-center gap-2 flex-1 min-w-0">
                       <ChevronRight className={`w-4 h-4 text-gray-400 transition-transform ${isExpanded ? 'rotate-90' : ''}`} />
@@ -909,6 +938,9 @@ export function NoteList() {
                         <>
                           {nb.pinned && <Pin className="w-3 h-3 text-accent flex-shrink-0" />}
                           <span className="font-medium text-gray-700 truncate">{nb.name}</span>
+                          {nb.protected && (nb.locked
+                            ? <Lock className="w-3 h-3 text-gray-400 flex-shrink-0" />
+                            : <Unlock className="w-3 h-3 text-gray-400 flex-shrink-0" />)}
                         </>
                       )}
                       <span className="text-xs text-gray-400">({notebookNotes.length})</span>
@@ -936,8 +968,41 @@ export function NoteList() {
                             <Edit2 className="w-4 h-4" />
                             {t.noteList.rename}
                           </button>
+                          {nb.locked && (
+                            <button
+                              onClick={(e) => { e.stopPropagation(); handleNotebookPassword(nb, 'unlock'); }}
+                              className="w-full px-3 py-2 text-left text-sm hover:bg-gray-50 flex items-center gap-2"
+                            >
+                              <Unlock className="w-4 h-4" />
+                              {t.noteList.unlockNotebook}
+                            </button>
+                          )}
+                          {nb.protected && !nb.locked && (
+                            <button
+                              onClick={(e) => { e.stopPropagation(); handleLockNotebook(nb); }}
+                              className="w-full px-3 py-2 text-left text-sm hover:bg-gray-50 flex items-center gap-2"
+                            >
+                              <Lock className="w-4 h-4" />
+                              {t.noteList.lockNotebook}
+                            </button>
+                          )}
                           <button
-                            onClick={(e) => { e.stopPropagation(); setConfirmDeleteNotebookId(nb.id); setNotebookMenuOpen(null); }}
+                            onClick={(e) => { e.stopPropagation(); handleNotebookPassword(nb, nb.protected ? 'unprotect' : 'protect'); }}
+                            className="w-full px-3 py-2 text-left text-sm hover:bg-gray-50 flex items-center gap-2"
+                          >
+                            <Lock className="w-4 h-4" />
+                            {nb.protected ? t.noteList.unprotectNotebook : t.noteList.protectNotebook}
+                          </button>
+                          <button
+                            onClick={(e) => {
+                              e.stopPropagation();
+                              setNotebookMenuOpen(null);
+                              if (nb.protected) {
+                                alert(t.noteList.notebookProtectedDeleteTip);
+                                return;
+                              }
+                              setConfirmDeleteNotebookId(nb.id);
+                            }}
                             className="w-full px-3 py-2 text-left text-sm hover:bg-gray-50 flex items-center gap-2 text-red-500"
                           >
                             <Trash2 className="w-4 h-4" />
@@ -1019,12 +1084,13 @@ export function NoteList() {
                         <div className="flex-1 min-w-0">
                           <div className="flex items-center gap-2">
                             {note.pinned && <Pin className="w-3 h-3 text-accent flex-shrink-0" />}
+                            {note.locked && <Lock className="w-3 h-3 text-gray-400 flex-shrink-0" />}
                             <h3 className="font-medium text-gray-800 truncate">
-                              {note.title || t.noteList.untitled}
+                              {note.locked ? t.noteList.lockedNote : note.title || t.noteList.untitled}
                             </h3>
                           </div>
                           <p className="text-sm text-gray-500 mt-1 line-clamp-2">
-                            {note.content?.substring(0, 100) || t.noteList.noContent}
+                            {note.locked ? t.noteList.lockedNoteDesc : note.content?.substring(0, 100) || t.noteList.noContent}
                           </p>
                           <div className="flex items-center gap-2 mt-2">
                             <span className="text-xs text-gray-400">{formatDate(note.updatedAt)}</span>
@@ -1216,6 +1282,14 @@ export function NoteList() {
         </div>
       )}
 
+      {passwordDialog && (
+        <NotebookPasswordDialog
+          notebook={passwordDialog.notebook}
+          mode={passwordDialog.mode}
+          onClose={() => setPasswordDialog(null)}
+        />
+      )}
+
       {confirmBatchDelete && (
         <div
           className="fixed inset-0 z-50 flex items-center justify-center bg-black/30"
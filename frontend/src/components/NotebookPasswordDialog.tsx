@@ -0,0 +1,129 @@
+import { useState } from 'react';
+import { Lock } from 'lucide-react';
+import { useStore } from '../store';
+import { formatMessage, useI18n } from '../i18n';
+import { notebooks } from '../../wailsjs/go/models';
+import * as App from '../../wailsjs/go/main/App';
+
+export type NotebookPasswordMode = 'unlock' | 'protect' | 'unprotect';
+
+// reloadNotebookData 在笔记本加锁、解锁或改变保护后刷新笔记本、笔记列表与当前打开的笔记
+export async function reloadNotebookData() {
+  const state = useStore.getState();
+  const [notebooksList, notesList] = await Promise.all([App.ListNotebooks(), App.ListNotes()]);
+  state.setNotebooks(notebooksList || []);
+  state.setNotes(notesList || []);
+  const { selectedNoteId } = useStore.getState();
+  if (selectedNoteId) {
+    state.setSelectedNote(await App.GetNote(selectedNoteId));
+  }
+}
+
+interface NotebookPasswordDialogProps {
+  notebook: notebooks.Notebook;
+  mode: NotebookPasswordMode;
+  onClose: () => void;
+}
+
+export function NotebookPasswordDialog({ notebook, mode, onClose }: NotebookPasswordDialogProps) {
+  const { t } = useI18n();
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [error, setError] = useState('');
+  const [loading, setLoading] = useState(false);
+
+  // 已受保护但上次保护中断时只需验证密码
+  const needsConfirm = mode === 'protect' && !notebook.protected;
+
+  const title = {
+    unlock: formatMessage(t.noteList.unlockNotebookTitle, { name: notebook.name }),
+    protect: t.noteList.protectNotebookTitle,
+    unprotect: t.noteList.unprotectNotebookTitle,
+  }[mode];
+  const desc = {
+    unlock: '',
+    protect: t.noteList.protectNotebookDesc,
+    unprotect: t.noteList.unprotectNotebookDesc,
+  }[mode];
+
+  const handleSubmit = async () => {
+    if (!password || loading) return;
+    if (needsConfirm && password !== confirmPassword) {
+      setError(t.noteList.notebookPasswordMismatch);
+      return;
+    }
+
+    setLoading(true);
+    setError('');
+    try {
+      if (mode === 'unlock') {
+        await App.UnlockNotebook(notebook.id, password);
+      } else if (mode === 'protect') {
+        await App.ProtectNotebook(notebook.id, password);
+      } else {
+        await App.UnprotectNotebook(notebook.id, password);
+      }
+      await reloadNotebookData();
+      onClose();
+    } catch (err) {
+      setError(String(err));
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div
+      className="fixed inset-0 z-50 flex items-center justify-center bg-black/30"
+      onClick={onClose}
+    >
+      <div
+        className="w-[360px] bg-white rounded-xl shadow-xl border border-gray-200 p-4"
+        onClick={(e) => e.stopPropagation()}
+      >
+        <div className="text-sm font-semibold text-gray-900 flex items-center gap-2">
+          <Lock className="w-4 h-4 text-gray-500" />
+          {title}
+        </div>
+        {desc && <div className="mt-2 text-sm text-gray-600">{desc}</div>}
+        <div className="mt-3 space-y-2">
+          <input
+            type="password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            onKeyDown={(e) => { if (e.key === 'Enter') handleSubmit(); if (e.key === 'Escape') onClose(); }}
+            placeholder={t.noteList.notebookPasswordPlaceholder}
+            className="w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-accent/50"
+            autoFocus
+          />
+          {needsConfirm && (
+            <input
+              type="password"
+              value={confirmPassword}
+              onChange={(e) => setConfirmPassword(e.target.value)}
+              onKeyDown={(e) => { if (e.key === 'Enter') handleSubmit(); if (e.key === 'Escape') onClose(); }}
+              placeholder={t.noteList.notebookPasswordConfirmPlaceholder}
+              className="w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-accent/50"
+            />
+          )}
+        </div>
+        {error && <div className="mt-2 text-sm text-red-500">{error}</div>}
+        <div className="mt-4 flex justify-end gap-2">
+          <button
+            className="px-3 py-2 text-sm rounded-lg border border-gray-200 hover:bg-gray-50"
+            onClick={onClose}
+          >
+            {t.common.cancel}
+          </button>
+          <button
+            className="px-3 py-2 text-sm rounded-lg bg-accent text-white hover:bg-primary-600 disabled:opacity-50"
+            onClick={handleSubmit}
+            disabled={!password || loading}
+          >
+            {loading ? t.common.loading : t.common.confirm}
+          </button>
+        </div>
+      </div>
+    </div>
+  );
+}
@@ -4,6 +4,7 @@ import { useVirtualizer } from '@tanstack/react-virtual';
 import { useStore } from '../store';
 import { formatMessage, useI18n } from '../i18n';
 import { notes as notesModel } from '../../wailsjs/go/models';
+import * as App from '../../wailsjs/go/main/App';
 
 export function SearchView() {
   const {
@@ -44,33 +45,32 @@ export function SearchView() {
     setSearchProgress(0);
     abortRef.current = false;
 
-    const query = localQuery.toLowerCase();
-    const results: typeof notes = [];
+    try {
+      // 在 Go 端的加密索引上搜索，不再逐条读取笔记
+      const result = await App.SearchNotes(localQuery, notesModel.SearchOptions.createFrom({ limit: 500, offset: 0 }));
+      const results = (result.hits || []).map((hit) =>
+        notesModel.Note.createFrom({ ...hit.note, content: hit.snippet || hit.note.content })
+      );
 
-    for (let i = 0; i < notes.length; i++) {
-      if (abortRef.current) break;
-
-      const note = notes[i];
-      const titleMatch = note.title?.toLowerCase().includes(query);
-      const contentMatch = note.content?.toLowerCase().includes(query);
-      const tagMatch = note.tags?.some((tag) => tag.name.toLowerCase().includes(query));
-
-      if (titleMatch || contentMatch || tagMatch) {
-        results.push(note);
+      // 标签名仍在前端匹配（标签数据已在内存中）
+      const query = localQuery.toLowerCase();
+      const seen = new Set(results.map((n) => n.id));
+      for (const note of notes) {
+        if (!seen.has(note.id) && note.tags?.some((tag) => tag.name.toLowerCase().includes(query))) {
+          results.push(note);
+        }
       }
+      setSearchProgress(100);
 
-      if (i % 50 === 0) {
-        setSearchProgress(Math.round(((i + 1) / notes.length) * 100));
-        await new Promise((r) => setTimeout(r, 0));
+      if (!abortRef.current) {
+        setSearchResults(results);
+        setSearchQuery(localQuery);
       }
+    } catch (err) {
+      console.error('Search failed:', err);
+    } finally {
+      setIsSearching(false);
     }
-    setSearchProgress(100);
-
-    if (!abortRef.current) {
-      setSearchResults(results);
-      setSearchQuery(localQuery);
-    }
-    setIsSearching(false);
   };
 
   const handleCancel = () => {
@@ -181,6 +181,7 @@ export function SearchView() {
         <p className="text-sm text-gray-500 mt-3">
           {formatMessage(t.search.shortcutTip, { shortcut: 'Cmd/Ctrl+K' })}
         </p>
+        <p className="text-xs text-gray-400 mt-1">{t.search.syntaxTip}</p>
       </div>
 
       <div className="flex-1 overflow-y-auto p-6" ref={listContainerRef}>
@@ -1,5 +1,5 @@
 import { useState, useEffect } from 'react';
-import { Settings, Key, Clock, Monitor, Moon, Folder, Info, Check, AlertCircle, Globe } from 'lucide-react';
+import { Settings, Key, Clock, Monitor, Moon, Folder, Info, Check, AlertCircle, Globe, Database, FileKey, ShieldAlert } from 'lucide-react';
 import { useStore } from '../store';
 import { formatMessage, useI18n } from '../i18n';
 import * as App from '../../wailsjs/go/main/App';
@@ -21,6 +21,20 @@ export function SettingsView() {
   const [newHint, setNewHint] = useState('');
   const [changingPassword, setChangingPassword] = useState(false);
 
+  const [dbEncrypted, setDbEncrypted] = useState(false);
+  const [dbEncryptionAvailable, setDbEncryptionAvailable] = useState(false);
+  const [showEncryptDb, setShowEncryptDb] = useState(false);
+  const [encryptDbPassword, setEncryptDbPassword] = useState('');
+  const [encryptingDb, setEncryptingDb] = useState(false);
+
+  const [keyfileRequired, setKeyfileRequired] = useState(false);
+  const [keyfileMode, setKeyfileMode] = useState<'set' | 'remove' | null>(null);
+  const [keyfilePath, setKeyfilePath] = useState('');
+  const [keyfilePassword, setKeyfilePassword] = useState('');
+  const [savingKeyfile, setSavingKeyfile] = useState(false);
+
+  const [wipeAfterFailures, setWipeAfterFailures] = useState(0);
+
   const getPasswordStrength = (password: string) => {
     if (!password) return { score: 0 as 0 | 1 | 2 | 3, label: t.common.none, color: 'bg-gray-200' };
 
@@ -50,9 +64,77 @@ export function SettingsView() {
       setAutoLockMinutes(settings.AutoLockMinutes);
       setLockOnMinimize(settings.LockOnMinimize);
       setLockOnSleep(settings.LockOnSleep);
+      setWipeAfterFailures(settings.WipeAfterFailures || 0);
     }
   }, [settings]);
 
+  useEffect(() => {
+    App.IsDatabaseEncrypted().then(setDbEncrypted);
+    App.DatabaseEncryptionAvailable().then(setDbEncryptionAvailable);
+    App.RequiresKeyfile().then(setKeyfileRequired);
+  }, []);
+
+  const closeKeyfile = () => {
+    setKeyfileMode(null);
+    setKeyfilePath('');
+    setKeyfilePassword('');
+  };
+
+  const handlePickKeyfile = async (generate: boolean) => {
+    setMessage(null);
+    try {
+      const path = generate ? await App.GenerateKeyfile() : await App.SelectKeyfile();
+      if (path) setKeyfilePath(path);
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.settings.keyfileFailed}：${String(error)}` });
+    }
+  };
+
+  const handleSaveKeyfile = async () => {
+    setMessage(null);
+    setSavingKeyfile(true);
+
+    try {
+      const path = keyfileMode === 'set' ? keyfilePath : '';
+      await App.SetKeyfile(keyfilePassword, path);
+      setKeyfileRequired(path !== '');
+      closeKeyfile();
+      setMessage({ type: 'success', text: path ? t.settings.keyfileSaved : t.settings.keyfileRemoved });
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.settings.keyfileFailed}：${String(error)}` });
+    } finally {
+      setSavingKeyfile(false);
+    }
+  };
+
+  const handleEncryptDatabase = async () => {
+    setMessage(null);
+    setEncryptingDb(true);
+
+    try {
+      await App.EnableDatabaseEncryption(encryptDbPassword);
+      setDbEncrypted(true);
+      setShowEncryptDb(false);
+      setEncryptDbPassword('');
+      setMessage({ type: 'success', text: t.settings.databaseEncryptionEnabled });
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.settings.databaseEncryptionFailed}：${String(error)}` });
+    } finally {
+      setEncryptingDb(false);
+    }
+  };
+
+  const handleWipeAfterFailures = async (n: number) => {
+    setMessage(null);
+    try {
+      await App.SetWipeAfterFailures(n);
+      setWipeAfterFailures(n);
+      setMessage({ type: 'success', text: t.settings.saved });
+    } catch (error) {
+      setMessage({ type: 'error', text: `${t.settings.saveFailed}：${String(error)}` });
+    }
+  };
+
   const handleSaveSettings = async () => {
     setSaving(true);
     setMessage(null);
@@ -216,6 +298,166 @@ export function SettingsView() {
             )}
           </div>
 
+          <div className="p-6 border border-gray-200 rounded-xl">
+            <div className="flex items-center gap-3 mb-4">
+              <FileKey className="w-5 h-5 text-accent" />
+              <h3 className="font-semibold text-gray-800">{t.settings.keyfile}</h3>
+            </div>
+            <p className="text-sm text-gray-600 mb-4">{t.settings.keyfileDesc}</p>
+
+            {!keyfileMode ? (
+              <div className="space-y-4">
+                {keyfileRequired && (
+                  <div className="flex items-center gap-2 text-sm text-green-700">
+                    <Check className="w-4 h-4" />
+                    <span>{t.settings.keyfileEnabled}</span>
+                  </div>
+                )}
+                <div className="flex gap-2">
+                  <button
+                    onClick={() => setKeyfileMode('set')}
+                    className="px-4 py-2 bg-accent text-white rounded-lg font-medium hover:bg-primary-600 transition-colors"
+                  >
+                    {keyfileRequired ? t.settings.changeKeyfile : t.settings.setKeyfile}
+                  </button>
+                  {keyfileRequired && (
+                    <button
+                      onClick={() => setKeyfileMode('remove')}
+                      className="px-4 py-2 text-gray-600 border border-gray-200 hover:bg-gray-50 rounded-lg transition-colors"
+                    >
+                      {t.settings.removeKeyfile}
+                    </button>
+                  )}
+                </div>
+              </div>
+            ) : (
+              <div className="space-y-4">
+                {keyfileMode === 'set' && (
+                  <div>
+                    <label className="block text-sm font-medium text-gray-700 mb-1">{t.auth.keyfile}</label>
+                    <div className="flex gap-2">
+                      <div className="flex-1 px-4 py-2 border border-gray-200 rounded-lg text-sm text-gray-600 truncate" title={keyfilePath}>
+                        {keyfilePath || t.auth.keyfileNone}
+                      </div>
+                      <button
+                        onClick={() => handlePickKeyfile(false)}
+                        className="px-4 py-2 border border-gray-200 rounded-lg hover:bg-gray-50 transition-colors text-sm text-gray-600"
+                      >
+                        {t.auth.keyfileSelect}
+                      </button>
+                      <button
+                        onClick={() => handlePickKeyfile(true)}
+                        className="px-4 py-2 border border-gray-200 rounded-lg hover:bg-gray-50 transition-colors text-sm text-gray-600"
+                      >
+                        {t.auth.keyfileGenerate}
+                      </button>
+                    </div>
+                  </div>
+                )}
+                <div>
+                  <label className="block text-sm font-medium text-gray-700 mb-1">{t.settings.currentPassword}</label>
+                  <input
+                    type="password"
+                    value={keyfilePassword}
+                    onChange={(e) => setKeyfilePassword(e.target.value)}
+                    className="w-full px-4 py-2 border border-gray-200 rounded-lg focus:outline-none focus:ring-2 focus:ring-accent focus:border-transparent"
+                  />
+                </div>
+                <div className="flex gap-2">
+                  <button
+                    onClick={handleSaveKeyfile}
+                    disabled={savingKeyfile || !keyfilePassword || (keyfileMode === 'set' && !keyfilePath)}
+                    className="px-4 py-2 bg-accent text-white rounded-lg font-medium hover:bg-primary-600 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
+                  >
+                    {savingKeyfile ? t.common.loading : t.common.confirm}
+                  </button>
+                  <button
+                    onClick={closeKeyfile}
+                    className="px-4 py-2 text-gray-600 hover:bg-gray-100 rounded-lg transition-colors"
+                  >
+                    {t.common.cancel}
+                  </button>
+                </div>
+              </div>
+            )}
+          </div>
+
+          <div className="p-6 border border-gray-200 rounded-xl">
+            <div className="flex items-center gap-3 mb-4">
+              <ShieldAlert className="w-5 h-5 text-accent" />
+              <h3 className="font-semibold text-gray-800">{t.settings.failedAttempts}</h3>
+            </div>
+            <p className="text-sm text-gray-600 mb-4">{t.settings.failedAttemptsDesc}</p>
+            <label className="block text-sm font-medium text-gray-700 mb-2">{t.settings.wipeAfterFailures}</label>
+            <select
+              value={wipeAfterFailures}
+              onChange={(e) => handleWipeAfterFailures(Number(e.target.value))}
+              className="w-full px-4 py-2 border border-gray-200 rounded-lg focus:outline-none focus:ring-2 focus:ring-accent focus:border-transparent"
+            >
+              <option value={0}>{t.settings.never}</option>
+              <option value={10}>{formatMessage(t.settings.failures, { count: 10 })}</option>
+              <option value={20}>{formatMessage(t.settings.failures, { count: 20 })}</option>
+              <option value={50}>{formatMessage(t.settings.failures, { count: 50 })}</option>
+            </select>
+            {wipeAfterFailures > 0 && (
+              <p className="text-xs text-red-500 mt-2">{t.settings.wipeAfterFailuresWarning}</p>
+            )}
+          </div>
+
+          <div className="p-6 border border-gray-200 rounded-xl">
+            <div className="flex items-center gap-3 mb-4">
+              <Database className="w-5 h-5 text-accent" />
+              <h3 className="font-semibold text-gray-800">{t.settings.databaseEncryption}</h3>
+            </div>
+            <p className="text-sm text-gray-600 mb-4">{t.settings.databaseEncryptionDesc}</p>
+
+            {dbEncrypted ? (
+              <div className="flex items-center gap-2 text-sm text-green-700">
+                <Check className="w-4 h-4" />
+                <span>{t.settings.databaseEncrypted}</span>
+              </div>
+            ) : !dbEncryptionAvailable ? (
+              <p className="text-sm text-gray-500">{t.settings.databaseEncryptionUnavailable}</p>
+            ) : !showEncryptDb ? (
+              <button
+                onClick={() => setShowEncryptDb(true)}
+                className="px-4 py-2 bg-accent text-white rounded-lg font-medium hover:bg-primary-600 transition-colors"
+              >
+                {t.settings.enableDatabaseEncryption}
+              </button>
+            ) : (
+              <div className="space-y-4">
+                <div>
+                  <label className="block text-sm font-medium text-gray-700 mb-1">{t.settings.currentPassword}</label>
+                  <input
+                    type="password"
+                    value={encryptDbPassword}
+                    onChange={(e) => setEncryptDbPassword(e.target.value)}
+                    className="w-full px-4 py-2 border border-gray-200 rounded-lg focus:outline-none focus:ring-2 focus:ring-accent focus:border-transparent"
+                  />
+                </div>
+                <div className="flex gap-2">
+                  <button
+                    onClick={handleEncryptDatabase}
+                    disabled={encryptingDb || !encryptDbPassword}
+                    className="px-4 py-2 bg-accent text-white rounded-lg font-medium hover:bg-primary-600 disabled:opacity-50 disabled:cursor-not-allowed transition-colors"
+                  >
+                    {encryptingDb ? t.common.loading : t.common.confirm}
+                  </button>
+                  <button
+                    onClick={() => {
+                      setShowEncryptDb(false);
+                      setEncryptDbPassword('');
+                    }}
+                    className="px-4 py-2 text-gray-600 hover:bg-gray-100 rounded-lg transition-colors"
+                  >
+                    {t.common.cancel}
+                  </button>
+                </div>
+              </div>
+            )}
+          </div>
+
           <div className="p-6 border border-gray-200 rounded-xl">
             <div className="flex items-center gap-3 mb-4">
               <Clock className="w-5 h-5 text-accent" />
@@ -1,5 +1,5 @@
 import { useState } from 'react';
-import { Lock, Eye, EyeOff, Key, AlertCircle, Check, RefreshCw } from 'lucide-react';
+import { Lock, Eye, EyeOff, Key, AlertCircle, Check, RefreshCw, FileKey, X } from 'lucide-react';
 import { useStore } from '../store';
 import { useI18n } from '../i18n';
 import * as App from '../../wailsjs/go/main/App';
@@ -13,6 +13,7 @@ export function SetupScreen() {
   const [password, setPassword] = useState('');
   const [confirmPassword, setConfirmPassword] = useState('');
   const [hint, setHint] = useState('');
+  const [keyfile, setKeyfile] = useState('');
   const [showPassword, setShowPassword] = useState(false);
   const [dataKey, setDataKey] = useState('');
   const [verifyKey, setVerifyKey] = useState('');
@@ -30,6 +31,18 @@ export function SetupScreen() {
     return result;
   };
 
+  const fileName = (path: string) => path.split(/[\\/]/).pop() || path;
+
+  const handleKeyfile = async (generate: boolean) => {
+    setError('');
+    try {
+      const path = generate ? await App.GenerateKeyfile() : await App.SelectKeyfile();
+      if (path) setKeyfile(path);
+    } catch (err) {
+      setError(String(err));
+    }
+  };
+
   const handleSetPassword = () => {
     setError('');
 
@@ -69,7 +82,7 @@ export function SetupScreen() {
 
     setLoading(true);
     try {
-      const result = await App.SetupPassword(password, hint, dataKey);
+      const result = await App.SetupPassword(password, hint, dataKey, keyfile);
       if (result) {
         setFirstRun(false);
         setUnlocked(true);
@@ -169,6 +182,42 @@ export function SetupScreen() {
               />
             </div>
 
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-1">{t.auth.keyfileOptional}</label>
+              {keyfile ? (
+                <div className="flex items-center gap-2 px-4 py-3 border border-gray-200 rounded-lg text-sm text-gray-600">
+                  <FileKey className="w-4 h-4 text-accent flex-shrink-0" />
+                  <span className="flex-1 truncate" title={keyfile}>{fileName(keyfile)}</span>
+                  <button
+                    type="button"
+                    onClick={() => setKeyfile('')}
+                    className="text-gray-400 hover:text-gray-600"
+                    title={t.auth.keyfileClear}
+                  >
+                    <X className="w-4 h-4" />
+                  </button>
+                </div>
+              ) : (
+                <div className="flex gap-2">
+                  <button
+                    type="button"
+                    onClick={() => handleKeyfile(false)}
+                    className="flex-1 px-4 py-2 border border-gray-200 rounded-lg hover:bg-gray-50 transition-colors text-sm text-gray-600"
+                  >
+                    {t.auth.keyfileSelect}
+                  </button>
+                  <button
+                    type="button"
+                    onClick={() => handleKeyfile(true)}
+                    className="flex-1 px-4 py-2 border border-gray-200 rounded-lg hover:bg-gray-50 transition-colors text-sm text-gray-600"
+                  >
+                    {t.auth.keyfileGenerate}
+                  </button>
+                </div>
+              )}
+              <p className="text-xs text-gray-500 mt-1">{t.auth.keyfileDesc}</p>
+            </div>
+
             {error && (
               <div className="flex items-center gap-2 text-red-500 text-sm">
                 <AlertCircle className="w-4 h-4" />
@@ -131,10 +131,10 @@ export function TrashView() {
                 <div className="flex items-start justify-between">
                   <div className="flex-1 min-w-0">
                     <h3 className="font-medium text-gray-800 truncate">
-                      {note.title || t.noteList.untitled}
+                      {note.locked ? t.noteList.lockedNote : note.title || t.noteList.untitled}
                     </h3>
                     <p className="text-sm text-gray-500 mt-1 line-clamp-2">
-                      {note.content?.substring(0, 100) || t.noteList.noContent}
+                      {note.locked ? t.noteList.lockedNoteDesc : note.content?.substring(0, 100) || t.noteList.noContent}
                     </p>
                     <p className="text-xs text-gray-400 mt-2">
                       {t.trash.deletedAt} {formatDate(note.deletedAt)}
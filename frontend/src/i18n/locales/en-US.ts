@@ -78,6 +78,21 @@ export const enUS: Translations = {
     tag: 'Tag',
     clearFilter: 'Clear filter',
     notebookNamePlaceholder: 'Enter notebook name',
+    lockedNote: 'Locked note',
+    lockedNoteDesc: 'Unlock the notebook to view',
+    protectNotebook: 'Set password',
+    unprotectNotebook: 'Remove password',
+    lockNotebook: 'Lock now',
+    unlockNotebook: 'Unlock',
+    protectNotebookTitle: 'Set a notebook password',
+    protectNotebookDesc: 'Notes in this notebook will be encrypted with the notebook password. They stay hidden until you enter it, even while the app is unlocked, and relock after 5 idle minutes. If you forget this password these notes cannot be recovered, not even with the recovery key. Tags and attachments are not covered by this password, and protected notes do not appear in search results.',
+    unprotectNotebookTitle: 'Remove notebook password',
+    unprotectNotebookDesc: 'Notes in this notebook will be encrypted with the data key again and readable whenever the app is unlocked.',
+    unlockNotebookTitle: 'Unlock notebook "{name}"',
+    notebookPasswordPlaceholder: 'Notebook password',
+    notebookPasswordConfirmPlaceholder: 'Enter the notebook password again',
+    notebookPasswordMismatch: 'Passwords do not match',
+    notebookProtectedDeleteTip: 'Remove the password before deleting a protected notebook',
   },
 
   // Note Editor
@@ -93,7 +108,10 @@ export const enUS: Translations = {
     noTags: 'No tags',
     history: 'History',
     export: 'Export',
+    exportHTML: 'Export as HTML (printable to PDF)',
     selectNote: 'Select a note to edit',
+    lockedNote: 'This note is in a locked notebook',
+    lockedNoteTip: 'Enter the notebook password to view and edit it',
     selectNoteTip: 'Select a note from the list or create a new one',
     lastEdited: 'Last edited',
     historyTitle: 'Version History',
@@ -112,6 +130,7 @@ export const enUS: Translations = {
     resultsCount: 'Found {count} results',
     startSearch: 'Enter keywords to search',
     shortcutTip: 'Press {shortcut} to quick search',
+    syntaxTip: 'Words match whole words; the last word and words ending in * also match word beginnings. Use "..." for an exact phrase.',
   },
 
   // Tags
@@ -163,6 +182,16 @@ export const enUS: Translations = {
     exportMarkdownDesc: 'Export current note as a Markdown file',
     importMarkdown: 'Import Markdown',
     importMarkdownDesc: 'Import notes from Markdown files',
+    importFolder: 'Import Folder (Obsidian / Logseq)',
+    importedFolderCount: 'Imported {count} notes and {attachments} attachments, skipped {duplicates} already present, {failed} failed',
+    importExternal: 'Import from Evernote / Joplin',
+    importExternalDesc: 'Import Evernote .enex or Joplin .jex exports, including notebooks, tags and attachments',
+    importEvernote: 'Evernote',
+    importJoplin: 'Joplin',
+    dryRun: 'Dry run (check without writing)',
+    externalDryRunResult: 'Dry run: would import {count} notes and {attachments} attachments, create {notebooks} notebooks and {tags} tags; {issues} issues',
+    externalImportResult: 'Imported {count} notes and {attachments} attachments, created {notebooks} notebooks and {tags} tags; {issues} issues',
+    importIssuesTitle: 'These items could not be fully imported',
     backupSuccess: 'Backup successful',
     backupFailed: 'Backup failed',
     restoreSuccess: 'Restore successful',
@@ -173,7 +202,23 @@ export const enUS: Translations = {
     dataKeyPlaceholder: 'Enter the data key of the backup file',
     dataKeyTip: 'The data key was shown when you first set your password. Please keep it safe.',
     dataKeyRequired: 'Please enter the data key',
-    importedCount: 'Successfully imported {count} notes',
+    importedCount: 'Imported {count} notes, skipped {duplicates} already present, {failed} could not be decrypted',
+    exportVault: 'Export All Notes',
+    exportVaultDesc: 'Export notes as Markdown files in notebook folders, or as one HTML file with a table of contents that prints to PDF (unencrypted)',
+    exportWarning: 'Exported files are NOT encrypted. Anyone who can access them can read your notes. Keep them safe and delete them when done.',
+    exportScope: 'Scope',
+    exportAllNotes: 'All notes',
+    exportFormat: 'Format',
+    exportFormatMarkdown: 'Markdown files',
+    exportFormatHTML: 'Single HTML file (printable to PDF)',
+    exportEmbedImages: 'Embed images',
+    exportAttachments: 'Include attachments',
+    exportZip: 'Pack into a single zip file',
+    exportPasswordPlaceholder: 'Enter your master password to confirm',
+    exportPasswordRequired: 'Please enter your master password',
+    exportedCount: 'Exported {count} notes and {attachments} attachments to {path}',
+    exportLockedSkipped: ' ({count} notes in locked notebooks were not exported)',
+    exportFailed: 'Export failed',
     securityTipTitle: 'Security Tips',
     securityTip1: 'Backup files contain encrypted data and require the original password to decrypt',
     securityTip2: 'Back up regularly and store backup files in a safe place',
@@ -203,6 +248,33 @@ export const enUS: Translations = {
     strengthMedium: 'Medium',
     strengthStrong: 'Strong',
 
+    // Database Encryption
+    databaseEncryption: 'Database Encryption',
+    databaseEncryptionDesc: 'Encrypt the whole database file so that metadata such as note timestamps, counts and tag assignments is no longer stored in plaintext. This cannot be turned off, and only builds with database encryption support can open the data afterwards.',
+    databaseEncrypted: 'The database is encrypted',
+    databaseEncryptionUnavailable: 'This build does not support database encryption (build with -tags sqlcipher)',
+    enableDatabaseEncryption: 'Enable database encryption',
+    databaseEncryptionEnabled: 'The database is now encrypted',
+    databaseEncryptionFailed: 'Failed to enable database encryption',
+
+    // Keyfile
+    keyfile: 'Keyfile',
+    keyfileDesc: 'Require a file in addition to the master password to unlock. Use any file that never changes, or generate a random one and keep it on a USB stick. If it is lost, the password can only be reset with the data key.',
+    keyfileEnabled: 'A keyfile is required to unlock',
+    setKeyfile: 'Set Keyfile',
+    changeKeyfile: 'Change Keyfile',
+    removeKeyfile: 'Remove Keyfile',
+    keyfileSaved: 'Keyfile updated',
+    keyfileRemoved: 'Keyfile removed; only the master password is needed to unlock',
+    keyfileFailed: 'Failed to update keyfile',
+
+    // Failed Attempts
+    failedAttempts: 'Failed Attempts',
+    failedAttemptsDesc: 'After 3 consecutive failed attempts to unlock or enter the data key, the wait before the next attempt doubles with each failure, up to 1 hour. The failure count is stored in the data directory and only detects edits to the count itself; someone who can replace the whole data directory can still reset it.',
+    wipeAfterFailures: 'Erase all data after consecutive failures',
+    failures: '{count} failures',
+    wipeAfterFailuresWarning: 'When the limit is reached, the notes, attachments and history in the data directory are permanently deleted and cannot be recovered with the data key. The scheduled backup directory is not affected.',
+
     // Auto Lock
     autoLock: 'Auto Lock',
     autoLockTime: 'Auto lock after idle',
@@ -284,6 +356,16 @@ export const enUS: Translations = {
     resetFailed: 'Reset failed',
     setupFailed: 'Failed to set password',
     verifyFailed: 'Verification failed',
+    keyfile: 'Keyfile',
+    keyfileOptional: 'Keyfile (optional)',
+    keyfileDesc: 'Unlocking will require this file in addition to the password. Keep a backup: if the file is lost or modified, the password can only be reset with the data key.',
+    keyfileSelect: 'Choose file',
+    keyfileGenerate: 'Generate random file',
+    keyfileClear: 'Don\'t use a keyfile',
+    keyfileNone: 'No keyfile selected',
+    wrongPasswordOrKeyfile: 'Wrong password or keyfile',
+    throttled: 'Too many failed attempts. Try again in {seconds} seconds',
+    wipeWarning: 'All data will be erased after {count} more failed attempts',
   },
 
   // Command Palette
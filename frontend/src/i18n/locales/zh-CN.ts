@@ -76,6 +76,21 @@ export const zhCN = {
     tag: '标签',
     clearFilter: '清除筛选',
     notebookNamePlaceholder: '请输入笔记本名称',
+    lockedNote: '已锁定的笔记',
+    lockedNoteDesc: '解锁笔记本后查看',
+    protectNotebook: '设置密码',
+    unprotectNotebook: '取消密码',
+    lockNotebook: '立即锁定',
+    unlockNotebook: '解锁',
+    protectNotebookTitle: '为笔记本设置密码',
+    protectNotebookDesc: '其中的笔记将改用笔记本密码加密，应用解锁后仍需输入此密码才能查看，空闲 5 分钟后自动锁定。忘记此密码后这些笔记无法恢复，恢复密钥也无法解开。标签与附件不受此密码保护，受保护的笔记也不会出现在搜索结果中。',
+    unprotectNotebookTitle: '取消笔记本密码',
+    unprotectNotebookDesc: '其中的笔记将重新使用数据密钥加密，应用解锁后即可查看。',
+    unlockNotebookTitle: '解锁笔记本“{name}”',
+    notebookPasswordPlaceholder: '笔记本密码',
+    notebookPasswordConfirmPlaceholder: '再次输入笔记本密码',
+    notebookPasswordMismatch: '两次输入的密码不一致',
+    notebookProtectedDeleteTip: '受保护的笔记本需要先取消密码才能删除',
   },
 
   // 笔记编辑器
@@ -91,7 +106,10 @@ export const zhCN = {
     noTags: '无标签',
     history: '历史版本',
     export: '导出',
+    exportHTML: '导出为 HTML（可打印为 PDF）',
     selectNote: '选择一篇笔记开始编辑',
+    lockedNote: '这篇笔记所在的笔记本已锁定',
+    lockedNoteTip: '输入笔记本密码后查看与编辑',
     selectNoteTip: '从左侧列表选择笔记，或创建新笔记',
     lastEdited: '最后编辑于',
     historyTitle: '历史版本',
@@ -110,6 +128,7 @@ export const zhCN = {
     resultsCount: '找到 {count} 条结果',
     startSearch: '输入关键词开始搜索',
     shortcutTip: '按 {shortcut} 快速打开搜索',
+    syntaxTip: '英文等按整词匹配，最后一个词与以 * 结尾的词也匹配词的开头；用 "..." 搜索完整短语。',
   },
 
   // 标签
@@ -161,6 +180,16 @@ export const zhCN = {
     exportMarkdownDesc: '将当前笔记导出为 Markdown 文件',
     importMarkdown: '导入 Markdown',
     importMarkdownDesc: '从 Markdown 文件导入笔记',
+    importFolder: '导入文件夹（Obsidian / Logseq）',
+    importedFolderCount: '成功导入 {count} 篇笔记和 {attachments} 个附件，跳过已存在的 {duplicates} 篇，{failed} 篇失败',
+    importExternal: '从 Evernote / Joplin 导入',
+    importExternalDesc: '导入 Evernote 的 .enex 或 Joplin 的 .jex 导出文件，包括笔记本、标签与附件',
+    importEvernote: 'Evernote',
+    importJoplin: 'Joplin',
+    dryRun: '仅试运行（检查但不写入）',
+    externalDryRunResult: '试运行：将导入 {count} 篇笔记和 {attachments} 个附件，新建 {notebooks} 个笔记本、{tags} 个标签；{issues} 个问题',
+    externalImportResult: '成功导入 {count} 篇笔记和 {attachments} 个附件，新建 {notebooks} 个笔记本、{tags} 个标签；{issues} 个问题',
+    importIssuesTitle: '以下条目未能完整导入',
     backupSuccess: '备份成功',
     backupFailed: '备份失败',
     restoreSuccess: '恢复成功',
@@ -171,7 +200,23 @@ export const zhCN = {
     dataKeyPlaceholder: '请输入备份文件的数据密钥',
     dataKeyTip: '数据密钥在首次设置密码时显示，请妥善保管',
     dataKeyRequired: '请输入数据密钥',
-    importedCount: '成功导入 {count} 篇笔记',
+    importedCount: '成功导入 {count} 篇笔记，跳过已存在的 {duplicates} 篇，{failed} 篇无法解密',
+    exportVault: '导出全部笔记',
+    exportVaultDesc: '将笔记导出为按笔记本分目录的 Markdown 文件，或带目录、可打印为 PDF 的 HTML 文件（未加密）',
+    exportWarning: '导出的文件未加密，任何能访问它们的人都能读取你的笔记。请妥善保管，使用后彻底删除。',
+    exportScope: '导出范围',
+    exportAllNotes: '全部笔记',
+    exportFormat: '格式',
+    exportFormatMarkdown: 'Markdown 文件',
+    exportFormatHTML: '单个 HTML 文件（可打印为 PDF）',
+    exportEmbedImages: '嵌入图片',
+    exportAttachments: '包含附件',
+    exportZip: '打包为单个 zip 文件',
+    exportPasswordPlaceholder: '请输入主密码以确认导出',
+    exportPasswordRequired: '请输入主密码',
+    exportedCount: '已导出 {count} 篇笔记、{attachments} 个附件到 {path}',
+    exportLockedSkipped: '（{count} 篇笔记所在的笔记本已锁定，未导出）',
+    exportFailed: '导出失败',
     securityTipTitle: '安全提示',
     securityTip1: '备份文件包含加密数据，需要原密码才能解密',
     securityTip2: '建议定期备份并将备份文件存储在安全位置',
@@ -201,6 +246,33 @@ export const zhCN = {
     strengthMedium: '中',
     strengthStrong: '强',
 
+    // 整库加密
+    databaseEncryption: '整库加密',
+    databaseEncryptionDesc: '把数据库文件整体加密，笔记的时间、数量、标签关联等元数据也不再以明文保存。开启后不能关闭，且只有支持整库加密的版本才能打开这份数据。',
+    databaseEncrypted: '数据库已整体加密',
+    databaseEncryptionUnavailable: '此版本不支持整库加密（需要以 -tags sqlcipher 构建）',
+    enableDatabaseEncryption: '开启整库加密',
+    databaseEncryptionEnabled: '数据库已整体加密',
+    databaseEncryptionFailed: '开启整库加密失败',
+
+    // 密钥文件
+    keyfile: '密钥文件',
+    keyfileDesc: '解锁时除主密码外还需要一个文件，可以是任意不会被修改的文件，或生成一个随机文件保存到 U 盘。丢失后只能用数据密钥重置密码。',
+    keyfileEnabled: '解锁需要密钥文件',
+    setKeyfile: '设置密钥文件',
+    changeKeyfile: '更换密钥文件',
+    removeKeyfile: '取消密钥文件',
+    keyfileSaved: '密钥文件已更新',
+    keyfileRemoved: '已取消密钥文件，解锁只需要主密码',
+    keyfileFailed: '更新密钥文件失败',
+
+    // 失败保护
+    failedAttempts: '失败保护',
+    failedAttemptsDesc: '解锁或输入数据密钥连续失败 3 次后，每次失败需要等待的时间加倍，最长 1 小时。失败计数保存在数据目录中，只能发现对计数本身的改动；能替换整个数据目录的人仍可以重置计数。',
+    wipeAfterFailures: '连续失败后清除全部数据',
+    failures: '{count} 次',
+    wipeAfterFailuresWarning: '达到次数后数据目录中的笔记、附件与历史记录将被永久删除，且无法用数据密钥恢复。定时备份目录不受影响。',
+
     // 自动锁定
     autoLock: '自动锁定',
     autoLockTime: '空闲自动锁定时间',
@@ -282,6 +354,16 @@ export const zhCN = {
     resetFailed: '重置失败',
     setupFailed: '设置密码失败',
     verifyFailed: '验证失败',
+    keyfile: '密钥文件',
+    keyfileOptional: '密钥文件（可选）',
+    keyfileDesc: '设置后解锁时除密码外还需要该文件。请另外备份，文件丢失或被修改后只能用数据密钥重置密码。',
+    keyfileSelect: '选择文件',
+    keyfileGenerate: '生成随机文件',
+    keyfileClear: '不使用密钥文件',
+    keyfileNone: '未选择密钥文件',
+    wrongPasswordOrKeyfile: '密码或密钥文件错误',
+    throttled: '失败次数过多，请在 {seconds} 秒后重试',
+    wipeWarning: '再失败 {count} 次将清除全部数据',
   },
 
   // 命令面板
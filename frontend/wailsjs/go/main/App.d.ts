@@ -6,6 +6,11 @@ import {smartviews} from '../models';
 import {tags} from '../models';
 import {database} from '../models';
 import {core} from '../models';
+import {attachments} from '../models';
+import {sync} from '../models';
+import {backup} from '../models';
+
+export function AddAttachments(arg1:string):Promise<Array<attachments.Attachment>>;
 
 export function AddTagToNote(arg1:string,arg2:string):Promise<void>;
 
@@ -15,8 +20,14 @@ export function BatchDeleteNotes(arg1:Array<string>):Promise<void>;
 
 export function ChangePassword(arg1:string,arg2:string,arg3:string):Promise<void>;
 
+export function ChooseBackupDirectory():Promise<string>;
+
+export function CloseBackupNotes():Promise<void>;
+
 export function CreateBackup():Promise<string>;
 
+export function CreateBackupWithPassphrase(arg1:string):Promise<string>;
+
 export function CreateNote(arg1:string,arg2:string):Promise<notes.Note>;
 
 export function CreateNotebook(arg1:string,arg2:string):Promise<notebooks.Notebook>;
@@ -25,6 +36,8 @@ export function CreateSmartView(arg1:string,arg2:string,arg3:smartviews.Filter):
 
 export function CreateTag(arg1:string,arg2:string):Promise<tags.Tag>;
 
+export function DatabaseEncryptionAvailable():Promise<boolean>;
+
 export function DeleteNote(arg1:string):Promise<void>;
 
 export function DeleteNotebook(arg1:string):Promise<void>;
@@ -33,10 +46,26 @@ export function DeleteSmartView(arg1:string):Promise<void>;
 
 export function DeleteTag(arg1:string):Promise<void>;
 
+export function DiscardRestoreSnapshot():Promise<void>;
+
+export function EnableDatabaseEncryption(arg1:string):Promise<void>;
+
+export function ExportAttachment(arg1:string):Promise<string>;
+
+export function ExportHTML(arg1:string,arg2:core.ExportOptions):Promise<core.ExportResult>;
+
+export function ExportMarkdown(arg1:string,arg2:core.ExportOptions):Promise<core.ExportResult>;
+
+export function ExportNoteAsHTML(arg1:string):Promise<string>;
+
 export function ExportNoteAsMarkdown(arg1:string):Promise<string>;
 
 export function GenerateDataKey():Promise<string>;
 
+export function GenerateKeyfile():Promise<string>;
+
+export function GetBackupNote(arg1:string):Promise<notes.Note>;
+
 export function GetDataDir():Promise<string>;
 
 export function GetNote(arg1:string):Promise<notes.Note>;
@@ -49,16 +78,30 @@ export function GetSettings():Promise<database.Settings>;
 
 export function GetSmartView(arg1:string):Promise<smartviews.SmartView>;
 
+export function GetUnlockThrottle():Promise<core.UnlockThrottleStatus>;
+
 export function GetVersion():Promise<string>;
 
-export function ImportBackupWithKey(arg1:string):Promise<number>;
+export function ImportBackupWithKey(arg1:string):Promise<core.ImportReport>;
+
+export function ImportEvernote(arg1:boolean):Promise<core.ExternalImportReport>;
+
+export function ImportJoplin(arg1:boolean):Promise<core.ExternalImportReport>;
 
 export function ImportMarkdown():Promise<notes.Note>;
 
+export function ImportMarkdownFolder():Promise<core.MarkdownImportReport>;
+
+export function IsDatabaseEncrypted():Promise<boolean>;
+
 export function IsFirstRun():Promise<boolean>;
 
 export function IsUnlocked():Promise<boolean>;
 
+export function LastRestore():Promise<core.RestoreInfo>;
+
+export function ListAttachments(arg1:string):Promise<Array<attachments.Attachment>>;
+
 export function ListDeletedNotes():Promise<Array<notes.Note>>;
 
 export function ListNotebooks():Promise<Array<notebooks.Notebook>>;
@@ -73,22 +116,56 @@ export function ListTags():Promise<Array<tags.Tag>>;
 
 export function Lock():Promise<void>;
 
+export function LockNotebook(arg1:string):Promise<void>;
+
 export function MigrateOldNotes():Promise<number>;
 
+export function OpenAttachment(arg1:string):Promise<void>;
+
+export function OpenBackupNotes(arg1:string,arg2:string):Promise<Array<core.BackupNote>>;
+
+export function ProtectNotebook(arg1:string,arg2:string):Promise<void>;
+
+export function RebuildSearchIndex():Promise<number>;
+
+export function RemoveAttachment(arg1:string):Promise<void>;
+
 export function RemoveTagFromNote(arg1:string,arg2:string):Promise<void>;
 
 export function ReorderNotebooks(arg1:Array<string>):Promise<void>;
 
 export function ReorderNotes(arg1:Array<string>):Promise<void>;
 
+export function RepairData(arg1:core.RepairOptions):Promise<core.VerifyReport>;
+
+export function RequiresKeyfile():Promise<boolean>;
+
 export function ResetPasswordWithDataKey(arg1:string,arg2:string,arg3:string):Promise<void>;
 
-export function RestoreBackup():Promise<void>;
+export function ResolveSmartView(arg1:string,arg2:number,arg3:number):Promise<notes.ListResult>;
+
+export function RestoreBackup():Promise<core.RestoreResult>;
+
+export function RestoreBackupWithPassphrase(arg1:string):Promise<core.RestoreResult>;
 
 export function RestoreNote(arg1:string):Promise<void>;
 
 export function RestoreNoteFromHistory(arg1:string,arg2:string):Promise<notes.Note>;
 
+export function RestoreNotesFromBackup(arg1:Array<string>,arg2:boolean):Promise<core.NotesRestoreResult>;
+
+export function RollbackRestore():Promise<void>;
+
+export function RotateDataKey(arg1:string):Promise<core.RotateResult>;
+
+export function RunScheduledBackup():Promise<backup.ScheduledResult>;
+
+export function SearchNotes(arg1:string,arg2:notes.SearchOptions):Promise<notes.SearchResult>;
+
+export function SelectKeyfile():Promise<string>;
+
+export function SetKeyfile(arg1:string,arg2:string):Promise<void>;
+
 export function SetNoteNotebook(arg1:string,arg2:any):Promise<void>;
 
 export function SetNotePinned(arg1:string,arg2:boolean):Promise<void>;
@@ -97,14 +174,26 @@ export function SetNotebookPinned(arg1:string,arg2:boolean):Promise<void>;
 
 export function SetNotesNotebook(arg1:Array<string>,arg2:any):Promise<void>;
 
-export function SetupPassword(arg1:string,arg2:string,arg3:string):Promise<core.SetupResult>;
+export function SetWipeAfterFailures(arg1:number):Promise<void>;
+
+export function SetupPassword(arg1:string,arg2:string,arg3:string,arg4:string):Promise<core.SetupResult>;
 
 export function SoftDeleteNote(arg1:string):Promise<void>;
 
-export function Unlock(arg1:string):Promise<boolean>;
+export function SyncWithFolder():Promise<sync.Report>;
+
+export function TakeRotatedDataKey():Promise<string>;
+
+export function Unlock(arg1:string,arg2:string):Promise<boolean>;
+
+export function UnlockNotebook(arg1:string,arg2:string):Promise<void>;
+
+export function UnprotectNotebook(arg1:string,arg2:string):Promise<void>;
 
 export function UpdateActivity():Promise<void>;
 
+export function UpdateBackupSchedule(arg1:number,arg2:string,arg3:number,arg4:number):Promise<void>;
+
 export function UpdateNote(arg1:string,arg2:string,arg3:string):Promise<notes.Note>;
 
 export function UpdateNotebook(arg1:string,arg2:string,arg3:string):Promise<notebooks.Notebook>;
@@ -115,4 +204,8 @@ export function UpdateSmartView(arg1:string,arg2:string,arg3:string,arg4:smartvi
 
 export function UpdateTag(arg1:string,arg2:string,arg3:string):Promise<tags.Tag>;
 
+export function VerifyBackup(arg1:string):Promise<backup.BackupInfo>;
+
+export function VerifyData():Promise<core.VerifyReport>;
+
 export function VerifyDataKey(arg1:string):Promise<boolean>;
@@ -2,6 +2,10 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddAttachments(arg1) {
+  return window['go']['main']['App']['AddAttachments'](arg1);
+}
+
 export function AddTagToNote(arg1, arg2) {
   return window['go']['main']['App']['AddTagToNote'](arg1, arg2);
 }
@@ -18,10 +22,22 @@ export function ChangePassword(arg1, arg2, arg3) {
   return window['go']['main']['App']['ChangePassword'](arg1, arg2, arg3);
 }
 
+export function ChooseBackupDirectory() {
+  return window['go']['main']['App']['ChooseBackupDirectory']();
+}
+
+export function CloseBackupNotes() {
+  return window['go']['main']['App']['CloseBackupNotes']();
+}
+
 export function CreateBackup() {
   return window['go']['main']['App']['CreateBackup']();
 }
 
+export function CreateBackupWithPassphrase(arg1) {
+  return window['go']['main']['App']['CreateBackupWithPassphrase'](arg1);
+}
+
 export function CreateNote(arg1, arg2) {
   return window['go']['main']['App']['CreateNote'](arg1, arg2);
 }
@@ -38,6 +54,10 @@ export function CreateTag(arg1, arg2) {
   return window['go']['main']['App']['CreateTag'](arg1, arg2);
 }
 
+export function DatabaseEncryptionAvailable() {
+  return window['go']['main']['App']['DatabaseEncryptionAvailable']();
+}
+
 export function DeleteNote(arg1) {
   return window['go']['main']['App']['DeleteNote'](arg1);
 }
@@ -54,6 +74,30 @@ export function DeleteTag(arg1) {
   return window['go']['main']['App']['DeleteTag'](arg1);
 }
 
+export function DiscardRestoreSnapshot() {
+  return window['go']['main']['App']['DiscardRestoreSnapshot']();
+}
+
+export function EnableDatabaseEncryption(arg1) {
+  return window['go']['main']['App']['EnableDatabaseEncryption'](arg1);
+}
+
+export function ExportAttachment(arg1) {
+  return window['go']['main']['App']['ExportAttachment'](arg1);
+}
+
+export function ExportHTML(arg1, arg2) {
+  return window['go']['main']['App']['ExportHTML'](arg1, arg2);
+}
+
+export function ExportMarkdown(arg1, arg2) {
+  return window['go']['main']['App']['ExportMarkdown'](arg1, arg2);
+}
+
+export function ExportNoteAsHTML(arg1) {
+  return window['go']['main']['App']['ExportNoteAsHTML'](arg1);
+}
+
 export function ExportNoteAsMarkdown(arg1) {
   return window['go']['main']['App']['ExportNoteAsMarkdown'](arg1);
 }
@@ -62,6 +106,14 @@ export function GenerateDataKey() {
   return window['go']['main']['App']['GenerateDataKey']();
 }
 
+export function GenerateKeyfile() {
+  return window['go']['main']['App']['GenerateKeyfile']();
+}
+
+export function GetBackupNote(arg1) {
+  return window['go']['main']['App']['GetBackupNote'](arg1);
+}
+
 export function GetDataDir() {
   return window['go']['main']['App']['GetDataDir']();
 }
@@ -86,6 +138,10 @@ export function GetSmartView(arg1) {
   return window['go']['main']['App']['GetSmartView'](arg1);
 }
 
+export function GetUnlockThrottle() {
+  return window['go']['main']['App']['GetUnlockThrottle']();
+}
+
 export function GetVersion() {
   return window['go']['main']['App']['GetVersion']();
 }
@@ -94,10 +150,26 @@ export function ImportBackupWithKey(arg1) {
   return window['go']['main']['App']['ImportBackupWithKey'](arg1);
 }
 
+export function ImportEvernote(arg1) {
+  return window['go']['main']['App']['ImportEvernote'](arg1);
+}
+
+export function ImportJoplin(arg1) {
+  return window['go']['main']['App']['ImportJoplin'](arg1);
+}
+
 export function ImportMarkdown() {
   return window['go']['main']['App']['ImportMarkdown']();
 }
 
+export function ImportMarkdownFolder() {
+  return window['go']['main']['App']['ImportMarkdownFolder']();
+}
+
+export function IsDatabaseEncrypted() {
+  return window['go']['main']['App']['IsDatabaseEncrypted']();
+}
+
 export function IsFirstRun() {
   return window['go']['main']['App']['IsFirstRun']();
 }
@@ -106,6 +178,14 @@ export function IsUnlocked() {
   return window['go']['main']['App']['IsUnlocked']();
 }
 
+export function LastRestore() {
+  return window['go']['main']['App']['LastRestore']();
+}
+
+export function ListAttachments(arg1) {
+  return window['go']['main']['App']['ListAttachments'](arg1);
+}
+
 export function ListDeletedNotes() {
   return window['go']['main']['App']['ListDeletedNotes']();
 }
@@ -134,10 +214,34 @@ export function Lock() {
   return window['go']['main']['App']['Lock']();
 }
 
+export function LockNotebook(arg1) {
+  return window['go']['main']['App']['LockNotebook'](arg1);
+}
+
 export function MigrateOldNotes() {
   return window['go']['main']['App']['MigrateOldNotes']();
 }
 
+export function OpenAttachment(arg1) {
+  return window['go']['main']['App']['OpenAttachment'](arg1);
+}
+
+export function OpenBackupNotes(arg1, arg2) {
+  return window['go']['main']['App']['OpenBackupNotes'](arg1, arg2);
+}
+
+export function ProtectNotebook(arg1, arg2) {
+  return window['go']['main']['App']['ProtectNotebook'](arg1, arg2);
+}
+
+export function RebuildSearchIndex() {
+  return window['go']['main']['App']['RebuildSearchIndex']();
+}
+
+export function RemoveAttachment(arg1) {
+  return window['go']['main']['App']['RemoveAttachment'](arg1);
+}
+
 export function RemoveTagFromNote(arg1, arg2) {
   return window['go']['main']['App']['RemoveTagFromNote'](arg1, arg2);
 }
@@ -150,14 +254,30 @@ export function ReorderNotes(arg1) {
   return window['go']['main']['App']['ReorderNotes'](arg1);
 }
 
+export function RepairData(arg1) {
+  return window['go']['main']['App']['RepairData'](arg1);
+}
+
+export function RequiresKeyfile() {
+  return window['go']['main']['App']['RequiresKeyfile']();
+}
+
 export function ResetPasswordWithDataKey(arg1, arg2, arg3) {
   return window['go']['main']['App']['ResetPasswordWithDataKey'](arg1, arg2, arg3);
 }
 
+export function ResolveSmartView(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ResolveSmartView'](arg1, arg2, arg3);
+}
+
 export function RestoreBackup() {
   return window['go']['main']['App']['RestoreBackup']();
 }
 
+export function RestoreBackupWithPassphrase(arg1) {
+  return window['go']['main']['App']['RestoreBackupWithPassphrase'](arg1);
+}
+
 export function RestoreNote(arg1) {
   return window['go']['main']['App']['RestoreNote'](arg1);
 }
@@ -166,6 +286,34 @@ export function RestoreNoteFromHistory(arg1, arg2) {
   return window['go']['main']['App']['RestoreNoteFromHistory'](arg1, arg2);
 }
 
+export function RestoreNotesFromBackup(arg1, arg2) {
+  return window['go']['main']['App']['RestoreNotesFromBackup'](arg1, arg2);
+}
+
+export function RollbackRestore() {
+  return window['go']['main']['App']['RollbackRestore']();
+}
+
+export function RotateDataKey(arg1) {
+  return window['go']['main']['App']['RotateDataKey'](arg1);
+}
+
+export function RunScheduledBackup() {
+  return window['go']['main']['App']['RunScheduledBackup']();
+}
+
+export function SearchNotes(arg1, arg2) {
+  return window['go']['main']['App']['SearchNotes'](arg1, arg2);
+}
+
+export function SelectKeyfile() {
+  return window['go']['main']['App']['SelectKeyfile']();
+}
+
+export function SetKeyfile(arg1, arg2) {
+  return window['go']['main']['App']['SetKeyfile'](arg1, arg2);
+}
+
 export function SetNoteNotebook(arg1, arg2) {
   return window['go']['main']['App']['SetNoteNotebook'](arg1, arg2);
 }
@@ -182,22 +330,46 @@ export function SetNotesNotebook(arg1, arg2) {
   return window['go']['main']['App']['SetNotesNotebook'](arg1, arg2);
 }
 
-export function SetupPassword(arg1, arg2, arg3) {
-  return window['go']['main']['App']['SetupPassword'](arg1, arg2, arg3);
+export function SetWipeAfterFailures(arg1) {
+  return window['go']['main']['App']['SetWipeAfterFailures'](arg1);
+}
+
+export function SetupPassword(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['SetupPassword'](arg1, arg2, arg3, arg4);
 }
 
 export function SoftDeleteNote(arg1) {
   return window['go']['main']['App']['SoftDeleteNote'](arg1);
 }
 
-export function Unlock(arg1) {
-  return window['go']['main']['App']['Unlock'](arg1);
+export function SyncWithFolder() {
+  return window['go']['main']['App']['SyncWithFolder']();
+}
+
+export function TakeRotatedDataKey() {
+  return window['go']['main']['App']['TakeRotatedDataKey']();
+}
+
+export function Unlock(arg1, arg2) {
+  return window['go']['main']['App']['Unlock'](arg1, arg2);
+}
+
+export function UnlockNotebook(arg1, arg2) {
+  return window['go']['main']['App']['UnlockNotebook'](arg1, arg2);
+}
+
+export function UnprotectNotebook(arg1, arg2) {
+  return window['go']['main']['App']['UnprotectNotebook'](arg1, arg2);
 }
 
 export function UpdateActivity() {
   return window['go']['main']['App']['UpdateActivity']();
 }
 
+export function UpdateBackupSchedule(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['UpdateBackupSchedule'](arg1, arg2, arg3, arg4);
+}
+
 export function UpdateNote(arg1, arg2, arg3) {
   return window['go']['main']['App']['UpdateNote'](arg1, arg2, arg3);
 }
@@ -218,6 +390,14 @@ export function UpdateTag(arg1, arg2, arg3) {
   return window['go']['main']['App']['UpdateTag'](arg1, arg2, arg3);
 }
 
+export function VerifyBackup(arg1) {
+  return window['go']['main']['App']['VerifyBackup'](arg1);
+}
+
+export function VerifyData() {
+  return window['go']['main']['App']['VerifyData']();
+}
+
 export function VerifyDataKey(arg1) {
   return window['go']['main']['App']['VerifyDataKey'](arg1);
 }
@@ -1,3 +1,77 @@
+export namespace attachments {
+	
+	export class Attachment {
+	    id: string;
+	    noteId: string;
+	    filename: string;
+	    mime: string;
+	    size: number;
+	    sha256: string;
+	    createdAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Attachment(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.noteId = source["noteId"];
+	        this.filename = source["filename"];
+	        this.mime = source["mime"];
+	        this.size = source["size"];
+	        this.sha256 = source["sha256"];
+	        this.createdAt = source["createdAt"];
+	    }
+	}
+
+}
+
+export namespace backup {
+	
+	export class BackupInfo {
+	    format: string;
+	    keySource?: string;
+	    createdAt?: string;
+	    entries: number;
+	    size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.format = source["format"];
+	        this.keySource = source["keySource"];
+	        this.createdAt = source["createdAt"];
+	        this.entries = source["entries"];
+	        this.size = source["size"];
+	    }
+	}
+	export class ScheduledResult {
+	    time: string;
+	    path?: string;
+	    skipped?: string;
+	    removed?: string[];
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ScheduledResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.time = source["time"];
+	        this.path = source["path"];
+	        this.skipped = source["skipped"];
+	        this.removed = source["removed"];
+	        this.error = source["error"];
+	    }
+	}
+
+}
+
 export namespace core {
 	
 	export class SetupResult {
@@ -12,6 +86,350 @@ export namespace core {
 	        this.dataKey = source["dataKey"];
 	    }
 	}
+	export class RotateResult {
+	    dataKey: string;
+	    notes: number;
+	    history: number;
+	    attachments: number;
+	    skipped: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RotateResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dataKey = source["dataKey"];
+	        this.notes = source["notes"];
+	        this.history = source["history"];
+	        this.attachments = source["attachments"];
+	        this.skipped = source["skipped"];
+	    }
+	}
+	export class RepairOptions {
+	    tempFiles: boolean;
+	    orphanFiles: boolean;
+	    danglingRows: boolean;
+	    undecryptable: boolean;
+	    rebuild: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RepairOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.tempFiles = source["tempFiles"];
+	        this.orphanFiles = source["orphanFiles"];
+	        this.danglingRows = source["danglingRows"];
+	        this.undecryptable = source["undecryptable"];
+	        this.rebuild = source["rebuild"];
+	    }
+	}
+	export class VerifyIssue {
+	    kind: string;
+	    object: string;
+	    id?: string;
+	    noteId?: string;
+	    path?: string;
+	    detail?: string;
+	    action?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VerifyIssue(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.object = source["object"];
+	        this.id = source["id"];
+	        this.noteId = source["noteId"];
+	        this.path = source["path"];
+	        this.detail = source["detail"];
+	        this.action = source["action"];
+	    }
+	}
+	export class VerifyReport {
+	    notes: number;
+	    history: number;
+	    attachments: number;
+	    files: number;
+	    issues: VerifyIssue[];
+	    quarantineDir?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VerifyReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.notes = source["notes"];
+	        this.history = source["history"];
+	        this.attachments = source["attachments"];
+	        this.files = source["files"];
+	        this.issues = this.convertValues(source["issues"], VerifyIssue);
+	        this.quarantineDir = source["quarantineDir"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class RestoreInfo {
+	    snapshot: string;
+	    source: string;
+	    restoredAt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new RestoreInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.snapshot = source["snapshot"];
+	        this.source = source["source"];
+	        this.restoredAt = source["restoredAt"];
+	    }
+	}
+	export class RestoreResult {
+	    snapshot: string;
+	    unlocked: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RestoreResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.snapshot = source["snapshot"];
+	        this.unlocked = source["unlocked"];
+	    }
+	}
+	export class BackupNote {
+	    id: string;
+	    title: string;
+	    preview: string;
+	    tags: string[];
+	    notebook?: string;
+	    pinned: boolean;
+	    createdAt: string;
+	    updatedAt: string;
+	    deletedAt?: string;
+	    history: number;
+	    attachments: number;
+	    status: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupNote(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.preview = source["preview"];
+	        this.tags = source["tags"];
+	        this.notebook = source["notebook"];
+	        this.pinned = source["pinned"];
+	        this.createdAt = source["createdAt"];
+	        this.updatedAt = source["updatedAt"];
+	        this.deletedAt = source["deletedAt"];
+	        this.history = source["history"];
+	        this.attachments = source["attachments"];
+	        this.status = source["status"];
+	    }
+	}
+	export class NotesRestoreResult {
+	    restored: Record<string, string>;
+	    failed?: Record<string, string>;
+	
+	    static createFrom(source: any = {}) {
+	        return new NotesRestoreResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.restored = source["restored"];
+	        this.failed = source["failed"];
+	    }
+	}
+	export class ImportReport {
+	    imported: Record<string, string>;
+	    duplicates: string[];
+	    copies: string[];
+	    failed?: Record<string, string>;
+	    history: number;
+	    attachments: number;
+	    tagsCreated: number;
+	    notebooksCreated: number;
+	    smartViewsCreated: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.imported = source["imported"];
+	        this.duplicates = source["duplicates"];
+	        this.copies = source["copies"];
+	        this.failed = source["failed"];
+	        this.history = source["history"];
+	        this.attachments = source["attachments"];
+	        this.tagsCreated = source["tagsCreated"];
+	        this.notebooksCreated = source["notebooksCreated"];
+	        this.smartViewsCreated = source["smartViewsCreated"];
+	    }
+	}
+	export class ExportOptions {
+	    notebookId: string;
+	    tagId: string;
+	    smartViewId: string;
+	    attachments: boolean;
+	    zip: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExportOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.notebookId = source["notebookId"];
+	        this.tagId = source["tagId"];
+	        this.smartViewId = source["smartViewId"];
+	        this.attachments = source["attachments"];
+	        this.zip = source["zip"];
+	    }
+	}
+	export class ExportResult {
+	    path: string;
+	    notes: number;
+	    attachments: number;
+	    locked?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ExportResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.notes = source["notes"];
+	        this.attachments = source["attachments"];
+	        this.locked = source["locked"];
+	    }
+	}
+	export class MarkdownImportReport {
+	    imported: Record<string, string>;
+	    duplicates: string[];
+	    failed?: Record<string, string>;
+	    unresolved?: Record<string, Array<string>>;
+	    attachments: number;
+	    tagsCreated: number;
+	    notebooksCreated: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MarkdownImportReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.imported = source["imported"];
+	        this.duplicates = source["duplicates"];
+	        this.failed = source["failed"];
+	        this.unresolved = source["unresolved"];
+	        this.attachments = source["attachments"];
+	        this.tagsCreated = source["tagsCreated"];
+	        this.notebooksCreated = source["notebooksCreated"];
+	    }
+	}
+	export class ImportIssue {
+	    kind: string;
+	    item: string;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportIssue(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.item = source["item"];
+	        this.error = source["error"];
+	    }
+	}
+	export class ExternalImportReport {
+	    dryRun: boolean;
+	    notes: number;
+	    attachments: number;
+	    notebooksCreated: number;
+	    tagsCreated: number;
+	    issues: ImportIssue[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ExternalImportReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dryRun = source["dryRun"];
+	        this.notes = source["notes"];
+	        this.attachments = source["attachments"];
+	        this.notebooksCreated = source["notebooksCreated"];
+	        this.tagsCreated = source["tagsCreated"];
+	        this.issues = this.convertValues(source["issues"], ImportIssue);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class UnlockThrottleStatus {
+	    failures: number;
+	    retryAfterSeconds: number;
+	    wipeAfterFailures: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new UnlockThrottleStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.failures = source["failures"];
+	        this.retryAfterSeconds = source["retryAfterSeconds"];
+	        this.wipeAfterFailures = source["wipeAfterFailures"];
+	    }
+	}
 
 }
 
@@ -21,6 +439,11 @@ export namespace database {
 	    AutoLockMinutes: number;
 	    LockOnMinimize: boolean;
 	    LockOnSleep: boolean;
+	    BackupIntervalHours: number;
+	    BackupDir: string;
+	    BackupKeepDaily: number;
+	    BackupKeepWeekly: number;
+	    WipeAfterFailures: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new Settings(source);
@@ -31,6 +454,11 @@ export namespace database {
 	        this.AutoLockMinutes = source["AutoLockMinutes"];
 	        this.LockOnMinimize = source["LockOnMinimize"];
 	        this.LockOnSleep = source["LockOnSleep"];
+	        this.BackupIntervalHours = source["BackupIntervalHours"];
+	        this.BackupDir = source["BackupDir"];
+	        this.BackupKeepDaily = source["BackupKeepDaily"];
+	        this.BackupKeepWeekly = source["BackupKeepWeekly"];
+	        this.WipeAfterFailures = source["WipeAfterFailures"];
 	    }
 	}
 
@@ -46,6 +474,8 @@ export namespace notebooks {
 	    pinned: boolean;
 	    createdAt: string;
 	    updatedAt: string;
+	    protected: boolean;
+	    locked: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new Notebook(source);
@@ -60,6 +490,8 @@ export namespace notebooks {
 	        this.pinned = source["pinned"];
 	        this.createdAt = source["createdAt"];
 	        this.updatedAt = source["updatedAt"];
+	        this.protected = source["protected"];
+	        this.locked = source["locked"];
 	    }
 	}
 
@@ -93,6 +525,7 @@ export namespace notes {
 	    deletedAt?: string;
 	    notebookId?: string;
 	    tags: Tag[];
+	    locked?: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new Note(source);
@@ -109,6 +542,7 @@ export namespace notes {
 	        this.deletedAt = source["deletedAt"];
 	        this.notebookId = source["notebookId"];
 	        this.tags = this.convertValues(source["tags"], Tag);
+	        this.locked = source["locked"];
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -161,6 +595,88 @@ export namespace notes {
 		    return a;
 		}
 	}
+	export class SearchHit {
+	    note: Note;
+	    score: number;
+	    snippet: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchHit(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.note = this.convertValues(source["note"], Note);
+	        this.score = source["score"];
+	        this.snippet = source["snippet"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class SearchOptions {
+	    limit: number;
+	    offset: number;
+	    notebookId?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.limit = source["limit"];
+	        this.offset = source["offset"];
+	        this.notebookId = source["notebookId"];
+	    }
+	}
+	export class SearchResult {
+	    hits: SearchHit[];
+	    total: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.hits = this.convertValues(source["hits"], SearchHit);
+	        this.total = source["total"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	
 
 }
@@ -263,6 +779,29 @@ export namespace smartviews {
 
 }
 
+export namespace sync {
+	
+	export class Report {
+	    pulled: number;
+	    pushed: number;
+	    conflicts: number;
+	    skipped: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Report(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.pulled = source["pulled"];
+	        this.pushed = source["pushed"];
+	        this.conflicts = source["conflicts"];
+	        this.skipped = source["skipped"];
+	    }
+	}
+
+}
+
 export namespace tags {
 	
 	export class Tag {
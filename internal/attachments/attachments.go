@@ -0,0 +1,511 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package attachments
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"locknote/internal/crypto"
+	"locknote/internal/database"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 附件内容的校验值使用从数据密钥派生的 HMAC-SHA256，
+// 既能在解密后校验完整性，又不会像裸 SHA-256 那样泄露“是否为某个已知文件”。
+const checksumPurpose = "locknote-attachment-checksum-v1"
+
+type Service struct {
+	db        *database.DB
+	dataDir   string
+	crypto    *crypto.Service
+	masterKey []byte
+	mu        sync.RWMutex
+}
+
+type Attachment struct {
+	ID        string `json:"id"`
+	NoteID    string `json:"noteId"`
+	Filename  string `json:"filename"`
+	Mime      string `json:"mime"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func NewService(db *database.DB, dataDir string) *Service {
+	return &Service{
+		db:      db,
+		dataDir: dataDir,
+		crypto:  crypto.NewService(),
+	}
+}
+
+func (s *Service) SetMasterKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.masterKey = key
+}
+
+func (s *Service) getMasterKey() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.masterKey == nil {
+		return nil, errors.New("not unlocked")
+	}
+	return s.masterKey, nil
+}
+
+func (s *Service) buildCipherPath(id string) string {
+	return filepath.Join("attachments", id[:2], id+".enc")
+}
+
+func (s *Service) newChecksum(key []byte) hash.Hash {
+	return hmac.New(sha256.New, s.crypto.DeriveSubKey(key, checksumPurpose))
+}
+
+func (s *Service) toAttachment(key []byte, a *database.Attachment) (*Attachment, error) {
+	filename, err := s.crypto.Decrypt(key, a.EncryptedFilename)
+	if err != nil {
+		return nil, err
+	}
+	return &Attachment{
+		ID:        a.ID,
+		NoteID:    a.NoteID,
+		Filename:  string(filename),
+		Mime:      a.Mime,
+		Size:      a.Size,
+		SHA256:    a.SHA256,
+		CreatedAt: formatTime(a.CreatedAt),
+	}, nil
+}
+
+// DetectMime 根据扩展名与文件头推断 MIME 类型
+func DetectMime(filename string, head []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); t != "" {
+		return t
+	}
+	return http.DetectContentType(head)
+}
+
+// AddFile 把本地文件加密后作为附件添加到笔记
+func (s *Service) AddFile(noteID, srcPath string) (*Attachment, error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return s.Add(noteID, filepath.Base(srcPath), "", f)
+}
+
+// Add 以流的方式加密 r 的内容并保存为附件，mimeType 为空时自动推断
+func (s *Service) Add(noteID, filename, mimeType string, r io.Reader) (*Attachment, error) {
+	return s.add(uuid.New().String(), noteID, filename, mimeType, time.Now(), r)
+}
+
+// Import 以指定的 ID 与创建时间添加附件，用于从备份中恢复笔记时保留附件链接
+func (s *Service) Import(id, noteID, filename, mimeType string, createdAt time.Time, r io.Reader) (*Attachment, error) {
+	if _, err := s.db.GetAttachment(id); err == nil {
+		return nil, errors.New("attachment already exists")
+	}
+	return s.add(id, noteID, filename, mimeType, createdAt, r)
+}
+
+func (s *Service) add(id, noteID, filename, mimeType string, createdAt time.Time, r io.Reader) (*Attachment, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.GetNote(noteID); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	if mimeType == "" {
+		head, _ := br.Peek(512)
+		mimeType = DetectMime(filename, head)
+	}
+
+	encryptedFilename, err := s.crypto.Encrypt(key, []byte(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	cipherPath := s.buildCipherPath(id)
+	fullPath := filepath.Join(s.dataDir, cipherPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return nil, err
+	}
+
+	tempPath := fullPath + ".tmp"
+	out, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(out)
+	ew, err := s.crypto.NewEncryptWriter(key, bw)
+	if err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	checksum := s.newChecksum(key)
+	size, err := io.Copy(io.MultiWriter(ew, checksum), br)
+	if err == nil {
+		err = ew.Close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tempPath, fullPath); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	meta := &database.Attachment{
+		ID:                id,
+		NoteID:            noteID,
+		EncryptedFilename: encryptedFilename,
+		Mime:              mimeType,
+		Size:              size,
+		SHA256:            hex.EncodeToString(checksum.Sum(nil)),
+		CipherPath:        cipherPath,
+		CreatedAt:         createdAt,
+	}
+	if err := s.db.CreateAttachment(meta); err != nil {
+		os.Remove(fullPath)
+		return nil, err
+	}
+
+	return &Attachment{
+		ID:        meta.ID,
+		NoteID:    meta.NoteID,
+		Filename:  filename,
+		Mime:      meta.Mime,
+		Size:      meta.Size,
+		SHA256:    meta.SHA256,
+		CreatedAt: formatTime(meta.CreatedAt),
+	}, nil
+}
+
+func (s *Service) Get(id string) (*Attachment, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := s.db.GetAttachment(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toAttachment(key, meta)
+}
+
+func (s *Service) List(noteID string) ([]*Attachment, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	metas, err := s.db.ListAttachments(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]*Attachment, 0, len(metas))
+	for _, meta := range metas {
+		a, err := s.toAttachment(key, meta)
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+type attachmentReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *attachmentReader) Close() error {
+	return r.file.Close()
+}
+
+// Open 返回附件的解密流，调用方负责关闭
+func (s *Service) Open(id string) (io.ReadCloser, *Attachment, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, err := s.db.GetAttachment(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := s.toAttachment(key, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(filepath.Join(s.dataDir, meta.CipherPath))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dr, err := s.crypto.NewDecryptReader(key, bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return &attachmentReader{Reader: dr, file: f}, a, nil
+}
+
+// Export 把附件解密写到 destPath，并校验内容完整性
+func (s *Service) Export(id, destPath string) error {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return err
+	}
+
+	rc, a, err := s.Open(id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tempPath := destPath + ".tmp"
+	out, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	checksum := s.newChecksum(key)
+	_, err = io.Copy(io.MultiWriter(out, checksum), rc)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(checksum.Sum(nil)) != a.SHA256 {
+		err = errors.New("attachment checksum mismatch")
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, destPath)
+}
+
+func (s *Service) Remove(id string) error {
+	meta, err := s.db.GetAttachment(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.DeleteAttachment(id); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(s.dataDir, meta.CipherPath))
+	return nil
+}
+
+// Rekey 把所有附件的内容、文件名与校验值从 oldKey 重新加密为 newKey，
+// 已经是 newKey 的部分保持不变，中断后可以重复调用。返回处理的附件数与跳过（已损坏）的数量。
+func (s *Service) Rekey(oldKey, newKey []byte) (int, int, error) {
+	metas, err := s.db.ListAllAttachments()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	done, skipped := 0, 0
+	for _, meta := range metas {
+		checksum, ok, err := s.rekeyContent(filepath.Join(s.dataDir, meta.CipherPath), oldKey, newKey)
+		if err != nil {
+			return done, skipped, err
+		}
+		filename, nameErr := s.crypto.Decrypt(newKey, meta.EncryptedFilename)
+		if nameErr != nil {
+			filename, nameErr = s.crypto.Decrypt(oldKey, meta.EncryptedFilename)
+		}
+		if !ok || nameErr != nil {
+			skipped++
+			continue
+		}
+
+		encryptedFilename, err := s.crypto.Encrypt(newKey, filename)
+		if err != nil {
+			return done, skipped, err
+		}
+		if err := s.db.UpdateAttachmentEncryption(meta.ID, encryptedFilename, checksum); err != nil {
+			return done, skipped, err
+		}
+		done++
+	}
+	return done, skipped, nil
+}
+
+// rekeyContent 重新加密附件文件并返回新密钥下的校验值；文件缺失或无法解密时返回 false
+func (s *Service) rekeyContent(path string, oldKey, newKey []byte) (string, bool, error) {
+	// 已经用 newKey 加密：只需重新计算校验值
+	if checksum, err := s.checksumFile(path, newKey); err == nil {
+		return checksum, true, nil
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	defer in.Close()
+
+	dr, err := s.crypto.NewDecryptReader(oldKey, bufio.NewReader(in))
+	if err != nil {
+		return "", false, nil
+	}
+
+	tempPath := path + ".tmp"
+	out, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", false, err
+	}
+
+	bw := bufio.NewWriter(out)
+	ew, err := s.crypto.NewEncryptWriter(newKey, bw)
+	if err != nil {
+		out.Close()
+		os.Remove(tempPath)
+		return "", false, err
+	}
+
+	checksum := s.newChecksum(newKey)
+	_, copyErr := io.Copy(io.MultiWriter(ew, checksum), dr)
+	if copyErr == nil {
+		err = ew.Close()
+	}
+	if copyErr == nil && err == nil {
+		err = bw.Flush()
+	}
+	if copyErr == nil && err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if errors.Is(copyErr, crypto.ErrStreamCorrupted) {
+		// 旧密钥也无法解密：文件已损坏
+		os.Remove(tempPath)
+		return "", false, nil
+	}
+	if err == nil {
+		err = copyErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", false, err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return "", false, err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), true, nil
+}
+
+func (s *Service) checksumFile(path string, key []byte) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dr, err := s.crypto.NewDecryptReader(key, bufio.NewReader(f))
+	if err != nil {
+		return "", err
+	}
+	checksum := s.newChecksum(key)
+	if _, err := io.Copy(checksum, dr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
+
+// CheckResult 是单个附件的检查结果
+type CheckResult struct {
+	Missing       bool   // 密文文件不存在
+	Undecryptable bool   // 内容或文件名无法用当前数据密钥解密
+	Legacy        bool   // 文件名仍是旧格式
+	Checksum      string // 按内容重新计算的校验值，与记录不同时需要更新
+}
+
+// Check 用当前数据密钥解密附件内容与文件名，检查是否完整
+func (s *Service) Check(meta *database.Attachment) (*CheckResult, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{}
+	path := filepath.Join(s.dataDir, meta.CipherPath)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			result.Missing = true
+			return result, nil
+		}
+		return nil, err
+	}
+
+	checksum, err := s.checksumFile(path, key)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return nil, err
+		}
+		result.Undecryptable = true
+		return result, nil
+	}
+	result.Checksum = checksum
+
+	if _, err := s.crypto.Decrypt(key, meta.EncryptedFilename); err != nil {
+		result.Undecryptable = true
+	}
+	result.Legacy = s.crypto.NeedsUpgrade(meta.EncryptedFilename)
+	return result, nil
+}
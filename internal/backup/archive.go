@@ -0,0 +1,469 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"locknote/internal/crypto"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// .locknote 备份格式：
+//
+//	magic "LNBK" | version uint8 | headerLen uint32 | header JSON | 加密流（crypto 包的分块流式格式）
+//
+// 加密流的内容是 gzip 压缩的 tar，最后一项是清单 MANIFEST.json，列出每一项的大小与 SHA-256。
+// 备份密钥由数据密钥派生，或由单独的备份口令经 Argon2id 派生；加密流的密钥再绑定 header 的摘要，
+// 因此 header、清单与各项内容任何一处被修改、截断或调换都会在读取时被发现。
+const (
+	archiveMagic     = "LNBK"
+	ArchiveVersion   = 1
+	archiveMaxHead   = 64 * 1024
+	manifestName     = "MANIFEST.json"
+	backupKeyPurpose = "locknote-backup-v1"
+	streamKeyPurpose = "locknote-backup-archive-v1"
+)
+
+// 备份密钥的来源
+const (
+	KeySourceDataKey    = "datakey"
+	KeySourcePassphrase = "passphrase"
+)
+
+var (
+	ErrWrongBackupKey     = errors.New("备份密钥或口令不正确")
+	ErrBackupCorrupted    = errors.New("备份文件已损坏或被篡改")
+	ErrPassphraseRequired = errors.New("该备份使用单独的口令加密，请输入备份口令")
+)
+
+// Key 指定加密或打开备份所用的密钥：Passphrase 非空时使用备份口令，否则使用数据密钥
+type Key struct {
+	DataKey    []byte
+	Passphrase string
+
+	derivedKey []byte // 已由数据密钥派生的备份密钥，供锁定后的定时备份使用
+}
+
+// Header 是备份文件开头未加密的描述信息
+type Header struct {
+	Version   int    `json:"version"`
+	CreatedAt string `json:"createdAt"`
+	KeySource string `json:"keySource"`
+	KDF       string `json:"kdf,omitempty"`  // 口令的派生参数
+	Salt      []byte `json:"salt,omitempty"` // 口令的盐
+	KeyID     []byte `json:"keyId"`          // 备份密钥的短标识，用于提前发现密钥错误
+}
+
+// Manifest 是备份内容的清单
+type Manifest struct {
+	Version   int             `json:"version"`
+	CreatedAt string          `json:"createdAt"`
+	Entries   []ManifestEntry `json:"entries"`
+}
+
+type ManifestEntry struct {
+	Path   string `json:"path"` // 相对数据目录，使用 / 分隔
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// BackupInfo 是校验备份后的结果
+type BackupInfo struct {
+	Format    string `json:"format"` // "locknote" 或旧版 "zip"
+	KeySource string `json:"keySource,omitempty"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	Entries   int    `json:"entries"`
+	Size      int64  `json:"size"` // 各项内容的总大小
+}
+
+var cryptoService = crypto.NewService()
+
+// IsArchive 判断 path 是否为 .locknote 格式的备份
+func IsArchive(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return string(magic) == archiveMagic, nil
+}
+
+// ReadHeader 读取备份的描述信息，不需要密钥
+func ReadHeader(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, _, err := readHeader(bufio.NewReader(f))
+	return header, err
+}
+
+func readHeader(r io.Reader) (*Header, []byte, error) {
+	prefix := make([]byte, len(archiveMagic)+1+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, nil, ErrBackupCorrupted
+	}
+	if string(prefix[:len(archiveMagic)]) != archiveMagic {
+		return nil, nil, errors.New("不是 LockNote 备份文件")
+	}
+	if prefix[len(archiveMagic)] != ArchiveVersion {
+		return nil, nil, fmt.Errorf("不支持的备份格式版本 %d", prefix[len(archiveMagic)])
+	}
+
+	n := binary.BigEndian.Uint32(prefix[len(archiveMagic)+1:])
+	if n == 0 || n > archiveMaxHead {
+		return nil, nil, ErrBackupCorrupted
+	}
+	raw := make([]byte, n)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, nil, ErrBackupCorrupted
+	}
+
+	var header Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, nil, ErrBackupCorrupted
+	}
+	return &header, raw, nil
+}
+
+// backupKey 由 key 与 header 派生备份密钥
+func backupKey(header *Header, key Key) ([]byte, error) {
+	switch header.KeySource {
+	case KeySourceDataKey:
+		if key.Passphrase != "" {
+			return nil, errors.New("该备份使用数据密钥加密，不需要备份口令")
+		}
+		if key.DataKey == nil {
+			if key.derivedKey != nil {
+				return key.derivedKey, nil
+			}
+			return nil, errors.New("not unlocked")
+		}
+		return cryptoService.DeriveSubKey(key.DataKey, backupKeyPurpose), nil
+
+	case KeySourcePassphrase:
+		if key.Passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		params, err := crypto.ParseKDFParams(header.KDF)
+		if err != nil {
+			return nil, err
+		}
+		passphraseKey, err := cryptoService.DeriveKeyWithParams(key.Passphrase, header.Salt, params)
+		if err != nil {
+			return nil, err
+		}
+		return cryptoService.DeriveSubKey(passphraseKey, backupKeyPurpose), nil
+
+	default:
+		return nil, fmt.Errorf("unknown backup key source %q", header.KeySource)
+	}
+}
+
+// streamKey 把加密流的密钥绑定到 header 的原始字节
+func streamKey(backupKey, rawHeader []byte) []byte {
+	digest := sha256.Sum256(rawHeader)
+	return cryptoService.HMAC(cryptoService.DeriveSubKey(backupKey, streamKeyPurpose), digest[:])
+}
+
+// ============ 写入 ============
+
+// archiveWriter 逐项写入备份并记录清单
+type archiveWriter struct {
+	file     *os.File
+	bw       *bufio.Writer
+	stream   io.WriteCloser
+	gz       *gzip.Writer
+	tw       *tar.Writer
+	manifest *Manifest
+}
+
+// newHeader 按 key 的来源生成新的 header，并返回对应的备份密钥
+func newHeader(version int, key Key) (*Header, []byte, error) {
+	header := &Header{Version: version, CreatedAt: time.Now().Format(time.RFC3339)}
+	if key.Passphrase != "" {
+		salt, err := cryptoService.GenerateSalt()
+		if err != nil {
+			return nil, nil, err
+		}
+		header.KeySource = KeySourcePassphrase
+		header.KDF = crypto.DefaultKDFParams.String()
+		header.Salt = salt
+	} else {
+		header.KeySource = KeySourceDataKey
+	}
+
+	bk, err := backupKey(header, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.KeyID = cryptoService.KeyID(bk)
+	return header, bk, nil
+}
+
+func newArchiveWriter(outputPath string, key Key) (*archiveWriter, error) {
+	header, bk, err := newHeader(ArchiveVersion, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rawHeader, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(f)
+
+	prefix := append([]byte(archiveMagic), ArchiveVersion)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(rawHeader)))
+	if _, err := bw.Write(append(prefix, rawHeader...)); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	stream, err := cryptoService.NewEncryptWriter(streamKey(bk, rawHeader), bw)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	gz := gzip.NewWriter(stream)
+
+	return &archiveWriter{
+		file:     f,
+		bw:       bw,
+		stream:   stream,
+		gz:       gz,
+		tw:       tar.NewWriter(gz),
+		manifest: &Manifest{Version: ArchiveVersion, CreatedAt: header.CreatedAt, Entries: []ManifestEntry{}},
+	}, nil
+}
+
+// addFile 把本地文件 src 以 name 写入备份
+func (w *archiveWriter) addFile(name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w.tw, h), f)
+	if err != nil {
+		return err
+	}
+	if n != info.Size() {
+		return fmt.Errorf("%s changed during backup", name)
+	}
+
+	w.manifest.Entries = append(w.manifest.Entries, ManifestEntry{
+		Path:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	})
+	return nil
+}
+
+// close 写入清单并结束加密流
+func (w *archiveWriter) close() error {
+	data, err := json.Marshal(w.manifest)
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+	err = w.tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()})
+	if err == nil {
+		_, err = w.tw.Write(data)
+	}
+	if err == nil {
+		err = w.tw.Close()
+	}
+	if err == nil {
+		err = w.gz.Close()
+	}
+	if err == nil {
+		err = w.stream.Close()
+	}
+	if err == nil {
+		err = w.bw.Flush()
+	}
+	if err == nil {
+		err = w.file.Sync()
+	}
+	closeErr := w.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// abort 放弃写入
+func (w *archiveWriter) abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// ============ 读取 ============
+
+// readArchive 解密并逐项读取备份，每一项交给 fn（可以为 nil），最后与清单核对。
+// fn 收到的内容在全部读完并核对之前不能视为可信。
+func readArchive(inputPath string, key Key, fn func(name string, r io.Reader) error) (*Header, *Manifest, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, rawHeader, err := readHeader(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	bk, err := backupKey(header, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hmac.Equal(cryptoService.KeyID(bk), header.KeyID) {
+		return nil, nil, ErrWrongBackupKey
+	}
+
+	stream, err := cryptoService.NewDecryptReader(streamKey(bk, rawHeader), br)
+	if err != nil {
+		return nil, nil, ErrBackupCorrupted
+	}
+	gz, err := gzip.NewReader(stream)
+	if err != nil {
+		return nil, nil, ErrBackupCorrupted
+	}
+
+	var manifest *Manifest
+	seen := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, corrupted(err)
+		}
+		if manifest != nil {
+			// 清单必须是最后一项
+			return nil, nil, ErrBackupCorrupted
+		}
+
+		if hdr.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, corrupted(err)
+			}
+			continue
+		}
+
+		name, ok := cleanEntryName(hdr.Name)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			return nil, nil, ErrBackupCorrupted
+		}
+		if _, dup := seen[name]; dup {
+			return nil, nil, ErrBackupCorrupted
+		}
+
+		h := sha256.New()
+		r := io.TeeReader(tr, h)
+		if fn != nil {
+			if err := fn(name, r); err != nil {
+				return nil, nil, corrupted(err)
+			}
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, nil, corrupted(err)
+		}
+		seen[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	// 读完剩余数据，确认加密流的最后一块完整
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, nil, corrupted(err)
+	}
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		return nil, nil, corrupted(err)
+	}
+
+	if manifest == nil || len(manifest.Entries) != len(seen) {
+		return nil, nil, ErrBackupCorrupted
+	}
+	for _, entry := range manifest.Entries {
+		if seen[entry.Path] != entry.SHA256 {
+			return nil, nil, ErrBackupCorrupted
+		}
+	}
+	return header, manifest, nil
+}
+
+// corrupted 把解密与解析错误统一为 ErrBackupCorrupted，保留文件系统等其他错误
+func corrupted(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	return ErrBackupCorrupted
+}
+
+// cleanEntryName 检查备份中的路径是否为数据目录内的相对路径
+func cleanEntryName(name string) (string, bool) {
+	clean := path.Clean(name)
+	if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, "\\") {
+		return "", false
+	}
+	return clean, true
+}
+
+func infoFromManifest(header *Header, manifest *Manifest) *BackupInfo {
+	info := &BackupInfo{
+		Format:    "locknote",
+		KeySource: header.KeySource,
+		CreatedAt: manifest.CreatedAt,
+		Entries:   len(manifest.Entries),
+	}
+	for _, entry := range manifest.Entries {
+		info.Size += entry.Size
+	}
+	return info
+}
@@ -0,0 +1,233 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntries 是写入测试备份的内容，其中一项跨越多个加密块
+var testEntries = map[string][]byte{
+	"locknote.db":       []byte("database"),
+	"notes/a.enc":       randomBytes(200 * 1024),
+	"history/empty.enc": {},
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func testDataKey(t *testing.T) Key {
+	t.Helper()
+	key, err := cryptoService.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{DataKey: key}
+}
+
+// writeTestArchive 写入 testEntries，edit 可以在写入清单之前修改它
+func writeTestArchive(t *testing.T, key Key, edit func(*Manifest)) string {
+	t.Helper()
+	dir := t.TempDir()
+	out := filepath.Join(dir, "backup.locknote")
+
+	w, err := newArchiveWriter(out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"locknote.db", "notes/a.enc", "history/empty.enc"} {
+		src := filepath.Join(dir, filepath.Base(name))
+		if err := os.WriteFile(src, testEntries[name], 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.addFile(name, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if edit != nil {
+		edit(w.manifest)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func readAll(path string, key Key) (map[string][]byte, *Manifest, error) {
+	got := make(map[string][]byte)
+	_, manifest, err := readArchive(path, key, func(name string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		got[name] = data
+		return err
+	})
+	return got, manifest, err
+}
+
+// headerLen 返回备份开头未加密部分的长度，之后是加密流
+func headerLen(t *testing.T, data []byte) int {
+	t.Helper()
+	_, raw, err := readHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(archiveMagic) + 1 + 4 + len(raw)
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	key := testDataKey(t)
+	path := writeTestArchive(t, key, nil)
+
+	header, err := ReadHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.KeySource != KeySourceDataKey {
+		t.Fatalf("key source = %q", header.KeySource)
+	}
+
+	got, manifest, err := readAll(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Entries) != len(testEntries) {
+		t.Fatalf("manifest has %d entries, want %d", len(manifest.Entries), len(testEntries))
+	}
+	for name, want := range testEntries {
+		if !bytes.Equal(got[name], want) {
+			t.Fatalf("%s: content does not match", name)
+		}
+	}
+}
+
+func TestArchiveKeys(t *testing.T) {
+	dataKey := testDataKey(t)
+	dataPath := writeTestArchive(t, dataKey, nil)
+	passPath := writeTestArchive(t, Key{Passphrase: "correct horse"}, nil)
+
+	tests := []struct {
+		name string
+		path string
+		key  Key
+		want error
+	}{
+		{"data key", dataPath, dataKey, nil},
+		{"wrong data key", dataPath, testDataKey(t), ErrWrongBackupKey},
+		{"passphrase", passPath, Key{Passphrase: "correct horse"}, nil},
+		{"wrong passphrase", passPath, Key{Passphrase: "battery staple"}, ErrWrongBackupKey},
+		{"passphrase missing", passPath, dataKey, ErrPassphraseRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readAll(tt.path, tt.key)
+			if tt.want == nil && err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveRejectsTruncation(t *testing.T) {
+	key := testDataKey(t)
+	path := writeTestArchive(t, key, nil)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerEnd := headerLen(t, data)
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"magic only", len(archiveMagic)},
+		{"inside header", headerEnd - 1},
+		{"header only", headerEnd},
+		{"first chunk", headerEnd + 1024},
+		{"middle", len(data) / 2},
+		{"missing tag", len(data) - 16},
+		{"missing last byte", len(data) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncated := filepath.Join(t.TempDir(), "truncated.locknote")
+			if err := os.WriteFile(truncated, data[:tt.size], 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := readAll(truncated, key); !errors.Is(err, ErrBackupCorrupted) {
+				t.Fatalf("err = %v, want ErrBackupCorrupted", err)
+			}
+		})
+	}
+}
+
+func TestArchiveRejectsTampering(t *testing.T) {
+	key := testDataKey(t)
+	path := writeTestArchive(t, key, nil)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := bytes.Index(data, []byte(`"createdAt":"`)) + len(`"createdAt":"`)
+	headerEnd := headerLen(t, data)
+
+	tests := []struct {
+		name string
+		edit func([]byte) []byte
+	}{
+		{"header", func(b []byte) []byte { b[createdAt]++; return b }},
+		{"stream header", func(b []byte) []byte { b[headerEnd+2] ^= 0x01; return b }},
+		{"first chunk", func(b []byte) []byte { b[headerEnd+100] ^= 0x01; return b }},
+		{"middle", func(b []byte) []byte { b[len(b)/2] ^= 0x01; return b }},
+		{"last byte", func(b []byte) []byte { b[len(b)-1] ^= 0x01; return b }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := filepath.Join(t.TempDir(), "tampered.locknote")
+			if err := os.WriteFile(tampered, tt.edit(bytes.Clone(data)), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := readAll(tampered, key); !errors.Is(err, ErrBackupCorrupted) {
+				t.Fatalf("err = %v, want ErrBackupCorrupted", err)
+			}
+		})
+	}
+}
+
+func TestArchiveRejectsManifestMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Manifest)
+	}{
+		{"checksum", func(m *Manifest) { m.Entries[0].SHA256 = m.Entries[1].SHA256 }},
+		{"missing entry", func(m *Manifest) { m.Entries = m.Entries[1:] }},
+		{"extra entry", func(m *Manifest) {
+			m.Entries = append(m.Entries, ManifestEntry{Path: "notes/b.enc", SHA256: m.Entries[0].SHA256})
+		}},
+		{"renamed entry", func(m *Manifest) { m.Entries[1].Path = "notes/b.enc" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := testDataKey(t)
+			path := writeTestArchive(t, key, tt.edit)
+			if _, _, err := readAll(path, key); !errors.Is(err, ErrBackupCorrupted) {
+				t.Fatalf("err = %v, want ErrBackupCorrupted", err)
+			}
+		})
+	}
+}
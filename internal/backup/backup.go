@@ -5,134 +5,244 @@ package backup
 
 import (
 	"archive/zip"
+	"errors"
 	"io"
+	"locknote/internal/database"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 type Service struct {
-	dataDir string
+	db        *database.DB
+	dataDir   string
+	masterKey []byte
+	// archiveKey 是由数据密钥单向派生的备份密钥，锁定后仍然保留，供定时备份使用。
+	// 它只能打开备份文件，备份中的笔记仍是用数据密钥加密的密文
+	archiveKey []byte
+	mu         sync.RWMutex
 }
 
-func NewService(dataDir string) *Service {
-	return &Service{dataDir: dataDir}
+func NewService(db *database.DB, dataDir string) *Service {
+	return &Service{db: db, dataDir: dataDir}
 }
 
-func (s *Service) ExtractBackupToTemp(inputPath string) (string, error) {
-	tempDir, err := os.MkdirTemp("", "locknote-import-*")
-	if err != nil {
-		return "", err
-	}
-
-	reader, err := zip.OpenReader(inputPath)
-	if err != nil {
-		os.RemoveAll(tempDir)
-		return "", err
+func (s *Service) SetMasterKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.masterKey = key
+	if key != nil {
+		s.archiveKey = cryptoService.DeriveSubKey(key, backupKeyPurpose)
 	}
-	defer reader.Close()
+}
 
-	for _, file := range reader.File {
-		destPath := filepath.Join(tempDir, file.Name)
-		cleanDestPath := filepath.Clean(destPath)
+// dataKey 返回用当前数据密钥打开备份的 Key，未解锁时 DataKey 为 nil
+func (s *Service) dataKey() Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Key{DataKey: s.masterKey}
+}
 
-		if !strings.HasPrefix(cleanDestPath, filepath.Clean(tempDir)+string(os.PathSeparator)) {
-			continue
-		}
+// RestoreMarkerFile 记录最近一次恢复前数据快照的位置，只对本机有意义
+const RestoreMarkerFile = "restore.json"
 
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(cleanDestPath, 0700)
-			continue
-		}
+// 不放入备份的文件：数据库（及整库加密时解锁前的明文小库）另行生成快照，临时文件、隔离区与恢复记录没有意义
+func skipBackupEntry(rel string, info os.FileInfo) bool {
+	name := info.Name()
+	if info.IsDir() {
+		return rel == "quarantine"
+	}
+	return strings.HasPrefix(rel, "locknote.db") || strings.HasPrefix(rel, database.UnlockStoreFile) || strings.HasSuffix(name, ".tmp") ||
+		rel == RestoreMarkerFile || rel == scheduleStateFile
+}
 
-		if err := os.MkdirAll(filepath.Dir(cleanDestPath), 0700); err != nil {
-			os.RemoveAll(tempDir)
-			return "", err
-		}
+// CreateBackup 用由数据密钥派生的备份密钥创建 .locknote 备份
+func (s *Service) CreateBackup(outputPath string) error {
+	key := s.dataKey()
+	if key.DataKey == nil {
+		return errors.New("not unlocked")
+	}
+	return s.createArchive(outputPath, key)
+}
 
-		destFile, err := os.OpenFile(cleanDestPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-		if err != nil {
-			os.RemoveAll(tempDir)
-			return "", err
-		}
+// CreateBackupWithPassphrase 用单独的备份口令创建 .locknote 备份，恢复时只需要该口令
+func (s *Service) CreateBackupWithPassphrase(outputPath, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("备份口令不能为空")
+	}
+	return s.createArchive(outputPath, Key{Passphrase: passphrase})
+}
 
-		srcFile, err := file.Open()
-		if err != nil {
-			destFile.Close()
-			os.RemoveAll(tempDir)
-			return "", err
-		}
+func (s *Service) createArchive(outputPath string, key Key) error {
+	// 数据库在使用中，先生成一致的快照
+	snapshotDir, err := os.MkdirTemp("", "locknote-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(snapshotDir)
+	snapshotPath := filepath.Join(snapshotDir, "locknote.db")
+	if err := s.db.SnapshotTo(snapshotPath); err != nil {
+		return err
+	}
 
-		_, err = io.Copy(destFile, srcFile)
-		srcFile.Close()
-		destFile.Close()
+	tempPath := outputPath + ".tmp"
+	w, err := newArchiveWriter(tempPath, key)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			os.RemoveAll(tempDir)
-			return "", err
-		}
+	err = w.addFile("locknote.db", snapshotPath)
+	if err == nil && s.db.Encrypted() {
+		err = w.addFile(database.UnlockStoreFile, database.UnlockStorePath(snapshotPath))
+	}
+	if err == nil {
+		err = filepath.Walk(s.dataDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(s.dataDir, path)
+			if err != nil {
+				return err
+			}
+			if skipBackupEntry(relPath, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			return w.addFile(filepath.ToSlash(relPath), path)
+		})
+	}
+	if err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.close(); err != nil {
+		os.Remove(tempPath)
+		return err
 	}
 
-	return tempDir, nil
+	if err := os.Rename(tempPath, outputPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
 }
 
-func (s *Service) CleanupTempDir(tempDir string) {
-	os.RemoveAll(tempDir)
+// VerifyBackup 用当前数据密钥解密并校验备份的每一项，不恢复任何内容。
+// 旧版 zip 备份只校验压缩包自身的 CRC。
+func (s *Service) VerifyBackup(inputPath string) (*BackupInfo, error) {
+	return s.VerifyBackupWithKey(inputPath, s.dataKey())
 }
 
-func (s *Service) CreateBackup(outputPath string) error {
-	zipFile, err := os.Create(outputPath)
+// VerifyBackupWithKey 用指定的数据密钥或备份口令校验备份
+func (s *Service) VerifyBackupWithKey(inputPath string, key Key) (*BackupInfo, error) {
+	isArchive, err := IsArchive(inputPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !isArchive {
+		return verifyZip(inputPath)
 	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
 
-	err = filepath.Walk(s.dataDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	header, manifest, err := readArchive(inputPath, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return infoFromManifest(header, manifest), nil
+}
 
-		if info.IsDir() {
-			return nil
-		}
+func verifyZip(inputPath string) (*BackupInfo, error) {
+	reader, err := zip.OpenReader(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
 
-		relPath, err := filepath.Rel(s.dataDir, path)
-		if err != nil {
-			return err
+	info := &BackupInfo{Format: "zip"}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
 		}
-
-		header, err := zip.FileInfoHeader(info)
+		rc, err := file.Open()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		header.Name = relPath
-		header.Method = zip.Deflate
-
-		writer, err := zipWriter.CreateHeader(header)
+		n, err := io.Copy(io.Discard, rc)
+		rc.Close()
 		if err != nil {
-			return err
+			return nil, ErrBackupCorrupted
 		}
+		info.Entries++
+		info.Size += n
+	}
+	return info, nil
+}
 
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
+// Extract 把备份解压到 destDir，支持 .locknote 与旧版 zip 格式（旧格式忽略 key）。
+// .locknote 备份先完整校验一遍，通过后才写出文件。
+func Extract(inputPath, destDir string, key Key) error {
+	isArchive, err := IsArchive(inputPath)
+	if err != nil {
+		return err
+	}
+	if !isArchive {
+		return extractZip(inputPath, destDir)
+	}
 
-		_, copyErr := io.Copy(writer, file)
-		closeErr := file.Close()
-		if copyErr != nil {
-			return copyErr
-		}
-		return closeErr
+	if _, _, err := readArchive(inputPath, key, nil); err != nil {
+		return err
+	}
+	_, _, err = readArchive(inputPath, key, func(name string, r io.Reader) error {
+		return writeEntry(destDir, name, r)
 	})
-
 	return err
 }
 
-func (s *Service) RestoreBackup(inputPath string) error {
+func writeEntry(destDir, name string, r io.Reader) error {
+	destPath := filepath.Join(destDir, filepath.FromSlash(name))
+	cleanDestPath := filepath.Clean(destPath)
+	if !strings.HasPrefix(cleanDestPath, filepath.Clean(destDir)+string(os.PathSeparator)) {
+		return ErrBackupCorrupted
+	}
+	if err := os.MkdirAll(filepath.Dir(cleanDestPath), 0700); err != nil {
+		return err
+	}
+
+	destFile, err := os.OpenFile(cleanDestPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destFile, r)
+	closeErr := destFile.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (s *Service) ExtractBackupToTemp(inputPath string) (string, error) {
+	return s.ExtractBackupToTempWithKey(inputPath, s.dataKey())
+}
+
+// ExtractBackupToTempWithKey 用指定的数据密钥或备份口令把备份解压到临时目录
+func (s *Service) ExtractBackupToTempWithKey(inputPath string, key Key) (string, error) {
+	tempDir, err := os.MkdirTemp("", "locknote-import-*")
+	if err != nil {
+		return "", err
+	}
+	if err := Extract(inputPath, tempDir, key); err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+	return tempDir, nil
+}
+
+func extractZip(inputPath, destDir string) error {
 	reader, err := zip.OpenReader(inputPath)
 	if err != nil {
 		return err
@@ -140,10 +250,10 @@ func (s *Service) RestoreBackup(inputPath string) error {
 	defer reader.Close()
 
 	for _, file := range reader.File {
-		destPath := filepath.Join(s.dataDir, file.Name)
+		destPath := filepath.Join(destDir, file.Name)
 		cleanDestPath := filepath.Clean(destPath)
 
-		if !strings.HasPrefix(cleanDestPath, filepath.Clean(s.dataDir)+string(os.PathSeparator)) {
+		if !strings.HasPrefix(cleanDestPath, filepath.Clean(destDir)+string(os.PathSeparator)) {
 			continue
 		}
 
@@ -178,3 +288,31 @@ func (s *Service) RestoreBackup(inputPath string) error {
 
 	return nil
 }
+
+func (s *Service) CleanupTempDir(tempDir string) {
+	os.RemoveAll(tempDir)
+}
+
+// StageRestore 用当前数据密钥把备份解压到与数据目录同级的暂存目录，返回该目录。
+// 暂存目录与数据目录在同一文件系统上，校验通过后可以直接重命名替换
+func (s *Service) StageRestore(inputPath string) (string, error) {
+	return s.StageRestoreWithKey(inputPath, s.dataKey())
+}
+
+// StageRestoreWithKey 用指定的数据密钥或备份口令把备份解压到暂存目录
+func (s *Service) StageRestoreWithKey(inputPath string, key Key) (string, error) {
+	stagedDir, err := s.newStagingDir()
+	if err != nil {
+		return "", err
+	}
+	if err := Extract(inputPath, stagedDir, key); err != nil {
+		os.RemoveAll(stagedDir)
+		return "", err
+	}
+	return stagedDir, nil
+}
+
+func (s *Service) newStagingDir() (string, error) {
+	dataDir := filepath.Clean(s.dataDir)
+	return os.MkdirTemp(filepath.Dir(dataDir), filepath.Base(dataDir)+".restore-*")
+}
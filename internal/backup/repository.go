@@ -0,0 +1,710 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package backup
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 备份仓库的目录结构：
+//
+//	config.json          未加密的 Header，用于派生仓库密钥并检查密钥是否正确
+//	objects/ab/<id>      按内容寻址的数据块，每块用仓库密钥加密
+//	snapshots/<id>.snap  加密的快照清单，列出每个文件由哪些数据块组成
+//
+// 数据目录中的 .enc 文件本身就是密文，直接按原样切块存入，不需要解密；
+// 数据块的 ID 是带密钥的 HMAC，相同内容只存一份，也不会泄露内容的哈希。
+// 与上一个快照相比路径、大小与修改时间都没变的文件直接复用原来的数据块，不再读取。
+
+const (
+	RepositoryVersion = 1
+
+	repoConfigFile   = "config.json"
+	repoObjectsDir   = "objects"
+	repoSnapshotsDir = "snapshots"
+	repoSnapshotExt  = ".snap"
+
+	// repoChunkSize 是数据块的大小。数据库快照按页存储，固定大小切块时未变化的页可以去重
+	repoChunkSize = 1 << 20
+
+	repoObjectPurpose   = "locknote-repo-object-v1"
+	repoIDPurpose       = "locknote-repo-id-v1"
+	repoSnapshotPurpose = "locknote-repo-snapshot-v1"
+)
+
+var ErrSnapshotNotFound = errors.New("快照不存在")
+
+// Repository 是一个已打开的备份仓库
+type Repository struct {
+	dir         string
+	objectKey   []byte
+	idKey       []byte
+	snapshotKey []byte
+}
+
+// SnapshotInfo 描述仓库中的一个快照
+type SnapshotInfo struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"createdAt"`
+	Files     int    `json:"files"`
+	Size      int64  `json:"size"`                  // 各文件的总大小
+	NewChunks int    `json:"newChunks,omitempty"`   // 创建快照时新写入的数据块数量
+	NewBytes  int64  `json:"newBytes,omitempty"`    // 创建快照时新写入的数据量（加密前）
+	Reused    int    `json:"reusedFiles,omitempty"` // 未变化而直接复用的文件数量
+}
+
+// PruneResult 是清理仓库后的结果
+type PruneResult struct {
+	Snapshots []string `json:"snapshots"` // 被删除的快照
+	Chunks    int      `json:"chunks"`    // 被删除的数据块数量
+	Bytes     int64    `json:"bytes"`     // 释放的空间
+}
+
+// RepositoryCheck 是检查仓库后的结果
+type RepositoryCheck struct {
+	Snapshots    int      `json:"snapshots"`
+	Chunks       int      `json:"chunks"`
+	Missing      []string `json:"missing,omitempty"`   // 被快照引用但不存在的数据块
+	Corrupted    []string `json:"corrupted,omitempty"` // 无法解密或内容与 ID 不符的数据块，以及无法读取的快照（snapshot:<id>）
+	Unreferenced int      `json:"unreferenced"`        // 没有被任何快照引用的数据块，可由 Prune 清理
+}
+
+// OK 表示仓库中所有快照都可以完整恢复
+func (c *RepositoryCheck) OK() bool {
+	return len(c.Missing) == 0 && len(c.Corrupted) == 0
+}
+
+type repoSnapshot struct {
+	ID        string      `json:"id"`
+	CreatedAt string      `json:"createdAt"`
+	Entries   []repoEntry `json:"entries"`
+}
+
+type repoEntry struct {
+	Path    string   `json:"path"`
+	Size    int64    `json:"size"`
+	ModTime int64    `json:"modTime,omitempty"` // 数据目录中文件的修改时间，用于跳过未变化的文件
+	SHA256  string   `json:"sha256"`
+	Chunks  []string `json:"chunks"`
+}
+
+// InitRepository 在 dir 创建备份仓库，key 的含义与 .locknote 备份相同
+func InitRepository(dir string, key Key) error {
+	if _, err := os.Stat(filepath.Join(dir, repoConfigFile)); err == nil {
+		return errors.New("该目录已经是备份仓库")
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return errors.New("备份仓库目录必须为空")
+	}
+
+	header, _, err := newHeader(RepositoryVersion, key)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(header, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{repoObjectsDir, repoSnapshotsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(filepath.Join(dir, repoConfigFile), data)
+}
+
+// InitRepository 在 dir 创建用当前数据密钥加密的备份仓库
+func (s *Service) InitRepository(dir string) error {
+	key := s.dataKey()
+	if key.DataKey == nil {
+		return errors.New("not unlocked")
+	}
+	return InitRepository(dir, key)
+}
+
+// OpenRepository 打开备份仓库，密钥不正确时返回 ErrWrongBackupKey
+func OpenRepository(dir string, key Key) (*Repository, error) {
+	data, err := os.ReadFile(filepath.Join(dir, repoConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("该目录不是备份仓库")
+		}
+		return nil, err
+	}
+	var header Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	if header.Version > RepositoryVersion {
+		return nil, fmt.Errorf("不支持的备份仓库版本 %d", header.Version)
+	}
+
+	bk, err := backupKey(&header, key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(cryptoService.KeyID(bk), header.KeyID) {
+		return nil, ErrWrongBackupKey
+	}
+	return &Repository{
+		dir:         dir,
+		objectKey:   cryptoService.DeriveSubKey(bk, repoObjectPurpose),
+		idKey:       cryptoService.DeriveSubKey(bk, repoIDPurpose),
+		snapshotKey: cryptoService.DeriveSubKey(bk, repoSnapshotPurpose),
+	}, nil
+}
+
+// OpenRepository 用当前数据密钥打开备份仓库；锁定后使用解锁期间派生的备份密钥
+func (s *Service) OpenRepository(dir string) (*Repository, error) {
+	s.mu.RLock()
+	key := Key{DataKey: s.masterKey, derivedKey: s.archiveKey}
+	s.mu.RUnlock()
+	return OpenRepository(dir, key)
+}
+
+// Dir 返回仓库所在的目录
+func (r *Repository) Dir() string {
+	return r.dir
+}
+
+// ============ 数据块与快照 ============
+
+func (r *Repository) objectPath(id string) string {
+	return filepath.Join(r.dir, repoObjectsDir, id[:2], id)
+}
+
+func (r *Repository) snapshotPath(id string) string {
+	return filepath.Join(r.dir, repoSnapshotsDir, id+repoSnapshotExt)
+}
+
+func (r *Repository) chunkID(data []byte) string {
+	return hex.EncodeToString(cryptoService.HMAC(r.idKey, data))
+}
+
+// putChunk 写入一个数据块，已存在时跳过，返回是否新写入
+func (r *Repository) putChunk(id string, data []byte) (bool, error) {
+	path := r.objectPath(id)
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+	ciphertext, err := cryptoService.EncryptWithAAD(r.objectKey, data, []byte(id))
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, err
+	}
+	return true, writeFileAtomic(path, ciphertext)
+}
+
+// getChunk 读取并解密数据块，并确认内容与 ID 相符
+func (r *Repository) getChunk(id string) ([]byte, error) {
+	if !isHexID(id) {
+		return nil, ErrBackupCorrupted
+	}
+	ciphertext, err := os.ReadFile(r.objectPath(id))
+	if err != nil {
+		return nil, err
+	}
+	data, err := cryptoService.DecryptWithAAD(r.objectKey, ciphertext, []byte(id))
+	if err != nil || r.chunkID(data) != id {
+		return nil, ErrBackupCorrupted
+	}
+	return data, nil
+}
+
+func (r *Repository) readSnapshot(id string) (*repoSnapshot, error) {
+	ciphertext, err := os.ReadFile(r.snapshotPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSnapshotNotFound
+		}
+		return nil, err
+	}
+	data, err := cryptoService.DecryptWithAAD(r.snapshotKey, ciphertext, []byte(id))
+	if err != nil {
+		return nil, ErrBackupCorrupted
+	}
+	var snap repoSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil || snap.ID != id {
+		return nil, ErrBackupCorrupted
+	}
+	return &snap, nil
+}
+
+func (r *Repository) writeSnapshot(snap *repoSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := cryptoService.EncryptWithAAD(r.snapshotKey, data, []byte(snap.ID))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.snapshotPath(snap.ID), ciphertext)
+}
+
+// snapshotIDs 返回所有快照 ID
+func (r *Repository) snapshotIDs() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.dir, repoSnapshotsDir))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, repoSnapshotExt) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, repoSnapshotExt))
+	}
+	return ids, nil
+}
+
+// loadSnapshots 读取所有快照，按创建时间从新到旧排列；无法读取的快照 ID 单独返回
+func (r *Repository) loadSnapshots() ([]*repoSnapshot, []string, error) {
+	ids, err := r.snapshotIDs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var snaps []*repoSnapshot
+	var bad []string
+	for _, id := range ids {
+		snap, err := r.readSnapshot(id)
+		if err != nil {
+			if errors.Is(err, ErrBackupCorrupted) {
+				bad = append(bad, id)
+				continue
+			}
+			return nil, nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	// RFC3339Nano 会去掉小数末尾的 0，不能按字符串比较
+	sort.SliceStable(snaps, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, snaps[i].CreatedAt)
+		tj, _ := time.Parse(time.RFC3339Nano, snaps[j].CreatedAt)
+		return ti.After(tj)
+	})
+	return snaps, bad, nil
+}
+
+func snapshotInfo(snap *repoSnapshot) *SnapshotInfo {
+	info := &SnapshotInfo{ID: snap.ID, CreatedAt: snap.CreatedAt, Files: len(snap.Entries)}
+	for _, entry := range snap.Entries {
+		info.Size += entry.Size
+	}
+	return info
+}
+
+// ListSnapshots 列出仓库中的快照，按创建时间从新到旧排列
+func (r *Repository) ListSnapshots() ([]*SnapshotInfo, error) {
+	snaps, bad, err := r.loadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("%w: 快照 %s", ErrBackupCorrupted, strings.Join(bad, ", "))
+	}
+	infos := make([]*SnapshotInfo, len(snaps))
+	for i, snap := range snaps {
+		infos[i] = snapshotInfo(snap)
+	}
+	return infos, nil
+}
+
+// ResolveSnapshot 把快照 ID 或唯一前缀解析为完整 ID
+func (r *Repository) ResolveSnapshot(ref string) (string, error) {
+	ids, err := r.snapshotIDs()
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	for _, id := range ids {
+		if id == ref {
+			return id, nil
+		}
+		if strings.HasPrefix(id, ref) {
+			matches = append(matches, id)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	return "", ErrSnapshotNotFound
+}
+
+// ============ 创建快照 ============
+
+// snapshotWriter 把文件切块写入仓库，并统计新写入的数据
+type snapshotWriter struct {
+	repo     *Repository
+	previous map[string]repoEntry
+	info     SnapshotInfo
+	snap     repoSnapshot
+}
+
+func (w *snapshotWriter) addFile(name, src string, modTime int64) error {
+	if prev, ok := w.previous[name]; ok && modTime != 0 && prev.ModTime == modTime {
+		if fi, err := os.Stat(src); err == nil && fi.Size() == prev.Size && w.repo.hasChunks(prev.Chunks) {
+			w.snap.Entries = append(w.snap.Entries, prev)
+			w.info.Reused++
+			return nil
+		}
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry := repoEntry{Path: name, ModTime: modTime}
+	h := sha256.New()
+	buf := make([]byte, repoChunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			h.Write(chunk)
+			id := w.repo.chunkID(chunk)
+			written, putErr := w.repo.putChunk(id, chunk)
+			if putErr != nil {
+				return putErr
+			}
+			if written {
+				w.info.NewChunks++
+				w.info.NewBytes += int64(n)
+			}
+			entry.Chunks = append(entry.Chunks, id)
+			entry.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	w.snap.Entries = append(w.snap.Entries, entry)
+	return nil
+}
+
+func (r *Repository) hasChunks(ids []string) bool {
+	for _, id := range ids {
+		if !isHexID(id) {
+			return false
+		}
+		if _, err := os.Stat(r.objectPath(id)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// BackupToRepository 在仓库中创建数据目录的新快照，只写入有变化的数据块
+func (s *Service) BackupToRepository(repo *Repository) (*SnapshotInfo, error) {
+	w := &snapshotWriter{repo: repo, previous: make(map[string]repoEntry)}
+	snaps, _, err := repo.loadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(snaps) > 0 {
+		for _, entry := range snaps[0].Entries {
+			w.previous[entry.Path] = entry
+		}
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	w.snap.ID = hex.EncodeToString(idBytes)
+	w.snap.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	// 数据库在使用中，先生成一致的快照；快照文件每次都是新的，不按修改时间跳过
+	snapshotDir, err := os.MkdirTemp("", "locknote-backup-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(snapshotDir)
+	snapshotPath := filepath.Join(snapshotDir, "locknote.db")
+	if err := s.db.SnapshotTo(snapshotPath); err != nil {
+		return nil, err
+	}
+	if err := w.addFile("locknote.db", snapshotPath, 0); err != nil {
+		return nil, err
+	}
+	if s.db.Encrypted() {
+		if err := w.addFile(database.UnlockStoreFile, database.UnlockStorePath(snapshotPath), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	err = filepath.Walk(s.dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(s.dataDir, path)
+		if err != nil {
+			return err
+		}
+		if skipBackupEntry(relPath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return w.addFile(filepath.ToSlash(relPath), path, info.ModTime().UnixNano())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 快照清单最后写入，中断时只会留下未被引用的数据块
+	if err := repo.writeSnapshot(&w.snap); err != nil {
+		return nil, err
+	}
+
+	info := snapshotInfo(&w.snap)
+	info.NewChunks = w.info.NewChunks
+	info.NewBytes = w.info.NewBytes
+	info.Reused = w.info.Reused
+	return info, nil
+}
+
+// ============ 恢复 ============
+
+// RestoreSnapshot 把快照中的文件写到 destDir，每个文件拼接后都核对校验和
+func (r *Repository) RestoreSnapshot(id, destDir string) error {
+	snap, err := r.readSnapshot(id)
+	if err != nil {
+		return err
+	}
+	for _, entry := range snap.Entries {
+		name, ok := cleanEntryName(entry.Path)
+		if !ok {
+			return ErrBackupCorrupted
+		}
+
+		h := sha256.New()
+		err := writeEntry(destDir, name, io.TeeReader(&chunkReader{repo: r, chunks: entry.Chunks}, h))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%w: 数据块缺失", ErrBackupCorrupted)
+			}
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != entry.SHA256 {
+			return ErrBackupCorrupted
+		}
+	}
+	return nil
+}
+
+// chunkReader 依次读取并解密一个文件的各个数据块
+type chunkReader struct {
+	repo   *Repository
+	chunks []string
+	buf    []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if len(c.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := c.repo.getChunk(c.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		c.chunks = c.chunks[1:]
+		c.buf = data
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// StageSnapshot 把仓库中的快照恢复到与数据目录同级的暂存目录，返回该目录
+func (s *Service) StageSnapshot(repo *Repository, id string) (string, error) {
+	stagedDir, err := s.newStagingDir()
+	if err != nil {
+		return "", err
+	}
+	if err := repo.RestoreSnapshot(id, stagedDir); err != nil {
+		os.RemoveAll(stagedDir)
+		return "", err
+	}
+	return stagedDir, nil
+}
+
+// ============ 清理与检查 ============
+
+// Prune 按保留策略删除快照，并删除不再被任何快照引用的数据块
+func (r *Repository) Prune(policy RetentionPolicy) (*PruneResult, error) {
+	snaps, bad, err := r.loadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(bad) > 0 {
+		// 无法读取的快照引用了哪些数据块未知，此时清理可能删掉仍需要的数据
+		return nil, fmt.Errorf("%w: 快照 %s，请先运行检查", ErrBackupCorrupted, strings.Join(bad, ", "))
+	}
+
+	times := make([]time.Time, len(snaps))
+	for i, snap := range snaps {
+		t, err := time.Parse(time.RFC3339Nano, snap.CreatedAt)
+		if err != nil {
+			return nil, ErrBackupCorrupted
+		}
+		times[i] = t.Local()
+	}
+	keep := policy.retain(times)
+
+	result := &PruneResult{Snapshots: []string{}}
+	referenced := make(map[string]bool)
+	for i, snap := range snaps {
+		if keep[i] {
+			for _, entry := range snap.Entries {
+				for _, id := range entry.Chunks {
+					referenced[id] = true
+				}
+			}
+			continue
+		}
+		if err := os.Remove(r.snapshotPath(snap.ID)); err != nil {
+			return nil, err
+		}
+		result.Snapshots = append(result.Snapshots, snap.ID)
+	}
+
+	err = r.walkChunks(func(id, path string, size int64) error {
+		if referenced[id] {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		result.Chunks++
+		result.Bytes += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// walkChunks 遍历仓库中的数据块文件，忽略写入中断留下的临时文件
+func (r *Repository) walkChunks(fn func(id, path string, size int64) error) error {
+	return filepath.WalkDir(filepath.Join(r.dir, repoObjectsDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isHexID(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(d.Name(), path, info.Size())
+	})
+}
+
+// Check 读取并解密所有快照与数据块，确认每个快照都能完整恢复
+func (r *Repository) Check() (*RepositoryCheck, error) {
+	snaps, bad, err := r.loadSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	result := &RepositoryCheck{Snapshots: len(snaps) + len(bad)}
+	for _, id := range bad {
+		result.Corrupted = append(result.Corrupted, "snapshot:"+id)
+	}
+
+	chunkOK := make(map[string]bool)
+	err = r.walkChunks(func(id, path string, size int64) error {
+		result.Chunks++
+		if _, err := r.getChunk(id); err != nil {
+			if !errors.Is(err, ErrBackupCorrupted) {
+				return err
+			}
+			result.Corrupted = append(result.Corrupted, id)
+			chunkOK[id] = false
+			return nil
+		}
+		chunkOK[id] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 快照清单经过认证，数据块的 ID 又是内容的 HMAC，
+	// 所以每个被引用的数据块都存在且能通过校验时，文件内容就是完整的
+	referenced := make(map[string]bool)
+	missing := make(map[string]bool)
+	for _, snap := range snaps {
+		for _, entry := range snap.Entries {
+			for _, id := range entry.Chunks {
+				referenced[id] = true
+				if _, exists := chunkOK[id]; !exists {
+					missing[id] = true
+				}
+			}
+		}
+	}
+	for id := range missing {
+		result.Missing = append(result.Missing, id)
+	}
+	sort.Strings(result.Missing)
+	for id := range chunkOK {
+		if !referenced[id] {
+			result.Unreferenced++
+		}
+	}
+	return result, nil
+}
+
+// ============ 工具函数 ============
+
+func isHexID(id string) bool {
+	if len(id) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepository 创建一个数据目录（带数据库与几个密文文件）、使用它的 Service 与一个空的备份仓库
+func newTestRepository(t *testing.T, key Key) (*Service, *Repository) {
+	t.Helper()
+	dataDir := t.TempDir()
+	db, err := database.New(filepath.Join(dataDir, "locknote.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewService(db, dataDir)
+
+	writeDataFile(t, s, "notes/a.enc", randomBytes(repoChunkSize+1000))
+	writeDataFile(t, s, "history/b.enc", randomBytes(1000))
+	writeDataFile(t, s, "notes/temp.enc.tmp", []byte("partial"))
+
+	repoDir := t.TempDir()
+	if err := InitRepository(repoDir, key); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := OpenRepository(repoDir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, repo
+}
+
+func writeDataFile(t *testing.T, s *Service, rel string, data []byte) {
+	t.Helper()
+	path := filepath.Join(s.dataDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTree 读取 dir 下的所有文件，键为斜杠分隔的相对路径
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = data
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// checkRestored 确认快照恢复出的文件与 want 相同，并且带有数据库
+func checkRestored(t *testing.T, repo *Repository, id string, want map[string][]byte) {
+	t.Helper()
+	dest := t.TempDir()
+	if err := repo.RestoreSnapshot(id, dest); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	got := readTree(t, dest)
+	if _, ok := got["locknote.db"]; !ok {
+		t.Fatal("snapshot has no database")
+	}
+	delete(got, "locknote.db")
+	if len(got) != len(want) {
+		t.Fatalf("restored %d files, want %d", len(got), len(want))
+	}
+	for name, data := range want {
+		if !bytes.Equal(got[name], data) {
+			t.Fatalf("%s differs after restore", name)
+		}
+	}
+}
+
+func TestRepositoryRoundTrip(t *testing.T) {
+	key := testDataKey(t)
+	s, repo := newTestRepository(t, key)
+	first := readTree(t, s.dataDir)
+	delete(first, "notes/temp.enc.tmp")
+	delete(first, "locknote.db")
+
+	snap1, err := s.BackupToRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap1.Files != 3 || snap1.NewChunks < 3 || snap1.Reused != 0 {
+		t.Fatalf("first snapshot = %+v", snap1)
+	}
+
+	writeDataFile(t, s, "notes/c.enc", randomBytes(500))
+	second := readTree(t, s.dataDir)
+	delete(second, "notes/temp.enc.tmp")
+	delete(second, "locknote.db")
+
+	snap2, err := s.BackupToRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未变化的两个文件直接复用，数据库快照的内容相同也不会新写入数据块
+	if snap2.Files != 4 || snap2.Reused != 2 || snap2.NewChunks != 1 {
+		t.Fatalf("second snapshot = %+v", snap2)
+	}
+
+	snaps, err := repo.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].ID != snap2.ID || snaps[1].ID != snap1.ID {
+		t.Fatalf("ListSnapshots = %+v", snaps)
+	}
+	if id, err := repo.ResolveSnapshot(snap1.ID[:6]); err != nil || id != snap1.ID {
+		t.Fatalf("ResolveSnapshot = %q, %v", id, err)
+	}
+	if _, err := repo.ResolveSnapshot("zz"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("ResolveSnapshot(unknown) = %v", err)
+	}
+
+	checkRestored(t, repo, snap1.ID, first)
+	checkRestored(t, repo, snap2.ID, second)
+
+	check, err := repo.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.OK() || check.Snapshots != 2 || check.Unreferenced != 0 {
+		t.Fatalf("Check = %+v", check)
+	}
+}
+
+func TestRepositoryKeys(t *testing.T) {
+	key := testDataKey(t)
+	_, repo := newTestRepository(t, key)
+
+	if _, err := OpenRepository(repo.Dir(), testDataKey(t)); !errors.Is(err, ErrWrongBackupKey) {
+		t.Fatalf("OpenRepository with another key = %v", err)
+	}
+	if _, err := OpenRepository(t.TempDir(), key); err == nil {
+		t.Fatal("opened a directory that is not a repository")
+	}
+	if err := InitRepository(repo.Dir(), key); err == nil {
+		t.Fatal("initialized an existing repository again")
+	}
+}
+
+func TestRepositoryPrune(t *testing.T) {
+	s, repo := newTestRepository(t, testDataKey(t))
+	old, err := s.BackupToRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(s.dataDir, "notes", "a.enc")); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.BackupToRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个快照在同一天，只保留最新的一个；只被旧快照引用的 a.enc 的两个数据块随之删除
+	result, err := repo.Prune(RetentionPolicy{KeepDaily: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Snapshots) != 1 || result.Snapshots[0] != old.ID || result.Chunks != 2 {
+		t.Fatalf("Prune = %+v", result)
+	}
+	snaps, err := repo.ListSnapshots()
+	if err != nil || len(snaps) != 1 || snaps[0].ID != kept.ID {
+		t.Fatalf("ListSnapshots after prune = %+v, %v", snaps, err)
+	}
+	check, err := repo.Check()
+	if err != nil || !check.OK() || check.Unreferenced != 0 {
+		t.Fatalf("Check after prune = %+v, %v", check, err)
+	}
+	if _, err := os.Stat(repo.snapshotPath(old.ID)); !os.IsNotExist(err) {
+		t.Fatalf("pruned snapshot still exists: %v", err)
+	}
+}
+
+func TestRepositoryCheckDetectsDamage(t *testing.T) {
+	s, repo := newTestRepository(t, testDataKey(t))
+	info, err := s.BackupToRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := repo.readSnapshot(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []string
+	for _, entry := range snap.Entries {
+		if entry.Path == "notes/a.enc" {
+			chunks = entry.Chunks
+		}
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("notes/a.enc has %d chunks", len(chunks))
+	}
+
+	corrupted, missing := chunks[0], chunks[1]
+	data, err := os.ReadFile(repo.objectPath(corrupted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(repo.objectPath(corrupted), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(repo.objectPath(missing)); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := repo.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.OK() || len(check.Corrupted) != 1 || check.Corrupted[0] != corrupted ||
+		len(check.Missing) != 1 || check.Missing[0] != missing {
+		t.Fatalf("Check = %+v", check)
+	}
+	if err := repo.RestoreSnapshot(info.ID, t.TempDir()); !errors.Is(err, ErrBackupCorrupted) {
+		t.Fatalf("RestoreSnapshot of a damaged snapshot = %v", err)
+	}
+
+	// 快照清单被改动后无法读取，清理拒绝执行
+	path := repo.snapshotPath(info.ID)
+	if data, err = os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if check, err = repo.Check(); err != nil || len(check.Corrupted) != 2 {
+		t.Fatalf("Check with a damaged snapshot = %+v, %v", check, err)
+	}
+	if _, err := repo.Prune(RetentionPolicy{KeepDaily: 1}); !errors.Is(err, ErrBackupCorrupted) {
+		t.Fatalf("Prune with a damaged snapshot = %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scheduleStateFile 记录上一次定时备份的时间与数据指纹
+const scheduleStateFile = "backup_schedule.json"
+
+// 定时备份的文件名，只有符合该格式的文件才会被保留策略清理
+const scheduledTimeLayout = "20060102-150405"
+
+var scheduledNamePattern = regexp.MustCompile(`^locknote-(\d{8}-\d{6})\.locknote$`)
+
+// 定时备份跳过的原因
+const (
+	SkipUnchanged = "unchanged" // 数据自上次备份以来没有变化
+	SkipLocked    = "locked"    // 本次启动后尚未解锁过，没有备份密钥
+)
+
+// ScheduledResult 是一次定时备份的结果
+type ScheduledResult struct {
+	Time    string   `json:"time"`
+	Path    string   `json:"path,omitempty"`
+	Skipped string   `json:"skipped,omitempty"`
+	Removed []string `json:"removed,omitempty"` // 按保留策略删除的旧备份
+	Error   string   `json:"error,omitempty"`
+}
+
+// RetentionPolicy 是定时备份与备份仓库快照的保留策略：保留最近 KeepDaily 天每天最新的一份，
+// 以及最近 KeepWeekly 周每周最新的一份；最新的一份总是保留
+type RetentionPolicy struct {
+	KeepDaily  int
+	KeepWeekly int
+}
+
+// retain 对按时间从新到旧排列的备份返回哪些应当保留
+func (p RetentionPolicy) retain(times []time.Time) []bool {
+	keep := make([]bool, len(times))
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for i, t := range times {
+		if i == 0 {
+			keep[i] = true
+		}
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < p.KeepDaily {
+			days[day] = true
+			keep[i] = true
+		}
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%02d", year, week)
+		if !weeks[weekKey] && len(weeks) < p.KeepWeekly {
+			weeks[weekKey] = true
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+type scheduleState struct {
+	LastRun     string `json:"lastRun"`
+	LastBackup  string `json:"lastBackup,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+func (s *Service) scheduleStatePath() string {
+	return filepath.Join(s.dataDir, scheduleStateFile)
+}
+
+func (s *Service) readScheduleState() *scheduleState {
+	var state scheduleState
+	data, err := os.ReadFile(s.scheduleStatePath())
+	if err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return &state
+}
+
+func (s *Service) writeScheduleState(state *scheduleState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.scheduleStatePath(), data)
+}
+
+// LastScheduledRun 返回上一次运行定时备份的时间，从未运行过时返回零值
+func (s *Service) LastScheduledRun() time.Time {
+	t, _ := time.Parse(time.RFC3339, s.readScheduleState().LastRun)
+	return t
+}
+
+// fingerprint 根据数据目录中各文件的路径、大小与修改时间计算指纹，用于判断数据是否有变化
+func (s *Service) fingerprint(targetDir string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", filepath.Clean(targetDir))
+	err := filepath.Walk(s.dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dataDir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "locknote.db" && rel != database.UnlockStoreFile && skipBackupEntry(rel, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CreateScheduledBackup 在数据有变化时向 targetDir 写入一份定时备份，并按保留策略清理旧备份。
+// 已锁定时使用解锁期间派生的备份密钥，只读取密文，不需要数据密钥。
+func (s *Service) CreateScheduledBackup(targetDir string, policy RetentionPolicy) (*ScheduledResult, error) {
+	now := time.Now()
+	result := &ScheduledResult{Time: now.UTC().Format(time.RFC3339)}
+
+	s.mu.RLock()
+	key := Key{DataKey: s.masterKey, derivedKey: s.archiveKey}
+	s.mu.RUnlock()
+	if key.DataKey == nil && key.derivedKey == nil {
+		result.Skipped = SkipLocked
+		return result, nil
+	}
+
+	state := s.readScheduleState()
+	state.LastRun = result.Time
+	fail := func(err error) (*ScheduledResult, error) {
+		result.Error = err.Error()
+		_ = s.writeScheduleState(state)
+		return result, err
+	}
+
+	fp, err := s.fingerprint(targetDir)
+	if err != nil {
+		return fail(err)
+	}
+	if fp == state.Fingerprint && state.LastBackup != "" {
+		if _, err := os.Stat(state.LastBackup); err == nil {
+			result.Skipped = SkipUnchanged
+			return result, s.writeScheduleState(state)
+		}
+	}
+
+	if err := os.MkdirAll(targetDir, 0700); err != nil {
+		return fail(err)
+	}
+	path := filepath.Join(targetDir, "locknote-"+now.Format(scheduledTimeLayout)+".locknote")
+	if err := s.createArchive(path, key); err != nil {
+		return fail(err)
+	}
+	result.Path = path
+	state.LastBackup = path
+	state.Fingerprint = fp
+
+	removed, err := PruneScheduledBackups(targetDir, policy)
+	result.Removed = removed
+	if err != nil {
+		return fail(err)
+	}
+	return result, s.writeScheduleState(state)
+}
+
+// PruneScheduledBackups 按保留策略删除 dir 中多余的定时备份，返回被删除的文件名。
+// 只处理符合定时备份命名格式的文件
+func PruneScheduledBackups(dir string, policy RetentionPolicy) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type scheduled struct {
+		name string
+		time time.Time
+	}
+	var backups []scheduled
+	for _, entry := range entries {
+		m := scheduledNamePattern.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation(scheduledTimeLayout, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, scheduled{name: entry.Name(), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+
+	times := make([]time.Time, len(backups))
+	for i, b := range backups {
+		times[i] = b.time
+	}
+	keep := policy.retain(times)
+
+	var removed []string
+	var errs []string
+	for i, b := range backups {
+		if keep[i] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, b.name)); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		removed = append(removed, b.name)
+	}
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("清理旧备份失败: %s", strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
@@ -0,0 +1,578 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"locknote/internal/backup"
+	"locknote/internal/database"
+	"locknote/internal/notes"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 备份中的笔记与当前数据比较的结果
+const (
+	BackupNoteNew           = "new"           // 当前数据中没有该笔记
+	BackupNoteSame          = "same"          // 正文、标签、笔记本与状态都相同
+	BackupNoteChanged       = "changed"       // 当前数据中的同一笔记已被修改
+	BackupNoteUndecryptable = "undecryptable" // 无法用给定的恢复密钥解密
+)
+
+// 选择性恢复笔记的方式
+const (
+	RestoreAsCopy    = "copy"      // 作为新笔记恢复，不影响当前笔记
+	RestoreOverwrite = "overwrite" // 覆盖 ID 相同的笔记，被覆盖的版本保存到历史
+)
+
+// attachmentLinkPrefix 是笔记正文中引用附件的链接前缀
+const attachmentLinkPrefix = "attachment://"
+
+// BackupNote 是备份中的一篇笔记及其与当前数据的差异
+type BackupNote struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Preview     string   `json:"preview"`
+	Tags        []string `json:"tags"`
+	Notebook    string   `json:"notebook,omitempty"`
+	Pinned      bool     `json:"pinned"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+	DeletedAt   *string  `json:"deletedAt,omitempty"`
+	History     int      `json:"history"`
+	Attachments int      `json:"attachments"`
+	Status      string   `json:"status"`
+}
+
+// NotesRestoreResult 是选择性恢复笔记的结果
+type NotesRestoreResult struct {
+	Restored map[string]string `json:"restored"`         // 备份中的笔记 ID -> 恢复后的笔记 ID
+	Failed   map[string]string `json:"failed,omitempty"` // 备份中的笔记 ID -> 失败原因
+}
+
+// BackupView 是以只读方式打开的备份：备份被解压到临时目录，用恢复密钥解密其中的笔记。
+// 同一时间只有一个打开的备份，锁定时自动关闭。
+type BackupView struct {
+	mu     sync.RWMutex
+	source string
+	dir    string
+	store  *Core // 打开在临时目录上的数据，关闭后为 nil
+}
+
+// OpenBackup 以只读方式打开备份。displayKey 是备份数据的恢复密钥，为空时使用当前数据密钥；
+// passphrase 不为空时用它打开使用备份口令创建的备份，否则用数据密钥打开
+func (c *Core) OpenBackup(inputPath, passphrase, displayKey string) (*BackupView, error) {
+	view, err := c.openBackupView(inputPath, passphrase, displayKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	previous := c.backupView
+	c.backupView = view
+	c.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return view, nil
+}
+
+// openBackupView 打开备份但不登记为当前打开的备份，调用方负责关闭
+func (c *Core) openBackupView(inputPath, passphrase, displayKey string) (*BackupView, error) {
+	c.mu.RLock()
+	dataKey := append([]byte(nil), c.dataKey...)
+	unlocked := c.isUnlocked
+	c.mu.RUnlock()
+	if !unlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	if displayKey != "" {
+		key, err := c.cryptoService.ParseDisplayKey(displayKey)
+		if err != nil {
+			return nil, errors.New("无效的密钥格式")
+		}
+		dataKey = key
+	}
+	archiveKey := backup.Key{DataKey: dataKey}
+	if passphrase != "" {
+		archiveKey = backup.Key{Passphrase: passphrase}
+	}
+
+	tempDir, err := c.backupService.ExtractBackupToTempWithKey(inputPath, archiveKey)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openBackupStore(tempDir, dataKey)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return &BackupView{source: inputPath, dir: tempDir, store: store}, nil
+}
+
+// openBackupStore 在解压出的备份目录上打开数据并用 dataKey 解锁，旧格式的数据在临时副本上升级
+func openBackupStore(dir string, dataKey []byte) (*Core, error) {
+	store, err := New(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fail := func(err error) (*Core, error) {
+		store.db.Close()
+		return nil, err
+	}
+	if !store.db.HasMasterPassword() {
+		return fail(errors.New("备份中没有主密码信息"))
+	}
+	// 很早的备份没有数据密钥校验文件，只能在读取笔记时逐篇判断能否解密
+	if _, err := os.Stat(store.dataKeyVerifierFilePath()); err == nil {
+		ok, err := store.verifyDataKeyWithFile(dataKey)
+		if err != nil {
+			return fail(err)
+		}
+		if !ok {
+			return fail(errors.New("密钥与备份中的数据不匹配"))
+		}
+	}
+	if err := store.unlockDatabase(dataKey); err != nil {
+		return fail(err)
+	}
+
+	mp, err := store.db.GetMasterPassword()
+	if err != nil {
+		return fail(err)
+	}
+	if mp.DataVersion < dataFormatVersion {
+		if err := store.upgradeData(dataKey); err != nil {
+			return fail(err)
+		}
+	}
+	store.dataKey = dataKey
+	store.isUnlocked = true
+	store.setServiceKeys(dataKey)
+	return store, nil
+}
+
+// Source 返回备份文件的路径
+func (v *BackupView) Source() string {
+	return v.source
+}
+
+// Close 关闭备份并删除解压出的临时数据，可重复调用
+func (v *BackupView) Close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.store == nil {
+		return
+	}
+	v.store.setServiceKeys(nil)
+	v.store.db.Close()
+	v.store = nil
+	os.RemoveAll(v.dir)
+}
+
+func (v *BackupView) acquire() (*Core, error) {
+	v.mu.RLock()
+	if v.store == nil {
+		v.mu.RUnlock()
+		return nil, errors.New("备份已关闭")
+	}
+	return v.store, nil
+}
+
+// closeBackupView 关闭打开的备份，调用方需持有 c.mu。
+// 正在使用备份的操作会等待 c.mu，因此在后台关闭，避免互相等待
+func (c *Core) closeBackupView() {
+	if view := c.backupView; view != nil {
+		c.backupView = nil
+		go view.Close()
+	}
+}
+
+// Get 返回备份中的一篇笔记，NotebookID 与标签 ID 是备份中的 ID
+func (v *BackupView) Get(id string) (*notes.Note, error) {
+	store, err := v.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer v.mu.RUnlock()
+	return store.noteService.Get(id)
+}
+
+// BackupNotes 列出备份中的全部笔记（含回收站），并与当前数据比较
+func (c *Core) BackupNotes(v *BackupView) ([]*BackupNote, error) {
+	store, err := v.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer v.mu.RUnlock()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	metas, err := store.db.ListNotes(true)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := store.noteService.ListFromMetas(metas)
+	if err != nil {
+		return nil, err
+	}
+	decryptable := make(map[string]*notes.Note, len(summaries))
+	for _, n := range summaries {
+		decryptable[n.ID] = n
+	}
+
+	backupNotebooks, err := store.notebookNames()
+	if err != nil {
+		return nil, err
+	}
+	currentNotebooks, err := c.notebookNames()
+	if err != nil {
+		return nil, err
+	}
+	historyCounts := make(map[string]int)
+	if history, err := store.db.ListAllNoteHistory(); err == nil {
+		for _, h := range history {
+			historyCounts[h.NoteID]++
+		}
+	}
+	attachmentCounts := make(map[string]int)
+	if attachments, err := store.db.ListAllAttachments(); err == nil {
+		for _, a := range attachments {
+			attachmentCounts[a.NoteID]++
+		}
+	}
+
+	result := make([]*BackupNote, 0, len(metas))
+	for _, meta := range metas {
+		entry := &BackupNote{
+			ID:          meta.ID,
+			Tags:        []string{},
+			Pinned:      meta.Pinned,
+			CreatedAt:   meta.CreatedAt.Format(time.RFC3339Nano),
+			UpdatedAt:   meta.UpdatedAt.Format(time.RFC3339Nano),
+			History:     historyCounts[meta.ID],
+			Attachments: attachmentCounts[meta.ID],
+		}
+		if meta.DeletedAt != nil {
+			s := meta.DeletedAt.Format(time.RFC3339Nano)
+			entry.DeletedAt = &s
+		}
+		if meta.NotebookID != nil {
+			entry.Notebook = backupNotebooks[*meta.NotebookID]
+		}
+		result = append(result, entry)
+
+		summary := decryptable[meta.ID]
+		if summary == nil {
+			entry.Status = BackupNoteUndecryptable
+			continue
+		}
+		entry.Title = summary.Title
+		entry.Preview = summary.Content
+		for _, t := range summary.Tags {
+			entry.Tags = append(entry.Tags, t.Name)
+		}
+		sort.Strings(entry.Tags)
+
+		entry.Status, err = c.compareBackupNote(store, meta, entry, currentNotebooks)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// compareBackupNote 比较备份中的笔记与当前数据中 ID 相同的笔记，调用方需持有 c.mu
+func (c *Core) compareBackupNote(store *Core, meta *database.NoteMeta, entry *BackupNote, currentNotebooks map[string]string) (string, error) {
+	current, err := c.db.GetNote(meta.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BackupNoteNew, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	backupContent, err := store.noteService.ReadContent(meta)
+	if err != nil {
+		return BackupNoteUndecryptable, nil
+	}
+	currentContent, err := c.noteService.ReadContent(current)
+	if err != nil || *currentContent != *backupContent {
+		return BackupNoteChanged, nil
+	}
+
+	var notebook string
+	if current.NotebookID != nil {
+		notebook = currentNotebooks[*current.NotebookID]
+	}
+	if notebook != entry.Notebook || current.Pinned != meta.Pinned || (current.DeletedAt == nil) != (meta.DeletedAt == nil) {
+		return BackupNoteChanged, nil
+	}
+
+	currentTags, err := c.tagService.NoteTags(meta.ID)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(currentTags))
+	for _, t := range currentTags {
+		names = append(names, t.Name)
+	}
+	if strings.Join(names, "\x00") != strings.Join(entry.Tags, "\x00") {
+		return BackupNoteChanged, nil
+	}
+	return BackupNoteSame, nil
+}
+
+// notebookNames 返回笔记本 ID 到名称的映射，调用方需持有 c.mu
+func (c *Core) notebookNames() (map[string]string, error) {
+	notebooks, err := c.notebookService.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(notebooks))
+	for _, nb := range notebooks {
+		names[nb.ID] = nb.Name
+	}
+	return names, nil
+}
+
+// RestoreNotesFromBackup 把备份中的 ids 恢复到当前数据，mode 为 RestoreAsCopy 或 RestoreOverwrite。
+// 笔记的日期、置顶、回收站状态、历史版本与附件随之恢复，标签与笔记本按名称对应，不存在时创建。
+// 单篇笔记失败不影响其他笔记，失败原因记录在结果中。
+func (c *Core) RestoreNotesFromBackup(v *BackupView, ids []string, mode string) (*NotesRestoreResult, error) {
+	if mode != RestoreAsCopy && mode != RestoreOverwrite {
+		return nil, fmt.Errorf("未知的恢复方式: %s", mode)
+	}
+	store, err := v.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer v.mu.RUnlock()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	imp := c.newBackupImport(store)
+	result := &NotesRestoreResult{Restored: make(map[string]string), Failed: make(map[string]string)}
+	for _, id := range ids {
+		newID := id
+		if mode == RestoreAsCopy {
+			newID = uuid.New().String()
+		}
+		if err := imp.restoreNote(id, newID); err != nil {
+			result.Failed[id] = err.Error()
+			continue
+		}
+		result.Restored[id] = newID
+	}
+	return result, nil
+}
+
+// backupImport 把备份中的笔记写入当前数据：标签与笔记本按名称对应（不存在时创建），并统计写入的内容。
+// 调用方需持有 c.mu 的读锁与备份的读锁
+type backupImport struct {
+	c     *Core
+	store *Core
+
+	notebooks map[string]string // 备份中的笔记本 ID -> 当前数据中的 ID
+	tags      map[string]string // 备份中的标签 ID -> 当前数据中的 ID
+
+	notebooksCreated int
+	tagsCreated      int
+	history          int
+	attachments      int
+}
+
+func (c *Core) newBackupImport(store *Core) *backupImport {
+	return &backupImport{
+		c:         c,
+		store:     store,
+		notebooks: make(map[string]string),
+		tags:      make(map[string]string),
+	}
+}
+
+// restoreNote 把备份中的笔记 id 以 newID 写入当前数据，newID 已存在时覆盖
+func (imp *backupImport) restoreNote(id, newID string) error {
+	c, store := imp.c, imp.store
+	record, err := store.noteService.ReadRecord(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("备份中没有该笔记")
+		}
+		return fmt.Errorf("无法解密: %w", err)
+	}
+
+	// 附件尽量保留原 ID；ID 已被占用时换用新 ID，并改写正文中的链接。
+	// 覆盖笔记时已在该笔记上的附件保持不变
+	attachments, err := store.db.ListAttachments(id)
+	if err != nil {
+		return err
+	}
+	var toCopy []*database.Attachment
+	newAttachmentIDs := make(map[string]string)
+	for _, a := range attachments {
+		existing, err := c.db.GetAttachment(a.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if existing != nil && existing.NoteID == newID {
+			continue
+		}
+		toCopy = append(toCopy, a)
+		if existing != nil {
+			newAttachmentIDs[a.ID] = uuid.New().String()
+		}
+	}
+	if len(newAttachmentIDs) > 0 {
+		record.Content.Content = rewriteAttachmentLinks(record.Content.Content, newAttachmentIDs)
+		for i := range record.History {
+			record.History[i].Content.Content = rewriteAttachmentLinks(record.History[i].Content.Content, newAttachmentIDs)
+		}
+	}
+
+	var notebookID *string
+	if record.Meta.NotebookID != nil {
+		if notebookID, err = imp.notebook(*record.Meta.NotebookID); err != nil {
+			return err
+		}
+	}
+	backupTags, err := store.db.GetNoteTags(id)
+	if err != nil {
+		return err
+	}
+	tagIDs := make([]string, 0, len(backupTags))
+	for _, t := range backupTags {
+		tagID, err := imp.tag(t.ID)
+		if err != nil {
+			return err
+		}
+		if tagID != "" {
+			tagIDs = append(tagIDs, tagID)
+		}
+	}
+
+	record.Meta.ID = newID
+	record.Meta.NotebookID = notebookID
+	if err := c.noteService.PutRecord(record); err != nil {
+		return err
+	}
+	imp.history += len(record.History)
+	if err := c.db.SetNoteTags(newID, tagIDs); err != nil {
+		return err
+	}
+
+	for _, a := range toCopy {
+		attachmentID := a.ID
+		if mapped, ok := newAttachmentIDs[a.ID]; ok {
+			attachmentID = mapped
+		}
+		if err := imp.copyAttachment(a, attachmentID, newID); err != nil {
+			return fmt.Errorf("恢复附件失败: %w", err)
+		}
+		imp.attachments++
+	}
+	return nil
+}
+
+func (imp *backupImport) copyAttachment(a *database.Attachment, attachmentID, noteID string) error {
+	rc, info, err := imp.store.attachmentService.Open(a.ID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = imp.c.attachmentService.Import(attachmentID, noteID, info.Filename, info.Mime, a.CreatedAt, rc)
+	return err
+}
+
+func rewriteAttachmentLinks(content string, ids map[string]string) string {
+	for oldID, newID := range ids {
+		content = strings.ReplaceAll(content, attachmentLinkPrefix+oldID, attachmentLinkPrefix+newID)
+	}
+	return content
+}
+
+// notebook 返回备份中笔记本在当前数据中按名称对应的笔记本 ID，不存在时创建；
+// 备份中没有该笔记本时返回 nil
+func (imp *backupImport) notebook(backupID string) (*string, error) {
+	if id, ok := imp.notebooks[backupID]; ok {
+		return &id, nil
+	}
+	notebook, err := imp.store.notebookService.Get(backupID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	current, err := imp.c.notebookService.List()
+	if err != nil {
+		return nil, err
+	}
+	id := ""
+	for _, nb := range current {
+		if nb.Name == notebook.Name {
+			id = nb.ID
+			break
+		}
+	}
+	if id == "" {
+		created, err := imp.c.notebookService.Create(notebook.Name, notebook.Icon)
+		if err != nil {
+			return nil, err
+		}
+		id = created.ID
+		imp.notebooksCreated++
+	}
+	imp.notebooks[backupID] = id
+	return &id, nil
+}
+
+// tag 返回备份中标签在当前数据中按名称对应的标签 ID，不存在时创建；备份中没有该标签时返回空字符串
+func (imp *backupImport) tag(backupID string) (string, error) {
+	if id, ok := imp.tags[backupID]; ok {
+		return id, nil
+	}
+	tag, err := imp.store.tagService.Get(backupID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var id string
+	if existing, err := imp.c.tagService.GetByName(tag.Name); err == nil {
+		id = existing.ID
+	} else if errors.Is(err, sql.ErrNoRows) {
+		created, err := imp.c.tagService.Create(tag.Name, tag.Color)
+		if err != nil {
+			return "", err
+		}
+		id = created.ID
+		imp.tagsCreated++
+	} else {
+		return "", err
+	}
+	imp.tags[backupID] = id
+	return id, nil
+}
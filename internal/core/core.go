@@ -7,12 +7,14 @@ package core
 import (
 	"errors"
 	"fmt"
+	"locknote/internal/attachments"
 	"locknote/internal/backup"
 	"locknote/internal/crypto"
 	"locknote/internal/database"
 	"locknote/internal/notebooks"
 	"locknote/internal/notes"
 	"locknote/internal/smartviews"
+	locksync "locknote/internal/sync"
 	"locknote/internal/tags"
 	"os"
 	"path/filepath"
@@ -22,26 +24,46 @@ import (
 
 const dataKeyVerifierPlaintext = "LOCKNOTE_DATAKEY_VERIFY_V1"
 
+// dataFormatVersion 是数据的加密格式版本，低于此版本的数据在解锁时升级。
+// 1: 版本化信封
+// 2: 笔记密文绑定笔记 ID 与字段
+const dataFormatVersion = 2
+
 // LockCallback 是锁定时的回调函数类型，用于通知上层（如桌面端发送事件）
 type LockCallback func()
 
 // Core 是 LockNote 的核心业务逻辑层，与平台无关
 type Core struct {
-	db               *database.DB
-	cryptoService    *crypto.Service
-	noteService      *notes.Service
-	tagService       *tags.Service
-	notebookService  *notebooks.Service
-	smartViewService *smartviews.Service
-	backupService    *backup.Service
-	dataDir          string
-
-	isUnlocked   bool
-	dataKey      []byte
-	mu           sync.RWMutex
+	db                *database.DB
+	cryptoService     *crypto.Service
+	noteService       *notes.Service
+	tagService        *tags.Service
+	notebookService   *notebooks.Service
+	smartViewService  *smartviews.Service
+	backupService     *backup.Service
+	attachmentService *attachments.Service
+	syncService       *locksync.Service
+	dataDir           string
+
+	isUnlocked bool
+	dataKey    []byte
+	keyfile    []byte // 解锁时提供的密钥文件摘要
+	mu         sync.RWMutex
+	// dataMu 串行化定时备份与更换数据密钥、恢复备份等改写数据目录的操作。
+	// 定时备份只持有 dataMu，不阻塞锁定；需要同时持有时先获取 dataMu 再获取 mu
+	dataMu       sync.Mutex
 	lastActivity time.Time
 	lockTimer    *time.Timer
 	lockCallback LockCallback
+	powerSource  PowerSource
+
+	notebookLockCallback func(id string)
+
+	backupStop     chan struct{}
+	backupCallback BackupCallback
+	backupView     *BackupView
+
+	rotatedDataKey string
 }
 
 // SetupResult 是初始化密码后的返回结果
@@ -52,18 +74,33 @@ type SetupResult struct {
 // New 创建一个新的 Core 实例
 // dataDir: 数据目录路径（由上层根据平台决定）
 func New(dataDir string) (*Core, error) {
+	c := &Core{
+		cryptoService: crypto.NewService(),
+		dataDir:       dataDir,
+		lastActivity:  time.Now(),
+	}
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// open 打开数据目录中的数据库并创建各服务，恢复备份替换数据目录后也用它重新打开
+func (c *Core) open() error {
+	dataDir := c.dataDir
+
 	// 确保目录存在
 	if err := os.MkdirAll(dataDir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create data dir: %w", err)
+		return fmt.Errorf("failed to create data dir: %w", err)
 	}
 	if err := os.MkdirAll(filepath.Join(dataDir, "notes"), 0700); err != nil {
-		return nil, fmt.Errorf("failed to create notes dir: %w", err)
+		return fmt.Errorf("failed to create notes dir: %w", err)
 	}
 	if err := os.MkdirAll(filepath.Join(dataDir, "attachments"), 0700); err != nil {
-		return nil, fmt.Errorf("failed to create attachments dir: %w", err)
+		return fmt.Errorf("failed to create attachments dir: %w", err)
 	}
 	if err := os.MkdirAll(filepath.Join(dataDir, "history"), 0700); err != nil {
-		return nil, fmt.Errorf("failed to create history dir: %w", err)
+		return fmt.Errorf("failed to create history dir: %w", err)
 	}
 
 	// 处理旧版数据库迁移
@@ -77,27 +114,32 @@ func New(dataDir string) (*Core, error) {
 
 	db, err := database.New(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return fmt.Errorf("failed to open database: %w", err)
 	}
 
-	c := &Core{
-		db:               db,
-		cryptoService:    crypto.NewService(),
-		noteService:      notes.NewService(db, dataDir),
-		tagService:       tags.NewService(db),
-		notebookService:  notebooks.NewService(db),
-		smartViewService: smartviews.NewService(db),
-		backupService:    backup.NewService(dataDir),
-		dataDir:          dataDir,
-		lastActivity:     time.Now(),
-	}
+	notebookService := notebooks.NewService(db)
+	notebookService.SetLockCallback(c.notebookLockCallback)
+	noteService := notes.NewService(db, dataDir, notebookService)
 
-	return c, nil
+	c.db = db
+	c.noteService = noteService
+	c.tagService = tags.NewService(db)
+	c.notebookService = notebookService
+	c.smartViewService = smartviews.NewService(db, noteService)
+	c.backupService = backup.NewService(db, dataDir)
+	c.attachmentService = attachments.NewService(db, dataDir)
+	c.syncService = locksync.NewService(db, dataDir, noteService)
+	return nil
 }
 
 // Close 关闭 Core，释放资源
 func (c *Core) Close() {
+	c.StopPowerMonitor()
+	c.StopBackupScheduler()
 	c.Lock()
+	// 等待正在运行的定时备份
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
 	if c.db != nil {
 		c.db.Close()
 	}
@@ -150,40 +192,44 @@ func (c *Core) verifyDataKeyWithFile(dataKey []byte) (bool, error) {
 	return string(plaintext) == dataKeyVerifierPlaintext, nil
 }
 
-// SetupPassword 初始化主密码（首次运行时调用）
-func (c *Core) SetupPassword(password, hint, displayKey string) (*SetupResult, error) {
+// setServiceKeys 设置（key 为 nil 时清除）各服务使用的数据密钥
+func (c *Core) setServiceKeys(key []byte) {
+	c.noteService.SetMasterKey(key)
+	c.attachmentService.SetMasterKey(key)
+	c.backupService.SetMasterKey(key)
+	c.syncService.SetMasterKey(key)
+	c.tagService.SetMasterKey(key)
+	c.notebookService.SetMasterKey(key)
+	c.smartViewService.SetMasterKey(key)
+}
+
+// SetupPassword 初始化主密码（首次运行时调用），keyfile 不为空时解锁还需要该密钥文件
+func (c *Core) SetupPassword(password, hint, displayKey, keyfile string) (*SetupResult, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	salt, err := c.cryptoService.GenerateSalt()
+	keyfileDigest, err := c.readKeyfile(keyfile)
 	if err != nil {
 		return nil, err
 	}
-
-	passwordKey := c.cryptoService.DeriveKey(password, salt)
 	dataKey := c.cryptoService.DeriveDataKey(displayKey)
-
-	encryptedDataKey, err := c.cryptoService.Encrypt(passwordKey, dataKey)
-	if err != nil {
+	if err := c.saveMasterPassword(password, keyfileDigest, hint, dataKey); err != nil {
 		return nil, err
 	}
-
-	verifier, err := c.cryptoService.Encrypt(passwordKey, []byte("LOCKNOTE_VERIFY"))
-	if err != nil {
+	if err := c.db.SetDataVersion(dataFormatVersion); err != nil {
 		return nil, err
 	}
-
-	err = c.db.SaveMasterPassword(salt, verifier, hint, encryptedDataKey)
-	if err != nil {
+	if err := c.writeDataKeyVerifierFile(dataKey); err != nil {
 		return nil, err
 	}
-	if err := c.writeDataKeyVerifierFile(dataKey); err != nil {
+	if err := c.resetThrottle(); err != nil {
 		return nil, err
 	}
 
 	c.dataKey = dataKey
+	c.keyfile = keyfileDigest
 	c.isUnlocked = true
-	c.noteService.SetMasterKey(dataKey)
+	c.setServiceKeys(dataKey)
 	c.lastActivity = time.Now()
 	c.startLockTimer()
 
@@ -192,8 +238,10 @@ func (c *Core) SetupPassword(password, hint, displayKey string) (*SetupResult, e
 	}, nil
 }
 
-// VerifyDataKey 验证恢复密钥是否正确
+// VerifyDataKey 验证恢复密钥是否正确，失败计入连续失败次数（见 throttle.go）
 func (c *Core) VerifyDataKey(displayKey string) (bool, error) {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -201,15 +249,24 @@ func (c *Core) VerifyDataKey(displayKey string) (bool, error) {
 	if err != nil {
 		return false, nil
 	}
+	if err := c.checkThrottle(); err != nil {
+		return false, err
+	}
 	ok, err := c.verifyDataKeyWithFile(dataKey)
 	if err != nil {
 		return false, err
 	}
-	return ok, nil
+	if !ok {
+		return false, c.recordFailure()
+	}
+	return true, c.resetThrottle()
 }
 
-// Unlock 使用密码解锁
-func (c *Core) Unlock(password string) (bool, error) {
+// Unlock 使用密码解锁。需要密钥文件时 keyfile 为其路径，没有提供时返回 ErrKeyfileRequired；
+// 不需要时忽略 keyfile。连续失败过多时返回 *ThrottledError，达到设置的次数时清除数据并返回 ErrDataWiped
+func (c *Core) Unlock(password, keyfile string) (bool, error) {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -217,25 +274,70 @@ func (c *Core) Unlock(password string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if err := c.checkThrottle(); err != nil {
+		return false, err
+	}
 
-	passwordKey := c.cryptoService.DeriveKey(password, mp.Salt)
+	var keyfileDigest []byte
+	if mp.Keyfile {
+		if keyfile == "" {
+			return false, ErrKeyfileRequired
+		}
+		if keyfileDigest, err = c.readKeyfile(keyfile); err != nil {
+			return false, err
+		}
+	}
+	passwordKey, err := c.derivePasswordKey(mp, password, keyfileDigest)
+	if err != nil {
+		return false, err
+	}
 
 	_, err = c.cryptoService.Decrypt(passwordKey, mp.Verifier)
 	if err != nil {
-		return false, nil
+		return false, c.recordFailure()
 	}
 
 	dataKey, err := c.cryptoService.Decrypt(passwordKey, mp.EncryptedDataKey)
 	if err != nil {
-		return false, nil
+		// 密码正确但数据密钥无法解密，说明主密码记录已损坏，不计入失败次数
+		return false, ErrDataKeyCorrupted
+	}
+	if err := c.resetThrottle(); err != nil {
+		return false, err
+	}
+	if err := c.unlockDatabase(dataKey); err != nil {
+		return false, err
+	}
+
+	// 继续上次中断的数据密钥更换
+	dataKey, err = c.resumeRotation(dataKey, c.wrapDataKey(passwordKey, mp))
+	if err != nil {
+		return false, err
+	}
+
+	// 透明升级旧的密码派生参数与加密格式
+	if err := c.upgradeMasterPassword(password, keyfileDigest, dataKey); err != nil {
+		return false, err
+	}
+	if mp.DataVersion < dataFormatVersion {
+		if err := c.upgradeData(dataKey); err != nil {
+			return false, err
+		}
+	}
+	if err := c.rekeyNames(dataKey, dataKey); err != nil {
+		return false, fmt.Errorf("encrypt names: %w", err)
 	}
 
 	c.dataKey = dataKey
+	c.keyfile = keyfileDigest
 	c.isUnlocked = true
-	c.noteService.SetMasterKey(dataKey)
+	c.setServiceKeys(dataKey)
 	c.lastActivity = time.Now()
 	c.startLockTimer()
 
+	// 后台检查全文索引，缺失或与当前数据密钥不匹配时重建
+	go c.noteService.EnsureSearchIndex()
+
 	return true, nil
 }
 
@@ -243,7 +345,11 @@ func (c *Core) Unlock(password string) (bool, error) {
 func (c *Core) Lock() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.lock()
+}
 
+// lock 锁定应用，调用方需持有 c.mu
+func (c *Core) lock() {
 	c.isUnlocked = false
 	if c.dataKey != nil {
 		for i := range c.dataKey {
@@ -251,7 +357,11 @@ func (c *Core) Lock() {
 		}
 		c.dataKey = nil
 	}
-	c.noteService.SetMasterKey(nil)
+	clear(c.keyfile)
+	c.keyfile = nil
+	c.setServiceKeys(nil)
+	c.db.Lock()
+	c.closeBackupView()
 	if c.lockTimer != nil {
 		c.lockTimer.Stop()
 	}
@@ -273,46 +383,51 @@ func (c *Core) GetPasswordHint() (string, error) {
 	return mp.Hint, nil
 }
 
-// ChangePassword 修改密码（需要旧密码）
+// ChangePassword 修改密码（需要旧密码），只能在解锁后调用。旧密码错误计入连续失败次数，与 Unlock 相同
 func (c *Core) ChangePassword(oldPassword, newPassword, newHint string) error {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	mp, err := c.db.GetMasterPassword()
-	if err != nil {
+	if !c.isUnlocked {
+		return errors.New("not unlocked")
+	}
+	if err := c.checkThrottle(); err != nil {
 		return err
 	}
 
-	oldPasswordKey := c.cryptoService.DeriveKey(oldPassword, mp.Salt)
-	_, err = c.cryptoService.Decrypt(oldPasswordKey, mp.Verifier)
+	mp, err := c.db.GetMasterPassword()
 	if err != nil {
-		return errors.New("旧密码不正确")
+		return err
 	}
-
-	dataKey, err := c.cryptoService.Decrypt(oldPasswordKey, mp.EncryptedDataKey)
+	// 密钥文件保持不变
+	keyfile, err := c.sessionKeyfile(mp)
 	if err != nil {
 		return err
 	}
 
-	newSalt, err := c.cryptoService.GenerateSalt()
+	oldPasswordKey, err := c.derivePasswordKey(mp, oldPassword, keyfile)
 	if err != nil {
 		return err
 	}
-
-	newPasswordKey := c.cryptoService.DeriveKey(newPassword, newSalt)
-
-	newEncryptedDataKey, err := c.cryptoService.Encrypt(newPasswordKey, dataKey)
+	_, err = c.cryptoService.Decrypt(oldPasswordKey, mp.Verifier)
 	if err != nil {
-		return err
+		if err := c.recordFailure(); err != nil {
+			return err
+		}
+		return errors.New("旧密码不正确")
 	}
 
-	newVerifier, err := c.cryptoService.Encrypt(newPasswordKey, []byte("LOCKNOTE_VERIFY"))
+	dataKey, err := c.cryptoService.Decrypt(oldPasswordKey, mp.EncryptedDataKey)
 	if err != nil {
+		return ErrDataKeyCorrupted
+	}
+	if err := c.resetThrottle(); err != nil {
 		return err
 	}
 
-	err = c.db.SaveMasterPassword(newSalt, newVerifier, newHint, newEncryptedDataKey)
-	if err != nil {
+	if err := c.saveMasterPassword(newPassword, keyfile, newHint, dataKey); err != nil {
 		return err
 	}
 
@@ -320,8 +435,11 @@ func (c *Core) ChangePassword(oldPassword, newPassword, newHint string) error {
 	return nil
 }
 
-// ResetPasswordWithDataKey 使用恢复密钥重置密码
+// ResetPasswordWithDataKey 使用恢复密钥重置密码，同时取消密钥文件。
+// 恢复密钥错误计入连续失败次数，与 Unlock 相同
 func (c *Core) ResetPasswordWithDataKey(displayKey, newPassword, newHint string) error {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -329,42 +447,60 @@ func (c *Core) ResetPasswordWithDataKey(displayKey, newPassword, newHint string)
 	if err != nil {
 		return errors.New("密钥格式不正确")
 	}
+	if err := c.checkThrottle(); err != nil {
+		return err
+	}
 
 	ok, err := c.verifyDataKeyWithFile(dataKey)
 	if err != nil {
 		return err
 	}
+	if !ok && c.hasRotationJournal() {
+		// 更换数据密钥中断时校验文件可能已是新密钥，旧恢复密钥仍能打开日志
+		_, jerr := c.readRotationJournal(dataKey)
+		ok = jerr == nil
+	}
 	if !ok {
+		if err := c.recordFailure(); err != nil {
+			return err
+		}
 		return errors.New("密钥不正确")
 	}
-
-	newSalt, err := c.cryptoService.GenerateSalt()
-	if err != nil {
+	if err := c.resetThrottle(); err != nil {
 		return err
 	}
 
-	newPasswordKey := c.cryptoService.DeriveKey(newPassword, newSalt)
-
-	newEncryptedDataKey, err := c.cryptoService.Encrypt(newPasswordKey, dataKey)
-	if err != nil {
+	if err := c.unlockDatabase(dataKey); err != nil {
 		return err
 	}
 
-	newVerifier, err := c.cryptoService.Encrypt(newPasswordKey, []byte("LOCKNOTE_VERIFY"))
-	if err != nil {
+	if err := c.saveMasterPassword(newPassword, nil, newHint, dataKey); err != nil {
 		return err
 	}
 
-	err = c.db.SaveMasterPassword(newSalt, newVerifier, newHint, newEncryptedDataKey)
+	dataKey, err = c.resumeRotation(dataKey, func(newKey []byte) error {
+		return c.saveMasterPassword(newPassword, nil, newHint, newKey)
+	})
 	if err != nil {
 		return err
 	}
+	if mp, err := c.db.GetMasterPassword(); err == nil && mp.DataVersion < dataFormatVersion {
+		if err := c.upgradeData(dataKey); err != nil {
+			return err
+		}
+	}
+	if err := c.rekeyNames(dataKey, dataKey); err != nil {
+		return fmt.Errorf("encrypt names: %w", err)
+	}
 
 	c.dataKey = dataKey
+	c.keyfile = nil
 	c.isUnlocked = true
-	c.noteService.SetMasterKey(dataKey)
+	c.setServiceKeys(dataKey)
 	c.startLockTimer()
 
+	go c.noteService.EnsureSearchIndex()
+
 	return nil
 }
 
@@ -448,6 +584,20 @@ func (c *Core) Backup() *backup.Service {
 	return c.backupService
 }
 
+// ============ 附件相关（代理到 attachmentService）============
+
+// Attachments 返回附件服务
+func (c *Core) Attachments() *attachments.Service {
+	return c.attachmentService
+}
+
+// ============ 同步相关（代理到 syncService）============
+
+// Sync 返回同步服务
+func (c *Core) Sync() *locksync.Service {
+	return c.syncService
+}
+
 // ============ 设置相关 ============
 
 // GetSettings 获取设置
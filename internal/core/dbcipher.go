@@ -0,0 +1,97 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"locknote/internal/database"
+)
+
+// 整库加密是可选的：开启后数据库文件整体以由数据密钥派生的密钥加密，
+// 笔记的时间、数量与标签关联等元数据也不再以明文保存。解锁前只能读取主密码信息与设置。
+// 更换数据密钥时数据库随之更换密钥；需要以 -tags sqlcipher 构建才支持。
+
+// databaseKeyPurpose 是由数据密钥派生数据库密钥的用途标识
+const databaseKeyPurpose = "locknote-database-v1"
+
+// databaseKey 返回由数据密钥派生的数据库密钥
+func (c *Core) databaseKey(dataKey []byte) []byte {
+	return c.cryptoService.DeriveSubKey(dataKey, databaseKeyPurpose)
+}
+
+// unlockDatabase 用数据密钥打开整体加密的数据库，未加密时不做任何事。
+// 更换数据密钥中断时数据库可能已换成新密钥，此时用日志中的新密钥再试一次。调用方需持有 c.mu
+func (c *Core) unlockDatabase(dataKey []byte) error {
+	err := c.db.Unlock(c.databaseKey(dataKey))
+	if !errors.Is(err, database.ErrWrongKey) || !c.hasRotationJournal() {
+		return err
+	}
+	displayKey, jerr := c.readRotationJournal(dataKey)
+	if jerr != nil || displayKey == "" {
+		return err
+	}
+	return c.db.Unlock(c.databaseKey(c.cryptoService.DeriveDataKey(displayKey)))
+}
+
+// IsDatabaseEncrypted 返回数据库是否已整体加密
+func (c *Core) IsDatabaseEncrypted() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.db.Encrypted()
+}
+
+// DatabaseEncryptionAvailable 返回当前构建是否支持整库加密
+func (c *Core) DatabaseEncryptionAvailable() bool {
+	return database.CipherAvailable()
+}
+
+// EncryptDatabase 把现有的明文数据库转换为整体加密，需要再次输入主密码。
+// 转换期间关闭数据库，完成后重新打开并保持解锁；开启后不能关闭
+func (c *Core) EncryptDatabase(password string) error {
+	if !database.CipherAvailable() {
+		return database.ErrCipherUnavailable
+	}
+
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isUnlocked {
+		return errors.New("not unlocked")
+	}
+	if c.db.Encrypted() {
+		return errors.New("数据库已经整体加密")
+	}
+	if c.hasRotationJournal() {
+		return errors.New("更换数据密钥尚未完成，请先完成后再开启")
+	}
+	if err := c.checkPassword(password); err != nil {
+		return err
+	}
+
+	c.closeBackupView()
+	c.setServiceKeys(nil)
+	dataKey := c.dataKey
+	dbPath := c.db.Path()
+
+	c.db.Close()
+	convertErr := database.ExportPlainToEncrypted(dbPath, c.databaseKey(dataKey))
+	if err := c.open(); err != nil {
+		c.isUnlocked, c.dataKey = false, nil
+		if convertErr != nil {
+			return fmt.Errorf("%w（重新打开数据库失败: %v）", convertErr, err)
+		}
+		return fmt.Errorf("重新打开数据库失败: %w", err)
+	}
+	if err := c.unlockDatabase(dataKey); err != nil {
+		c.isUnlocked, c.dataKey = false, nil
+		return err
+	}
+	c.setServiceKeys(dataKey)
+	if convertErr != nil {
+		return fmt.Errorf("数据库加密失败: %w", convertErr)
+	}
+	return nil
+}
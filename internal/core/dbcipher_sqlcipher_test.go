@@ -0,0 +1,114 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+//go:build sqlcipher
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checkMetadata 确认加密前写入的标签、笔记本与标签关联都还在
+func checkMetadata(t *testing.T, c *Core, f *rotationFixture, tagID, notebookID string) {
+	t.Helper()
+	f.check(t, c)
+	tags, err := c.Tags().NoteTags(f.noteID)
+	if err != nil || len(tags) != 1 || tags[0].ID != tagID || tags[0].Name != "work" {
+		t.Fatalf("NoteTags = %+v, %v", tags, err)
+	}
+	nb, err := c.Notebooks().Get(notebookID)
+	if err != nil || nb.Name != "Projects" {
+		t.Fatalf("notebook = %+v, %v", nb, err)
+	}
+}
+
+func TestEncryptDatabaseLockUnlock(t *testing.T) {
+	c, _ := newTestCore(t)
+	f := newRotationFixture(t, c)
+	tag, err := c.Tags().Create("work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Tags().AddToNote(f.noteID, tag.ID); err != nil {
+		t.Fatal(err)
+	}
+	nb, err := c.Notebooks().Create("Projects", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := c.dataDir
+	dbPath := filepath.Join(dataDir, "locknote.db")
+
+	if err := c.EncryptDatabase("wrong password"); err == nil {
+		t.Fatal("encrypted the database with a wrong password")
+	}
+	if c.IsDatabaseEncrypted() {
+		t.Fatal("database encrypted after a wrong password")
+	}
+
+	if err := c.EncryptDatabase("password"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsDatabaseEncrypted() {
+		t.Fatal("database is not encrypted")
+	}
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		t.Fatal("database file is still plain SQLite")
+	}
+	checkMetadata(t, c, f, tag.ID, nb.ID)
+	if err := c.EncryptDatabase("password"); err == nil {
+		t.Fatal("encrypted the database twice")
+	}
+
+	// 锁定后只能读取设置，其余查询返回 ErrLocked
+	c.Lock()
+	if _, err := c.db.ListTags(); !errors.Is(err, database.ErrLocked) {
+		t.Fatalf("ListTags while locked = %v", err)
+	}
+	if _, err := c.GetSettings(); err != nil {
+		t.Fatalf("GetSettings while locked: %v", err)
+	}
+	if ok, _ := c.Unlock("wrong password", ""); ok {
+		t.Fatal("unlocked with a wrong password")
+	}
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	checkMetadata(t, c, f, tag.ID, nb.ID)
+
+	// 更换数据密钥时数据库随之换成新密钥
+	if _, err := c.RotateDataKey("password"); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock after rotation = %v, %v", ok, err)
+	}
+	checkMetadata(t, c, f, tag.ID, nb.ID)
+
+	// 重新打开数据目录
+	c.Close()
+	c, err = New(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if !c.IsDatabaseEncrypted() {
+		t.Fatal("database is not encrypted after reopening")
+	}
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock after reopening = %v, %v", ok, err)
+	}
+	checkMetadata(t, c, f, tag.ID, nb.ID)
+}
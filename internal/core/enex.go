@@ -0,0 +1,253 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Evernote 的 ENEX 导出文件是一个 XML，每个 <note> 包含标题、ENML 格式的正文、时间、标签与内嵌的资源。
+// 正文转换为 Markdown，<en-media> 按资源数据的 MD5 对应到导入的附件，正文中没有引用的资源附加在末尾。
+// ENEX 不记录笔记本，导出时每个笔记本是一个文件，因此以文件名作为笔记本名。
+
+// enexTimeLayout 是 ENEX 中的时间格式（UTC）
+const enexTimeLayout = "20060102T150405Z"
+
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data struct {
+		Encoding string `xml:"encoding,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"data"`
+	Mime       string `xml:"mime"`
+	Attributes struct {
+		FileName  string `xml:"file-name"`
+		Timestamp string `xml:"timestamp"`
+	} `xml:"resource-attributes"`
+}
+
+// enexAttachment 是一个待导入的资源
+type enexAttachment struct {
+	id       string
+	filename string
+	mimeType string
+	created  time.Time
+	data     []byte
+	linked   bool // 正文中有 <en-media> 引用
+}
+
+// ImportENEX 从 Evernote 的 ENEX 文件导入笔记，笔记本名为文件名。
+// 逐篇读取，单篇笔记或资源的问题记入报告，不影响其他笔记；dryRun 时只转换与计数，不写入任何数据
+func (c *Core) ImportENEX(inputPath string, dryRun bool) (*ExternalImportReport, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	notebook := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	report := &ExternalImportReport{DryRun: dryRun, Issues: []ImportIssue{}}
+	imp := c.newImportNames(dryRun)
+
+	dec := xml.NewDecoder(bufio.NewReader(f))
+	dec.Entity = xml.HTMLEntity
+	foundExport := false
+	index := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// XML 语法错误之后的内容无法继续读取
+			report.issue("file", filepath.Base(inputPath), fmt.Errorf("第 %d 篇笔记之后的内容无法解析: %w", index, err))
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "en-export":
+			foundExport = true
+			continue
+		case "note":
+		default:
+			continue
+		}
+
+		index++
+		var note enexNote
+		if err := dec.DecodeElement(&note, &start); err != nil {
+			report.issue("note", fmt.Sprintf("第 %d 篇笔记", index), err)
+			break
+		}
+		c.importENEXNote(imp, report, &note, notebook, index)
+	}
+	if !foundExport && index == 0 && len(report.Issues) == 0 {
+		return nil, errors.New("不是 Evernote 导出文件（.enex）")
+	}
+
+	report.NotebooksCreated = imp.notebooksCreated
+	report.TagsCreated = imp.tagsCreated
+	return report, nil
+}
+
+// importENEXNote 转换并写入一篇笔记，问题记入 report
+func (c *Core) importENEXNote(imp *importNames, report *ExternalImportReport, note *enexNote, notebook string, index int) {
+	item := strings.TrimSpace(note.Title)
+	if item == "" {
+		item = fmt.Sprintf("第 %d 篇笔记", index)
+	}
+
+	// 资源按数据的 MD5 索引，与 <en-media hash="..."> 对应
+	byHash := make(map[string]*enexAttachment)
+	var attachments []*enexAttachment
+	for i, res := range note.Resources {
+		data, err := decodeENEXData(res.Data.Encoding, res.Data.Value)
+		if err != nil {
+			report.issue("resource", fmt.Sprintf("%s 的第 %d 个资源", item, i+1), err)
+			continue
+		}
+		sum := md5.Sum(data)
+		a := &enexAttachment{
+			id:       uuid.New().String(),
+			filename: res.Attributes.FileName,
+			mimeType: res.Mime,
+			created:  parseENEXTime(res.Attributes.Timestamp, time.Now()),
+			data:     data,
+		}
+		if a.filename == "" {
+			a.filename = "attachment-" + hex.EncodeToString(sum[:4]) + mimeExtension(res.Mime)
+		}
+		byHash[hex.EncodeToString(sum[:])] = a
+		attachments = append(attachments, a)
+	}
+
+	renderer := &htmlRenderer{media: func(attrs map[string]string) string {
+		a := byHash[strings.ToLower(attrs["hash"])]
+		if a == nil {
+			return ""
+		}
+		a.linked = true
+		return attachmentMarkdown(a.filename, a.mimeType, a.id)
+	}}
+	content, err := renderer.htmlToMarkdown(note.Content)
+	if err != nil {
+		report.issue("note", item, fmt.Errorf("正文格式有误，只导入了可以解析的部分: %w", err))
+	}
+	if renderer.encrypted {
+		report.issue("note", item, errors.New("包含 Evernote 加密的内容，该部分未导入"))
+	}
+
+	var unlinked []string
+	for _, a := range attachments {
+		if !a.linked {
+			unlinked = append(unlinked, attachmentMarkdown(a.filename, a.mimeType, a.id))
+		}
+	}
+	if len(unlinked) > 0 {
+		content = strings.TrimRight(content, "\n") + "\n\n" + strings.Join(unlinked, "\n\n") + "\n"
+	}
+
+	now := time.Now()
+	created := parseENEXTime(note.Created, now)
+	imported := &importedNote{
+		id:       uuid.New().String(),
+		title:    strings.TrimSpace(note.Title),
+		content:  content,
+		created:  created,
+		updated:  parseENEXTime(note.Updated, created),
+		notebook: notebook,
+		tags:     note.Tags,
+	}
+	if err := imp.put(imported); err != nil {
+		report.issue("note", item, err)
+		return
+	}
+	report.Notes++
+
+	for _, a := range attachments {
+		if !imp.dryRun {
+			if _, err := c.attachmentService.Import(a.id, imported.id, a.filename, a.mimeType, a.created, bytes.NewReader(a.data)); err != nil {
+				report.issue("resource", item+" / "+a.filename, err)
+				continue
+			}
+		}
+		report.Attachments++
+	}
+}
+
+func decodeENEXData(encoding, value string) ([]byte, error) {
+	if encoding != "" && encoding != "base64" {
+		return nil, fmt.Errorf("不支持的资源编码 %q", encoding)
+	}
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+}
+
+func parseENEXTime(value string, fallback time.Time) time.Time {
+	t, err := time.Parse(enexTimeLayout, strings.TrimSpace(value))
+	if err != nil {
+		return fallback
+	}
+	return t
+}
+
+// attachmentMarkdown 返回附件在正文中的链接，图片以图片语法嵌入
+func attachmentMarkdown(filename, mimeType, id string) string {
+	label := strings.NewReplacer("[", "(", "]", ")").Replace(filename)
+	if strings.HasPrefix(mimeType, "image/") || mimeType == "" && isImageFile(filename) {
+		return "![" + label + "](" + attachmentLinkPrefix + id + ")"
+	}
+	return "[" + label + "](" + attachmentLinkPrefix + id + ")"
+}
+
+// mimeExtension 返回 MIME 类型常用的扩展名，未知时返回空字符串
+func mimeExtension(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "application/pdf":
+		return ".pdf"
+	case "audio/mpeg":
+		return ".mp3"
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
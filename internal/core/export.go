@@ -0,0 +1,468 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"locknote/internal/database"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 导出的 Markdown 是明文，任何能读取导出目录的人都能看到笔记内容，因此导出前必须重新输入主密码。
+//
+// 导出结构：
+//
+//	<笔记本名>/<标题>.md          属于笔记本的笔记
+//	<标题>.md                     不属于任何笔记本的笔记
+//	attachments/<附件ID>/<文件名>  附件，笔记中的 attachment:// 链接改写为指向它的相对路径
+//
+// 每个文件以 YAML front matter 开头，记录 id、title、tags、notebook、created、updated、pinned。
+
+// exportPageSize 是解析智能视图时每页读取的笔记数量
+const exportPageSize = 500
+
+// exportNameMaxLen 是导出文件名与目录名的最大长度（字符数）
+const exportNameMaxLen = 100
+
+// ExportOptions 选择要导出的笔记与导出方式，NotebookID、TagID、SmartViewID 最多设置一个，
+// 都为空时导出全部笔记（不含回收站）
+type ExportOptions struct {
+	NotebookID  string `json:"notebookId,omitempty"`
+	TagID       string `json:"tagId,omitempty"`
+	SmartViewID string `json:"smartViewId,omitempty"`
+	Attachments bool   `json:"attachments"` // 同时导出附件
+	Zip         bool   `json:"zip"`         // 导出为单个 zip 文件，否则 dest 是目录
+}
+
+func (o ExportOptions) validate() error {
+	selections := 0
+	for _, id := range []string{o.NotebookID, o.TagID, o.SmartViewID} {
+		if id != "" {
+			selections++
+		}
+	}
+	if selections > 1 {
+		return errors.New("笔记本、标签与智能视图只能选择一个")
+	}
+	return nil
+}
+
+// ExportResult 是导出 Markdown 或 HTML 的结果
+type ExportResult struct {
+	Path        string `json:"path"`
+	Notes       int    `json:"notes"`
+	Attachments int    `json:"attachments"`
+	Locked      int    `json:"locked,omitempty"` // 所在笔记本锁定而未导出的笔记
+}
+
+// ExportMarkdown 把笔记以明文 Markdown 导出到 dest，需要再次输入主密码，锁定的笔记本中的笔记不导出。
+// 导出到目录时 dest 必须不存在或为空；导出为 zip 时 dest 是 zip 文件路径
+func (c *Core) ExportMarkdown(password, dest string, opts ExportOptions) (*ExportResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+	if err := c.checkPassword(password); err != nil {
+		return nil, err
+	}
+
+	metas, err := c.exportSelection(opts)
+	if err != nil {
+		return nil, err
+	}
+	metas, locked, err := c.skipLockedNotes(metas)
+	if err != nil {
+		return nil, err
+	}
+
+	var sink exportSink
+	if opts.Zip {
+		sink, err = newZipExportSink(dest)
+	} else {
+		sink, err = newDirExportSink(dest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.exportNotes(sink, metas, opts.Attachments)
+	if err != nil {
+		sink.abort()
+		return nil, err
+	}
+	if err := sink.close(); err != nil {
+		return nil, err
+	}
+	result.Path = dest
+	result.Locked = locked
+	return result, nil
+}
+
+// checkPassword 校验主密码，调用方需持有 c.mu
+func (c *Core) checkPassword(password string) error {
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		return err
+	}
+	keyfile, err := c.sessionKeyfile(mp)
+	if err != nil {
+		return err
+	}
+	passwordKey, err := c.derivePasswordKey(mp, password, keyfile)
+	if err != nil {
+		return err
+	}
+	if _, err := c.cryptoService.Decrypt(passwordKey, mp.Verifier); err != nil {
+		return errors.New("密码不正确")
+	}
+	return nil
+}
+
+// exportSelection 返回 opts 选中的笔记元数据，调用方需持有 c.mu
+func (c *Core) exportSelection(opts ExportOptions) ([]*database.NoteMeta, error) {
+	switch {
+	case opts.TagID != "":
+		if _, err := c.db.GetTag(opts.TagID); err != nil {
+			return nil, fmt.Errorf("标签不存在: %w", err)
+		}
+		return c.db.GetNotesByTag(opts.TagID)
+
+	case opts.SmartViewID != "":
+		var ids []string
+		for offset := 0; ; offset += exportPageSize {
+			page, err := c.smartViewService.Resolve(opts.SmartViewID, exportPageSize, offset)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range page.Notes {
+				ids = append(ids, n.ID)
+			}
+			if len(page.Notes) < exportPageSize || offset+exportPageSize >= page.Total {
+				break
+			}
+		}
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		return c.db.GetNotesByIDs(ids)
+	}
+
+	metas, err := c.db.ListNotes(false)
+	if err != nil {
+		return nil, err
+	}
+	if opts.NotebookID == "" {
+		return metas, nil
+	}
+	if _, err := c.db.GetNotebook(opts.NotebookID); err != nil {
+		return nil, fmt.Errorf("笔记本不存在: %w", err)
+	}
+	selected := metas[:0]
+	for _, meta := range metas {
+		if meta.NotebookID != nil && *meta.NotebookID == opts.NotebookID {
+			selected = append(selected, meta)
+		}
+	}
+	return selected, nil
+}
+
+// skipLockedNotes 去掉锁定的笔记本中的笔记，返回其余笔记与去掉的数量，调用方需持有 c.mu
+func (c *Core) skipLockedNotes(metas []*database.NoteMeta) ([]*database.NoteMeta, int, error) {
+	protected, err := c.notebookService.ProtectedIDs()
+	if err != nil {
+		return nil, 0, err
+	}
+	kept := make([]*database.NoteMeta, 0, len(metas))
+	for _, meta := range metas {
+		if meta.NotebookID != nil && protected[*meta.NotebookID] && !c.notebookService.IsUnlocked(*meta.NotebookID) {
+			continue
+		}
+		kept = append(kept, meta)
+	}
+	return kept, len(metas) - len(kept), nil
+}
+
+func (c *Core) exportNotes(sink exportSink, metas []*database.NoteMeta, withAttachments bool) (*ExportResult, error) {
+	notebooks, err := c.notebookNames()
+	if err != nil {
+		return nil, err
+	}
+	noteIDs := make([]string, len(metas))
+	for i, meta := range metas {
+		noteIDs[i] = meta.ID
+	}
+	tagsByNote, err := c.tagService.NoteTagsBatch(noteIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExportResult{}
+	names := newExportNames()
+	for _, meta := range metas {
+		content, err := c.noteService.ReadContent(meta)
+		if err != nil {
+			return nil, fmt.Errorf("笔记 %s 无法解密: %w", meta.ID, err)
+		}
+
+		var notebook, dir string
+		if meta.NotebookID != nil {
+			notebook = notebooks[*meta.NotebookID]
+			if notebook != "" {
+				dir = names.dir(notebook)
+			}
+		}
+
+		body := content.Content
+		if withAttachments {
+			attachments, err := c.db.ListAttachments(meta.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range attachments {
+				name, err := c.exportAttachment(sink, a)
+				if err != nil {
+					return nil, fmt.Errorf("导出附件 %s 失败: %w", a.ID, err)
+				}
+				rel := name
+				if dir != "" {
+					rel = "../" + name
+				}
+				body = strings.ReplaceAll(body, attachmentLinkPrefix+a.ID, rel)
+				result.Attachments++
+			}
+		}
+
+		tagNames := make([]string, 0, len(tagsByNote[meta.ID]))
+		for _, t := range tagsByNote[meta.ID] {
+			tagNames = append(tagNames, t.Name)
+		}
+
+		var b strings.Builder
+		b.WriteString("---\n")
+		writeFrontMatter(&b, "id", meta.ID)
+		writeFrontMatter(&b, "title", content.Title)
+		writeFrontMatter(&b, "tags", tagNames)
+		if notebook != "" {
+			writeFrontMatter(&b, "notebook", notebook)
+		}
+		fmt.Fprintf(&b, "created: %s\n", meta.CreatedAt.Format(time.RFC3339))
+		fmt.Fprintf(&b, "updated: %s\n", meta.UpdatedAt.Format(time.RFC3339))
+		fmt.Fprintf(&b, "pinned: %t\n", meta.Pinned)
+		b.WriteString("---\n\n")
+		b.WriteString(body)
+		if !strings.HasSuffix(body, "\n") {
+			b.WriteString("\n")
+		}
+
+		name := names.file(dir, content.Title, ".md")
+		if err := sink.writeFile(name, strings.NewReader(b.String())); err != nil {
+			return nil, err
+		}
+		result.Notes++
+	}
+	return result, nil
+}
+
+// exportAttachment 解密附件写入 attachments/<ID>/<文件名>，返回该路径（已做 URL 转义）
+func (c *Core) exportAttachment(sink exportSink, a *database.Attachment) (string, error) {
+	rc, info, err := c.attachmentService.Open(a.ID)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	filename := sanitizeExportName(info.Filename)
+	if filename == "" {
+		filename = a.ID
+	}
+	if err := sink.writeFile(path.Join("attachments", a.ID, filename), rc); err != nil {
+		return "", err
+	}
+	return "attachments/" + a.ID + "/" + url.PathEscape(filename), nil
+}
+
+// writeFrontMatter 写入一行 YAML；JSON 字符串与数组同时也是合法的 YAML
+func writeFrontMatter(b *strings.Builder, key string, value interface{}) {
+	data, _ := json.Marshal(value)
+	fmt.Fprintf(b, "%s: %s\n", key, data)
+}
+
+// sanitizeExportName 去掉文件名中各平台不允许的字符
+func sanitizeExportName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > exportNameMaxLen {
+		name = string(runes[:exportNameMaxLen])
+	}
+	return strings.Trim(name, " .")
+}
+
+// exportNames 为导出的文件与目录分配不重复的名称（不区分大小写）
+type exportNames struct {
+	used map[string]bool
+	dirs map[string]string
+}
+
+func newExportNames() *exportNames {
+	return &exportNames{used: map[string]bool{"attachments": true}, dirs: make(map[string]string)}
+}
+
+func (n *exportNames) unique(dir, base, ext string) string {
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s (%d)", base, i)
+		}
+		full := path.Join(dir, name+ext)
+		if !n.used[strings.ToLower(full)] {
+			n.used[strings.ToLower(full)] = true
+			return full
+		}
+	}
+}
+
+// dir 返回笔记本对应的目录，同名笔记本共用一个目录
+func (n *exportNames) dir(notebook string) string {
+	if dir, ok := n.dirs[notebook]; ok {
+		return dir
+	}
+	base := sanitizeExportName(notebook)
+	if base == "" {
+		base = "Notebook"
+	}
+	dir := n.unique("", base, "")
+	n.dirs[notebook] = dir
+	return dir
+}
+
+func (n *exportNames) file(dir, title, ext string) string {
+	base := sanitizeExportName(title)
+	if base == "" {
+		base = "Untitled"
+	}
+	return n.unique(dir, base, ext)
+}
+
+// exportSink 是导出的目标：目录或 zip 文件
+type exportSink interface {
+	writeFile(name string, r io.Reader) error
+	close() error
+	abort()
+}
+
+type dirExportSink struct {
+	dir     string
+	created bool // 目录由导出创建，中止时连同目录一起删除
+}
+
+func newDirExportSink(dir string) (*dirExportSink, error) {
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return nil, errors.New("导出目录必须为空")
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &dirExportSink{dir: dir, created: err != nil}, nil
+}
+
+func (s *dirExportSink) writeFile(name string, r io.Reader) error {
+	fullPath := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (s *dirExportSink) close() error { return nil }
+
+// abort 删除已写出的明文；目录在导出前为空，其中的内容都是本次写出的
+func (s *dirExportSink) abort() {
+	if s.created {
+		os.RemoveAll(s.dir)
+		return
+	}
+	entries, _ := os.ReadDir(s.dir)
+	for _, entry := range entries {
+		os.RemoveAll(filepath.Join(s.dir, entry.Name()))
+	}
+}
+
+type zipExportSink struct {
+	path     string
+	tempPath string
+	file     *os.File
+	zw       *zip.Writer
+}
+
+func newZipExportSink(zipPath string) (*zipExportSink, error) {
+	tempPath := zipPath + ".tmp"
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &zipExportSink{path: zipPath, tempPath: tempPath, file: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (s *zipExportSink) writeFile(name string, r io.Reader) error {
+	w, err := s.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (s *zipExportSink) close() error {
+	err := s.zw.Close()
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(s.tempPath, s.path)
+	}
+	if err != nil {
+		os.Remove(s.tempPath)
+	}
+	return err
+}
+
+func (s *zipExportSink) abort() {
+	s.file.Close()
+	os.Remove(s.tempPath)
+}
@@ -0,0 +1,160 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"locknote/internal/database"
+	"locknote/internal/notes"
+	"time"
+)
+
+// ExternalImportReport 是从其他笔记软件的导出文件（Evernote ENEX、Joplin JEX）导入的结果。
+// 试运行时不写入任何数据，计数为实际导入时会导入或新建的数量
+type ExternalImportReport struct {
+	DryRun           bool          `json:"dryRun"`
+	Notes            int           `json:"notes"`            // 导入的笔记数量
+	Attachments      int           `json:"attachments"`      // 导入的附件数量
+	NotebooksCreated int           `json:"notebooksCreated"` // 按名称没有对应而新建的笔记本
+	TagsCreated      int           `json:"tagsCreated"`      // 按名称没有对应而新建的标签
+	Issues           []ImportIssue `json:"issues"`           // 无法导入或只导入了一部分的条目
+}
+
+// ImportIssue 是导入时一个条目的问题
+type ImportIssue struct {
+	Kind  string `json:"kind"`  // note、notebook、tag、resource 或 file
+	Item  string `json:"item"`  // 条目的标题、文件名或在导出文件中的位置
+	Error string `json:"error"` // 原因
+}
+
+func (r *ExternalImportReport) issue(kind, item string, err error) {
+	r.Issues = append(r.Issues, ImportIssue{Kind: kind, Item: item, Error: err.Error()})
+}
+
+// importedNote 是从其他格式转换得到、待写入的一篇笔记
+type importedNote struct {
+	id       string
+	title    string
+	content  string
+	created  time.Time
+	updated  time.Time
+	deleted  *time.Time
+	notebook string // 笔记本名，为空时不属于笔记本
+	tags     []string
+}
+
+// importNames 把导入笔记的笔记本与标签按名称对应到当前数据，没有时新建；dryRun 时只计数不新建
+type importNames struct {
+	c                *Core
+	dryRun           bool
+	notebooks        map[string]string // 笔记本名 -> ID，试运行时新笔记本的 ID 为空
+	tags             map[string]string // 标签名 -> ID，试运行时新标签的 ID 为空
+	notebooksCreated int
+	tagsCreated      int
+}
+
+func (c *Core) newImportNames(dryRun bool) *importNames {
+	return &importNames{
+		c:         c,
+		dryRun:    dryRun,
+		notebooks: make(map[string]string),
+		tags:      make(map[string]string),
+	}
+}
+
+// put 写入笔记 n 并设置其笔记本与标签，调用方需持有 c.mu
+func (imp *importNames) put(n *importedNote) error {
+	var notebookID *string
+	if n.notebook != "" {
+		id, err := imp.notebook(n.notebook)
+		if err != nil {
+			return err
+		}
+		notebookID = &id
+	}
+	tagIDs := make([]string, 0, len(n.tags))
+	for _, name := range n.tags {
+		id, err := imp.tag(name)
+		if err != nil {
+			return err
+		}
+		tagIDs = append(tagIDs, id)
+	}
+	if imp.dryRun {
+		return nil
+	}
+
+	updated := n.updated
+	if updated.Before(n.created) {
+		updated = n.created
+	}
+	record := &notes.Record{
+		Meta: database.NoteMeta{
+			ID:         n.id,
+			CreatedAt:  n.created,
+			UpdatedAt:  updated,
+			DeletedAt:  n.deleted,
+			NotebookID: notebookID,
+		},
+		Content: notes.NoteContent{Title: n.title, Content: n.content},
+	}
+	if err := imp.c.noteService.PutRecord(record); err != nil {
+		return err
+	}
+	return imp.c.db.SetNoteTags(n.id, tagIDs)
+}
+
+// notebook 返回名为 name 的笔记本 ID，不存在时创建
+func (imp *importNames) notebook(name string) (string, error) {
+	if id, ok := imp.notebooks[name]; ok {
+		return id, nil
+	}
+	current, err := imp.c.notebookService.List()
+	if err != nil {
+		return "", err
+	}
+	for _, nb := range current {
+		if nb.Name == name {
+			imp.notebooks[name] = nb.ID
+			return nb.ID, nil
+		}
+	}
+
+	id := ""
+	if !imp.dryRun {
+		created, err := imp.c.notebookService.Create(name, "")
+		if err != nil {
+			return "", err
+		}
+		id = created.ID
+	}
+	imp.notebooksCreated++
+	imp.notebooks[name] = id
+	return id, nil
+}
+
+// tag 返回名为 name 的标签 ID，不存在时创建
+func (imp *importNames) tag(name string) (string, error) {
+	if id, ok := imp.tags[name]; ok {
+		return id, nil
+	}
+	id := ""
+	if existing, err := imp.c.tagService.GetByName(name); err == nil {
+		id = existing.ID
+	} else if errors.Is(err, sql.ErrNoRows) {
+		if !imp.dryRun {
+			created, err := imp.c.tagService.Create(name, "")
+			if err != nil {
+				return "", err
+			}
+			id = created.ID
+		}
+		imp.tagsCreated++
+	} else {
+		return "", err
+	}
+	imp.tags[name] = id
+	return id, nil
+}
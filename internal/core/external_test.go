@@ -0,0 +1,222 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"io"
+	"locknote/internal/notes"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importedNotes 返回按标题索引的全部笔记（含回收站）
+func importedNotes(t *testing.T, c *Core) map[string]*notes.Note {
+	t.Helper()
+	list, err := c.Notes().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := c.Notes().ListDeleted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byTitle := make(map[string]*notes.Note)
+	for _, n := range append(list, deleted...) {
+		full, err := c.Notes().Get(n.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byTitle[n.Title] = full
+	}
+	return byTitle
+}
+
+func tagNames(n *notes.Note) []string {
+	names := make([]string, len(n.Tags))
+	for i, tag := range n.Tags {
+		names[i] = tag.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// notebookName 返回笔记所在笔记本的名称，不属于笔记本时返回空字符串
+func notebookName(t *testing.T, c *Core, n *notes.Note) string {
+	t.Helper()
+	if n.NotebookID == nil {
+		return ""
+	}
+	nb, err := c.Notebooks().Get(*n.NotebookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nb.Name
+}
+
+// checkAttachment 确认笔记只有一个名为 filename 的附件、正文中有指向它的链接，并返回附件内容
+func checkAttachment(t *testing.T, c *Core, n *notes.Note, filename, mimeType string) []byte {
+	t.Helper()
+	list, err := c.Attachments().List(n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Filename != filename || list[0].Mime != mimeType {
+		t.Fatalf("%s: attachments = %+v", n.Title, list)
+	}
+	if !strings.Contains(n.Content, "]("+attachmentLinkPrefix+list[0].ID+")") {
+		t.Fatalf("%s: content does not link the attachment:\n%s", n.Title, n.Content)
+	}
+	r, _, err := c.Attachments().Open(list[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func unlockedTestCore(t *testing.T) *Core {
+	t.Helper()
+	c, _ := newTestCore(t)
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	return c
+}
+
+func TestImportENEX(t *testing.T) {
+	c := unlockedTestCore(t)
+	path := filepath.Join("testdata", "Work.enex")
+
+	dry, err := c.ImportENEX(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ExternalImportReport{DryRun: true, Notes: 2, Attachments: 2, NotebooksCreated: 1, TagsCreated: 3, Issues: []ImportIssue{}}
+	if !reflect.DeepEqual(*dry, want) {
+		t.Fatalf("dry run = %+v, want %+v", *dry, want)
+	}
+	if got := importedNotes(t, c); len(got) != 0 {
+		t.Fatalf("dry run imported %d notes", len(got))
+	}
+
+	report, err := c.ImportENEX(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.DryRun = false
+	if !reflect.DeepEqual(*report, want) {
+		t.Fatalf("report = %+v, want %+v", *report, want)
+	}
+
+	got := importedNotes(t, c)
+	meeting, receipt := got["Meeting notes"], got["Receipt"]
+	if meeting == nil || receipt == nil || len(got) != 2 {
+		t.Fatalf("imported notes = %v", got)
+	}
+	for _, n := range []*notes.Note{meeting, receipt} {
+		if name := notebookName(t, c, n); name != "Work" {
+			t.Fatalf("%s: notebook = %q", n.Title, name)
+		}
+	}
+	if names := tagNames(meeting); !reflect.DeepEqual(names, []string{"urgent", "work"}) {
+		t.Fatalf("Meeting notes: tags = %v", names)
+	}
+	if names := tagNames(receipt); !reflect.DeepEqual(names, []string{"finance", "work"}) {
+		t.Fatalf("Receipt: tags = %v", names)
+	}
+	if created, err := time.Parse(time.RFC3339, meeting.CreatedAt); err != nil || !created.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("Meeting notes: createdAt = %q, %v", meeting.CreatedAt, err)
+	}
+
+	for _, text := range []string{"Agenda:", "Budget", "Hiring", "![whiteboard.png]("} {
+		if !strings.Contains(meeting.Content, text) {
+			t.Fatalf("Meeting notes: content lacks %q:\n%s", text, meeting.Content)
+		}
+	}
+	if data := checkAttachment(t, c, meeting, "whiteboard.png", "image/png"); !strings.HasPrefix(string(data), "\x89PNG") {
+		t.Fatal("Meeting notes: attachment is not the PNG")
+	}
+	// 正文中没有引用的资源附加在末尾
+	if !strings.Contains(receipt.Content, "**42**") || !strings.HasSuffix(strings.TrimSpace(receipt.Content), ")") {
+		t.Fatalf("Receipt: content =\n%s", receipt.Content)
+	}
+	if data := checkAttachment(t, c, receipt, "receipt.pdf", "application/pdf"); !strings.HasPrefix(string(data), "%PDF") {
+		t.Fatal("Receipt: attachment is not the PDF")
+	}
+
+	// 再次导入时笔记本与标签按名称复用
+	again, err := c.ImportENEX(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.NotebooksCreated != 0 || again.TagsCreated != 0 {
+		t.Fatalf("second import = %+v", again)
+	}
+}
+
+func TestImportJEX(t *testing.T) {
+	c := unlockedTestCore(t)
+	path := filepath.Join("testdata", "sample.jex")
+
+	dry, err := c.ImportJEX(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ExternalImportReport{DryRun: true, Notes: 2, Attachments: 1, NotebooksCreated: 2, TagsCreated: 1, Issues: []ImportIssue{}}
+	if !reflect.DeepEqual(*dry, want) {
+		t.Fatalf("dry run = %+v, want %+v", *dry, want)
+	}
+	if got := importedNotes(t, c); len(got) != 0 {
+		t.Fatalf("dry run imported %d notes", len(got))
+	}
+
+	report, err := c.ImportJEX(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.DryRun = false
+	if !reflect.DeepEqual(*report, want) {
+		t.Fatalf("report = %+v, want %+v", *report, want)
+	}
+
+	got := importedNotes(t, c)
+	plan, done := got["Plan"], got["Done"]
+	if plan == nil || done == nil || len(got) != 2 {
+		t.Fatalf("imported notes = %v", got)
+	}
+	if name := notebookName(t, c, plan); name != "Projects/Alpha" {
+		t.Fatalf("Plan: notebook = %q", name)
+	}
+	if name := notebookName(t, c, done); name != "Projects" {
+		t.Fatalf("Done: notebook = %q", name)
+	}
+	if names := tagNames(plan); !reflect.DeepEqual(names, []string{"alpha"}) {
+		t.Fatalf("Plan: tags = %v", names)
+	}
+	if len(done.Tags) != 0 {
+		t.Fatalf("Done: tags = %v", done.Tags)
+	}
+	if created, err := time.Parse(time.RFC3339, plan.CreatedAt); err != nil || !created.Equal(time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Plan: createdAt = %q, %v", plan.CreatedAt, err)
+	}
+
+	// :/<ID> 链接改写为附件与笔记链接，HTML 笔记转换为 Markdown
+	if !strings.Contains(plan.Content, "Steps for the launch.") || !strings.Contains(plan.Content, "[Done]("+noteLinkPrefix+done.ID+")") {
+		t.Fatalf("Plan: content =\n%s", plan.Content)
+	}
+	if data := checkAttachment(t, c, plan, "diagram.png", "image/png"); !strings.HasPrefix(string(data), "\x89PNG") {
+		t.Fatal("Plan: attachment is not the PNG")
+	}
+	if !strings.Contains(done.Content, "Shipped **v1**.") || strings.Contains(done.Content, "<p>") {
+		t.Fatalf("Done: content =\n%s", done.Content)
+	}
+}
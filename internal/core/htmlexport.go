@@ -0,0 +1,224 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"locknote/internal/database"
+	"locknote/internal/render"
+	"os"
+	"strings"
+)
+
+// 笔记可以导出为单个自包含的 HTML 文件：样式内联，图片附件以 data URI 嵌入，可以直接在浏览器中打开或打印为 PDF。
+// 导出多篇笔记时开头是目录，笔记之间的 note:// 链接改写为文档内的锚点，指向文档外笔记的链接只保留文字。
+
+// htmlEmbedMaxSize 是以 data URI 嵌入的单个图片的最大字节数，更大的图片只保留替代文本
+const htmlEmbedMaxSize = 20 << 20
+
+// htmlEmbedMimes 是可以嵌入的图片类型，其他类型的 data URI 会被渲染器当作不安全的链接清空
+var htmlEmbedMimes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// NoteHTML 把一篇笔记渲染为自包含的 HTML 文档，图片附件嵌入文档
+func (c *Core) NoteHTML(noteID string) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	meta, err := c.db.GetNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+	doc, _, err := c.renderHTML("", []*database.NoteMeta{meta}, true)
+	return doc, err
+}
+
+// ExportHTML 把选中的笔记以明文导出为 dest 处的单个 HTML 文件，需要再次输入主密码，锁定的笔记本中的笔记不导出。
+// opts.Attachments 为 true 时嵌入图片附件；不支持 opts.Zip
+func (c *Core) ExportHTML(password, dest string, opts ExportOptions) (*ExportResult, error) {
+	if opts.Zip {
+		return nil, errors.New("HTML 导出为单个文件，不支持 zip")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+	if err := c.checkPassword(password); err != nil {
+		return nil, err
+	}
+
+	metas, err := c.exportSelection(opts)
+	if err != nil {
+		return nil, err
+	}
+	metas, locked, err := c.skipLockedNotes(metas)
+	if err != nil {
+		return nil, err
+	}
+	title, err := c.exportTitle(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, embedded, err := c.renderHTML(title, metas, opts.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	tempPath := dest + ".tmp"
+	if err := os.WriteFile(tempPath, doc, 0600); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	if err := os.Rename(tempPath, dest); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	return &ExportResult{Path: dest, Notes: len(metas), Attachments: embedded, Locked: locked}, nil
+}
+
+// exportTitle 返回导出文档的标题：所选笔记本、标签或智能视图的名称，导出全部笔记时为 LockNote
+func (c *Core) exportTitle(opts ExportOptions) (string, error) {
+	switch {
+	case opts.NotebookID != "":
+		nb, err := c.notebookService.Get(opts.NotebookID)
+		if err != nil {
+			return "", err
+		}
+		return nb.Name, nil
+	case opts.TagID != "":
+		tag, err := c.tagService.Get(opts.TagID)
+		if err != nil {
+			return "", err
+		}
+		return "#" + tag.Name, nil
+	case opts.SmartViewID != "":
+		sv, err := c.smartViewService.Get(opts.SmartViewID)
+		if err != nil {
+			return "", err
+		}
+		return sv.Name, nil
+	}
+	return "LockNote", nil
+}
+
+// renderHTML 渲染 metas 为一个 HTML 文档，返回文档与嵌入的图片数量。
+// 多于一篇笔记时生成目录；title 为空时使用第一篇笔记的标题。调用方需持有 c.mu
+func (c *Core) renderHTML(title string, metas []*database.NoteMeta, embed bool) ([]byte, int, error) {
+	notebooks, err := c.notebookNames()
+	if err != nil {
+		return nil, 0, err
+	}
+	noteIDs := make([]string, len(metas))
+	included := make(map[string]bool, len(metas))
+	for i, meta := range metas {
+		noteIDs[i] = meta.ID
+		included[meta.ID] = true
+	}
+	tagsByNote, err := c.tagService.NoteTagsBatch(noteIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 同一附件在文档中多次出现时只读取一次
+	images := make(map[string]string)
+	embedded := 0
+	resolve := func(dest string, image bool) string {
+		switch {
+		case strings.HasPrefix(dest, noteLinkPrefix):
+			if id := strings.TrimPrefix(dest, noteLinkPrefix); included[id] {
+				return "#note-" + id
+			}
+			return ""
+		case strings.HasPrefix(dest, attachmentLinkPrefix):
+			if !image || !embed {
+				return ""
+			}
+			id := strings.TrimPrefix(dest, attachmentLinkPrefix)
+			uri, ok := images[id]
+			if !ok {
+				uri = c.attachmentDataURI(id)
+				images[id] = uri
+				if uri != "" {
+					embedded++
+				}
+			}
+			return uri
+		}
+		return dest
+	}
+
+	notes := make([]render.Note, 0, len(metas))
+	for _, meta := range metas {
+		content, err := c.noteService.ReadContent(meta)
+		if err != nil {
+			return nil, 0, fmt.Errorf("笔记 %s 无法解密: %w", meta.ID, err)
+		}
+		body, err := render.Markdown(content.Content, resolve)
+		if err != nil {
+			return nil, 0, fmt.Errorf("笔记 %s 渲染失败: %w", meta.ID, err)
+		}
+
+		tagNames := make([]string, 0, len(tagsByNote[meta.ID]))
+		for _, t := range tagsByNote[meta.ID] {
+			tagNames = append(tagNames, t.Name)
+		}
+
+		note := render.Note{
+			ID:      meta.ID,
+			Title:   content.Title,
+			Created: meta.CreatedAt,
+			Updated: meta.UpdatedAt,
+			Tags:    tagNames,
+			Body:    body,
+		}
+		if meta.NotebookID != nil {
+			note.Notebook = notebooks[*meta.NotebookID]
+		}
+		notes = append(notes, note)
+	}
+
+	if title == "" && len(notes) > 0 {
+		title = notes[0].Title
+	}
+	doc, err := render.Document(title, notes, len(notes) > 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	return doc, embedded, nil
+}
+
+// attachmentDataURI 返回图片附件的 data URI；附件不存在、不是可嵌入的图片或过大时返回空字符串
+func (c *Core) attachmentDataURI(id string) string {
+	a, err := c.db.GetAttachment(id)
+	if err != nil || !htmlEmbedMimes[a.Mime] || a.Size > htmlEmbedMaxSize {
+		return ""
+	}
+	rc, _, err := c.attachmentService.Open(id)
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, htmlEmbedMaxSize+1))
+	if err != nil || len(data) > htmlEmbedMaxSize {
+		return ""
+	}
+	return "data:" + a.Mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
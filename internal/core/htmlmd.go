@@ -0,0 +1,412 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// htmlNode 是解析后的 HTML 节点，tag 为空时是文本节点
+type htmlNode struct {
+	tag      string
+	attrs    map[string]string
+	text     string
+	children []*htmlNode
+}
+
+// parseHTML 宽松地解析 HTML 或 Evernote 的 ENML：允许未闭合的标签与 HTML 实体。
+// 语法错误之前已解析的部分照常返回
+func parseHTML(src string) (*htmlNode, error) {
+	dec := xml.NewDecoder(strings.NewReader(src))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	root := &htmlNode{tag: "#root"}
+	stack := []*htmlNode{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return root, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &htmlNode{tag: strings.ToLower(t.Name.Local), attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			top.children = append(top.children, &htmlNode{text: string(t)})
+		}
+	}
+}
+
+// htmlBlockTags 是按块渲染的标签，其余标签按行内渲染
+var htmlBlockTags = map[string]bool{
+	"#root": true, "en-note": true, "html": true, "body": true,
+	"div": true, "p": true, "section": true, "article": true, "header": true, "footer": true,
+	"main": true, "aside": true, "nav": true, "center": true, "figure": true, "figcaption": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"blockquote": true, "pre": true, "table": true, "hr": true, "address": true,
+}
+
+// htmlIgnoredTags 的内容不导入
+var htmlIgnoredTags = map[string]bool{
+	"head": true, "title": true, "style": true, "script": true, "meta": true, "link": true,
+	"noscript": true, "template": true,
+}
+
+var htmlSpacePattern = regexp.MustCompile(`[ \t\r\n]+`)
+
+// htmlRenderer 把 HTML 节点树转换为 Markdown。
+// media 把 Evernote 的 <en-media> 转换为 Markdown 链接，返回空字符串时忽略该元素
+type htmlRenderer struct {
+	media     func(attrs map[string]string) string
+	encrypted bool // 遇到了 Evernote 加密的内容
+}
+
+// htmlToMarkdown 解析 HTML 并转换为 Markdown
+func (r *htmlRenderer) htmlToMarkdown(src string) (string, error) {
+	root, err := parseHTML(src)
+	return strings.TrimSpace(r.blocks(root.children)) + "\n", err
+}
+
+// blocks 渲染一组节点：连续的行内节点组成一个段落，块之间以空行分隔。
+// 列表项中紧跟在文字后的嵌套列表只换一行，保持列表紧凑
+func (r *htmlRenderer) blocks(nodes []*htmlNode) string {
+	var b strings.Builder
+	var inline []*htmlNode
+	add := func(text string, list bool) {
+		if b.Len() > 0 {
+			if list {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(text)
+	}
+	flush := func() {
+		if text := strings.TrimSpace(r.inline(inline)); text != "" {
+			add(text, false)
+		}
+		inline = nil
+	}
+	for _, n := range nodes {
+		if n.tag != "" && htmlIgnoredTags[n.tag] {
+			continue
+		}
+		if n.tag == "" || !htmlBlockTags[n.tag] {
+			inline = append(inline, n)
+			continue
+		}
+		flush()
+		if block := strings.Trim(r.block(n), "\n"); strings.TrimSpace(block) != "" {
+			add(block, n.tag == "ul" || n.tag == "ol")
+		}
+	}
+	flush()
+	return b.String()
+}
+
+func (r *htmlRenderer) block(n *htmlNode) string {
+	switch n.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.tag[1:])
+		text := strings.TrimSpace(strings.ReplaceAll(r.inline(n.children), "  \n", " "))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + text
+	case "hr":
+		return "---"
+	case "pre":
+		return fenceCode(htmlPlainText(n))
+	case "ul", "ol":
+		return r.list(n)
+	case "blockquote":
+		return prefixLines(r.blocks(n.children), "> ")
+	case "table":
+		return r.table(n)
+	case "li":
+		return r.list(&htmlNode{tag: "ul", children: []*htmlNode{n}})
+	}
+
+	style := strings.ReplaceAll(n.attrs["style"], " ", "")
+	// Evernote 的代码块是带 -en-codeblock 样式的 div
+	if strings.Contains(style, "-en-codeblock:true") {
+		return fenceCode(htmlPlainText(n))
+	}
+	// 以 <en-todo> 开头的段落是 Evernote 的待办事项
+	if first := firstElement(n.children); first != nil && first.tag == "en-todo" {
+		return "- " + strings.TrimSpace(r.inline(n.children))
+	}
+	return r.blocks(n.children)
+}
+
+// list 渲染 ul 或 ol，子项内容缩进到列表标记之后；Evernote 把嵌套列表直接放在 ul 中
+func (r *htmlRenderer) list(n *htmlNode) string {
+	ordered := n.tag == "ol"
+	// Evernote 新版的清单是带 --en-todo 样式的 ul
+	todo := strings.Contains(strings.ReplaceAll(n.attrs["style"], " ", ""), "--en-todo:true")
+	var items []string
+	number := 1
+	if start, err := strconv.Atoi(n.attrs["start"]); err == nil && ordered {
+		number = start
+	}
+	for _, child := range n.children {
+		switch {
+		case child.tag == "li":
+			marker := "- "
+			if ordered {
+				marker = strconv.Itoa(number) + ". "
+				number++
+			}
+			if todo {
+				if strings.Contains(strings.ReplaceAll(child.attrs["style"], " ", ""), "--en-checked:true") {
+					marker += "[x] "
+				} else {
+					marker += "[ ] "
+				}
+			}
+			body := strings.TrimSpace(r.blocks(child.children))
+			items = append(items, marker+indentLines(body, strings.Repeat(" ", len(marker))))
+		case child.tag == "ul" || child.tag == "ol":
+			nested := indentLines(r.list(child), "  ")
+			if len(items) == 0 {
+				items = append(items, "- "+strings.TrimLeft(nested, " "))
+			} else {
+				items[len(items)-1] += "\n  " + nested
+			}
+		case child.tag == "" && strings.TrimSpace(child.text) == "":
+		default:
+			if text := strings.TrimSpace(r.blocks([]*htmlNode{child})); text != "" {
+				items = append(items, "- "+indentLines(text, "  "))
+			}
+		}
+	}
+	return strings.Join(items, "\n")
+}
+
+// table 渲染为 GFM 表格，第一行作为表头，单元格中的换行替换为空格
+func (r *htmlRenderer) table(n *htmlNode) string {
+	var rows [][]string
+	var walk func(*htmlNode)
+	walk = func(node *htmlNode) {
+		for _, child := range node.children {
+			switch child.tag {
+			case "tr":
+				var cells []string
+				for _, cell := range child.children {
+					if cell.tag == "td" || cell.tag == "th" {
+						text := strings.TrimSpace(r.blocks(cell.children))
+						text = htmlSpacePattern.ReplaceAllString(strings.ReplaceAll(text, "|", `\|`), " ")
+						cells = append(cells, text)
+					}
+				}
+				rows = append(rows, cells)
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// inline 渲染行内节点，连续空白合并为一个空格
+func (r *htmlRenderer) inline(nodes []*htmlNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		if n.tag == "" {
+			b.WriteString(htmlSpacePattern.ReplaceAllString(n.text, " "))
+			continue
+		}
+		if htmlIgnoredTags[n.tag] {
+			continue
+		}
+		switch n.tag {
+		case "br":
+			b.WriteString("  \n")
+		case "b", "strong":
+			b.WriteString(wrapInline(r.inline(n.children), "**"))
+		case "i", "em":
+			b.WriteString(wrapInline(r.inline(n.children), "*"))
+		case "s", "strike", "del":
+			b.WriteString(wrapInline(r.inline(n.children), "~~"))
+		case "code", "tt", "kbd":
+			if text := htmlPlainText(n); strings.TrimSpace(text) != "" {
+				ticks := "`"
+				for strings.Contains(text, ticks) {
+					ticks += "`"
+				}
+				b.WriteString(ticks + text + ticks)
+			}
+		case "a":
+			text := strings.TrimSpace(r.inline(n.children))
+			href := n.attrs["href"]
+			switch {
+			case href == "":
+				b.WriteString(text)
+			case text == "" || text == href:
+				b.WriteString("<" + href + ">")
+			default:
+				b.WriteString("[" + text + "](" + markdownDestination(href) + ")")
+			}
+		case "img":
+			if src := n.attrs["src"]; src != "" {
+				b.WriteString("![" + n.attrs["alt"] + "](" + markdownDestination(src) + ")")
+			}
+		case "en-media":
+			if r.media != nil {
+				b.WriteString(r.media(n.attrs))
+			}
+		case "en-todo":
+			if n.attrs["checked"] == "true" {
+				b.WriteString("[x] ")
+			} else {
+				b.WriteString("[ ] ")
+			}
+		case "en-crypt":
+			r.encrypted = true
+			b.WriteString("*[Evernote 加密内容未导入]*")
+		default:
+			if htmlBlockTags[n.tag] {
+				// 行内元素中的块元素按行分隔
+				if text := strings.TrimSpace(r.blocks([]*htmlNode{n})); text != "" {
+					b.WriteString("  \n" + text + "  \n")
+				}
+				continue
+			}
+			b.WriteString(r.inline(n.children))
+		}
+	}
+	return b.String()
+}
+
+// wrapInline 用 marker 包裹文本，标记放在首尾空白之内
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := text[:strings.Index(text, trimmed)]
+	end := text[len(start)+len(trimmed):]
+	return start + marker + trimmed + marker + end
+}
+
+// markdownDestination 在链接目标含空格或括号时用尖括号包裹
+func markdownDestination(dest string) string {
+	if strings.ContainsAny(dest, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(dest) + ">"
+	}
+	return dest
+}
+
+// htmlPlainText 返回节点的纯文本，块元素与 br 之间换行，用于代码块
+func htmlPlainText(n *htmlNode) string {
+	var b strings.Builder
+	var walk func(*htmlNode)
+	walk = func(node *htmlNode) {
+		if node.tag == "" {
+			b.WriteString(node.text)
+			return
+		}
+		if node.tag == "br" {
+			b.WriteString("\n")
+			return
+		}
+		block := htmlBlockTags[node.tag] && node != n
+		if block && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+		if block && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	walk(n)
+	return strings.Trim(b.String(), "\n")
+}
+
+func fenceCode(code string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + code + "\n" + fence
+}
+
+func firstElement(nodes []*htmlNode) *htmlNode {
+	for _, n := range nodes {
+		if n.tag == "" && strings.TrimSpace(n.text) == "" {
+			continue
+		}
+		return n
+	}
+	return nil
+}
+
+// indentLines 缩进除第一行以外的非空行
+func indentLines(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func prefixLines(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(prefix+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,181 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"locknote/internal/notes"
+
+	"github.com/google/uuid"
+)
+
+// ImportReport 是从备份导入笔记的结果，笔记 ID 均为备份中的 ID
+type ImportReport struct {
+	Imported          map[string]string `json:"imported"`          // 备份中的笔记 ID -> 导入后的笔记 ID
+	Duplicates        []string          `json:"duplicates"`        // 当前数据中已有相同标题与正文，跳过
+	Copies            []string          `json:"copies"`            // ID 已被内容不同的笔记使用，以新 ID 导入
+	Failed            map[string]string `json:"failed,omitempty"`  // 无法解密或写入的笔记及原因
+	History           int               `json:"history"`           // 导入的历史版本数量
+	Attachments       int               `json:"attachments"`       // 导入的附件数量
+	TagsCreated       int               `json:"tagsCreated"`       // 按名称没有对应而新建的标签
+	NotebooksCreated  int               `json:"notebooksCreated"`  // 按名称没有对应而新建的笔记本
+	SmartViewsCreated int               `json:"smartViewsCreated"` // 新建的智能视图（同名的不导入）
+}
+
+// ImportFromBackup 把备份中的全部笔记合并到当前数据，不替换现有内容。
+// 笔记保留日期、置顶、回收站状态、历史版本与附件；标签与笔记本按名称合并，智能视图按名称去重；
+// 当前数据中已有相同标题与正文的笔记被跳过。displayKey 与 passphrase 的含义同 OpenBackup
+func (c *Core) ImportFromBackup(inputPath, passphrase, displayKey string) (*ImportReport, error) {
+	view, err := c.openBackupView(inputPath, passphrase, displayKey)
+	if err != nil {
+		return nil, err
+	}
+	defer view.Close()
+
+	store, err := view.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer view.mu.RUnlock()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	present, err := c.contentDigests()
+	if err != nil {
+		return nil, err
+	}
+
+	metas, err := store.db.ListNotes(true)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := c.newBackupImport(store)
+	report := &ImportReport{
+		Imported:   make(map[string]string),
+		Duplicates: []string{},
+		Copies:     []string{},
+		Failed:     make(map[string]string),
+	}
+	for _, meta := range metas {
+		content, err := store.noteService.ReadContent(meta)
+		if err != nil {
+			report.Failed[meta.ID] = "无法解密"
+			continue
+		}
+		digest := contentDigest(content)
+		if present[digest] {
+			report.Duplicates = append(report.Duplicates, meta.ID)
+			continue
+		}
+
+		newID := meta.ID
+		if _, err := c.db.GetNote(meta.ID); err == nil {
+			newID = uuid.New().String()
+			report.Copies = append(report.Copies, meta.ID)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		if err := imp.restoreNote(meta.ID, newID); err != nil {
+			report.Failed[meta.ID] = err.Error()
+			continue
+		}
+		present[digest] = true
+		report.Imported[meta.ID] = newID
+	}
+
+	if report.SmartViewsCreated, err = imp.importSmartViews(); err != nil {
+		return nil, err
+	}
+	report.History = imp.history
+	report.Attachments = imp.attachments
+	report.TagsCreated = imp.tagsCreated
+	report.NotebooksCreated = imp.notebooksCreated
+	return report, nil
+}
+
+// contentDigests 返回当前全部笔记（含回收站）标题与正文的摘要，调用方需持有 c.mu
+func (c *Core) contentDigests() (map[[sha256.Size]byte]bool, error) {
+	metas, err := c.db.ListNotes(true)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[[sha256.Size]byte]bool, len(metas))
+	for _, meta := range metas {
+		content, err := c.noteService.ReadContent(meta)
+		if err != nil {
+			continue
+		}
+		digests[contentDigest(content)] = true
+	}
+	return digests, nil
+}
+
+func contentDigest(content *notes.NoteContent) [sha256.Size]byte {
+	data, _ := json.Marshal(content)
+	return sha256.Sum256(data)
+}
+
+// importSmartViews 导入备份中与当前数据不同名的智能视图，其中的标签与笔记本按名称对应，返回新建的数量
+func (imp *backupImport) importSmartViews() (int, error) {
+	views, err := imp.store.smartViewService.List()
+	if err != nil {
+		return 0, err
+	}
+	current, err := imp.c.smartViewService.List()
+	if err != nil {
+		return 0, err
+	}
+	names := make(map[string]bool, len(current))
+	for _, sv := range current {
+		names[sv.Name] = true
+	}
+
+	created := 0
+	for _, sv := range views {
+		if names[sv.Name] {
+			continue
+		}
+
+		// 备份中已不存在的标签与笔记本保留原 ID，与原视图一样匹配不到笔记
+		var mapErr error
+		filter := sv.Filter.RemapIDs(func(id string) string {
+			mapped, err := imp.tag(id)
+			if err != nil {
+				mapErr = err
+			}
+			if mapped == "" {
+				return id
+			}
+			return mapped
+		}, func(id string) string {
+			mapped, err := imp.notebook(id)
+			if err != nil {
+				mapErr = err
+			}
+			if mapped == nil {
+				return id
+			}
+			return *mapped
+		})
+		if mapErr != nil {
+			return created, mapErr
+		}
+
+		if _, err := imp.c.smartViewService.Create(sv.Name, sv.Icon, filter); err != nil {
+			return created, err
+		}
+		names[sv.Name] = true
+		created++
+	}
+	return created, nil
+}
@@ -0,0 +1,384 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Joplin 的 JEX 导出文件是一个 tar 包：每个条目（笔记、笔记本、资源、标签、笔记与标签的关联）是根目录下的
+// <ID>.md，内容为标题、空行、正文、空行与 "key: value" 元数据；资源文件在 resources/<ID>.<扩展名>。
+// 笔记本可以嵌套，导入后的笔记本名为各级名称以 / 连接。正文中的 :/<ID> 链接改写为附件或笔记链接。
+
+// Joplin 条目类型（type_）
+const (
+	joplinTypeNote     = 1
+	joplinTypeFolder   = 2
+	joplinTypeResource = 4
+	joplinTypeTag      = 5
+	joplinTypeNoteTag  = 6
+)
+
+// joplinMarkupHTML 是 markup_language 中 HTML 笔记的值
+const joplinMarkupHTML = "2"
+
+// joplinLinkPattern 匹配正文中指向资源或笔记的 :/<32 位 ID> 链接
+var joplinLinkPattern = regexp.MustCompile(`:/([0-9a-f]{32})\b`)
+
+// joplinItem 是 JEX 中的一个条目
+type joplinItem struct {
+	file  string
+	title string
+	body  string
+	props map[string]string
+}
+
+func (it *joplinItem) typ() int {
+	var t int
+	fmt.Sscanf(it.props["type_"], "%d", &t)
+	return t
+}
+
+// joplinAttachment 是某篇笔记引用的一个资源，同一资源被多篇笔记引用时每篇各导入一份
+type joplinAttachment struct {
+	id       string
+	noteID   string
+	resource string
+}
+
+// ImportJEX 从 Joplin 的 JEX 文件导入笔记、笔记本、标签与资源。
+// 单个条目的问题记入报告，不影响其他条目；dryRun 时只转换与计数，不写入任何数据
+func (c *Core) ImportJEX(inputPath string, dryRun bool) (*ExternalImportReport, error) {
+	items, blobs, err := readJEXItems(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	report := &ExternalImportReport{DryRun: dryRun, Issues: []ImportIssue{}}
+	imp := c.newImportNames(dryRun)
+
+	folders := make(map[string]*joplinItem)
+	tags := make(map[string]string)
+	resources := make(map[string]*joplinItem)
+	noteTags := make(map[string][]string)
+	var notes []*joplinItem
+	for _, it := range items {
+		if it.props["encryption_applied"] == "1" {
+			report.issue(joplinKind(it.typ()), it.file, errors.New("已使用 Joplin 端到端加密，请在 Joplin 中解密后重新导出"))
+			continue
+		}
+		switch it.typ() {
+		case joplinTypeNote:
+			notes = append(notes, it)
+		case joplinTypeFolder:
+			folders[it.props["id"]] = it
+		case joplinTypeResource:
+			resources[it.props["id"]] = it
+		case joplinTypeTag:
+			tags[it.props["id"]] = it.title
+		}
+	}
+	for _, it := range items {
+		if it.typ() == joplinTypeNoteTag {
+			if name, ok := tags[it.props["tag_id"]]; ok {
+				noteTags[it.props["note_id"]] = append(noteTags[it.props["note_id"]], name)
+			}
+		}
+	}
+
+	// 先为全部笔记分配 ID，笔记之间的链接才能改写
+	noteIDs := make(map[string]string, len(notes))
+	for _, it := range notes {
+		noteIDs[it.props["id"]] = uuid.New().String()
+	}
+
+	var attachments []joplinAttachment
+	failed := make(map[string]bool)
+	for _, it := range notes {
+		noteID := noteIDs[it.props["id"]]
+		body := it.body
+		if it.props["markup_language"] == joplinMarkupHTML {
+			renderer := &htmlRenderer{}
+			if body, err = renderer.htmlToMarkdown(body); err != nil {
+				report.issue("note", it.title, fmt.Errorf("HTML 正文格式有误，只导入了可以解析的部分: %w", err))
+			}
+		}
+
+		// 同一笔记中多次引用的资源只导入一份
+		noteAttachments := make(map[string]string)
+		body = joplinLinkPattern.ReplaceAllStringFunc(body, func(link string) string {
+			ref := link[2:]
+			if id, ok := noteIDs[ref]; ok {
+				return noteLinkPrefix + id
+			}
+			if res, ok := resources[ref]; ok {
+				if !blobs[ref] {
+					// 导出文件中缺少资源数据时保留原链接
+					report.issue("resource", it.title+" / "+res.title, errors.New("导出文件中缺少该资源的数据"))
+					return link
+				}
+				id, ok := noteAttachments[ref]
+				if !ok {
+					id = uuid.New().String()
+					noteAttachments[ref] = id
+					attachments = append(attachments, joplinAttachment{id: id, noteID: noteID, resource: ref})
+				}
+				return attachmentLinkPrefix + id
+			}
+			return link
+		})
+
+		created := joplinTime(it.props, "user_created_time", "created_time")
+		if created.IsZero() {
+			created = time.Now()
+		}
+		note := &importedNote{
+			id:       noteID,
+			title:    it.title,
+			content:  body,
+			created:  created,
+			updated:  joplinTime(it.props, "user_updated_time", "updated_time"),
+			notebook: joplinFolderPath(folders, it.props["parent_id"]),
+			tags:     noteTags[it.props["id"]],
+		}
+		if deleted := joplinTime(it.props, "deleted_time"); !deleted.IsZero() {
+			note.deleted = &deleted
+		}
+		if err := imp.put(note); err != nil {
+			report.issue("note", it.title, err)
+			failed[noteID] = true
+			continue
+		}
+		report.Notes++
+	}
+
+	// 写入失败的笔记的附件不导入
+	pending := make(map[string][]joplinAttachment)
+	for _, a := range attachments {
+		if !failed[a.noteID] {
+			pending[a.resource] = append(pending[a.resource], a)
+		}
+	}
+	if err := c.importJEXResources(inputPath, dryRun, resources, pending, report); err != nil {
+		return nil, err
+	}
+
+	report.NotebooksCreated = imp.notebooksCreated
+	report.TagsCreated = imp.tagsCreated
+	return report, nil
+}
+
+// importJEXResources 再次读取 tar 包，把 pending 中被笔记引用的资源文件导入为附件
+func (c *Core) importJEXResources(inputPath string, dryRun bool, resources map[string]*joplinItem, pending map[string][]joplinAttachment, report *ExternalImportReport) error {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(bufio.NewReader(f))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if !hdr.FileInfo().Mode().IsRegular() || path.Dir(name) != "resources" {
+			continue
+		}
+		base := path.Base(name)
+		resourceID := strings.TrimSuffix(base, path.Ext(base))
+		refs := pending[resourceID]
+		if len(refs) == 0 {
+			continue
+		}
+		delete(pending, resourceID)
+
+		res := resources[resourceID]
+		filename := res.props["filename"]
+		if filename == "" {
+			filename = res.title
+		}
+		if filename == "" {
+			filename = base
+		}
+		if path.Ext(filename) == "" && res.props["file_extension"] != "" {
+			filename += "." + res.props["file_extension"]
+		}
+		created := joplinTime(res.props, "user_created_time", "created_time")
+		if created.IsZero() {
+			created = time.Now()
+		}
+
+		if dryRun {
+			report.Attachments += len(refs)
+			continue
+		}
+
+		// 只被一篇笔记引用时直接从 tar 包流式写入，否则读入内存后为每篇笔记各写一份
+		var data []byte
+		if len(refs) > 1 {
+			if data, err = io.ReadAll(tr); err != nil {
+				return err
+			}
+		}
+		for _, a := range refs {
+			var r io.Reader = tr
+			if data != nil {
+				r = bytes.NewReader(data)
+			}
+			if _, err := c.attachmentService.Import(a.id, a.noteID, filename, res.props["mime"], created, r); err != nil {
+				report.issue("resource", filename, err)
+				continue
+			}
+			report.Attachments++
+		}
+	}
+
+	return nil
+}
+
+// readJEXItems 读取 tar 包中全部条目的元数据，并返回有数据文件的资源 ID；不读取资源文件的内容
+func readJEXItems(inputPath string) ([]*joplinItem, map[string]bool, error) {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var items []*joplinItem
+	blobs := make(map[string]bool)
+	tr := tar.NewReader(bufio.NewReader(f))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(items) == 0 {
+				return nil, nil, fmt.Errorf("不是 Joplin 导出文件（.jex）: %w", err)
+			}
+			return nil, nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if path.Dir(name) == "resources" {
+			base := path.Base(name)
+			blobs[strings.TrimSuffix(base, path.Ext(base))] = true
+			continue
+		}
+		if path.Dir(name) != "." || path.Ext(name) != ".md" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, parseJoplinItem(name, string(data)))
+	}
+	return items, blobs, nil
+}
+
+// parseJoplinItem 解析 Joplin 的条目格式：末尾连续的 "key: value" 行是元数据，
+// 之前的第一行是标题，标题后空一行是正文
+func parseJoplinItem(file, text string) *joplinItem {
+	it := &joplinItem{file: file, props: make(map[string]string)}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	for end > 0 {
+		line := lines[end-1]
+		i := strings.Index(line, ": ")
+		if line == "" || i <= 0 || strings.ContainsAny(line[:i], " \t") {
+			// 值为空时没有冒号后的空格
+			if strings.HasSuffix(line, ":") && !strings.ContainsAny(line, " \t") {
+				it.props[strings.TrimSuffix(line, ":")] = ""
+				end--
+				continue
+			}
+			break
+		}
+		it.props[line[:i]] = strings.NewReplacer("\\n", "\n", "\\r", "\r").Replace(line[i+2:])
+		end--
+	}
+
+	lines = lines[:end]
+	if len(lines) > 0 {
+		it.title = strings.TrimSpace(lines[0])
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	it.body = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if it.body != "" {
+		it.body += "\n"
+	}
+	return it
+}
+
+func joplinKind(typ int) string {
+	switch typ {
+	case joplinTypeNote:
+		return "note"
+	case joplinTypeFolder:
+		return "notebook"
+	case joplinTypeResource:
+		return "resource"
+	case joplinTypeTag, joplinTypeNoteTag:
+		return "tag"
+	}
+	return "file"
+}
+
+// joplinTime 返回 keys 中第一个有效的时间；Joplin 以 ISO 8601 记录时间，没有时为空或 0
+func joplinTime(props map[string]string, keys ...string) time.Time {
+	for _, key := range keys {
+		if t, err := time.Parse(time.RFC3339Nano, props[key]); err == nil && t.Unix() > 0 {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// joplinFolderPath 返回笔记本 id 的完整路径，各级名称以 / 连接；id 为空或不存在时返回空字符串
+func joplinFolderPath(folders map[string]*joplinItem, id string) string {
+	var names []string
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		seen[id] = true
+		folder, ok := folders[id]
+		if !ok {
+			break
+		}
+		names = append([]string{strings.ReplaceAll(folder.title, "/", "_")}, names...)
+		id = folder.props["parent_id"]
+	}
+	return strings.Join(names, "/")
+}
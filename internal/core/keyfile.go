@@ -0,0 +1,152 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"errors"
+	"locknote/internal/crypto"
+	"locknote/internal/database"
+	"os"
+)
+
+// 主密码可以额外要求一个密钥文件（见 crypto.MixKeyfile），缺少密码或密钥文件中的任一项都无法解开数据密钥。
+// 解锁期间密钥文件的摘要保存在内存中，修改密码、导出等需要再次输入密码的操作不必重新选择文件。
+// 恢复密钥不依赖密钥文件，用它重置密码时同时取消密钥文件。
+
+// ErrKeyfileRequired 表示解锁需要密钥文件但没有提供
+var ErrKeyfileRequired = errors.New("需要密钥文件")
+
+// RequiresKeyfile 返回解锁是否需要密钥文件
+func (c *Core) RequiresKeyfile() (bool, error) {
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		return false, err
+	}
+	return mp.Keyfile, nil
+}
+
+// GenerateKeyfile 在 path 处生成一个随机的密钥文件，不覆盖已有的文件
+func (c *Core) GenerateKeyfile(path string) error {
+	data, err := c.cryptoService.GenerateKeyfile()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// SetKeyfile 验证主密码后设置、更换或取消（path 为空）解锁所需的密钥文件
+func (c *Core) SetKeyfile(password, path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isUnlocked {
+		return errors.New("not unlocked")
+	}
+
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		return err
+	}
+	keyfile, err := c.sessionKeyfile(mp)
+	if err != nil {
+		return err
+	}
+	passwordKey, err := c.derivePasswordKey(mp, password, keyfile)
+	if err != nil {
+		return err
+	}
+	if _, err := c.cryptoService.Decrypt(passwordKey, mp.Verifier); err != nil {
+		return errors.New("密码不正确")
+	}
+	dataKey, err := c.cryptoService.Decrypt(passwordKey, mp.EncryptedDataKey)
+	if err != nil {
+		return err
+	}
+
+	newKeyfile, err := c.readKeyfile(path)
+	if err != nil {
+		return err
+	}
+	if err := c.saveMasterPassword(password, newKeyfile, mp.Hint, dataKey); err != nil {
+		return err
+	}
+	c.keyfile = newKeyfile
+	return nil
+}
+
+// readKeyfile 返回 path 处密钥文件的摘要，path 为空时返回 nil
+func (c *Core) readKeyfile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.cryptoService.HashKeyfile(f)
+}
+
+// sessionKeyfile 返回解锁时提供的密钥文件摘要，不需要密钥文件时返回 nil。
+// 用恢复密钥等方式解锁时没有摘要，需要锁定后用密钥文件重新解锁。调用方需持有 c.mu
+func (c *Core) sessionKeyfile(mp *database.MasterPassword) ([]byte, error) {
+	if !mp.Keyfile {
+		return nil, nil
+	}
+	if c.keyfile == nil {
+		return nil, errors.New("需要密钥文件，请锁定后使用密钥文件重新解锁")
+	}
+	return c.keyfile, nil
+}
+
+// derivePasswordKey 按 mp 中的参数由密码与密钥文件摘要派生包装数据密钥的密钥
+func (c *Core) derivePasswordKey(mp *database.MasterPassword, password string, keyfile []byte) ([]byte, error) {
+	kdfParams, err := crypto.ParseKDFParams(mp.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	passwordKey, err := c.cryptoService.DeriveKeyWithParams(password, mp.Salt, kdfParams)
+	if err != nil {
+		return nil, err
+	}
+	return c.cryptoService.MixKeyfile(passwordKey, keyfile), nil
+}
+
+// saveMasterPassword 用新的盐与当前派生参数重新包装数据密钥并保存，keyfile 为 nil 时不需要密钥文件。
+// 调用方需持有 c.mu
+func (c *Core) saveMasterPassword(password string, keyfile []byte, hint string, dataKey []byte) error {
+	salt, err := c.cryptoService.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	kdfParams := crypto.DefaultKDFParams
+	passwordKey, err := c.cryptoService.DeriveKeyWithParams(password, salt, kdfParams)
+	if err != nil {
+		return err
+	}
+	passwordKey = c.cryptoService.MixKeyfile(passwordKey, keyfile)
+
+	encryptedDataKey, err := c.cryptoService.Encrypt(passwordKey, dataKey)
+	if err != nil {
+		return err
+	}
+	verifier, err := c.cryptoService.Encrypt(passwordKey, []byte("LOCKNOTE_VERIFY"))
+	if err != nil {
+		return err
+	}
+	return c.db.SaveMasterPassword(salt, verifier, hint, encryptedDataKey, kdfParams.String(), keyfile != nil)
+}
@@ -0,0 +1,120 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newKeyfileCore 创建一个设置密码时要求密钥文件的 Core，返回时已锁定，以及恢复密钥、密钥文件与另一个密钥文件的路径
+func newKeyfileCore(t *testing.T) (c *Core, displayKey, keyfile, otherKeyfile string) {
+	t.Helper()
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+
+	dir := t.TempDir()
+	keyfile = filepath.Join(dir, "locknote.key")
+	otherKeyfile = filepath.Join(dir, "other.key")
+	for _, path := range []string{keyfile, otherKeyfile} {
+		if err := c.GenerateKeyfile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.GenerateKeyfile(keyfile); err == nil {
+		t.Fatal("GenerateKeyfile overwrote an existing file")
+	}
+
+	if displayKey, err = c.GenerateDataKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetupPassword("password", "", displayKey, keyfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Notes().Create("标题", "正文"); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+	return c, displayKey, keyfile, otherKeyfile
+}
+
+func checkFailures(t *testing.T, c *Core, want int) {
+	t.Helper()
+	status, err := c.UnlockThrottle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failures != want {
+		t.Fatalf("failures = %d, want %d", status.Failures, want)
+	}
+}
+
+func TestUnlockWithKeyfile(t *testing.T) {
+	c, _, keyfile, otherKeyfile := newKeyfileCore(t)
+	if required, err := c.RequiresKeyfile(); err != nil || !required {
+		t.Fatalf("RequiresKeyfile = %v, %v", required, err)
+	}
+
+	// 没有提供密钥文件时不尝试解锁，也不计入失败次数
+	if ok, err := c.Unlock("password", ""); ok || !errors.Is(err, ErrKeyfileRequired) {
+		t.Fatalf("Unlock without a keyfile = %v, %v", ok, err)
+	}
+	if ok, err := c.Unlock("password", filepath.Join(t.TempDir(), "missing.key")); ok || err == nil {
+		t.Fatalf("Unlock with a missing keyfile = %v, %v", ok, err)
+	}
+	checkFailures(t, c, 0)
+
+	// 错误的密钥文件与错误的密码一样计入失败次数
+	if ok, err := c.Unlock("password", otherKeyfile); ok || err != nil {
+		t.Fatalf("Unlock with another keyfile = %v, %v", ok, err)
+	}
+	checkFailures(t, c, 1)
+	if ok, err := c.Unlock("wrong password", keyfile); ok || err != nil {
+		t.Fatalf("Unlock with a wrong password = %v, %v", ok, err)
+	}
+	checkFailures(t, c, 2)
+
+	if ok, err := c.Unlock("password", keyfile); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	checkFailures(t, c, 0)
+	if list, err := c.Notes().List(); err != nil || len(list) != 1 {
+		t.Fatalf("notes = %v, %v", list, err)
+	}
+
+	// 会话中保存了密钥文件摘要，取消密钥文件时不必重新选择
+	if err := c.SetKeyfile("password", ""); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock after removing the keyfile = %v, %v", ok, err)
+	}
+}
+
+func TestResetPasswordRemovesKeyfile(t *testing.T) {
+	c, displayKey, _, _ := newKeyfileCore(t)
+
+	if err := c.ResetPasswordWithDataKey(displayKey, "new password", ""); err != nil {
+		t.Fatal(err)
+	}
+	if required, err := c.RequiresKeyfile(); err != nil || required {
+		t.Fatalf("RequiresKeyfile after reset = %v, %v", required, err)
+	}
+	if list, err := c.Notes().List(); err != nil || len(list) != 1 {
+		t.Fatalf("notes = %v, %v", list, err)
+	}
+
+	c.Lock()
+	if ok, err := c.Unlock("new password", ""); err != nil || !ok {
+		t.Fatalf("Unlock without a keyfile = %v, %v", ok, err)
+	}
+	if list, err := c.Notes().List(); err != nil || len(list) != 1 {
+		t.Fatalf("notes after unlock = %v, %v", list, err)
+	}
+}
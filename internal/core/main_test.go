@@ -0,0 +1,16 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"locknote/internal/crypto"
+	"os"
+	"testing"
+)
+
+// TestMain 把默认的密码派生参数调低以加快测试，仍与旧版参数不同，解锁时的升级照常发生
+func TestMain(m *testing.M) {
+	crypto.DefaultKDFParams = crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Time: 1, MemoryKiB: 8 * 1024, Threads: 1}
+	os.Exit(m.Run())
+}
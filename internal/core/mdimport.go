@@ -0,0 +1,760 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// 从 Obsidian、Logseq 或普通 Markdown 文件夹批量导入笔记：
+//
+//   - 子目录对应笔记本，多级目录的笔记本名为相对路径（如 "项目/2024"），根目录的笔记不属于笔记本
+//   - YAML front matter 与 Logseq 的 key:: value 属性中的 title、tags、aliases、created、updated 被解析，
+//     其余属性原样保留在正文开头
+//   - 正文中的 #标签 与 front matter 中的标签一起成为笔记标签
+//   - 文件修改时间作为创建与更新时间，front matter 中的日期优先
+//   - [[wikilink]] 改写为 note:// 链接，![[图片]] 与 ![](相对路径) 嵌入的文件作为附件导入
+//   - 隐藏文件与目录（.obsidian、.trash 等）以及 Logseq 的 logseq 配置目录被跳过
+
+// noteLinkPrefix 是正文中指向其他笔记的链接前缀，后接笔记 ID
+const noteLinkPrefix = "note://"
+
+// MarkdownImportReport 是导入 Markdown 文件夹的结果，文件以相对于文件夹的路径标识
+type MarkdownImportReport struct {
+	Imported         map[string]string   `json:"imported"`             // 文件路径 -> 新笔记 ID
+	Duplicates       []string            `json:"duplicates"`           // 已有相同标题与正文的笔记，跳过
+	Failed           map[string]string   `json:"failed,omitempty"`     // 无法读取或写入的文件及原因
+	Unresolved       map[string][]string `json:"unresolved,omitempty"` // 找不到目标的 wikilink 与嵌入，保留原文
+	Attachments      int                 `json:"attachments"`          // 导入的附件数量
+	TagsCreated      int                 `json:"tagsCreated"`          // 按名称没有对应而新建的标签
+	NotebooksCreated int                 `json:"notebooksCreated"`     // 按名称没有对应而新建的笔记本
+}
+
+// mdFile 是待导入的一个 Markdown 文件
+type mdFile struct {
+	rel      string // 相对路径，以 / 分隔
+	title    string
+	body     string
+	tags     []string
+	aliases  []string
+	created  time.Time
+	updated  time.Time
+	id       string
+	imported bool
+}
+
+// mdVault 是一次导入中扫描到的文件及按名称、路径的索引，键均为小写
+type mdVault struct {
+	root         string
+	files        []*mdFile
+	notesByPath  map[string]*mdFile   // 不含扩展名的相对路径
+	notesByName  map[string][]*mdFile // 不含扩展名的文件名、title 与 aliases
+	assets       map[string]string    // 相对路径 -> 原始相对路径
+	assetsByName map[string][]string  // 文件名 -> 原始相对路径
+}
+
+var (
+	// wikiLinkPattern 匹配 [[目标]]、[[目标|显示文本]] 与嵌入 ![[目标]]
+	wikiLinkPattern = regexp.MustCompile(`(!?)\[\[([^\[\]\n]+)\]\]`)
+	// mdLinkPattern 匹配 [文本](目标) 与 ![文本](目标)，目标可用尖括号包裹，可带标题
+	mdLinkPattern = regexp.MustCompile(`(!?)\[([^\[\]\n]*)\]\((<[^<>\n]*>|[^()\s]+)(?:\s+"[^"\n]*")?\)`)
+	// hashtagPattern 匹配行首或空白后的 #标签 与 Logseq 的 #[[多词标签]]
+	hashtagPattern = regexp.MustCompile(`(?:^|\s)#(?:\[\[([^\[\]\n]+)\]\]|([\p{L}\p{N}_/\-]+))`)
+	// logseqPropertyPattern 匹配 Logseq 页面开头的 key:: value 属性
+	logseqPropertyPattern = regexp.MustCompile(`^([A-Za-z][\w-]*):: ?(.*)$`)
+	// linkIDPattern 匹配正文中带 ID 的笔记与附件链接，比较内容时忽略 ID
+	linkIDPattern = regexp.MustCompile(`(attachment://|note://)[0-9a-fA-F-]{36}`)
+)
+
+var mdExtensions = map[string]bool{".md": true, ".markdown": true}
+
+// ImportMarkdownDir 把 root 目录中的 Markdown 文件导入为笔记，不修改现有笔记。
+// 已有相同标题与正文（忽略链接中的 ID）的文件被跳过，指向它们的链接改写为指向已有笔记
+func (c *Core) ImportMarkdownDir(root string) (*MarkdownImportReport, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("请选择一个文件夹")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	report := &MarkdownImportReport{
+		Imported:   make(map[string]string),
+		Duplicates: []string{},
+		Failed:     make(map[string]string),
+		Unresolved: make(map[string][]string),
+	}
+	vault, err := scanMarkdownDir(root, report)
+	if err != nil {
+		return nil, err
+	}
+
+	present, err := c.noteDigests()
+	if err != nil {
+		return nil, err
+	}
+
+	// 先确定每个文件的笔记 ID：重复的文件使用已有笔记的 ID，链接才能指向它们。
+	// 比较内容时链接中的 ID 为空，所以不依赖其他文件的 ID
+	for _, f := range vault.files {
+		content, _, _ := vault.rewrite(f, func(*mdFile) string { return "" }, func(string) string { return "" })
+		digest := noteDigest(f.title, content)
+		if id, ok := present[digest]; ok {
+			f.id = id
+			report.Duplicates = append(report.Duplicates, f.rel)
+			continue
+		}
+		f.id = uuid.New().String()
+		f.imported = true
+		present[digest] = f.id
+	}
+
+	imp := c.newImportNames(false)
+	for _, f := range vault.files {
+		if !f.imported {
+			continue
+		}
+		if err := imp.importMarkdownFile(vault, f, report); err != nil {
+			report.Failed[f.rel] = err.Error()
+			continue
+		}
+		report.Imported[f.rel] = f.id
+	}
+	report.NotebooksCreated = imp.notebooksCreated
+	report.TagsCreated = imp.tagsCreated
+	return report, nil
+}
+
+// noteDigests 返回当前笔记（不含回收站）标题与正文的摘要到笔记 ID 的映射，调用方需持有 c.mu
+func (c *Core) noteDigests() (map[[sha256.Size]byte]string, error) {
+	metas, err := c.db.ListNotes(false)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[[sha256.Size]byte]string, len(metas))
+	for _, meta := range metas {
+		content, err := c.noteService.ReadContent(meta)
+		if err != nil {
+			continue
+		}
+		digests[noteDigest(content.Title, linkIDPattern.ReplaceAllString(content.Content, "$1"))] = meta.ID
+	}
+	return digests, nil
+}
+
+// noteDigest 计算标题与正文的摘要，正文中的链接 ID 需已去掉
+func noteDigest(title, content string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(title + "\x00" + content))
+}
+
+// scanMarkdownDir 扫描 root 中的 Markdown 文件与其他文件，无法读取的 Markdown 文件记入 report.Failed
+func scanMarkdownDir(root string, report *MarkdownImportReport) (*mdVault, error) {
+	vault := &mdVault{
+		root:         root,
+		notesByPath:  make(map[string]*mdFile),
+		notesByName:  make(map[string][]*mdFile),
+		assets:       make(map[string]string),
+		assetsByName: make(map[string][]string),
+	}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			// Logseq 的配置目录，其中 bak 目录保存的是旧版本页面
+			if rel == "logseq" {
+				if _, err := os.Stat(filepath.Join(p, "config.edn")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		ext := strings.ToLower(path.Ext(rel))
+		if !mdExtensions[ext] {
+			vault.assets[strings.ToLower(rel)] = rel
+			name := strings.ToLower(path.Base(rel))
+			vault.assetsByName[name] = append(vault.assetsByName[name], rel)
+			return nil
+		}
+
+		f, err := readMarkdownFile(p, rel)
+		if err != nil {
+			report.Failed[rel] = err.Error()
+			return nil
+		}
+		vault.files = append(vault.files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(vault.files, func(i, j int) bool { return vault.files[i].rel < vault.files[j].rel })
+	for _, f := range vault.files {
+		key := strings.ToLower(strings.TrimSuffix(f.rel, path.Ext(f.rel)))
+		vault.notesByPath[key] = f
+		names := append([]string{path.Base(key), f.title}, f.aliases...)
+		seen := make(map[string]bool)
+		for _, name := range names {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			vault.notesByName[name] = append(vault.notesByName[name], f)
+		}
+	}
+	return vault, nil
+}
+
+// readMarkdownFile 读取并解析一个 Markdown 文件
+func readMarkdownFile(p, rel string) (*mdFile, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	f := &mdFile{
+		rel:     rel,
+		title:   strings.TrimSuffix(path.Base(rel), path.Ext(rel)),
+		created: info.ModTime(),
+		updated: info.ModTime(),
+	}
+
+	props, kept, body := splitFrontMatter(text)
+	if props == nil {
+		props, body = splitLogseqProperties(text)
+	}
+	for key, values := range props {
+		switch key {
+		case "title":
+			if len(values) > 0 && values[0] != "" {
+				f.title = values[0]
+			}
+		case "tags", "tag":
+			f.tags = append(f.tags, values...)
+		case "aliases", "alias":
+			f.aliases = append(f.aliases, values...)
+		case "created", "date", "date created", "created at":
+			if t, ok := parseImportTime(values); ok {
+				f.created = t
+			}
+		case "updated", "modified", "date modified", "last modified", "updated at":
+			if t, ok := parseImportTime(values); ok {
+				f.updated = t
+			}
+		}
+	}
+	if f.updated.Before(f.created) {
+		f.updated = f.created
+	}
+	if kept != "" {
+		body = "---\n" + kept + "---\n" + body
+	}
+	f.body = body
+
+	mapProse(body, func(s string) string {
+		for _, m := range hashtagPattern.FindAllStringSubmatch(s, -1) {
+			tag := m[1] + m[2]
+			// 纯数字（如 #123）不是标签
+			if strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+				f.tags = append(f.tags, tag)
+			}
+		}
+		return s
+	})
+
+	seen := make(map[string]bool)
+	tags := f.tags[:0]
+	for _, tag := range f.tags {
+		tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	f.tags = tags
+	return f, nil
+}
+
+// splitFrontMatter 拆出 YAML front matter，返回识别的属性、需要保留在正文中的其他属性原文与正文。
+// 只支持常见的写法：key: value、key: [a, b] 与下一行起的 "- a" 列表；没有 front matter 时 props 为 nil
+func splitFrontMatter(text string) (props map[string][]string, kept, body string) {
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, "", text
+	}
+	lines := strings.SplitAfter(text[len("---\n"):], "\n")
+	end := -1
+	for i, line := range lines {
+		if t := strings.TrimRight(line, " \t\n"); t == "---" || t == "..." {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, "", text
+	}
+
+	props = make(map[string][]string)
+	var keptLines strings.Builder
+	var key string
+	var recognized bool
+	for _, line := range lines[:end] {
+		trimmed := strings.TrimSpace(line)
+		if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(trimmed, "- ") || trimmed == "-" || trimmed == "" {
+			// 上一个键的续行
+			if recognized {
+				if strings.HasPrefix(trimmed, "-") {
+					if v := yamlScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))); v != "" {
+						props[key] = append(props[key], v)
+					}
+				}
+			} else {
+				keptLines.WriteString(line)
+			}
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			recognized = false
+			keptLines.WriteString(line)
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(line[:i]))
+		switch key {
+		case "title", "tags", "tag", "aliases", "alias", "created", "date", "date created", "created at",
+			"updated", "modified", "date modified", "last modified", "updated at":
+			recognized = true
+			props[key] = append(props[key], splitPropertyValue(strings.TrimSpace(line[i+1:]), key == "title")...)
+		default:
+			recognized = false
+			keptLines.WriteString(line)
+		}
+	}
+	return props, keptLines.String(), strings.Join(lines[end+1:], "")
+}
+
+// splitLogseqProperties 拆出 Logseq 页面开头的 key:: value 属性，没有属性时 props 为 nil
+func splitLogseqProperties(text string) (props map[string][]string, body string) {
+	lines := strings.SplitAfter(text, "\n")
+	n := 0
+	for ; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		m := logseqPropertyPattern.FindStringSubmatch(line)
+		if m == nil {
+			break
+		}
+		if props == nil {
+			props = make(map[string][]string)
+		}
+		key := strings.ToLower(m[1])
+		value := strings.TrimSpace(m[2])
+		if key == "title" {
+			props[key] = []string{value}
+			continue
+		}
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			v = strings.TrimSuffix(strings.TrimPrefix(v, "[["), "]]")
+			if v != "" {
+				props[key] = append(props[key], v)
+			}
+		}
+	}
+	if props == nil {
+		return nil, text
+	}
+	return props, strings.Join(lines[n:], "")
+}
+
+// splitPropertyValue 解析 front matter 的值：[a, b] 形式的列表、逗号或空格分隔的标签，或单个值
+func splitPropertyValue(value string, single bool) []string {
+	if value == "" {
+		return nil
+	}
+	if single {
+		return []string{yamlScalar(value)}
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = value[1 : len(value)-1]
+	} else if !strings.ContainsAny(value, `"'`) {
+		value = strings.ReplaceAll(value, " ", ",")
+	}
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = yamlScalar(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// yamlScalar 去掉 YAML 标量两端的引号
+func yamlScalar(v string) string {
+	if len(v) >= 2 && (v[0] == '"' && v[len(v)-1] == '"' || v[0] == '\'' && v[len(v)-1] == '\'') {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+var importTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseImportTime 解析 front matter 中的日期，没有时区的按本地时间
+func parseImportTime(values []string) (time.Time, bool) {
+	if len(values) == 0 {
+		return time.Time{}, false
+	}
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, values[0], time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// mapProse 对正文中代码块与行内代码以外的部分调用 fn，并拼回结果
+func mapProse(text string, fn func(string) string) string {
+	var b strings.Builder
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			b.WriteString(line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			for _, r := range trimmed[3:] {
+				if r != rune(fence[0]) {
+					break
+				}
+				fence += fence[:1]
+			}
+			b.WriteString(line)
+			continue
+		}
+		b.WriteString(mapInlineProse(line, fn))
+	}
+	return b.String()
+}
+
+// mapInlineProse 对一行中行内代码以外的部分调用 fn
+func mapInlineProse(line string, fn func(string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(line, "`")
+		if start < 0 {
+			b.WriteString(fn(line))
+			return b.String()
+		}
+		n := start
+		for n < len(line) && line[n] == '`' {
+			n++
+		}
+		ticks := line[start:n]
+		end := -1
+		for i := n; i < len(line); {
+			j := strings.Index(line[i:], ticks)
+			if j < 0 {
+				break
+			}
+			j += i
+			k := j + len(ticks)
+			if k == len(line) || line[k] != '`' {
+				end = k
+				break
+			}
+			for k < len(line) && line[k] == '`' {
+				k++
+			}
+			i = k
+		}
+		if end < 0 {
+			b.WriteString(fn(line))
+			return b.String()
+		}
+		b.WriteString(fn(line[:start]))
+		b.WriteString(line[start:end])
+		line = line[end:]
+	}
+}
+
+// rewrite 改写 f 正文中的链接：能找到目标的 wikilink 与指向 Markdown 文件的链接改为 note://，
+// 嵌入的本地文件改为 attachment://。noteID 与 attachmentID 返回链接使用的 ID；
+// 返回改写后的正文、需要导入的附件（附件 ID -> 相对路径）与找不到目标的链接
+func (v *mdVault) rewrite(f *mdFile, noteID func(*mdFile) string, attachmentID func(rel string) string) (string, map[string]string, []string) {
+	attachments := make(map[string]string)
+	ids := make(map[string]string)
+	var unresolved []string
+	dir := path.Dir(f.rel)
+
+	attach := func(rel string) string {
+		id, ok := ids[rel]
+		if !ok {
+			id = attachmentID(rel)
+			ids[rel] = id
+			attachments[id] = rel
+		}
+		return attachmentLinkPrefix + id
+	}
+
+	content := mapProse(f.body, func(s string) string {
+		s = replaceAllSubmatchIndex(wikiLinkPattern, s, func(s string, m []int) string {
+			// Logseq 的 #[[标签]] 是标签，不是链接
+			if m[0] > 0 && s[m[0]-1] == '#' {
+				return s[m[0]:m[1]]
+			}
+			embed := m[3] > m[2]
+			inner := s[m[4]:m[5]]
+			target, display := inner, ""
+			if i := strings.Index(inner, "|"); i >= 0 {
+				target, display = inner[:i], inner[i+1:]
+			}
+			target = strings.TrimSpace(target)
+			if i := strings.Index(target, "#"); i >= 0 {
+				target = target[:i]
+			}
+
+			if note := v.findNote(target, dir); note != nil {
+				if embed {
+					display = note.title
+				} else if display == "" {
+					display = strings.TrimSpace(inner)
+				}
+				return "[" + display + "](" + noteLinkPrefix + noteID(note) + ")"
+			}
+			if embed {
+				if rel := v.findAsset(target, dir); rel != "" {
+					name := path.Base(rel)
+					if isImageFile(rel) {
+						return "![" + name + "](" + attach(rel) + ")"
+					}
+					return "[" + name + "](" + attach(rel) + ")"
+				}
+			}
+			unresolved = append(unresolved, s[m[0]:m[1]])
+			return s[m[0]:m[1]]
+		})
+
+		return replaceAllSubmatchIndex(mdLinkPattern, s, func(s string, m []int) string {
+			bang, text, dest := s[m[2]:m[3]], s[m[4]:m[5]], s[m[6]:m[7]]
+			dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+			if dest == "" || strings.Contains(dest, ":") || strings.HasPrefix(dest, "#") {
+				return s[m[0]:m[1]]
+			}
+			if i := strings.Index(dest, "#"); i >= 0 {
+				dest = dest[:i]
+			}
+			if unescaped, err := url.PathUnescape(dest); err == nil {
+				dest = unescaped
+			}
+
+			if mdExtensions[strings.ToLower(path.Ext(dest))] {
+				if note := v.notePath(dest, dir); note != nil {
+					return "[" + text + "](" + noteLinkPrefix + noteID(note) + ")"
+				}
+				return s[m[0]:m[1]]
+			}
+			if rel := v.assetPath(dest, dir); rel != "" {
+				return bang + "[" + text + "](" + attach(rel) + ")"
+			}
+			return s[m[0]:m[1]]
+		})
+	})
+	return content, attachments, unresolved
+}
+
+// findNote 按 Obsidian 的规则查找 wikilink 目标：带路径时按相对路径，否则按文件名、标题或别名；
+// 同名时优先同一目录，再取路径最短的
+func (v *mdVault) findNote(target, dir string) *mdFile {
+	key := strings.ToLower(target)
+	if ext := path.Ext(key); mdExtensions[ext] {
+		key = strings.TrimSuffix(key, ext)
+	}
+	if key == "" {
+		return nil
+	}
+	if strings.Contains(key, "/") {
+		if f := v.notesByPath[strings.ToLower(path.Join(dir, key))]; f != nil {
+			return f
+		}
+		return v.notesByPath[strings.TrimPrefix(path.Clean(key), "/")]
+	}
+
+	candidates := v.notesByName[key]
+	if len(candidates) == 0 {
+		return nil
+	}
+	best := candidates[0]
+	for _, f := range candidates[1:] {
+		if path.Dir(f.rel) == dir && path.Dir(best.rel) != dir ||
+			(path.Dir(f.rel) == dir) == (path.Dir(best.rel) == dir) && len(f.rel) < len(best.rel) {
+			best = f
+		}
+	}
+	return best
+}
+
+// notePath 按相对路径查找 Markdown 链接指向的笔记，先相对于 dir，再相对于根目录
+func (v *mdVault) notePath(dest, dir string) *mdFile {
+	key := strings.ToLower(strings.TrimSuffix(dest, path.Ext(dest)))
+	if f := v.notesByPath[strings.ToLower(path.Join(dir, key))]; f != nil {
+		return f
+	}
+	return v.notesByPath[strings.TrimPrefix(path.Clean(key), "/")]
+}
+
+// findAsset 查找嵌入的文件：带路径时按相对路径，否则按文件名，同名时取路径最短的
+func (v *mdVault) findAsset(target, dir string) string {
+	if strings.Contains(target, "/") {
+		return v.assetPath(target, dir)
+	}
+	candidates := v.assetsByName[strings.ToLower(target)]
+	best := ""
+	for _, rel := range candidates {
+		if path.Dir(rel) == dir {
+			return rel
+		}
+		if best == "" || len(rel) < len(best) {
+			best = rel
+		}
+	}
+	return best
+}
+
+// assetPath 按相对路径查找文件，先相对于 dir，再相对于根目录
+func (v *mdVault) assetPath(dest, dir string) string {
+	if rel, ok := v.assets[strings.ToLower(path.Join(dir, dest))]; ok {
+		return rel
+	}
+	return v.assets[strings.ToLower(strings.TrimPrefix(path.Clean(dest), "/"))]
+}
+
+func isImageFile(name string) bool {
+	return strings.HasPrefix(mime.TypeByExtension(strings.ToLower(path.Ext(name))), "image/")
+}
+
+// replaceAllSubmatchIndex 与 Regexp.ReplaceAllStringFunc 相同，但 fn 可以拿到子匹配的位置与前文
+func replaceAllSubmatchIndex(re *regexp.Regexp, s string, fn func(s string, m []int) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		b.WriteString(fn(s, m))
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// importMarkdownFile 写入 f 对应的笔记、附件与标签
+func (imp *importNames) importMarkdownFile(vault *mdVault, f *mdFile, report *MarkdownImportReport) error {
+	content, attachments, unresolved := vault.rewrite(f,
+		func(note *mdFile) string { return note.id },
+		func(string) string { return uuid.New().String() })
+	if len(unresolved) > 0 {
+		report.Unresolved[f.rel] = unresolved
+	}
+
+	note := &importedNote{
+		id:      f.id,
+		title:   f.title,
+		content: content,
+		created: f.created,
+		updated: f.updated,
+		tags:    f.tags,
+	}
+	if dir := path.Dir(f.rel); dir != "." {
+		note.notebook = dir
+	}
+	if err := imp.put(note); err != nil {
+		return err
+	}
+
+	for id, rel := range attachments {
+		if err := imp.c.importAttachmentFile(id, f.id, filepath.Join(vault.root, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+		report.Attachments++
+	}
+	return nil
+}
+
+// importAttachmentFile 把文件 p 导入为笔记 noteID 的附件 id，以文件修改时间作为创建时间
+func (c *Core) importAttachmentFile(id, noteID, p string) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = c.attachmentService.Import(id, noteID, filepath.Base(p), "", info.ModTime(), file)
+	return err
+}
@@ -0,0 +1,176 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"locknote/internal/database"
+	"testing"
+)
+
+// plaintextNames 是加密名称之前的版本写入（或旧版本同步来）的明文标签、笔记本与智能视图
+type plaintextNames struct {
+	noteID      string
+	workTagID   string // 已加密的 work 标签
+	dupTagID    string // 与 work 同名的明文标签
+	urgentTagID string
+	notebookID  string
+	viewID      string
+}
+
+func insertPlaintextNames(t *testing.T, c *Core) *plaintextNames {
+	t.Helper()
+	note, err := c.Notes().Create("标题", "正文")
+	if err != nil {
+		t.Fatal(err)
+	}
+	work, err := c.Tags().Create("work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &plaintextNames{noteID: note.ID, workTagID: work.ID, dupTagID: "plain-work", urgentTagID: "plain-urgent", notebookID: "plain-notebook", viewID: "plain-view"}
+
+	for _, tag := range []*database.Tag{{ID: p.dupTagID, Name: "work"}, {ID: p.urgentTagID, Name: "urgent"}} {
+		if err := c.db.CreateTag(tag); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.db.AddNoteTag(note.ID, tag.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.db.CreateNotebook(&database.Notebook{ID: p.notebookID, Name: "Projects", Icon: "folder"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.db.CreateSmartView(&database.SmartView{ID: p.viewID, Name: "Secret", Icon: "star", FilterJSON: `{"searchQuery":"launch plan"}`}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// checkSealed 确认数据库中不再有明文名称，并返回各行的密文
+func (p *plaintextNames) checkSealed(t *testing.T, c *Core) [][]byte {
+	t.Helper()
+	var sealed [][]byte
+	for _, id := range []string{p.workTagID, p.urgentTagID} {
+		tag, err := c.db.GetTag(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag.Name != "" || tag.EncryptedName == nil || tag.NameIndex == nil {
+			t.Fatalf("tag %s is not sealed: %+v", id, tag)
+		}
+		sealed = append(sealed, tag.EncryptedName)
+	}
+	nb, err := c.db.GetNotebook(p.notebookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb.Name != "" || nb.Icon != "" || nb.EncryptedName == nil || nb.EncryptedIcon == nil {
+		t.Fatalf("notebook is not sealed: %+v", nb)
+	}
+	sv, err := c.db.GetSmartView(p.viewID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sv.Name != "" || sv.Icon != "" || sv.FilterJSON != "" || sv.EncryptedName == nil || sv.EncryptedFilter == nil {
+		t.Fatalf("smart view is not sealed: %+v", sv)
+	}
+	return append(sealed, nb.EncryptedName, sv.EncryptedName, sv.EncryptedFilter)
+}
+
+// checkNames 确认名称能用当前数据密钥读出，标签能按名称查找
+func (p *plaintextNames) checkNames(t *testing.T, c *Core) {
+	t.Helper()
+	for name, id := range map[string]string{"work": p.workTagID, "urgent": p.urgentTagID} {
+		tag, err := c.Tags().GetByName(name)
+		if err != nil || tag.ID != id || tag.Name != name {
+			t.Fatalf("GetByName(%q) = %+v, %v", name, tag, err)
+		}
+	}
+	if _, err := c.Tags().GetByName("Projects"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByName(unknown) = %v", err)
+	}
+	tags, err := c.Tags().NoteTags(p.noteID)
+	if err != nil || len(tags) != 2 || tags[0].ID != p.urgentTagID || tags[1].ID != p.workTagID {
+		t.Fatalf("NoteTags = %+v, %v", tags, err)
+	}
+
+	nb, err := c.Notebooks().Get(p.notebookID)
+	if err != nil || nb.Name != "Projects" || nb.Icon != "folder" {
+		t.Fatalf("notebook = %+v, %v", nb, err)
+	}
+	sv, err := c.smartViewService.Get(p.viewID)
+	if err != nil || sv.Name != "Secret" || sv.Icon != "star" || sv.Filter.SearchQuery == nil || *sv.Filter.SearchQuery != "launch plan" {
+		t.Fatalf("smart view = %+v, %v", sv, err)
+	}
+}
+
+func TestUnlockEncryptsPlaintextNames(t *testing.T) {
+	c := unlockedTestCore(t)
+	p := insertPlaintextNames(t, c)
+	c.Lock()
+
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	sealed := p.checkSealed(t, c)
+	p.checkNames(t, c)
+
+	// 同名的明文标签合并到已加密的标签
+	if _, err := c.db.GetTag(p.dupTagID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("duplicate plaintext tag: %v", err)
+	}
+
+	// 已加密的数据不会在下次解锁时改写
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	for i, data := range p.checkSealed(t, c) {
+		if !bytes.Equal(data, sealed[i]) {
+			t.Fatal("sealed names were rewritten on unlock")
+		}
+	}
+}
+
+func TestRotateDataKeyRekeysNames(t *testing.T) {
+	c := unlockedTestCore(t)
+	p := insertPlaintextNames(t, c)
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	oldKey := append([]byte(nil), c.dataKey...)
+	before := p.checkSealed(t, c)
+
+	if _, err := c.RotateDataKey("password"); err != nil {
+		t.Fatal(err)
+	}
+	after := p.checkSealed(t, c)
+	for i := range before {
+		if bytes.Equal(before[i], after[i]) {
+			t.Fatal("names were not re-encrypted")
+		}
+	}
+	p.checkNames(t, c)
+
+	// 旧数据密钥既不能解密名称，也算不出相同的名称索引
+	c.tagService.SetMasterKey(oldKey)
+	if _, err := c.Tags().GetByName("work"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetByName with the old key = %v", err)
+	}
+	c.tagService.SetMasterKey(c.dataKey)
+	c.notebookService.SetMasterKey(oldKey)
+	if _, err := c.Notebooks().Get(p.notebookID); err == nil {
+		t.Fatal("old key still decrypts the notebook name")
+	}
+
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock after rotation = %v, %v", ok, err)
+	}
+	p.checkNames(t, c)
+}
@@ -0,0 +1,220 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// PowerEvent 是系统电源/会话事件
+type PowerEvent int
+
+const (
+	// PowerSuspend 表示系统即将休眠，或检测到刚从休眠中恢复
+	PowerSuspend PowerEvent = iota + 1
+	// PowerSessionLock 表示用户会话被锁屏
+	PowerSessionLock
+)
+
+// PowerSource 是电源/会话事件来源，由各平台实现；上层（如移动端）也可以自行实现后传入
+type PowerSource interface {
+	Events() <-chan PowerEvent
+	Close() error
+}
+
+// ManualPowerSource 是由调用方主动发送事件的 PowerSource，
+// 用于测试，或由无法在 Go 中监听系统事件的平台转发原生通知。
+type ManualPowerSource struct {
+	events chan PowerEvent
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewManualPowerSource() *ManualPowerSource {
+	return &ManualPowerSource{events: make(chan PowerEvent, 8)}
+}
+
+// Emit 发送一个事件，source 已关闭时忽略。不会阻塞：缓冲区已满时丢弃，
+// 此时已有未处理的事件，处理它同样会锁定应用
+func (s *ManualPowerSource) Emit(ev PowerEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- ev:
+	default:
+	}
+}
+
+func (s *ManualPowerSource) Events() <-chan PowerEvent {
+	return s.events
+}
+
+func (s *ManualPowerSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	return nil
+}
+
+const (
+	clockJumpInterval  = 5 * time.Second
+	clockJumpThreshold = 30 * time.Second
+)
+
+// clockJumpSource 通过比较墙上时钟与单调时钟检测休眠：
+// 多数平台上单调时钟在休眠期间不走，恢复后两者会出现明显差值；
+// 即使单调时钟包含休眠时间，定时器长时间未触发也同样说明进程被挂起。
+type clockJumpSource struct {
+	events chan PowerEvent
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newClockJumpSource() *clockJumpSource {
+	s := &clockJumpSource{
+		events: make(chan PowerEvent, 1),
+		stop:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *clockJumpSource) run() {
+	ticker := time.NewTicker(clockJumpInterval)
+	defer ticker.Stop()
+	defer close(s.events)
+
+	last := time.Now()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			monoElapsed := now.Sub(last)
+			wallElapsed := now.Round(0).Sub(last.Round(0))
+			last = now
+
+			drift := wallElapsed - monoElapsed
+			if drift < 0 {
+				drift = -drift
+			}
+			if drift > clockJumpThreshold || monoElapsed > clockJumpInterval+clockJumpThreshold {
+				select {
+				case s.events <- PowerSuspend:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (s *clockJumpSource) Events() <-chan PowerEvent {
+	return s.events
+}
+
+func (s *clockJumpSource) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+// mergedPowerSource 把多个来源的事件合并到一个通道
+type mergedPowerSource struct {
+	sources []PowerSource
+	events  chan PowerEvent
+}
+
+func mergePowerSources(sources ...PowerSource) PowerSource {
+	m := &mergedPowerSource{
+		sources: sources,
+		events:  make(chan PowerEvent, 8),
+	}
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src PowerSource) {
+			defer wg.Done()
+			for ev := range src.Events() {
+				m.events <- ev
+			}
+		}(src)
+	}
+	go func() {
+		wg.Wait()
+		close(m.events)
+	}()
+
+	return m
+}
+
+func (m *mergedPowerSource) Events() <-chan PowerEvent {
+	return m.events
+}
+
+func (m *mergedPowerSource) Close() error {
+	var firstErr error
+	for _, src := range m.sources {
+		if err := src.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StartPowerMonitor 监听电源/会话事件，在设置了 LockOnSleep 时锁定并触发 LockCallback。
+// 再次调用会替换之前的来源。
+func (c *Core) StartPowerMonitor(src PowerSource) {
+	c.StopPowerMonitor()
+
+	c.mu.Lock()
+	c.powerSource = src
+	c.mu.Unlock()
+
+	go func() {
+		for range src.Events() {
+			c.handlePowerEvent()
+		}
+	}()
+}
+
+// StopPowerMonitor 停止电源/会话事件监听
+func (c *Core) StopPowerMonitor() {
+	c.mu.Lock()
+	src := c.powerSource
+	c.powerSource = nil
+	c.mu.Unlock()
+
+	if src != nil {
+		src.Close()
+	}
+}
+
+func (c *Core) handlePowerEvent() {
+	c.mu.RLock()
+	unlocked := c.isUnlocked
+	cb := c.lockCallback
+	c.mu.RUnlock()
+
+	if !unlocked {
+		return
+	}
+
+	settings, _ := c.db.GetSettings()
+	if settings == nil || !settings.LockOnSleep {
+		return
+	}
+
+	c.Lock()
+	if cb != nil {
+		cb()
+	}
+}
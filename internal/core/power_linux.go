@@ -0,0 +1,109 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+//go:build linux
+
+package core
+
+import (
+	"os"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindService          = "org.freedesktop.login1"
+	logindPath             = "/org/freedesktop/login1"
+	logindManagerInterface = "org.freedesktop.login1.Manager"
+	logindSessionInterface = "org.freedesktop.login1.Session"
+)
+
+// logindSource 监听 systemd-logind 的 PrepareForSleep 与当前会话的 Lock 信号
+type logindSource struct {
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+	events  chan PowerEvent
+	once    sync.Once
+}
+
+func newLogindSource() (*logindSource, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindManagerInterface),
+		dbus.WithMatchMember("PrepareForSleep"),
+	); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// 会话锁屏信号只监听当前进程所在的会话；找不到会话时仅监听休眠
+	var sessionPath dbus.ObjectPath
+	manager := conn.Object(logindService, logindPath)
+	if err := manager.Call(logindManagerInterface+".GetSessionByPID", 0, uint32(os.Getpid())).Store(&sessionPath); err == nil {
+		conn.AddMatchSignal(
+			dbus.WithMatchObjectPath(sessionPath),
+			dbus.WithMatchInterface(logindSessionInterface),
+			dbus.WithMatchMember("Lock"),
+		)
+	}
+
+	s := &logindSource{
+		conn:    conn,
+		signals: make(chan *dbus.Signal, 8),
+		events:  make(chan PowerEvent, 8),
+	}
+	conn.Signal(s.signals)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *logindSource) run() {
+	defer close(s.events)
+
+	for sig := range s.signals {
+		switch sig.Name {
+		case logindManagerInterface + ".PrepareForSleep":
+			// 参数为 true 表示即将休眠，false 表示已恢复
+			if len(sig.Body) > 0 {
+				if start, ok := sig.Body[0].(bool); ok && start {
+					s.events <- PowerSuspend
+				}
+			}
+		case logindSessionInterface + ".Lock":
+			s.events <- PowerSessionLock
+		}
+	}
+}
+
+func (s *logindSource) Events() <-chan PowerEvent {
+	return s.events
+}
+
+func (s *logindSource) Close() error {
+	var err error
+	s.once.Do(func() {
+		// 关闭连接时 godbus 会关闭 signals 通道，run 随之退出
+		err = s.conn.Close()
+	})
+	return err
+}
+
+// NewSystemPowerSource 返回当前平台的电源/会话事件来源：
+// Linux 上使用 logind 信号，并始终叠加时钟跳变检测作为兜底。
+func NewSystemPowerSource() PowerSource {
+	clock := newClockJumpSource()
+
+	logind, err := newLogindSource()
+	if err != nil {
+		return clock
+	}
+	return mergePowerSources(logind, clock)
+}
@@ -0,0 +1,13 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+//go:build !linux
+
+package core
+
+// NewSystemPowerSource 返回当前平台的电源/会话事件来源。
+// 非 Linux 平台暂时只使用时钟跳变检测，可在恢复后立即锁定。
+func NewSystemPowerSource() PowerSource {
+	return newClockJumpSource()
+}
@@ -0,0 +1,81 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func setLockOnSleep(t *testing.T, c *Core, on bool) {
+	t.Helper()
+	settings, err := c.GetSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.LockOnSleep = on
+	if err := c.UpdateSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPowerMonitorLocks(t *testing.T) {
+	for _, ev := range []PowerEvent{PowerSuspend, PowerSessionLock} {
+		c, _ := newTestCore(t)
+		setLockOnSleep(t, c, true)
+		locked := make(chan struct{}, 1)
+		c.SetLockCallback(func() { locked <- struct{}{} })
+
+		src := NewManualPowerSource()
+		c.StartPowerMonitor(src)
+		if ok, err := c.Unlock("password", ""); err != nil || !ok {
+			t.Fatalf("Unlock = %v, %v", ok, err)
+		}
+
+		src.Emit(ev)
+		select {
+		case <-locked:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d: lock callback was not called", ev)
+		}
+		if c.IsUnlocked() {
+			t.Fatalf("event %d: still unlocked", ev)
+		}
+
+		c.StopPowerMonitor()
+		src.Emit(ev) // 关闭后发送的事件被忽略
+	}
+}
+
+func TestHandlePowerEventIgnored(t *testing.T) {
+	tests := []struct {
+		name        string
+		lockOnSleep bool
+		unlock      bool
+	}{
+		{"lock on sleep off", false, true},
+		{"already locked", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestCore(t)
+			setLockOnSleep(t, c, tt.lockOnSleep)
+			calls := 0
+			c.SetLockCallback(func() { calls++ })
+			if tt.unlock {
+				if ok, err := c.Unlock("password", ""); err != nil || !ok {
+					t.Fatalf("Unlock = %v, %v", ok, err)
+				}
+			}
+
+			c.handlePowerEvent()
+			if calls != 0 {
+				t.Fatalf("lock callback called %d times", calls)
+			}
+			if c.IsUnlocked() != tt.unlock {
+				t.Fatalf("IsUnlocked = %v, want %v", c.IsUnlocked(), tt.unlock)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import "errors"
+
+// 笔记本可以设置自己的密码（见 notebooks 包），保护与取消保护时其中的笔记在数据密钥与笔记本密钥之间重新加密。
+// 重新加密可以重复执行：中断后再次保护或取消保护即可继续，期间笔记用任一可用的密钥都能读取。
+
+// SetNotebookLockCallback 设置受保护的笔记本空闲自动锁定时的回调
+func (c *Core) SetNotebookLockCallback(cb func(id string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notebookLockCallback = cb
+	c.notebookService.SetLockCallback(cb)
+}
+
+// ProtectNotebook 为笔记本设置密码，并把其中的笔记重新加密为笔记本密钥。
+// 笔记本已受保护时验证密码后继续重新加密，用于完成上次中断的保护
+func (c *Core) ProtectNotebook(id, password string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return errors.New("not unlocked")
+	}
+
+	if err := c.notebookService.Protect(id, password); err != nil {
+		return err
+	}
+	return c.noteService.SealNotebook(id)
+}
+
+// UnprotectNotebook 验证笔记本密码后把其中的笔记重新加密为数据密钥，并取消笔记本的保护
+func (c *Core) UnprotectNotebook(id, password string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return errors.New("not unlocked")
+	}
+
+	if err := c.notebookService.Unlock(id, password); err != nil {
+		return err
+	}
+	protected, err := c.notebookService.IsProtected(id)
+	if err != nil || !protected {
+		return err
+	}
+	if err := c.noteService.UnsealNotebook(id); err != nil {
+		return err
+	}
+	return c.notebookService.Unprotect(id)
+}
@@ -0,0 +1,209 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"errors"
+	"locknote/internal/notebooks"
+	"locknote/internal/notes"
+	"testing"
+)
+
+// newNoteWithHistory 创建一篇带一个历史版本的笔记并放入 notebookID
+func newNoteWithHistory(t *testing.T, c *Core, title string, notebookID *string) string {
+	t.Helper()
+	note, err := c.Notes().Create(title, title+" 第一版")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Notes().Update(note.ID, title, title+" 第二版"); err != nil {
+		t.Fatal(err)
+	}
+	if notebookID != nil {
+		if err := c.Notes().SetNotebook(note.ID, notebookID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return note.ID
+}
+
+// checkReadable 确认笔记的正文与历史版本都能读出
+func checkReadable(t *testing.T, c *Core, id, title string) {
+	t.Helper()
+	note, err := c.Notes().Get(id)
+	if err != nil || note.Locked || note.Content != title+" 第二版" {
+		t.Fatalf("%s: note = %+v, %v", title, note, err)
+	}
+	history, err := c.Notes().GetHistory(id)
+	if err != nil || len(history) != 1 || history[0].Content != title+" 第一版" {
+		t.Fatalf("%s: history = %v, %v", title, history, err)
+	}
+}
+
+// checkLocked 确认笔记只返回占位，读取内容返回 notebooks.ErrLocked
+func checkLocked(t *testing.T, c *Core, id, title string) {
+	t.Helper()
+	note, err := c.Notes().Get(id)
+	if err != nil || !note.Locked || note.Title != "" || note.Content != "" {
+		t.Fatalf("%s: note = %+v, %v", title, note, err)
+	}
+	if _, err := c.Notes().GetHistory(id); !errors.Is(err, notebooks.ErrLocked) {
+		t.Fatalf("%s: GetHistory = %v", title, err)
+	}
+	list, err := c.Notes().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range list {
+		if n.ID == id && (!n.Locked || n.Title != "") {
+			t.Fatalf("%s: listed as %+v", title, n)
+		}
+	}
+}
+
+// checkTrashed 确认回收站中的笔记与其他笔记一同重新加密：wantErr 为 nil 时正文与历史版本都能读出
+func checkTrashed(t *testing.T, c *Core, id string, wantErr error) {
+	t.Helper()
+	record, err := c.Notes().ReadRecord(id)
+	if wantErr != nil {
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("trashed: ReadRecord = %v, want %v", err, wantErr)
+		}
+		return
+	}
+	if err != nil || record.Content.Content != "trashed 第二版" || len(record.History) != 1 {
+		t.Fatalf("trashed: record = %+v, %v", record, err)
+	}
+}
+
+func newProtectedNotebook(t *testing.T, c *Core) *notebooks.Notebook {
+	t.Helper()
+	nb, err := c.Notebooks().Create("HR", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nb
+}
+
+func TestProtectNotebook(t *testing.T) {
+	c := unlockedTestCore(t)
+	nb := newProtectedNotebook(t, c)
+	inside := newNoteWithHistory(t, c, "inside", &nb.ID)
+	trashed := newNoteWithHistory(t, c, "trashed", &nb.ID)
+	if err := c.Notes().SoftDelete(trashed); err != nil {
+		t.Fatal(err)
+	}
+	outside := newNoteWithHistory(t, c, "outside", nil)
+
+	if err := c.ProtectNotebook(nb.ID, ""); err == nil {
+		t.Fatal("protected a notebook with an empty password")
+	}
+	if err := c.ProtectNotebook(nb.ID, "notebook password"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Notebooks().Get(nb.ID); err != nil || !got.Protected || got.Locked {
+		t.Fatalf("notebook after protecting = %+v, %v", got, err)
+	}
+	checkReadable(t, c, inside, "inside")
+
+	// 受保护笔记本中的笔记不进入全文索引
+	result, err := c.Notes().Search("inside", notes.SearchOptions{Limit: 10})
+	if err != nil || result.Total != 0 {
+		t.Fatalf("Search found a protected note: %+v, %v", result, err)
+	}
+
+	c.Notebooks().Lock(nb.ID)
+	checkLocked(t, c, inside, "inside")
+	checkReadable(t, c, outside, "outside")
+
+	if err := c.Notebooks().Unlock(nb.ID, "wrong password"); !errors.Is(err, notebooks.ErrWrongPassword) {
+		t.Fatalf("Unlock with a wrong password = %v", err)
+	}
+	checkLocked(t, c, inside, "inside")
+	if err := c.Notebooks().Unlock(nb.ID, "notebook password"); err != nil {
+		t.Fatal(err)
+	}
+	checkReadable(t, c, inside, "inside")
+	checkTrashed(t, c, trashed, nil)
+
+	// 锁定应用时笔记本随之锁定，重新解锁应用后仍需笔记本密码
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	checkLocked(t, c, inside, "inside")
+	checkTrashed(t, c, trashed, notebooks.ErrLocked)
+
+	// 取消保护同样需要笔记本密码
+	if err := c.UnprotectNotebook(nb.ID, "wrong password"); !errors.Is(err, notebooks.ErrWrongPassword) {
+		t.Fatalf("UnprotectNotebook with a wrong password = %v", err)
+	}
+	if err := c.UnprotectNotebook(nb.ID, "notebook password"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Notebooks().Get(nb.ID); err != nil || got.Protected || got.Locked {
+		t.Fatalf("notebook after unprotecting = %+v, %v", got, err)
+	}
+	checkReadable(t, c, inside, "inside")
+	checkTrashed(t, c, trashed, nil)
+	if result, err := c.Notes().Search("inside", notes.SearchOptions{Limit: 10}); err != nil || result.Total != 1 {
+		t.Fatalf("Search after unprotecting = %+v, %v", result, err)
+	}
+}
+
+func TestMoveNoteAcrossProtectedNotebook(t *testing.T) {
+	c := unlockedTestCore(t)
+	nb := newProtectedNotebook(t, c)
+	if err := c.ProtectNotebook(nb.ID, "notebook password"); err != nil {
+		t.Fatal(err)
+	}
+	moved := newNoteWithHistory(t, c, "moved", nil)
+	put := newNoteWithHistory(t, c, "put", nil)
+
+	// 移入已锁定的笔记本需要先解锁
+	c.Notebooks().Lock(nb.ID)
+	if err := c.Notes().SetNotebook(moved, &nb.ID); !errors.Is(err, notebooks.ErrLocked) {
+		t.Fatalf("SetNotebook into a locked notebook = %v", err)
+	}
+	checkReadable(t, c, moved, "moved")
+	if err := c.Notebooks().Unlock(nb.ID, "notebook password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Notes().SetNotebook(moved, &nb.ID); err != nil {
+		t.Fatal(err)
+	}
+	// 同步或导入写入的记录改到受保护笔记本时，已有的历史版本随之换用笔记本密钥
+	record, err := c.Notes().ReadRecord(put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Meta.NotebookID = &nb.ID
+	if err := c.Notes().PutRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	checkReadable(t, c, moved, "moved")
+	checkReadable(t, c, put, "put")
+	c.Notebooks().Lock(nb.ID)
+	checkLocked(t, c, moved, "moved")
+	checkLocked(t, c, put, "put")
+
+	// 移出笔记本后重新用数据密钥加密，笔记本锁定时也能读取
+	if err := c.Notebooks().Unlock(nb.ID, "notebook password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Notes().SetNotebook(moved, nil); err != nil {
+		t.Fatal(err)
+	}
+	if record, err = c.Notes().ReadRecord(put); err != nil {
+		t.Fatal(err)
+	}
+	record.Meta.NotebookID = nil
+	if err := c.Notes().PutRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	c.Notebooks().Lock(nb.ID)
+	checkReadable(t, c, moved, "moved")
+	checkReadable(t, c, put, "put")
+}
@@ -0,0 +1,371 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"locknote/internal/backup"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"locknote/internal/notes"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 恢复备份的流程：
+//
+//  1. 把备份解压到与数据目录同级的暂存目录，不触碰当前数据；
+//  2. 校验暂存的数据：数据库能打开且完整、存在主密码与数据密钥校验文件，
+//     与当前数据密钥相同时再抽查若干笔记能否解密；
+//  3. 锁定并关闭数据库，把当前数据目录改名为恢复前快照，再把暂存目录改名为数据目录；
+//  4. 重新打开数据库，并在新数据目录中记录快照位置，供解锁失败时回滚。
+//
+// 任一步骤失败时当前数据保持不变，或被换回原位。
+
+// restoreSampleSize 是校验暂存数据时抽查解密的笔记数量
+const restoreSampleSize = 20
+
+// restoreSnapshotLabel 是恢复前快照目录名中的标记，快照位于 <数据目录>.pre-restore-<时间>
+const restoreSnapshotLabel = "pre-restore"
+
+// swapTimeFormat 是 swapDataDir 生成的目录名中的时间格式
+const swapTimeFormat = "20060102-150405.000"
+
+// RestoreResult 是恢复备份后的返回结果
+type RestoreResult struct {
+	Snapshot string `json:"snapshot"` // 恢复前的数据目录被保存到的位置
+	Unlocked bool   `json:"unlocked"` // 备份与当前数据密钥相同时保持解锁，否则需要用备份时的主密码解锁
+}
+
+// RestoreInfo 记录最近一次恢复备份的信息，保存在新数据目录的 restore.json 中
+type RestoreInfo struct {
+	Snapshot   string `json:"snapshot"`
+	Source     string `json:"source"`
+	RestoredAt string `json:"restoredAt"`
+}
+
+// RestoreBackup 用当前数据密钥恢复备份
+func (c *Core) RestoreBackup(inputPath string) (*RestoreResult, error) {
+	return c.restoreBackup(inputPath, nil)
+}
+
+// RestoreBackupWithKey 用指定的数据密钥或备份口令恢复备份
+func (c *Core) RestoreBackupWithKey(inputPath string, key backup.Key) (*RestoreResult, error) {
+	return c.restoreBackup(inputPath, &key)
+}
+
+func (c *Core) restoreBackup(inputPath string, key *backup.Key) (*RestoreResult, error) {
+	return c.restore(inputPath, func() (string, error) {
+		if key != nil {
+			return c.backupService.StageRestoreWithKey(inputPath, *key)
+		}
+		return c.backupService.StageRestore(inputPath)
+	})
+}
+
+// RestoreRepositorySnapshot 从备份仓库恢复快照，流程与恢复备份文件相同
+func (c *Core) RestoreRepositorySnapshot(repo *backup.Repository, snapshotID string) (*RestoreResult, error) {
+	return c.restore(repo.Dir()+"#"+snapshotID, func() (string, error) {
+		return c.backupService.StageSnapshot(repo, snapshotID)
+	})
+}
+
+// restore 用 stage 把备份解压到暂存目录，校验后替换数据目录，source 记录在恢复信息中
+func (c *Core) restore(source string, stage func() (string, error)) (*RestoreResult, error) {
+	c.mu.RLock()
+	currentKey := append([]byte(nil), c.dataKey...)
+	c.mu.RUnlock()
+
+	stagedDir, err := stage()
+	if err != nil {
+		return nil, err
+	}
+
+	sameKey, err := c.validateStagedData(stagedDir, currentKey)
+	if err != nil {
+		os.RemoveAll(stagedDir)
+		return nil, fmt.Errorf("备份数据校验失败: %w", err)
+	}
+
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+	c.Lock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot, err := c.swapDataDir(stagedDir, restoreSnapshotLabel)
+	if err != nil {
+		os.RemoveAll(stagedDir)
+		return nil, err
+	}
+
+	info := &RestoreInfo{Snapshot: snapshot, Source: source, RestoredAt: time.Now().UTC().Format(time.RFC3339)}
+	if err := c.writeRestoreInfo(info); err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{Snapshot: snapshot}
+	if sameKey && !c.hasRotationJournal() {
+		if err := c.unlockWithDataKey(currentKey); err != nil {
+			return nil, err
+		}
+		result.Unlocked = true
+	}
+	return result, nil
+}
+
+// validateStagedData 校验暂存目录中的数据，返回它是否使用 currentKey 加密
+func (c *Core) validateStagedData(dir string, currentKey []byte) (bool, error) {
+	dbPath := filepath.Join(dir, "locknote.db")
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		dbPath = filepath.Join(dir, "notebase.db")
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return false, errors.New("备份中没有数据库文件")
+	}
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	// 整体加密的数据库要用数据密钥打开后才能检查，来自其他数据密钥时只能在解锁时验证
+	if !db.Encrypted() {
+		if err := db.IntegrityCheck(); err != nil {
+			return false, err
+		}
+	}
+	if !db.HasMasterPassword() {
+		return false, errors.New("备份中没有主密码信息")
+	}
+
+	verifier, err := os.ReadFile(filepath.Join(dir, "data_key_verifier"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, errors.New("备份中缺少数据密钥校验文件")
+		}
+		return false, err
+	}
+	if len(currentKey) == 0 {
+		return false, nil
+	}
+	plaintext, err := c.cryptoService.Decrypt(currentKey, verifier)
+	if err != nil || string(plaintext) != dataKeyVerifierPlaintext {
+		// 来自其他数据密钥，只能在解锁时验证
+		return false, nil
+	}
+	if db.Encrypted() {
+		if err := db.Unlock(c.databaseKey(currentKey)); err != nil {
+			return false, err
+		}
+		if err := db.IntegrityCheck(); err != nil {
+			return false, err
+		}
+	}
+
+	// 与当前数据密钥相同，抽查笔记能否解密
+	notebookService := notebooks.NewService(db)
+	notebookService.SetMasterKey(currentKey)
+	noteService := notes.NewService(db, dir, notebookService)
+	noteService.SetMasterKey(currentKey)
+	metas, err := db.ListNotes(true)
+	if err != nil {
+		return false, err
+	}
+	for i, meta := range metas {
+		if i == restoreSampleSize {
+			break
+		}
+		check, err := noteService.CheckNote(meta)
+		if err != nil {
+			return false, err
+		}
+		switch check.Content {
+		case notes.StateMissing:
+			return false, fmt.Errorf("笔记 %s 的密文文件缺失", meta.ID)
+		case notes.StateUndecryptable:
+			return false, fmt.Errorf("笔记 %s 无法解密", meta.ID)
+		}
+	}
+	return true, nil
+}
+
+// swapDataDir 关闭数据库，用 newDir 替换数据目录后重新打开，返回原数据目录被移到的位置。
+// 调用方需持有 c.mu 且已锁定。失败时尽量换回原来的数据目录。
+func (c *Core) swapDataDir(newDir, label string) (string, error) {
+	dataDir := filepath.Clean(c.dataDir)
+	oldDir := fmt.Sprintf("%s.%s-%s", dataDir, label, time.Now().Format(swapTimeFormat))
+
+	c.db.Close()
+	reopen := func(err error) error {
+		if openErr := c.open(); openErr != nil {
+			return fmt.Errorf("%w（重新打开数据目录失败: %v）", err, openErr)
+		}
+		return err
+	}
+
+	if err := os.Rename(dataDir, oldDir); err != nil {
+		return "", reopen(err)
+	}
+	if err := os.Rename(newDir, dataDir); err != nil {
+		if restoreErr := os.Rename(oldDir, dataDir); restoreErr != nil {
+			return "", fmt.Errorf("%w（原数据保存在 %s）", err, oldDir)
+		}
+		return "", reopen(err)
+	}
+	if err := c.open(); err != nil {
+		// 新数据无法打开，换回原来的数据目录
+		if moveErr := os.Rename(dataDir, newDir); moveErr == nil {
+			if restoreErr := os.Rename(oldDir, dataDir); restoreErr == nil {
+				return "", reopen(err)
+			}
+		}
+		return "", fmt.Errorf("%w（原数据保存在 %s）", err, oldDir)
+	}
+	return oldDir, nil
+}
+
+// unlockWithDataKey 用已知的数据密钥直接解锁，调用方需持有 c.mu
+func (c *Core) unlockWithDataKey(dataKey []byte) error {
+	if err := c.unlockDatabase(dataKey); err != nil {
+		return err
+	}
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		return err
+	}
+	if mp.DataVersion < dataFormatVersion {
+		if err := c.upgradeData(dataKey); err != nil {
+			return err
+		}
+	}
+	if err := c.rekeyNames(dataKey, dataKey); err != nil {
+		return fmt.Errorf("encrypt names: %w", err)
+	}
+
+	c.dataKey = dataKey
+	c.isUnlocked = true
+	c.setServiceKeys(dataKey)
+	c.lastActivity = time.Now()
+	c.startLockTimer()
+
+	go c.noteService.EnsureSearchIndex()
+	return nil
+}
+
+func (c *Core) restoreInfoPath() string {
+	return filepath.Join(c.dataDir, backup.RestoreMarkerFile)
+}
+
+func (c *Core) writeRestoreInfo(info *RestoreInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	path := c.restoreInfoPath()
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// LastRestore 返回最近一次恢复备份的信息；没有恢复记录或快照已被删除时返回 nil
+func (c *Core) LastRestore() (*RestoreInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.readRestoreInfo()
+}
+
+func (c *Core) readRestoreInfo() (*RestoreInfo, error) {
+	data, err := os.ReadFile(c.restoreInfoPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var info RestoreInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	// restore.json 没有认证，只接受恢复时生成的快照目录，避免回滚或删除快照时操作任意路径
+	if !c.isRestoreSnapshot(info.Snapshot) {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+// isRestoreSnapshot 判断 path 是否为恢复备份时生成的快照目录：与数据目录同级、名称符合
+// <数据目录>.pre-restore-<时间>，且是目录而不是符号链接
+func (c *Core) isRestoreSnapshot(path string) bool {
+	dataDir := filepath.Clean(c.dataDir)
+	if path == "" || filepath.Clean(path) != path || filepath.Dir(path) != filepath.Dir(dataDir) {
+		return false
+	}
+	prefix := filepath.Base(dataDir) + "." + restoreSnapshotLabel + "-"
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if _, err := time.Parse(swapTimeFormat, strings.TrimPrefix(name, prefix)); err != nil {
+		return false
+	}
+	fi, err := os.Lstat(path)
+	return err == nil && fi.IsDir()
+}
+
+// RollbackRestore 撤销最近一次恢复，换回恢复前的数据目录。
+// 用于恢复的数据无法解锁等情况，被撤销的数据直接删除（备份文件本身仍然保留）
+func (c *Core) RollbackRestore() error {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+	c.Lock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := c.readRestoreInfo()
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return errors.New("没有可回滚的备份恢复")
+	}
+
+	restoredDir, err := c.swapDataDir(info.Snapshot, "rolled-back")
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(restoredDir)
+}
+
+// DiscardRestoreSnapshot 确认恢复结果，删除恢复前的数据快照
+func (c *Core) DiscardRestoreSnapshot() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := c.readRestoreInfo()
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		if err := os.RemoveAll(info.Snapshot); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(c.restoreInfoPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsRestoreSnapshot(t *testing.T) {
+	parent := t.TempDir()
+	dataDir := filepath.Join(parent, "data")
+	c := &Core{dataDir: dataDir + string(filepath.Separator)}
+
+	mkdir := func(path string) string {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	snapshot := mkdir(dataDir + ".pre-restore-20260101-120000.000")
+	link := dataDir + ".pre-restore-20260101-120001.000"
+	if err := os.Symlink(mkdir(filepath.Join(parent, "elsewhere")), link); err != nil {
+		t.Fatal(err)
+	}
+	file := dataDir + ".pre-restore-20260101-120002.000"
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"snapshot", snapshot, true},
+		{"empty", "", false},
+		{"data dir", dataDir, false},
+		{"parent", parent, false},
+		{"other label", mkdir(dataDir + ".rolled-back-20260101-120000.000"), false},
+		{"bad time", mkdir(dataDir + ".pre-restore-latest"), false},
+		{"other data dir", mkdir(filepath.Join(parent, "other.pre-restore-20260101-120000.000")), false},
+		{"nested", mkdir(filepath.Join(dataDir, "x", "data.pre-restore-20260101-120000.000")), false},
+		{"not clean", parent + string(filepath.Separator) + "." + string(filepath.Separator) + filepath.Base(snapshot), false},
+		{"missing", dataDir + ".pre-restore-20260101-130000.000", false},
+		{"symlink", link, false},
+		{"file", file, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.isRestoreSnapshot(tt.path); got != tt.want {
+				t.Fatalf("isRestoreSnapshot(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+)
+
+// 更换数据密钥的流程：
+//
+//  1. 写入日志 rotation_journal，其中保存用旧数据密钥加密的新恢复密钥；
+//  2. 把所有笔记、历史版本与附件重新加密为新数据密钥（逐个原子替换，已完成的会被跳过），
+//     整体加密的数据库也换成由新数据密钥派生的密钥；
+//  3. 用新数据密钥重写 data_key_verifier；
+//  4. 最后才把 master_password 中包装的数据密钥换成新的，并删除日志。
+//
+// 任一步骤中断后，master_password 中仍是旧密钥，下次解锁时会根据日志继续完成。
+const rotationJournalFile = "rotation_journal"
+
+type rotationJournal struct {
+	Version int    `json:"version"`
+	NewKey  []byte `json:"newKey"` // 用旧数据密钥加密的新恢复密钥
+}
+
+// RotateResult 是更换数据密钥后的返回结果
+type RotateResult struct {
+	DataKey     string `json:"dataKey"` // 新的恢复密钥，需要提示用户重新保存
+	Notes       int    `json:"notes"`
+	History     int    `json:"history"`
+	Attachments int    `json:"attachments"`
+	Skipped     int    `json:"skipped"` // 已损坏、无法解密而跳过的对象
+}
+
+func (c *Core) rotationJournalPath() string {
+	return filepath.Join(c.dataDir, rotationJournalFile)
+}
+
+func (c *Core) hasRotationJournal() bool {
+	_, err := os.Stat(c.rotationJournalPath())
+	return err == nil
+}
+
+func (c *Core) writeRotationJournal(oldKey []byte, displayKey string) error {
+	newKey, err := c.cryptoService.Encrypt(oldKey, []byte(displayKey))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&rotationJournal{Version: 1, NewKey: newKey})
+	if err != nil {
+		return err
+	}
+
+	path := c.rotationJournalPath()
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// readRotationJournal 用旧数据密钥取出日志中的新恢复密钥；
+// 日志不存在时返回 ""，无法用 oldKey 解密时返回错误
+func (c *Core) readRotationJournal(oldKey []byte) (string, error) {
+	data, err := os.ReadFile(c.rotationJournalPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var journal rotationJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return "", err
+	}
+	displayKey, err := c.cryptoService.Decrypt(oldKey, journal.NewKey)
+	if err != nil {
+		return "", errors.New("rotation journal does not match the data key")
+	}
+	return string(displayKey), nil
+}
+
+// RotateDataKey 生成新的恢复密钥，并用新数据密钥重新加密所有数据。
+// 需要当前密码；完成前中断时，下次解锁会自动继续。
+// 旧的备份仍只能用旧恢复密钥恢复，与其他设备的同步需要重新建立。
+func (c *Core) RotateDataKey(password string) (*RotateResult, error) {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		return nil, err
+	}
+	keyfile, err := c.sessionKeyfile(mp)
+	if err != nil {
+		return nil, err
+	}
+	passwordKey, err := c.derivePasswordKey(mp, password, keyfile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.cryptoService.Decrypt(passwordKey, mp.Verifier); err != nil {
+		return nil, errors.New("密码不正确")
+	}
+	oldKey, err := c.cryptoService.Decrypt(passwordKey, mp.EncryptedDataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 上次未完成的更换继续使用日志中的新密钥
+	displayKey, err := c.readRotationJournal(oldKey)
+	if err != nil {
+		return nil, err
+	}
+	if displayKey == "" {
+		if displayKey, err = c.cryptoService.GenerateDataKey(); err != nil {
+			return nil, err
+		}
+		if err := c.writeRotationJournal(oldKey, displayKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.runRotation(oldKey, displayKey, c.wrapDataKey(passwordKey, mp))
+}
+
+// wrapDataKey 返回把新数据密钥用 passwordKey 包装后保存到 master_password 的函数，其余字段沿用 mp
+func (c *Core) wrapDataKey(passwordKey []byte, mp *database.MasterPassword) func(newKey []byte) error {
+	return func(newKey []byte) error {
+		encryptedDataKey, err := c.cryptoService.Encrypt(passwordKey, newKey)
+		if err != nil {
+			return err
+		}
+		return c.db.SaveMasterPassword(mp.Salt, mp.Verifier, mp.Hint, encryptedDataKey, mp.KDFParams, mp.Keyfile)
+	}
+}
+
+// runRotation 完成日志中的数据密钥更换：重新加密、重写校验文件，
+// 再通过 wrap 保存新数据密钥，最后删除日志并让各服务使用新密钥。调用方需持有 c.mu。
+func (c *Core) runRotation(oldKey []byte, displayKey string, wrap func(newKey []byte) error) (*RotateResult, error) {
+	newKey := c.cryptoService.DeriveDataKey(displayKey)
+	result := &RotateResult{DataKey: displayKey}
+
+	// 重新加密期间暂停各服务，避免写入旧密钥加密的新数据
+	c.setServiceKeys(nil)
+	defer func() {
+		if c.isUnlocked && c.dataKey != nil {
+			c.setServiceKeys(c.dataKey)
+		}
+	}()
+
+	notesResult, err := c.noteService.Rekey(oldKey, newKey)
+	if err != nil {
+		return nil, fmt.Errorf("re-encrypt notes: %w", err)
+	}
+	result.Notes = notesResult.Notes
+	result.History = notesResult.History
+	result.Skipped = notesResult.Skipped
+
+	attachmentCount, skipped, err := c.attachmentService.Rekey(oldKey, newKey)
+	if err != nil {
+		return nil, fmt.Errorf("re-encrypt attachments: %w", err)
+	}
+	result.Attachments = attachmentCount
+	result.Skipped += skipped
+
+	if err := c.rekeyNames(oldKey, newKey); err != nil {
+		return nil, fmt.Errorf("re-encrypt names: %w", err)
+	}
+	if err := c.db.Rekey(c.databaseKey(newKey)); err != nil {
+		return nil, fmt.Errorf("re-encrypt database: %w", err)
+	}
+
+	if err := c.writeDataKeyVerifierFile(newKey); err != nil {
+		return nil, err
+	}
+	if err := wrap(newKey); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(c.rotationJournalPath()); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if c.dataKey != nil && !bytes.Equal(c.dataKey, newKey) {
+		for i := range c.dataKey {
+			c.dataKey[i] = 0
+		}
+	}
+	c.dataKey = newKey
+
+	// 全文索引的词条由数据密钥派生，需要重建
+	if c.isUnlocked {
+		c.noteService.SetMasterKey(newKey)
+		go c.noteService.EnsureSearchIndex()
+	}
+
+	return result, nil
+}
+
+// resumeRotation 在解锁时检查是否有未完成的数据密钥更换。
+// dataKey 是 master_password 中的数据密钥，返回此后应使用的数据密钥。调用方需持有 c.mu。
+func (c *Core) resumeRotation(dataKey []byte, wrap func(newKey []byte) error) ([]byte, error) {
+	if !c.hasRotationJournal() {
+		return dataKey, nil
+	}
+
+	displayKey, err := c.readRotationJournal(dataKey)
+	if err != nil {
+		// 密钥已经换好、只是没来得及删除日志
+		if ok, verr := c.verifyDataKeyWithFile(dataKey); verr == nil && ok {
+			os.Remove(c.rotationJournalPath())
+			return dataKey, nil
+		}
+		return nil, err
+	}
+
+	result, err := c.runRotation(dataKey, displayKey, wrap)
+	if err != nil {
+		return nil, fmt.Errorf("更换数据密钥未完成: %w", err)
+	}
+	c.rotatedDataKey = result.DataKey
+	return c.cryptoService.DeriveDataKey(result.DataKey), nil
+}
+
+// TakeRotatedDataKey 返回解锁时自动完成的数据密钥更换所生成的新恢复密钥（只返回一次），
+// 没有时返回空字符串。上层应提示用户保存。
+func (c *Core) TakeRotatedDataKey() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.rotatedDataKey
+	c.rotatedDataKey = ""
+	return key
+}
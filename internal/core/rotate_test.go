@@ -0,0 +1,155 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// rotationFixture 是更换数据密钥前写入的一篇笔记（带历史版本）与一个附件
+type rotationFixture struct {
+	noteID       string
+	attachmentID string
+}
+
+func newRotationFixture(t *testing.T, c *Core) *rotationFixture {
+	t.Helper()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	note, err := c.Notes().Create("标题", "第一版")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Notes().Update(note.ID, "标题", "第二版"); err != nil {
+		t.Fatal(err)
+	}
+	att, err := c.Attachments().Add(note.ID, "a.txt", "text/plain", strings.NewReader("附件内容"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &rotationFixture{noteID: note.ID, attachmentID: att.ID}
+}
+
+// check 确认笔记、历史版本与附件都能用当前数据密钥读出
+func (f *rotationFixture) check(t *testing.T, c *Core) {
+	t.Helper()
+	note, err := c.Notes().Get(f.noteID)
+	if err != nil {
+		t.Fatalf("read note: %v", err)
+	}
+	if note.Content != "第二版" {
+		t.Fatalf("note content = %q", note.Content)
+	}
+	history, err := c.Notes().GetHistory(f.noteID)
+	if err != nil || len(history) != 1 || history[0].Content != "第一版" {
+		t.Fatalf("history = %v, %v", history, err)
+	}
+	r, _, err := c.Attachments().Open(f.attachmentID)
+	if err != nil {
+		t.Fatalf("open attachment: %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "附件内容" {
+		t.Fatalf("attachment = %q, %v", data, err)
+	}
+}
+
+// interruptRotation 写入日志并执行更换数据密钥的一部分步骤后锁定，模拟进程在更换中途退出。
+// verifierRewritten 为 true 时中断发生在重写校验文件之后、保存新包装之前。返回新的恢复密钥
+func interruptRotation(t *testing.T, c *Core, verifierRewritten bool) string {
+	t.Helper()
+	c.mu.Lock()
+	oldKey := append([]byte(nil), c.dataKey...)
+	newDisplayKey, err := c.cryptoService.GenerateDataKey()
+	if err != nil {
+		c.mu.Unlock()
+		t.Fatal(err)
+	}
+	newKey := c.cryptoService.DeriveDataKey(newDisplayKey)
+	err = c.writeRotationJournal(oldKey, newDisplayKey)
+	if err == nil {
+		c.setServiceKeys(nil)
+		_, err = c.noteService.Rekey(oldKey, newKey)
+	}
+	if err == nil && verifierRewritten {
+		if _, _, err = c.attachmentService.Rekey(oldKey, newKey); err == nil {
+			if err = c.rekeyNames(oldKey, newKey); err == nil {
+				err = c.writeDataKeyVerifierFile(newKey)
+			}
+		}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+	if !c.hasRotationJournal() {
+		t.Fatal("rotation journal missing")
+	}
+	return newDisplayKey
+}
+
+func TestUnlockResumesRotation(t *testing.T) {
+	for _, verifierRewritten := range []bool{false, true} {
+		c, oldDisplayKey := newTestCore(t)
+		f := newRotationFixture(t, c)
+		newDisplayKey := interruptRotation(t, c, verifierRewritten)
+
+		if ok, err := c.Unlock("password", ""); err != nil || !ok {
+			t.Fatalf("Unlock = %v, %v", ok, err)
+		}
+		if got := c.TakeRotatedDataKey(); got != newDisplayKey {
+			t.Fatalf("TakeRotatedDataKey = %q, want the journaled key", got)
+		}
+		if c.hasRotationJournal() {
+			t.Fatal("rotation journal was not removed")
+		}
+		f.check(t, c)
+
+		if ok, err := c.VerifyDataKey(newDisplayKey); err != nil || !ok {
+			t.Fatalf("VerifyDataKey(new) = %v, %v", ok, err)
+		}
+		if ok, _ := c.VerifyDataKey(oldDisplayKey); ok {
+			t.Fatal("old recovery key still verifies")
+		}
+
+		c.Lock()
+		if ok, err := c.Unlock("password", ""); err != nil || !ok {
+			t.Fatalf("Unlock after rotation = %v, %v", ok, err)
+		}
+		f.check(t, c)
+	}
+}
+
+func TestResetPasswordResumesRotation(t *testing.T) {
+	for _, verifierRewritten := range []bool{false, true} {
+		c, oldDisplayKey := newTestCore(t)
+		f := newRotationFixture(t, c)
+		newDisplayKey := interruptRotation(t, c, verifierRewritten)
+
+		if err := c.ResetPasswordWithDataKey(oldDisplayKey, "new password", ""); err != nil {
+			t.Fatalf("ResetPasswordWithDataKey(old key): %v", err)
+		}
+		if got := c.TakeRotatedDataKey(); got != newDisplayKey {
+			t.Fatalf("TakeRotatedDataKey = %q, want the journaled key", got)
+		}
+		if c.hasRotationJournal() {
+			t.Fatal("rotation journal was not removed")
+		}
+		f.check(t, c)
+
+		c.Lock()
+		if ok, err := c.Unlock("new password", ""); err != nil || !ok {
+			t.Fatalf("Unlock with the new password = %v, %v", ok, err)
+		}
+		f.check(t, c)
+		if ok, err := c.VerifyDataKey(newDisplayKey); err != nil || !ok {
+			t.Fatalf("VerifyDataKey(new) = %v, %v", ok, err)
+		}
+	}
+}
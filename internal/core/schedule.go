@@ -0,0 +1,141 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"errors"
+	"locknote/internal/backup"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupCheckInterval 是定时备份检查是否到期的间隔
+const backupCheckInterval = time.Minute
+
+// BackupCallback 是定时备份运行后的回调函数类型，用于通知上层（如桌面端发送事件）
+type BackupCallback func(*backup.ScheduledResult)
+
+// SetBackupCallback 设置定时备份运行后的回调函数
+func (c *Core) SetBackupCallback(cb BackupCallback) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backupCallback = cb
+}
+
+// UpdateBackupSchedule 更新定时备份设置，intervalHours 为 0 或 dir 为空时关闭
+func (c *Core) UpdateBackupSchedule(intervalHours int, dir string, keepDaily, keepWeekly int) error {
+	if intervalHours < 0 || keepDaily < 0 || keepWeekly < 0 {
+		return errors.New("定时备份的间隔与保留数量不能为负数")
+	}
+	if dir != "" {
+		if !filepath.IsAbs(dir) {
+			return errors.New("定时备份目录必须是绝对路径")
+		}
+		dir = filepath.Clean(dir)
+		dataDir := filepath.Clean(c.dataDir)
+		if dir == dataDir || strings.HasPrefix(dir, dataDir+string(filepath.Separator)) {
+			return errors.New("定时备份目录不能位于数据目录中")
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	settings, err := c.db.GetSettings()
+	if err != nil {
+		return err
+	}
+	settings.BackupIntervalHours = intervalHours
+	settings.BackupDir = dir
+	settings.BackupKeepDaily = keepDaily
+	settings.BackupKeepWeekly = keepWeekly
+	return c.db.UpdateSettings(settings)
+}
+
+// StartBackupScheduler 在后台按设置定时备份，再次调用会替换之前的调度
+func (c *Core) StartBackupScheduler() {
+	c.StopBackupScheduler()
+
+	stop := make(chan struct{})
+	c.mu.Lock()
+	c.backupStop = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(backupCheckInterval)
+		defer ticker.Stop()
+		for {
+			c.runScheduledBackup()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopBackupScheduler 停止定时备份
+func (c *Core) StopBackupScheduler() {
+	c.mu.Lock()
+	stop := c.backupStop
+	c.backupStop = nil
+	c.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+	}
+}
+
+func (c *Core) runScheduledBackup() {
+	result, _ := c.scheduledBackup(false)
+	if result == nil {
+		return
+	}
+
+	c.mu.RLock()
+	cb := c.backupCallback
+	c.mu.RUnlock()
+	if cb != nil {
+		cb(result)
+	}
+}
+
+// RunScheduledBackup 立即按定时备份设置运行一次，不检查是否到期
+func (c *Core) RunScheduledBackup() (*backup.ScheduledResult, error) {
+	return c.scheduledBackup(true)
+}
+
+// scheduledBackup 在到期（或 force）时运行定时备份；未到期或未启用时返回 nil。
+// 写入备份期间只持有 c.dataMu，避免与更换数据密钥、恢复备份同时进行，但不阻塞锁定
+func (c *Core) scheduledBackup(force bool) (*backup.ScheduledResult, error) {
+	c.dataMu.Lock()
+	defer c.dataMu.Unlock()
+
+	c.mu.RLock()
+	backupService := c.backupService
+	settings, err := c.db.GetSettings()
+	c.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if settings.BackupDir == "" {
+		if force {
+			return nil, errors.New("尚未设置定时备份目录")
+		}
+		return nil, nil
+	}
+	if !force {
+		interval := time.Duration(settings.BackupIntervalHours) * time.Hour
+		if interval <= 0 || time.Since(backupService.LastScheduledRun()) < interval {
+			return nil, nil
+		}
+	}
+
+	return backupService.CreateScheduledBackup(settings.BackupDir, backup.RetentionPolicy{
+		KeepDaily:  settings.BackupKeepDaily,
+		KeepWeekly: settings.BackupKeepWeekly,
+	})
+}
@@ -0,0 +1,64 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+//go:build sqlcipher
+
+package core
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestScheduledBackupWhileLockedWithDatabaseEncryption(t *testing.T) {
+	c, _ := newTestCore(t)
+	if ok, err := c.Unlock("password", ""); !ok || err != nil {
+		t.Fatalf("Unlock: ok=%v err=%v", ok, err)
+	}
+	if err := c.EncryptDatabase("password"); err != nil {
+		t.Fatal(err)
+	}
+	note, err := c.Notes().Create("Title", "Body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "backups")
+	if err := c.UpdateBackupSchedule(1, dir, 7, 4); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+
+	result, err := c.RunScheduledBackup()
+	if err != nil {
+		t.Fatalf("RunScheduledBackup: %v", err)
+	}
+	if result.Path == "" || result.Skipped != "" {
+		t.Fatalf("result = %+v, want a backup", result)
+	}
+
+	if ok, err := c.Unlock("password", ""); !ok || err != nil {
+		t.Fatalf("Unlock: ok=%v err=%v", ok, err)
+	}
+	if _, err := c.Backup().VerifyBackup(result.Path); err != nil {
+		t.Fatalf("VerifyBackup: %v", err)
+	}
+	if err := c.Notes().Delete(note.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := c.RestoreBackup(result.Path)
+	if err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if !restored.Unlocked || !c.IsDatabaseEncrypted() {
+		t.Fatalf("restored = %+v, encrypted %v", restored, c.IsDatabaseEncrypted())
+	}
+	got, err := c.Notes().Get(note.ID)
+	if err != nil {
+		t.Fatalf("note missing after restore: %v", err)
+	}
+	if got.Title != "Title" || got.Content != "Body" {
+		t.Fatalf("got %q / %q", got.Title, got.Content)
+	}
+}
@@ -0,0 +1,289 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 解锁、验证恢复密钥与用恢复密钥重置密码共用一个连续失败计数，保存在解锁前可读的 unlock_throttle 表中，成功后清零。
+// 前 throttleFreeFailures 次失败不受限制，之后每次失败等待时间加倍，最长 throttleMaxDelay。
+// 记录带有用安装密钥（数据目录中的 install.key）计算的 MAC：记录被改动、删除或安装密钥丢失时按 throttleTamperedFailures 次失败处理。
+// 能同时替换数据目录中所有文件的人仍可以重置计数，此时每次尝试仍需承担密码派生的成本。
+
+const (
+	installKeyFile     = "install.key"
+	throttleMACPurpose = "locknote-unlock-throttle-v1"
+
+	throttleFreeFailures     = 3
+	throttleBaseDelay        = 2 * time.Second
+	throttleMaxDelay         = time.Hour
+	throttleTamperedFailures = 5
+
+	// MinWipeAfterFailures 是“连续失败后清除数据”允许设置的最小次数
+	MinWipeAfterFailures = 10
+)
+
+// ThrottledError 表示连续失败次数过多，需要等待 RetryAfter 后才能再次尝试
+type ThrottledError struct {
+	Failures   int
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	seconds := int((e.RetryAfter + time.Second - 1) / time.Second)
+	return fmt.Sprintf("连续失败 %d 次，请在 %d 秒后重试", e.Failures, seconds)
+}
+
+// ErrDataWiped 表示连续失败达到设置的次数，数据已被清除
+var ErrDataWiped = errors.New("连续失败次数过多，数据已清除")
+
+// ErrDataKeyCorrupted 表示密码正确，但主密码记录中的数据密钥无法解密，需要用数据密钥重置密码
+var ErrDataKeyCorrupted = errors.New("主密码记录已损坏，数据密钥无法解密，请使用数据密钥重置密码")
+
+// UnlockThrottleStatus 是当前的连续失败次数与需要等待的时间，供解锁界面显示
+type UnlockThrottleStatus struct {
+	Failures          int `json:"failures"`
+	RetryAfterSeconds int `json:"retryAfterSeconds"`
+	WipeAfterFailures int `json:"wipeAfterFailures"` // 0 表示不清除数据
+}
+
+// throttleState 是校验 MAC 之后的失败记录
+type throttleState struct {
+	failures    int
+	lastFailure time.Time
+	saved       bool // 已有记录且 MAC 正确
+}
+
+// UnlockThrottle 返回当前的连续失败次数与需要等待的时间
+func (c *Core) UnlockThrottle() (*UnlockThrottleStatus, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	state, err := c.loadThrottle()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := c.db.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	retryAfter := state.retryAfter(time.Now())
+	return &UnlockThrottleStatus{
+		Failures:          state.failures,
+		RetryAfterSeconds: int((retryAfter + time.Second - 1) / time.Second),
+		WipeAfterFailures: settings.WipeAfterFailures,
+	}, nil
+}
+
+// SetWipeAfterFailures 设置连续失败 n 次后清除全部数据，n 为 0 时关闭
+func (c *Core) SetWipeAfterFailures(n int) error {
+	if n != 0 && n < MinWipeAfterFailures {
+		return fmt.Errorf("清除数据前的失败次数不能少于 %d", MinWipeAfterFailures)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isUnlocked {
+		return errors.New("not unlocked")
+	}
+
+	settings, err := c.db.GetSettings()
+	if err != nil {
+		return err
+	}
+	settings.WipeAfterFailures = n
+	return c.db.UpdateSettings(settings)
+}
+
+// throttleDelay 返回连续失败 failures 次之后需要等待的时间
+func throttleDelay(failures int) time.Duration {
+	n := failures - throttleFreeFailures
+	if n < 0 {
+		return 0
+	}
+	if n >= 16 {
+		return throttleMaxDelay
+	}
+	return min(throttleBaseDelay<<n, throttleMaxDelay)
+}
+
+// retryAfter 返回距离下次可以尝试的时间；系统时间被调回时最多等待一个完整的间隔
+func (s *throttleState) retryAfter(now time.Time) time.Duration {
+	delay := throttleDelay(s.failures)
+	if delay == 0 {
+		return 0
+	}
+	wait := s.lastFailure.Add(delay).Sub(now)
+	return max(min(wait, delay), 0)
+}
+
+// checkThrottle 在尝试验证密码或恢复密钥之前调用，仍需等待时返回 *ThrottledError。调用方需持有 c.mu
+func (c *Core) checkThrottle() error {
+	state, err := c.loadThrottle()
+	if err != nil {
+		return err
+	}
+	if !state.saved && state.failures > 0 {
+		// 记录被改动过，按改动被发现的时间重新开始计时
+		if err := c.saveThrottle(state.failures, time.Now()); err != nil {
+			return err
+		}
+		return &ThrottledError{Failures: state.failures, RetryAfter: throttleDelay(state.failures)}
+	}
+	if wait := state.retryAfter(time.Now()); wait > 0 {
+		return &ThrottledError{Failures: state.failures, RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailure 记录一次失败；达到设置的次数时清除全部数据并返回 ErrDataWiped。调用方需持有 c.dataMu 与 c.mu
+func (c *Core) recordFailure() error {
+	state, err := c.loadThrottle()
+	if err != nil {
+		return err
+	}
+	failures := state.failures + 1
+	if err := c.saveThrottle(failures, time.Now()); err != nil {
+		return err
+	}
+
+	settings, err := c.db.GetSettings()
+	if err != nil {
+		return err
+	}
+	if settings.WipeAfterFailures > 0 && failures >= settings.WipeAfterFailures {
+		if err := c.wipeData(); err != nil {
+			return fmt.Errorf("清除数据失败: %w", err)
+		}
+		return ErrDataWiped
+	}
+	return nil
+}
+
+// resetThrottle 在验证成功后清零失败计数，并确保记录与安装密钥存在。调用方需持有 c.mu
+func (c *Core) resetThrottle() error {
+	state, err := c.loadThrottle()
+	if err != nil {
+		return err
+	}
+	if state.saved && state.failures == 0 {
+		return nil
+	}
+	return c.saveThrottle(0, time.Time{})
+}
+
+// loadThrottle 读取失败记录并校验 MAC。记录与安装密钥都不存在时视为没有失败（新数据或旧版本的数据）
+func (c *Core) loadThrottle() (*throttleState, error) {
+	t, err := c.db.GetUnlockThrottle()
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.readInstallKey()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t == nil && key == nil:
+		return &throttleState{}, nil
+	case t != nil && key != nil && hmac.Equal(t.MAC, c.throttleMAC(key, t.Failures, t.LastFailure)):
+		return &throttleState{failures: t.Failures, lastFailure: t.LastFailure, saved: true}, nil
+	}
+
+	failures := throttleTamperedFailures
+	if t != nil {
+		failures = max(failures, t.Failures)
+	}
+	return &throttleState{failures: failures, lastFailure: time.Now()}, nil
+}
+
+// saveThrottle 保存失败记录，安装密钥不存在时先生成
+func (c *Core) saveThrottle(failures int, lastFailure time.Time) error {
+	key, err := c.readInstallKey()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		if key, err = c.createInstallKey(); err != nil {
+			return err
+		}
+	}
+	// 数据库只保存到毫秒
+	lastFailure = lastFailure.Truncate(time.Millisecond)
+	return c.db.SaveUnlockThrottle(&database.UnlockThrottle{
+		Failures:    failures,
+		LastFailure: lastFailure,
+		MAC:         c.throttleMAC(key, failures, lastFailure),
+	})
+}
+
+func (c *Core) throttleMAC(installKey []byte, failures int, lastFailure time.Time) []byte {
+	var millis int64
+	if !lastFailure.IsZero() {
+		millis = lastFailure.UnixMilli()
+	}
+	data := strconv.Itoa(failures) + ":" + strconv.FormatInt(millis, 10)
+	return c.cryptoService.HMAC(c.cryptoService.DeriveSubKey(installKey, throttleMACPurpose), []byte(data))
+}
+
+func (c *Core) installKeyPath() string {
+	return filepath.Join(c.dataDir, installKeyFile)
+}
+
+// readInstallKey 读取安装密钥，不存在时返回 nil
+func (c *Core) readInstallKey() ([]byte, error) {
+	key, err := os.ReadFile(c.installKeyPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return key, err
+}
+
+func (c *Core) createInstallKey() ([]byte, error) {
+	key, err := c.cryptoService.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	path := c.installKeyPath()
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, key, 0600); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	return key, nil
+}
+
+// wipeData 清除数据目录中的全部数据与恢复备份前的快照，之后回到首次运行的状态。
+// 快照路径来自没有认证的 restore.json，readRestoreInfo 只返回恢复时生成的快照目录。
+// 定时备份目录不在数据目录中，不受影响。调用方需持有 c.dataMu 与 c.mu
+func (c *Core) wipeData() error {
+	c.lock()
+	info, _ := c.readRestoreInfo()
+
+	emptyDir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(c.dataDir)), ".locknote-wipe-")
+	if err != nil {
+		return err
+	}
+	oldDir, err := c.swapDataDir(emptyDir, "wiped")
+	if err != nil {
+		os.RemoveAll(emptyDir)
+		return err
+	}
+	if info != nil {
+		os.RemoveAll(info.Snapshot)
+	}
+	return os.RemoveAll(oldDir)
+}
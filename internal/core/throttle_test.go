@@ -0,0 +1,271 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"errors"
+	"locknote/internal/database"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{throttleFreeFailures - 1, 0},
+		{throttleFreeFailures, 2 * time.Second},
+		{throttleFreeFailures + 1, 4 * time.Second},
+		{throttleFreeFailures + 5, 64 * time.Second},
+		{throttleFreeFailures + 10, 2048 * time.Second},
+		{throttleFreeFailures + 11, time.Hour},
+		{throttleFreeFailures + 16, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := throttleDelay(tt.failures); got != tt.want {
+			t.Errorf("throttleDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleRetryAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		failures    int
+		lastFailure time.Time
+		want        time.Duration
+	}{
+		{"free failures", throttleFreeFailures - 1, now, 0},
+		{"just failed", throttleFreeFailures, now, 2 * time.Second},
+		{"partly waited", throttleFreeFailures + 1, now.Add(-time.Second), 3 * time.Second},
+		{"waited", throttleFreeFailures + 1, now.Add(-time.Minute), 0},
+		{"clock set back", throttleFreeFailures, now.Add(24 * time.Hour), 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &throttleState{failures: tt.failures, lastFailure: tt.lastFailure}
+			if got := s.retryAfter(now); got != tt.want {
+				t.Fatalf("retryAfter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestCore 在临时目录中创建并设置好主密码的 Core，返回它与恢复密钥
+func newTestCore(t *testing.T) (*Core, string) {
+	t.Helper()
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+
+	displayKey, err := c.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetupPassword("password", "", displayKey, ""); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+	return c, displayKey
+}
+
+func wrongDataKey(t *testing.T, c *Core) string {
+	t.Helper()
+	key, err := c.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// expireThrottle 把最近一次失败的时间调到足够早，下一次尝试不需要等待
+func expireThrottle(t *testing.T, c *Core) {
+	t.Helper()
+	state, err := c.loadThrottle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.saveThrottle(state.failures, time.Now().Add(-2*throttleMaxDelay)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnlockThrottle(t *testing.T) {
+	c, displayKey := newTestCore(t)
+	wrong := wrongDataKey(t, c)
+
+	for i := 0; i < throttleFreeFailures; i++ {
+		if ok, err := c.VerifyDataKey(wrong); ok || err != nil {
+			t.Fatalf("attempt %d: ok=%v err=%v", i+1, ok, err)
+		}
+	}
+
+	// 正确的恢复密钥也要等待
+	var throttled *ThrottledError
+	if _, err := c.VerifyDataKey(displayKey); !errors.As(err, &throttled) {
+		t.Fatalf("err = %v, want *ThrottledError", err)
+	}
+	if throttled.Failures != throttleFreeFailures || throttled.RetryAfter <= 0 || throttled.RetryAfter > throttleBaseDelay {
+		t.Fatalf("throttled = %+v", throttled)
+	}
+	if _, err := c.Unlock("password", ""); !errors.As(err, &throttled) {
+		t.Fatalf("Unlock err = %v, want *ThrottledError", err)
+	}
+
+	expireThrottle(t, c)
+	if ok, err := c.Unlock("password", ""); !ok || err != nil {
+		t.Fatalf("Unlock: ok=%v err=%v", ok, err)
+	}
+	status, err := c.UnlockThrottle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failures != 0 || status.RetryAfterSeconds != 0 {
+		t.Fatalf("status after unlock = %+v", status)
+	}
+}
+
+func TestUnlockThrottleTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, c *Core)
+	}{
+		{"reset counter", func(t *testing.T, c *Core) {
+			if err := c.db.SaveUnlockThrottle(&database.UnlockThrottle{}); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"install key removed", func(t *testing.T, c *Core) {
+			if err := os.Remove(c.installKeyPath()); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, displayKey := newTestCore(t)
+			if ok, err := c.VerifyDataKey(wrongDataKey(t, c)); ok || err != nil {
+				t.Fatalf("ok=%v err=%v", ok, err)
+			}
+			tt.tamper(t, c)
+
+			var throttled *ThrottledError
+			if _, err := c.VerifyDataKey(displayKey); !errors.As(err, &throttled) {
+				t.Fatalf("err = %v, want *ThrottledError", err)
+			}
+			if throttled.Failures != throttleTamperedFailures {
+				t.Fatalf("failures = %d, want %d", throttled.Failures, throttleTamperedFailures)
+			}
+		})
+	}
+}
+
+func TestWipeAfterFailures(t *testing.T) {
+	c, displayKey := newTestCore(t)
+	if ok, err := c.Unlock("password", ""); !ok || err != nil {
+		t.Fatalf("Unlock: ok=%v err=%v", ok, err)
+	}
+	if err := c.SetWipeAfterFailures(MinWipeAfterFailures - 1); err == nil {
+		t.Fatal("accepted a threshold below the minimum")
+	}
+	if err := c.SetWipeAfterFailures(MinWipeAfterFailures); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+
+	wrong := wrongDataKey(t, c)
+	for i := 1; i < MinWipeAfterFailures; i++ {
+		expireThrottle(t, c)
+		if _, err := c.VerifyDataKey(wrong); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+	if c.IsFirstRun() {
+		t.Fatal("data wiped before the threshold")
+	}
+
+	expireThrottle(t, c)
+	if _, err := c.VerifyDataKey(wrong); !errors.Is(err, ErrDataWiped) {
+		t.Fatalf("err = %v, want ErrDataWiped", err)
+	}
+	if !c.IsFirstRun() {
+		t.Fatal("data still present after wipe")
+	}
+	if ok, _ := c.VerifyDataKey(displayKey); ok {
+		t.Fatal("recovery key still works after wipe")
+	}
+}
+
+func TestUnlockReportsCorruptedDataKey(t *testing.T) {
+	c, _ := newTestCore(t)
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp.EncryptedDataKey[len(mp.EncryptedDataKey)-1] ^= 0x01
+	if err := c.db.SaveMasterPassword(mp.Salt, mp.Verifier, mp.Hint, mp.EncryptedDataKey, mp.KDFParams, mp.Keyfile); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := c.Unlock("password", ""); ok || !errors.Is(err, ErrDataKeyCorrupted) {
+		t.Fatalf("Unlock: ok=%v err=%v, want ErrDataKeyCorrupted", ok, err)
+	}
+	// 密码正确，不计入失败次数
+	status, err := c.UnlockThrottle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failures != 0 {
+		t.Fatalf("failures = %d, want 0", status.Failures)
+	}
+}
+
+func TestChangePasswordThrottle(t *testing.T) {
+	c, _ := newTestCore(t)
+	if err := c.ChangePassword("password", "new password", ""); err == nil {
+		t.Fatal("ChangePassword succeeded while locked")
+	}
+
+	if ok, err := c.Unlock("password", ""); !ok || err != nil {
+		t.Fatalf("Unlock: ok=%v err=%v", ok, err)
+	}
+	for i := 0; i < throttleFreeFailures; i++ {
+		err := c.ChangePassword("wrong", "new password", "")
+		var throttled *ThrottledError
+		if err == nil || errors.As(err, &throttled) {
+			t.Fatalf("attempt %d: err = %v", i+1, err)
+		}
+	}
+	var throttled *ThrottledError
+	if err := c.ChangePassword("password", "new password", ""); !errors.As(err, &throttled) {
+		t.Fatalf("err = %v, want *ThrottledError", err)
+	}
+
+	expireThrottle(t, c)
+	if err := c.ChangePassword("password", "new password", ""); err != nil {
+		t.Fatal(err)
+	}
+	status, err := c.UnlockThrottle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failures != 0 {
+		t.Fatalf("failures = %d after a correct password", status.Failures)
+	}
+
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); ok || err != nil {
+		t.Fatalf("old password: ok=%v err=%v", ok, err)
+	}
+	if ok, err := c.Unlock("new password", ""); !ok || err != nil {
+		t.Fatalf("new password: ok=%v err=%v", ok, err)
+	}
+}
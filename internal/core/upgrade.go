@@ -0,0 +1,66 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"fmt"
+	"locknote/internal/crypto"
+	"os"
+)
+
+// upgradeMasterPassword 在密码派生参数不是当前默认值、或校验值与包装的数据密钥仍是旧格式时，
+// 用当前参数重新派生密码密钥并重新包装，keyfile 为解锁时使用的密钥文件摘要。调用方需持有 c.mu。
+func (c *Core) upgradeMasterPassword(password string, keyfile, dataKey []byte) error {
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		return err
+	}
+	kdfParams, err := crypto.ParseKDFParams(mp.KDFParams)
+	if err != nil {
+		return err
+	}
+	if kdfParams == crypto.DefaultKDFParams && mp.KDFParams != "" &&
+		!c.cryptoService.NeedsUpgrade(mp.Verifier) && !c.cryptoService.NeedsUpgrade(mp.EncryptedDataKey) {
+		return nil
+	}
+
+	return c.saveMasterPassword(password, keyfile, mp.Hint, dataKey)
+}
+
+// upgradeData 把旧格式的笔记、历史版本、附件与校验文件重新加密为当前格式。
+// 每个对象单独原子替换，中断后下次解锁会继续。调用方需持有 c.mu，且各服务尚未设置密钥。
+func (c *Core) upgradeData(dataKey []byte) error {
+	if _, err := c.noteService.UpgradeFormat(dataKey); err != nil {
+		return fmt.Errorf("upgrade notes: %w", err)
+	}
+	if _, _, err := c.attachmentService.Rekey(dataKey, dataKey); err != nil {
+		return fmt.Errorf("upgrade attachments: %w", err)
+	}
+
+	if data, err := os.ReadFile(c.dataKeyVerifierFilePath()); err == nil && c.cryptoService.NeedsUpgrade(data) {
+		if ok, err := c.verifyDataKeyWithFile(dataKey); err == nil && ok {
+			if err := c.writeDataKeyVerifierFile(dataKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.db.SetDataVersion(dataFormatVersion)
+}
+
+// rekeyNames 把标签、笔记本与智能视图的名称等字段从 oldKey 重新加密为 newKey；
+// 两者相同时只加密明文的旧数据。名称加密之前的数据与旧版本同步来的明文记录都在解锁时加密，
+// 已加密的数据不会改写，因此每次解锁都调用。调用方需持有 c.mu
+func (c *Core) rekeyNames(oldKey, newKey []byte) error {
+	if _, err := c.tagService.Rekey(oldKey, newKey); err != nil {
+		return fmt.Errorf("tags: %w", err)
+	}
+	if _, err := c.notebookService.Rekey(oldKey, newKey); err != nil {
+		return fmt.Errorf("notebooks: %w", err)
+	}
+	if _, err := c.smartViewService.Rekey(oldKey, newKey); err != nil {
+		return fmt.Errorf("smart views: %w", err)
+	}
+	return nil
+}
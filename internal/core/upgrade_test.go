@@ -0,0 +1,73 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"bytes"
+	"locknote/internal/crypto"
+	"testing"
+)
+
+func TestUnlockUpgradesLegacyKDFParams(t *testing.T) {
+	c, displayKey := newTestCore(t)
+
+	// 用旧版固定参数重新包装数据密钥，kdf_params 为空，与旧版本写入的数据相同
+	dataKey, err := c.cryptoService.ParseDisplayKey(displayKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, err := c.cryptoService.GenerateSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordKey, err := c.cryptoService.DeriveKeyWithParams("password", salt, crypto.LegacyKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedDataKey, err := c.cryptoService.Encrypt(passwordKey, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := c.cryptoService.Encrypt(passwordKey, []byte("LOCKNOTE_VERIFY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.db.SaveMasterPassword(salt, verifier, "", encryptedDataKey, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock with legacy params = %v, %v", ok, err)
+	}
+	mp, err := c.db.GetMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp.KDFParams != crypto.DefaultKDFParams.String() {
+		t.Fatalf("kdf_params = %q, want %q", mp.KDFParams, crypto.DefaultKDFParams.String())
+	}
+	if bytes.Equal(mp.Salt, salt) || bytes.Equal(mp.EncryptedDataKey, encryptedDataKey) {
+		t.Fatal("data key was not rewrapped")
+	}
+	newKey, err := c.cryptoService.DeriveKeyWithParams("password", mp.Salt, crypto.DefaultKDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := c.cryptoService.Decrypt(newKey, mp.EncryptedDataKey)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("new wrap does not hold the data key: %v", err)
+	}
+
+	c.Lock()
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock after upgrade = %v, %v", ok, err)
+	}
+	again, err := c.db.GetMasterPassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.EncryptedDataKey, mp.EncryptedDataKey) {
+		t.Fatal("data key was rewrapped again on the second unlock")
+	}
+}
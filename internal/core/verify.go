@@ -0,0 +1,619 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"locknote/internal/database"
+	"locknote/internal/notes"
+	locksync "locknote/internal/sync"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 数据目录的完整性检查。Verify 只读取不修改；Repair 按选项修复，
+// 无法修复的文件移到 quarantine/<时间>/ 下，移除的数据库记录写入其中的 manifest.json，不会直接删除。
+const (
+	quarantineDirName  = "quarantine"
+	quarantineManifest = "manifest.json"
+
+	// 比这更新的 .tmp 文件可能正在写入，不视为残留
+	tempFileGrace = time.Minute
+)
+
+// 需要检查的密文目录
+var cipherDirs = []string{"notes", "history", "attachments"}
+
+// 问题种类
+const (
+	IssueTempFile        = "temp_file"        // 写入中断留下的 .tmp 文件
+	IssueOrphanFile      = "orphan_file"      // 没有数据库记录引用的密文文件
+	IssueMissingFile     = "missing_file"     // 记录指向的密文文件不存在
+	IssueDanglingRow     = "dangling_row"     // 记录引用了不存在的笔记、标签或笔记本
+	IssueUndecryptable   = "undecryptable"    // 无法用当前数据密钥解密
+	IssueLegacyFormat    = "legacy_format"    // 仍是旧的加密格式
+	IssueCacheMismatch   = "cache_mismatch"   // 标题、预览缓存或附件校验值与内容不一致
+	IssueVerifier        = "verifier"         // data_key_verifier 缺失或与数据密钥不符
+	IssueRotationPending = "rotation_pending" // 有未完成的数据密钥更换
+)
+
+// 笔记与历史版本在数据格式升级后仍是没有绑定附加数据的旧格式时的说明
+const legacyDetail = "ciphertext is not bound to this note (legacy format after upgrade)"
+
+// 问题涉及的对象
+const (
+	ObjectNote       = "note"
+	ObjectHistory    = "history"
+	ObjectAttachment = "attachment"
+	ObjectNoteTag    = "note_tag"
+	ObjectFile       = "file"
+	ObjectVerifier   = "verifier"
+	ObjectJournal    = "journal"
+)
+
+// Repair 对每个问题采取的处理
+const (
+	ActionRepaired    = "repaired"
+	ActionQuarantined = "quarantined"
+	ActionSkipped     = "skipped" // 未选择处理，或处理失败（原因见 Detail）
+)
+
+// VerifyIssue 是检查发现的一个问题
+type VerifyIssue struct {
+	Kind   string `json:"kind"`
+	Object string `json:"object"`
+	ID     string `json:"id,omitempty"`
+	NoteID string `json:"noteId,omitempty"`
+	Path   string `json:"path,omitempty"` // 相对数据目录
+	Detail string `json:"detail,omitempty"`
+	Action string `json:"action,omitempty"` // 仅 Repair 返回
+
+	note       *database.NoteMeta
+	history    *database.NoteHistory
+	attachment *database.Attachment
+	noteTag    *database.NoteTag
+}
+
+// VerifyReport 是完整性检查的结果
+type VerifyReport struct {
+	Notes         int            `json:"notes"`
+	History       int            `json:"history"`
+	Attachments   int            `json:"attachments"`
+	Files         int            `json:"files"`
+	Issues        []*VerifyIssue `json:"issues"`
+	QuarantineDir string         `json:"quarantineDir,omitempty"` // Repair 隔离了内容时的目录
+}
+
+// RepairOptions 选择 Repair 要处理的问题
+type RepairOptions struct {
+	TempFiles     bool `json:"tempFiles"`     // 隔离残留的 .tmp 文件
+	OrphanFiles   bool `json:"orphanFiles"`   // 隔离没有记录引用的密文文件
+	DanglingRows  bool `json:"danglingRows"`  // 处理指向不存在的文件或对象的记录
+	Undecryptable bool `json:"undecryptable"` // 隔离无法解密的笔记、历史版本与附件
+	Rebuild       bool `json:"rebuild"`       // 重新生成缓存、校验值与校验文件，并升级旧格式
+}
+
+func (r *VerifyReport) add(issue *VerifyIssue) {
+	r.Issues = append(r.Issues, issue)
+}
+
+// Verify 检查 notes/、history/、attachments/ 目录、数据库记录与校验文件，返回发现的问题
+func (c *Core) Verify() (*VerifyReport, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+	return c.verify()
+}
+
+func (c *Core) verify() (*VerifyReport, error) {
+	report := &VerifyReport{Issues: []*VerifyIssue{}}
+
+	if c.hasRotationJournal() {
+		report.add(&VerifyIssue{Kind: IssueRotationPending, Object: ObjectJournal, Path: rotationJournalFile,
+			Detail: "数据密钥更换尚未完成，部分数据可能仍使用旧密钥"})
+	}
+
+	if ok, err := c.verifyDataKeyWithFile(c.dataKey); err != nil || !ok {
+		detail := "does not match the data key"
+		if err != nil {
+			detail = err.Error()
+		}
+		report.add(&VerifyIssue{Kind: IssueVerifier, Object: ObjectVerifier, Path: "data_key_verifier", Detail: detail})
+	} else if data, err := os.ReadFile(c.dataKeyVerifierFilePath()); err == nil && c.cryptoService.NeedsUpgrade(data) {
+		report.add(&VerifyIssue{Kind: IssueLegacyFormat, Object: ObjectVerifier, Path: "data_key_verifier"})
+	}
+
+	referenced := make(map[string]bool)
+
+	noteIDs, err := c.verifyNotes(report, referenced)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifyHistory(report, referenced, noteIDs); err != nil {
+		return nil, err
+	}
+	if err := c.verifyAttachments(report, referenced, noteIDs); err != nil {
+		return nil, err
+	}
+
+	noteTags, err := c.db.ListDanglingNoteTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, nt := range noteTags {
+		report.add(&VerifyIssue{Kind: IssueDanglingRow, Object: ObjectNoteTag, ID: nt.TagID, NoteID: nt.NoteID,
+			Detail: "note or tag does not exist", noteTag: nt})
+	}
+
+	if err := c.verifyFiles(report, referenced); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *Core) verifyNotes(report *VerifyReport, referenced map[string]bool) (map[string]bool, error) {
+	metas, err := c.db.ListNotes(true)
+	if err != nil {
+		return nil, err
+	}
+	notebooks, err := c.db.ListNotebooks()
+	if err != nil {
+		return nil, err
+	}
+	notebookIDs := make(map[string]bool, len(notebooks))
+	for _, nb := range notebooks {
+		notebookIDs[nb.ID] = true
+	}
+
+	noteIDs := make(map[string]bool, len(metas))
+	for _, meta := range metas {
+		report.Notes++
+		noteIDs[meta.ID] = true
+		referenced[cleanPath(meta.CipherPath)] = true
+
+		issue := func(kind, detail string) {
+			report.add(&VerifyIssue{Kind: kind, Object: ObjectNote, ID: meta.ID, NoteID: meta.ID,
+				Path: meta.CipherPath, Detail: detail, note: meta})
+		}
+
+		check, err := c.noteService.CheckNote(meta)
+		if err != nil {
+			return nil, err
+		}
+		switch check.Content {
+		case notes.StateMissing:
+			issue(IssueMissingFile, "")
+		case notes.StateUndecryptable:
+			issue(IssueUndecryptable, "")
+		case notes.StateLegacy:
+			// 解锁时已经完成格式升级，之后出现的旧格式可能是被替换进来的
+			issue(IssueUndecryptable, legacyDetail)
+		}
+		if check.CacheMismatch {
+			issue(IssueCacheMismatch, "title or preview cache does not match the content")
+		}
+		if meta.NotebookID != nil && !notebookIDs[*meta.NotebookID] {
+			issue(IssueDanglingRow, fmt.Sprintf("notebook %s does not exist", *meta.NotebookID))
+		}
+	}
+	return noteIDs, nil
+}
+
+func (c *Core) verifyHistory(report *VerifyReport, referenced, noteIDs map[string]bool) error {
+	history, err := c.db.ListAllNoteHistory()
+	if err != nil {
+		return err
+	}
+	for _, h := range history {
+		report.History++
+		referenced[cleanPath(h.CipherPath)] = true
+
+		issue := func(kind, detail string) {
+			report.add(&VerifyIssue{Kind: kind, Object: ObjectHistory, ID: h.ID, NoteID: h.NoteID,
+				Path: h.CipherPath, Detail: detail, history: h})
+		}
+
+		if !noteIDs[h.NoteID] {
+			issue(IssueDanglingRow, "note does not exist")
+			continue
+		}
+		state, err := c.noteService.CheckHistory(h)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case notes.StateMissing:
+			issue(IssueMissingFile, "")
+		case notes.StateUndecryptable:
+			issue(IssueUndecryptable, "")
+		case notes.StateLegacy:
+			// 解锁时已经完成格式升级，之后出现的旧格式可能是被替换进来的
+			issue(IssueUndecryptable, legacyDetail)
+		}
+	}
+	return nil
+}
+
+func (c *Core) verifyAttachments(report *VerifyReport, referenced, noteIDs map[string]bool) error {
+	attachments, err := c.db.ListAllAttachments()
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		report.Attachments++
+		referenced[cleanPath(a.CipherPath)] = true
+
+		issue := func(kind, detail string) {
+			report.add(&VerifyIssue{Kind: kind, Object: ObjectAttachment, ID: a.ID, NoteID: a.NoteID,
+				Path: a.CipherPath, Detail: detail, attachment: a})
+		}
+
+		if !noteIDs[a.NoteID] {
+			issue(IssueDanglingRow, "note does not exist")
+			continue
+		}
+		check, err := c.attachmentService.Check(a)
+		if err != nil {
+			return err
+		}
+		switch {
+		case check.Missing:
+			issue(IssueMissingFile, "")
+		case check.Undecryptable:
+			issue(IssueUndecryptable, "")
+		default:
+			if check.Legacy {
+				issue(IssueLegacyFormat, "")
+			}
+			if check.Checksum != a.SHA256 {
+				issue(IssueCacheMismatch, "checksum does not match the content")
+			}
+		}
+	}
+	return nil
+}
+
+// verifyFiles 查找没有记录引用的密文文件与残留的 .tmp 文件
+func (c *Core) verifyFiles(report *VerifyReport, referenced map[string]bool) error {
+	isStaleTemp := func(name string, info fs.FileInfo) bool {
+		return strings.HasSuffix(name, ".tmp") && time.Since(info.ModTime()) > tempFileGrace
+	}
+
+	for _, dir := range cipherDirs {
+		err := filepath.WalkDir(filepath.Join(c.dataDir, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(c.dataDir, path)
+			if err != nil {
+				return err
+			}
+
+			report.Files++
+			switch {
+			case strings.HasSuffix(d.Name(), ".tmp"):
+				if isStaleTemp(d.Name(), info) {
+					report.add(&VerifyIssue{Kind: IssueTempFile, Object: ObjectFile, Path: rel})
+				}
+			case !referenced[cleanPath(rel)]:
+				report.add(&VerifyIssue{Kind: IssueOrphanFile, Object: ObjectFile, Path: rel})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 数据目录根下的临时文件，例如 data_key_verifier、rotation_journal 写入中断时留下的
+	entries, err := os.ReadDir(c.dataDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if isStaleTemp(entry.Name(), info) {
+			report.add(&VerifyIssue{Kind: IssueTempFile, Object: ObjectFile, Path: entry.Name()})
+		}
+	}
+	return nil
+}
+
+func cleanPath(path string) string {
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// ============ 修复 ============
+
+// quarantine 收集 Repair 隔离的文件与移除的记录，首次使用时才创建目录
+type quarantine struct {
+	dataDir string
+	dir     string
+	used    bool
+
+	CreatedAt   string                  `json:"createdAt"`
+	Issues      []*VerifyIssue          `json:"issues"`
+	Notes       []*database.NoteMeta    `json:"notes,omitempty"`
+	History     []*database.NoteHistory `json:"history,omitempty"`
+	Attachments []*database.Attachment  `json:"attachments,omitempty"`
+	NoteTags    []*database.NoteTag     `json:"noteTags,omitempty"`
+}
+
+func newQuarantine(dataDir string) *quarantine {
+	now := time.Now()
+	return &quarantine{
+		dataDir:   dataDir,
+		dir:       filepath.Join(dataDir, quarantineDirName, now.Format("20060102-150405")),
+		CreatedAt: now.Format(time.RFC3339),
+	}
+}
+
+// moveFile 把数据目录下的 rel 移入隔离目录，保留相对路径；文件不存在时忽略
+func (q *quarantine) moveFile(rel string) error {
+	src := filepath.Join(q.dataDir, rel)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	dst := filepath.Join(q.dir, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	q.used = true
+	return os.Rename(src, dst)
+}
+
+func (q *quarantine) save() error {
+	if !q.used && len(q.Issues) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return err
+	}
+	q.used = true
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(q.dir, quarantineManifest), data, 0600)
+}
+
+// Repair 重新检查数据目录并按 opts 处理发现的问题，返回带有处理结果的报告。
+// 有未完成的数据密钥更换时拒绝修复，因为此时部分数据仍使用旧密钥，会被误判为无法解密。
+func (c *Core) Repair(opts RepairOptions) (*VerifyReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isUnlocked {
+		return nil, errors.New("not unlocked")
+	}
+	if c.hasRotationJournal() {
+		return nil, errors.New("数据密钥更换尚未完成，请重新解锁完成更换后再修复")
+	}
+
+	report, err := c.verify()
+	if err != nil {
+		return nil, err
+	}
+
+	// 旧格式的附件统一重新加密，之后再处理缓存，因为重建缓存只接受当前格式
+	if opts.Rebuild && hasIssue(report, IssueLegacyFormat) {
+		if _, _, err := c.attachmentService.Rekey(c.dataKey, c.dataKey); err != nil {
+			return nil, err
+		}
+	}
+
+	// 先处理单个历史版本与附件，再处理笔记，隔离笔记时会连同剩余的历史版本与附件一起移走
+	q := newQuarantine(c.dataDir)
+	for _, notesPass := range []bool{false, true} {
+		for _, issue := range report.Issues {
+			if (issue.Object == ObjectNote) != notesPass {
+				continue
+			}
+			action, err := c.repairIssue(issue, opts, q)
+			if err != nil {
+				issue.Action = ActionSkipped
+				issue.Detail = err.Error()
+				continue
+			}
+			issue.Action = action
+			if action == ActionQuarantined {
+				q.Issues = append(q.Issues, issue)
+			}
+		}
+	}
+
+	if err := q.save(); err != nil {
+		return report, err
+	}
+	if q.used {
+		report.QuarantineDir = q.dir
+	}
+	return report, nil
+}
+
+func hasIssue(report *VerifyReport, kind string) bool {
+	for _, issue := range report.Issues {
+		if issue.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Core) repairIssue(issue *VerifyIssue, opts RepairOptions, q *quarantine) (string, error) {
+	switch issue.Kind {
+	case IssueTempFile:
+		if opts.TempFiles {
+			return ActionQuarantined, q.moveFile(issue.Path)
+		}
+
+	case IssueOrphanFile:
+		if opts.OrphanFiles {
+			return ActionQuarantined, q.moveFile(issue.Path)
+		}
+
+	case IssueLegacyFormat:
+		if !opts.Rebuild {
+			break
+		}
+		if issue.Object == ObjectVerifier {
+			return ActionRepaired, c.writeDataKeyVerifierFile(c.dataKey)
+		}
+		// 附件已在 Repair 开始时统一升级
+		return ActionRepaired, nil
+
+	case IssueCacheMismatch:
+		if !opts.Rebuild {
+			break
+		}
+		switch issue.Object {
+		case ObjectNote:
+			return ActionRepaired, c.noteService.RefreshCache(issue.note)
+		case ObjectAttachment:
+			// 重新读取记录，文件名可能刚被升级过
+			a, err := c.db.GetAttachment(issue.attachment.ID)
+			if err != nil {
+				return "", err
+			}
+			check, err := c.attachmentService.Check(a)
+			if err != nil {
+				return "", err
+			}
+			if check.Missing || check.Undecryptable {
+				return "", errors.New("attachment can no longer be read")
+			}
+			return ActionRepaired, c.db.UpdateAttachmentEncryption(a.ID, a.EncryptedFilename, check.Checksum)
+		}
+
+	case IssueVerifier:
+		if opts.Rebuild {
+			return ActionRepaired, c.writeDataKeyVerifierFile(c.dataKey)
+		}
+
+	case IssueMissingFile:
+		if opts.DanglingRows {
+			return c.repairObject(issue, q)
+		}
+
+	case IssueUndecryptable:
+		if opts.Undecryptable {
+			return c.repairObject(issue, q)
+		}
+
+	case IssueDanglingRow:
+		if !opts.DanglingRows {
+			break
+		}
+		switch issue.Object {
+		case ObjectNote:
+			// 笔记所在的笔记本已不存在：移回未分类
+			return ActionRepaired, c.db.SetNoteNotebook(issue.note.ID, nil)
+		case ObjectNoteTag:
+			q.NoteTags = append(q.NoteTags, issue.noteTag)
+			return ActionQuarantined, c.db.RemoveNoteTag(issue.noteTag.NoteID, issue.noteTag.TagID)
+		default:
+			return c.repairObject(issue, q)
+		}
+	}
+	return ActionSkipped, nil
+}
+
+// repairObject 处理文件丢失或无法解密的对象：笔记先尝试用历史版本恢复正文，
+// 其余情况把文件移入隔离目录、记录写入清单后从数据库移除
+func (c *Core) repairObject(issue *VerifyIssue, q *quarantine) (string, error) {
+	switch issue.Object {
+	case ObjectNote:
+		recovered, err := c.noteService.RecoverFromHistory(issue.note)
+		if err != nil {
+			return "", err
+		}
+		if recovered {
+			return ActionRepaired, nil
+		}
+		return ActionQuarantined, c.quarantineNote(issue.note, q)
+
+	case ObjectHistory:
+		if err := q.moveFile(issue.history.CipherPath); err != nil {
+			return "", err
+		}
+		q.History = append(q.History, issue.history)
+		return ActionQuarantined, c.db.DeleteSingleHistory(issue.history.ID)
+
+	case ObjectAttachment:
+		if err := q.moveFile(issue.attachment.CipherPath); err != nil {
+			return "", err
+		}
+		q.Attachments = append(q.Attachments, issue.attachment)
+		return ActionQuarantined, c.db.DeleteAttachment(issue.attachment.ID)
+	}
+	return ActionSkipped, nil
+}
+
+// quarantineNote 隔离无法恢复的笔记及其历史版本与附件。
+// 同时清除它的同步状态，下次同步时会从其他设备重新拉取，而不是把删除推送出去。
+func (c *Core) quarantineNote(meta *database.NoteMeta, q *quarantine) error {
+	history, err := c.db.GetNoteHistory(meta.ID)
+	if err != nil {
+		return err
+	}
+	attachments, err := c.db.ListAttachments(meta.ID)
+	if err != nil {
+		return err
+	}
+	tags, err := c.db.GetNoteTags(meta.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := q.moveFile(meta.CipherPath); err != nil {
+		return err
+	}
+	for _, h := range history {
+		if err := q.moveFile(h.CipherPath); err != nil {
+			return err
+		}
+	}
+	for _, a := range attachments {
+		if err := q.moveFile(a.CipherPath); err != nil {
+			return err
+		}
+	}
+
+	q.Notes = append(q.Notes, meta)
+	q.History = append(q.History, history...)
+	q.Attachments = append(q.Attachments, attachments...)
+	for _, t := range tags {
+		q.NoteTags = append(q.NoteTags, &database.NoteTag{NoteID: meta.ID, TagID: t.ID})
+	}
+
+	// 历史版本、附件、标签关联与索引随外键级联删除
+	if err := c.db.DeleteNotePermanently(meta.ID); err != nil {
+		return err
+	}
+	return c.syncService.Forget(locksync.KindNote, meta.ID)
+}
@@ -0,0 +1,183 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corruptFile 翻转数据目录下 rel 文件的最后一个字节
+func corruptFile(t *testing.T, c *Core, rel string) {
+	t.Helper()
+	path := filepath.Join(c.dataDir, rel)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func issueKey(issue *VerifyIssue) string {
+	return issue.Kind + "/" + issue.Object + "/" + issue.ID
+}
+
+func TestVerifyAndRepairCorruptedObjects(t *testing.T) {
+	c, _ := newTestCore(t)
+	if ok, err := c.Unlock("password", ""); err != nil || !ok {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+
+	// recovered 的正文损坏但有历史版本；lost 的正文损坏且没有历史版本；
+	// history 的历史版本损坏；attached 的附件损坏
+	recovered, err := c.Notes().Create("recovered", "第一版")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Notes().Update(recovered.ID, "recovered", "第二版"); err != nil {
+		t.Fatal(err)
+	}
+	lost, err := c.Notes().Create("lost", "正文")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := c.Notes().Create("history", "第一版")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Notes().Update(history.ID, "history", "第二版"); err != nil {
+		t.Fatal(err)
+	}
+	attached, err := c.Notes().Create("attached", "正文")
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := c.Attachments().Add(attached.ID, "a.txt", "text/plain", strings.NewReader("附件内容"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Fatalf("clean data reported issues: %+v", report.Issues[0])
+	}
+
+	for _, id := range []string{recovered.ID, lost.ID} {
+		meta, err := c.db.GetNote(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corruptFile(t, c, meta.CipherPath)
+	}
+	versions, err := c.db.GetNoteHistory(history.ID)
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("history = %v, %v", versions, err)
+	}
+	corruptFile(t, c, versions[0].CipherPath)
+	attMeta, err := c.db.GetAttachment(att.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptFile(t, c, attMeta.CipherPath)
+
+	report, err = c.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		IssueUndecryptable + "/" + ObjectNote + "/" + recovered.ID:      true,
+		IssueUndecryptable + "/" + ObjectNote + "/" + lost.ID:           true,
+		IssueUndecryptable + "/" + ObjectHistory + "/" + versions[0].ID: true,
+		IssueUndecryptable + "/" + ObjectAttachment + "/" + att.ID:      true,
+	}
+	if report.Notes != 4 || report.History != 2 || report.Attachments != 1 {
+		t.Fatalf("counts = %d notes, %d history, %d attachments", report.Notes, report.History, report.Attachments)
+	}
+	if len(report.Issues) != len(want) {
+		t.Fatalf("got %d issues, want %d", len(report.Issues), len(want))
+	}
+	for _, issue := range report.Issues {
+		if !want[issueKey(issue)] {
+			t.Fatalf("unexpected issue %s", issueKey(issue))
+		}
+	}
+
+	// 不选择处理时只报告
+	report, err = c.Repair(RepairOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range report.Issues {
+		if issue.Action != ActionSkipped {
+			t.Fatalf("%s: action = %s without options", issueKey(issue), issue.Action)
+		}
+	}
+
+	report, err = c.Repair(RepairOptions{Undecryptable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantActions := map[string]string{
+		recovered.ID:   ActionRepaired,
+		lost.ID:        ActionQuarantined,
+		versions[0].ID: ActionQuarantined,
+		att.ID:         ActionQuarantined,
+	}
+	for _, issue := range report.Issues {
+		if issue.Action != wantActions[issue.ID] {
+			t.Fatalf("%s: action = %s (%s), want %s", issueKey(issue), issue.Action, issue.Detail, wantActions[issue.ID])
+		}
+	}
+	if report.QuarantineDir == "" {
+		t.Fatal("no quarantine directory")
+	}
+	for _, rel := range []string{versions[0].CipherPath, attMeta.CipherPath, quarantineManifest} {
+		if _, err := os.Stat(filepath.Join(report.QuarantineDir, rel)); err != nil {
+			t.Fatalf("quarantine: %v", err)
+		}
+	}
+
+	if note, err := c.Notes().Get(recovered.ID); err != nil || note.Content != "第一版" {
+		t.Fatalf("recovered note = %+v, %v", note, err)
+	}
+	if _, err := c.db.GetNote(lost.ID); err == nil {
+		t.Fatal("lost note is still in the database")
+	}
+	if versions, err := c.db.GetNoteHistory(history.ID); err != nil || len(versions) != 0 {
+		t.Fatalf("history after repair = %v, %v", versions, err)
+	}
+	if note, err := c.Notes().Get(history.ID); err != nil || note.Content != "第二版" {
+		t.Fatalf("note with corrupted history = %+v, %v", note, err)
+	}
+	if _, err := c.db.GetAttachment(att.ID); err == nil {
+		t.Fatal("corrupted attachment is still in the database")
+	}
+	if _, err := c.Notes().Get(attached.ID); err != nil {
+		t.Fatalf("note with corrupted attachment: %v", err)
+	}
+
+	report, err = c.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range report.Issues {
+		if issue.Kind != IssueCacheMismatch || issue.ID != recovered.ID {
+			t.Fatalf("issue after repair: %s", issueKey(issue))
+		}
+	}
+	if _, err := c.Repair(RepairOptions{Rebuild: true}); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = c.Verify(); err != nil || len(report.Issues) != 0 {
+		t.Fatalf("issues after rebuild: %v, %v", report.Issues, err)
+	}
+}
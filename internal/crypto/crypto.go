@@ -4,15 +4,12 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"errors"
 	"io"
 	"unicode/utf8"
-
-	"golang.org/x/crypto/argon2"
 )
 
 type Service struct{}
@@ -27,8 +24,10 @@ func (s *Service) GenerateSalt() ([]byte, error) {
 	return salt, err
 }
 
+// DeriveKey 使用旧版固定参数派生密钥，新代码应使用 DeriveKeyWithParams
 func (s *Service) DeriveKey(password string, salt []byte) []byte {
-	return argon2.IDKey([]byte(password), salt, 3, 64*1024, 4, 32)
+	key, _ := s.DeriveKeyWithParams(password, salt, LegacyKDFParams)
+	return key
 }
 
 func (s *Service) GenerateDataKey() (string, error) {
@@ -59,33 +58,56 @@ func (s *Service) ParseDisplayKey(displayKey string) ([]byte, error) {
 	return s.DeriveDataKey(displayKey), nil
 }
 
-func (s *Service) Encrypt(key, plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
+// DeriveSubKey 从主密钥派生一个用途专属的子密钥，避免同一密钥在不同场景下复用
+func (s *Service) DeriveSubKey(key []byte, purpose string) []byte {
+	return s.HMAC(key, []byte(purpose))
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
+// HMAC 计算 HMAC-SHA256
+func (s *Service) HMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+// GenerateKey 生成一个随机的 32 字节密钥
+func (s *Service) GenerateKey() ([]byte, error) {
+	return s.randomBytes(32)
+}
+
+func (s *Service) randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
 		return nil, err
 	}
+	return b, nil
+}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+// Encrypt 用 AES-256-GCM 加密，输出当前版本的信封格式
+func (s *Service) Encrypt(key, plaintext []byte) ([]byte, error) {
+	return s.sealEnvelope(key, plaintext, nil)
 }
 
+// Decrypt 解密信封格式或旧版（v0）的 nonce|ciphertext
 func (s *Service) Decrypt(key, ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
+	plaintext, ok, err := s.openEnvelope(key, ciphertext, nil)
+	if ok && err == nil {
+		return plaintext, nil
+	}
+
+	// 不是信封，或者恰好以 magic 开头的旧数据
+	legacy, legacyErr := s.decryptV0(key, ciphertext)
+	if legacyErr == nil {
+		return legacy, nil
+	}
+	if ok {
 		return nil, err
 	}
+	return nil, legacyErr
+}
 
-	gcm, err := cipher.NewGCM(block)
+func (s *Service) decryptV0(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := s.gcm(key)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +119,7 @@ func (s *Service) Decrypt(key, ciphertext []byte) ([]byte, error) {
 	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return nil, errors.New("decryption failed: invalid password or corrupted data")
+		return nil, ErrWrongKey
 	}
 
 	return plaintext, nil
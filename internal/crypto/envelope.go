@@ -0,0 +1,202 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// 加密数据的信封格式：
+//
+//	v0（旧版）: nonce | ciphertext
+//	v1:         magic "LNE" | version 1 | alg | keyID [4]byte | nonce | ciphertext
+//
+// v1 的头部与调用方提供的附加数据（aad，例如笔记 ID 与字段）一起参与 AES-GCM 认证，
+// 因此密文不能被挪到别的对象上解密。keyID 由密钥派生，用来在解密前快速判断是否用错了密钥。
+// 附件的流式格式有独立的头部（"LNS1"）。
+const (
+	envelopeMagic     = "LNE"
+	EnvelopeVersion   = 1
+	envelopeHeaderLen = len(envelopeMagic) + 1 + 1 + envelopeKeyIDLen
+	envelopeKeyIDLen  = 4
+	keyIDPurpose      = "locknote-key-id-v1"
+
+	AlgAES256GCM byte = 1
+)
+
+var ErrWrongKey = errors.New("decryption failed: invalid password or corrupted data")
+
+// KeyID 返回密钥的短标识，用于信封头部
+func (s *Service) KeyID(key []byte) []byte {
+	return s.HMAC(key, []byte(keyIDPurpose))[:envelopeKeyIDLen]
+}
+
+func (s *Service) gcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptWithAAD 加密并绑定附加数据 aad，解密时必须提供相同的 aad
+func (s *Service) EncryptWithAAD(key, plaintext, aad []byte) ([]byte, error) {
+	return s.sealEnvelope(key, plaintext, aad)
+}
+
+// DecryptWithAAD 解密用 EncryptWithAAD 加密的数据。aad 非空时只接受信封格式，
+// 不会退回到没有绑定附加数据的旧格式。
+func (s *Service) DecryptWithAAD(key, ciphertext, aad []byte) ([]byte, error) {
+	if len(aad) == 0 {
+		return s.Decrypt(key, ciphertext)
+	}
+	plaintext, ok, err := s.openEnvelope(key, ciphertext, aad)
+	if !ok {
+		return nil, ErrWrongKey
+	}
+	return plaintext, err
+}
+
+func envelopeAAD(header, aad []byte) []byte {
+	if len(aad) == 0 {
+		return header
+	}
+	return append(append(make([]byte, 0, len(header)+len(aad)), header...), aad...)
+}
+
+func (s *Service) sealEnvelope(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := s.gcm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, envelopeHeaderLen+gcm.NonceSize())
+	header = append(header, envelopeMagic...)
+	header = append(header, EnvelopeVersion, AlgAES256GCM)
+	header = append(header, s.KeyID(key)...)
+
+	nonce, err := s.randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, envelopeAAD(out[:envelopeHeaderLen], aad)), nil
+}
+
+// openEnvelope 解密 v1 信封；ok 为 false 表示 data 不是 v1 信封
+func (s *Service) openEnvelope(key, data, aad []byte) (plaintext []byte, ok bool, err error) {
+	if !isEnvelope(data) {
+		return nil, false, nil
+	}
+	if data[len(envelopeMagic)+1] != AlgAES256GCM {
+		return nil, true, fmt.Errorf("unsupported encryption algorithm %d", data[len(envelopeMagic)+1])
+	}
+	if !hmac.Equal(data[len(envelopeMagic)+2:envelopeHeaderLen], s.KeyID(key)) {
+		return nil, true, ErrWrongKey
+	}
+
+	gcm, err := s.gcm(key)
+	if err != nil {
+		return nil, true, err
+	}
+	body := data[envelopeHeaderLen:]
+	if len(body) < gcm.NonceSize() {
+		return nil, true, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := body[:gcm.NonceSize()], body[gcm.NonceSize():]
+	plaintext, err = gcm.Open(nil, nonce, ciphertext, envelopeAAD(data[:envelopeHeaderLen], aad))
+	if err != nil {
+		return nil, true, ErrWrongKey
+	}
+	return plaintext, true, nil
+}
+
+func isEnvelope(data []byte) bool {
+	return len(data) >= envelopeHeaderLen &&
+		bytes.Equal(data[:len(envelopeMagic)], []byte(envelopeMagic)) &&
+		data[len(envelopeMagic)] == EnvelopeVersion
+}
+
+// NeedsUpgrade 判断 data 是否不是当前版本的信封，需要重新加密
+func (s *Service) NeedsUpgrade(data []byte) bool {
+	return !isEnvelope(data)
+}
+
+// ============ 密码派生参数 ============
+
+// KDFParams 是由密码派生密钥的参数，保存在 master_password 中以便日后调整
+type KDFParams struct {
+	Algorithm string `json:"alg"`
+	Time      uint32 `json:"t"`
+	MemoryKiB uint32 `json:"m"`
+	Threads   uint8  `json:"p"`
+}
+
+const KDFArgon2id = "argon2id"
+
+// LegacyKDFParams 是未保存参数的旧数据所使用的参数
+var LegacyKDFParams = KDFParams{Algorithm: KDFArgon2id, Time: 3, MemoryKiB: 64 * 1024, Threads: 4}
+
+// DefaultKDFParams 是新设置或升级后的密码使用的参数，强于 LegacyKDFParams，旧数据在解锁时升级
+var DefaultKDFParams = KDFParams{Algorithm: KDFArgon2id, Time: 4, MemoryKiB: 128 * 1024, Threads: 4}
+
+// 参数可能来自备份文件头、同步过来的笔记本等不可信的来源，超出上限时拒绝，
+// 避免在校验数据之前就耗尽内存或长时间计算
+const (
+	maxKDFTime      = 10
+	maxKDFMemoryKiB = 1 << 20 // 1 GiB
+	maxKDFThreads   = 16
+)
+
+// ParseKDFParams 解析保存的参数并检查取值范围，空字符串表示旧数据
+func ParseKDFParams(s string) (KDFParams, error) {
+	if s == "" {
+		return LegacyKDFParams, nil
+	}
+	var p KDFParams
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return KDFParams{}, err
+	}
+	if err := p.validate(); err != nil {
+		return KDFParams{}, err
+	}
+	return p, nil
+}
+
+// validate 检查参数是否为支持的算法且在合理范围内
+func (p KDFParams) validate() error {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		if p.Time == 0 || p.MemoryKiB == 0 || p.Threads == 0 {
+			return errors.New("invalid argon2id parameters")
+		}
+		if p.Time > maxKDFTime || p.MemoryKiB > maxKDFMemoryKiB || p.Threads > maxKDFThreads {
+			return errors.New("argon2id parameters exceed the allowed limits")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key derivation algorithm %q", p.Algorithm)
+	}
+}
+
+func (p KDFParams) String() string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+// DeriveKeyWithParams 按 p 由密码派生 32 字节密钥
+func (s *Service) DeriveKeyWithParams(password string, salt []byte, p KDFParams) ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return argon2.IDKey([]byte(password), salt, p.Time, p.MemoryKiB, p.Threads, 32), nil
+}
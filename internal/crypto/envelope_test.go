@@ -0,0 +1,221 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// sealV0 生成信封格式之前的 nonce|ciphertext
+func sealV0(t *testing.T, s *Service, key, plaintext []byte) []byte {
+	t.Helper()
+	gcm, err := s.gcm(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil)
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	s := NewService()
+	key := testKey(t)
+
+	for _, plaintext := range [][]byte{nil, []byte("x"), bytes.Repeat([]byte("locknote"), 4096)} {
+		data, err := s.Encrypt(key, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.NeedsUpgrade(data) {
+			t.Fatal("new ciphertext reported as needing upgrade")
+		}
+		got, err := s.Decrypt(key, data)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("got %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestDecryptLegacyV0(t *testing.T) {
+	s := NewService()
+	key := testKey(t)
+
+	data := sealV0(t, s, key, []byte("old note"))
+	if !s.NeedsUpgrade(data) {
+		t.Fatal("v0 ciphertext not reported as needing upgrade")
+	}
+	got, err := s.Decrypt(key, data)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(got) != "old note" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestEnvelopeRejectsWrongKeyAndTampering(t *testing.T) {
+	s := NewService()
+	key := testKey(t)
+	data, err := s.Encrypt(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(i int) []byte {
+		out := bytes.Clone(data)
+		out[i] ^= 0x01
+		return out
+	}
+	tests := []struct {
+		name string
+		key  []byte
+		data []byte
+	}{
+		{"wrong key", testKey(t), data},
+		{"key id", key, flip(envelopeHeaderLen - 1)},
+		{"nonce", key, flip(envelopeHeaderLen)},
+		{"ciphertext", key, flip(len(data) - 20)},
+		{"tag", key, flip(len(data) - 1)},
+		{"truncated", key, data[:len(data)-1]},
+		{"header only", key, data[:envelopeHeaderLen]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Decrypt(tt.key, tt.data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	t.Run("algorithm", func(t *testing.T) {
+		out := flip(len(envelopeMagic) + 1)
+		if _, err := s.Decrypt(key, out); err == nil || errors.Is(err, ErrWrongKey) {
+			t.Fatalf("expected unsupported algorithm, got %v", err)
+		}
+	})
+}
+
+func TestParseKDFParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    KDFParams
+		wantErr bool
+	}{
+		{name: "legacy", input: "", want: LegacyKDFParams},
+		{name: "default", input: DefaultKDFParams.String(), want: DefaultKDFParams},
+		{name: "at limits", input: `{"alg":"argon2id","t":10,"m":1048576,"p":16}`,
+			want: KDFParams{Algorithm: KDFArgon2id, Time: 10, MemoryKiB: 1 << 20, Threads: 16}},
+		{name: "time too high", input: `{"alg":"argon2id","t":11,"m":65536,"p":4}`, wantErr: true},
+		{name: "memory too high", input: `{"alg":"argon2id","t":3,"m":1048577,"p":4}`, wantErr: true},
+		{name: "threads too high", input: `{"alg":"argon2id","t":3,"m":65536,"p":17}`, wantErr: true},
+		{name: "zero time", input: `{"alg":"argon2id","t":0,"m":65536,"p":4}`, wantErr: true},
+		{name: "zero memory", input: `{"alg":"argon2id","t":3,"m":0,"p":4}`, wantErr: true},
+		{name: "zero threads", input: `{"alg":"argon2id","t":3,"m":65536,"p":0}`, wantErr: true},
+		{name: "unknown algorithm", input: `{"alg":"scrypt","t":3,"m":65536,"p":4}`, wantErr: true},
+		{name: "threads overflow", input: `{"alg":"argon2id","t":3,"m":65536,"p":256}`, wantErr: true},
+		{name: "not json", input: "argon2id", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKDFParams(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultKDFParamsStrongerThanLegacy(t *testing.T) {
+	d, l := DefaultKDFParams, LegacyKDFParams
+	if d == l || d.Time < l.Time || d.MemoryKiB < l.MemoryKiB {
+		t.Fatalf("default params %+v are not stronger than legacy %+v", d, l)
+	}
+	if err := d.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeriveKeyWithParamsRejectsOutOfRange(t *testing.T) {
+	s := NewService()
+	p := DefaultKDFParams
+	p.MemoryKiB = maxKDFMemoryKiB + 1
+	if _, err := s.DeriveKeyWithParams("password", make([]byte, 16), p); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDecryptWithAAD(t *testing.T) {
+	s := NewService()
+	key := testKey(t)
+	aad := []byte("locknote-note\x00content\x00note-1\x00")
+
+	bound, err := s.EncryptWithAAD(key, []byte("body"), aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unbound, err := s.Encrypt(key, []byte("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		aad  []byte
+		ok   bool
+	}{
+		{"bound", bound, aad, true},
+		{"other note", bound, []byte("locknote-note\x00content\x00note-2\x00"), false},
+		{"other field", bound, []byte("locknote-note\x00title\x00note-1\x00"), false},
+		{"bound without aad", bound, nil, false},
+		{"unbound envelope", unbound, aad, false},
+		{"unbound v0", sealV0(t, s, key, []byte("body")), aad, false},
+		{"unbound without aad", unbound, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DecryptWithAAD(key, tt.data, tt.aad)
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "body" {
+				t.Fatalf("got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// 密钥文件作为解锁的第二个因素：任意文件的 SHA-256 摘要经 HMAC 混入由密码派生的密钥，
+// 得到包装数据密钥的密钥。文件内容改变一个字节就会失效，因此应使用不会被修改的文件，
+// 或由 GenerateKeyfile 生成的随机文件。
+const (
+	// KeyfileSize 是生成的密钥文件的字节数
+	KeyfileSize = 64
+
+	keyfilePurpose = "locknote-keyfile-v1"
+)
+
+// HashKeyfile 计算密钥文件内容的摘要
+func (s *Service) HashKeyfile(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("密钥文件为空")
+	}
+	return h.Sum(nil), nil
+}
+
+// GenerateKeyfile 生成随机的密钥文件内容
+func (s *Service) GenerateKeyfile() ([]byte, error) {
+	return s.randomBytes(KeyfileSize)
+}
+
+// MixKeyfile 把密钥文件摘要混入由密码派生的密钥，digest 为 nil 时原样返回 passwordKey
+func (s *Service) MixKeyfile(passwordKey, digest []byte) []byte {
+	if digest == nil {
+		return passwordKey
+	}
+	return s.HMAC(passwordKey, append([]byte(keyfilePurpose), digest...))
+}
@@ -0,0 +1,209 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 分块流式加密格式（用于附件等大文件，无需整体读入内存）：
+//
+//	header: magic "LNS1" | chunkSize uint32 | salt [16]byte
+//	chunk:  AES-GCM(fileKey, nonce, plaintext[:chunkSize])
+//
+// fileKey = HMAC(key, salt)，每个文件独立；nonce 由块序号与“最后一块”标记组成，
+// 可以检测块的重排、删除与截断。
+const (
+	streamMagic       = "LNS1"
+	streamSaltSize    = 16
+	streamHeaderSize  = len(streamMagic) + 4 + streamSaltSize
+	DefaultChunkSize  = 64 * 1024
+	streamMaxChunk    = 16 * 1024 * 1024
+	streamLastFlagPos = 11
+)
+
+var ErrStreamCorrupted = errors.New("encrypted stream is corrupted or truncated")
+
+func streamNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[:8], counter)
+	if last {
+		nonce[streamLastFlagPos] = 1
+	}
+	return nonce
+}
+
+func (s *Service) streamAEAD(key, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.HMAC(key, salt))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type streamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	size    int
+	counter uint64
+	closed  bool
+}
+
+// NewEncryptWriter 返回一个流式加密 Writer，必须调用 Close 写出最后一块
+func (s *Service) NewEncryptWriter(key []byte, w io.Writer) (io.WriteCloser, error) {
+	salt := make([]byte, streamSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := s.streamAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, streamHeaderSize)
+	header = append(header, streamMagic...)
+	header = binary.BigEndian.AppendUint32(header, DefaultChunkSize)
+	header = append(header, salt...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &streamWriter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, DefaultChunkSize),
+		size: DefaultChunkSize,
+	}, nil
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.closed {
+		return 0, errors.New("write to closed stream")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区满且还有后续数据时，才能确定当前块不是最后一块
+		if len(sw.buf) == sw.size {
+			if err := sw.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(sw.buf[len(sw.buf):sw.size], p)
+		sw.buf = sw.buf[:len(sw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (sw *streamWriter) flush(last bool) error {
+	sealed := sw.aead.Seal(nil, streamNonce(sw.counter, last), sw.buf, nil)
+	if _, err := sw.w.Write(sealed); err != nil {
+		return err
+	}
+	sw.counter++
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+func (sw *streamWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	return sw.flush(true)
+}
+
+type streamReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// NewDecryptReader 返回一个流式解密 Reader，数据被篡改或截断时返回 ErrStreamCorrupted
+func (s *Service) NewDecryptReader(key []byte, r io.Reader) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrStreamCorrupted
+	}
+	if !bytes.Equal(header[:len(streamMagic)], []byte(streamMagic)) {
+		return nil, errors.New("not an encrypted stream")
+	}
+
+	chunkSize := binary.BigEndian.Uint32(header[len(streamMagic):])
+	if chunkSize == 0 || chunkSize > streamMaxChunk {
+		return nil, ErrStreamCorrupted
+	}
+
+	aead, err := s.streamAEAD(key, header[len(streamMagic)+4:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamReader{
+		r:     r,
+		aead:  aead,
+		chunk: make([]byte, int(chunkSize)+aead.Overhead()),
+	}, nil
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	for len(sr.plain) == 0 {
+		if sr.done {
+			return 0, io.EOF
+		}
+		if err := sr.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	return n, nil
+}
+
+func (sr *streamReader) next() error {
+	n, err := io.ReadFull(sr.r, sr.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		// 在最后一块之前遇到 EOF 说明被截断
+		return ErrStreamCorrupted
+	}
+
+	// 不满一整块的必然是最后一块；满块时先按普通块尝试，失败再按最后一块尝试
+	sealed := sr.chunk[:n]
+	if n == len(sr.chunk) {
+		if plain, openErr := sr.aead.Open(nil, streamNonce(sr.counter, false), sealed, nil); openErr == nil {
+			sr.plain = plain
+			sr.counter++
+			return nil
+		}
+	}
+
+	plain, openErr := sr.aead.Open(nil, streamNonce(sr.counter, true), sealed, nil)
+	if openErr != nil {
+		return ErrStreamCorrupted
+	}
+	sr.plain = plain
+	sr.counter++
+	sr.done = true
+
+	// 最后一块之后不应再有数据
+	var extra [1]byte
+	if m, _ := sr.r.Read(extra[:]); m > 0 {
+		return ErrStreamCorrupted
+	}
+	return nil
+}
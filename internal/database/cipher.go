@@ -0,0 +1,392 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 整库加密（可选）：数据库文件以 SQLCipher 格式按页加密，时间、数量、标签关联等元数据也不再以明文落盘。
+// 解锁前需要的主密码信息与设置保存在同目录的明文小库 UnlockStoreFile 中；
+// 数据库本身要等到解锁、拿到由数据密钥派生的密钥后才能打开，此前的查询返回 ErrLocked。
+// SQLCipher 驱动需要 cgo，只有以 -tags sqlcipher 构建时才包含，其他构建中无法开启或打开加密的数据库。
+
+// UnlockStoreFile 是整库加密时保存主密码信息与设置的明文小库，与数据库在同一目录
+const UnlockStoreFile = "locknote-unlock.db"
+
+var (
+	// ErrLocked 表示加密的数据库尚未用密钥打开
+	ErrLocked = errors.New("数据库已加密，尚未解锁")
+	// ErrWrongKey 表示密钥无法打开加密的数据库
+	ErrWrongKey = errors.New("数据库密钥不正确")
+	// ErrCipherUnavailable 表示当前构建不包含 SQLCipher 驱动
+	ErrCipherUnavailable = errors.New("此版本不支持数据库整体加密（需要以 -tags sqlcipher 构建）")
+)
+
+// sqliteHeader 是明文 SQLite 数据库文件的开头，加密的数据库文件开头是随机的盐
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// timeLayout 是数据库中时间的写入格式，与 SQLCipher 驱动写入 time.Time 的格式相同，
+// 明文数据库以 _time_format=sqlite 打开后也使用这一格式
+const timeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// dateTimeColumns 是需要在转换时统一格式的时间列。
+// 旧版本的明文数据库中的时间以 time.Time.String() 格式写入，SQLCipher 驱动无法解析会读成零值
+var dateTimeColumns = []struct{ table, column string }{
+	{"notes", "created_at"},
+	{"notes", "updated_at"},
+	{"notes", "deleted_at"},
+	{"note_history", "created_at"},
+	{"notebooks", "created_at"},
+	{"notebooks", "updated_at"},
+	{"attachments", "created_at"},
+}
+
+// CipherAvailable 返回当前构建是否支持数据库整体加密
+func CipherAvailable() bool {
+	return cipherDriver != nil
+}
+
+// UnlockStorePath 返回 dbPath 对应的解锁前明文小库的路径
+func UnlockStorePath(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), UnlockStoreFile)
+}
+
+// isPlainDatabase 判断 path 是否为明文 SQLite 数据库；文件不存在或为空时视为明文（新建）
+func isPlainDatabase(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	n, err := io.ReadFull(f, header)
+	if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(header, sqliteHeader), nil
+}
+
+// cipherDSN 返回以 key 打开 path 的连接串，key 为空时按明文打开
+func cipherDSN(path string, key []byte) string {
+	if len(key) == 0 {
+		return path + "?_foreign_keys=on"
+	}
+	return path + "?_foreign_keys=on&_pragma_key=" + url.QueryEscape("x'"+strings.ToUpper(hex.EncodeToString(key))+"'")
+}
+
+// cipherConnector 在设置密钥之后才建立连接，使 *sql.DB 可以在解锁前创建、解锁后直接使用
+type cipherConnector struct {
+	path string
+	mu   sync.Mutex
+	key  []byte
+}
+
+func (c *cipherConnector) setKey(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.key = key
+}
+
+// whileLocked 在没有密钥时运行 fn 并返回 true，期间持有锁，Unlock 之后的连接要等 fn 完成才能建立。
+// 锁定后不再有新的写入，fn 可以直接读取数据库文件；已有密钥时不运行 fn
+func (c *cipherConnector) whileLocked(fn func() error) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key != nil {
+		return false, nil
+	}
+	return true, fn()
+}
+
+func (c *cipherConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if cipherDriver == nil {
+		return nil, ErrCipherUnavailable
+	}
+	c.mu.Lock()
+	key := c.key
+	c.mu.Unlock()
+	if key == nil {
+		return nil, ErrLocked
+	}
+	return cipherDriver.Open(cipherDSN(c.path, key))
+}
+
+func (c *cipherConnector) Driver() driver.Driver {
+	return cipherDriver
+}
+
+// checkCipherKey 用 key 打开 path 处的加密数据库并读取一次，密钥不正确时返回 ErrWrongKey
+func checkCipherKey(path string, key []byte) error {
+	db := sql.OpenDB(&cipherConnector{path: path, key: key})
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master`).Scan(&count); err != nil {
+		if errors.Is(err, ErrCipherUnavailable) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrWrongKey, err)
+	}
+	return nil
+}
+
+// openEncrypted 打开整库加密的数据：只有解锁前的明文小库立即可用，数据库等待 Unlock
+func openEncrypted(dbPath string) (*DB, error) {
+	meta, err := openPlain(UnlockStorePath(dbPath))
+	if err != nil {
+		return nil, err
+	}
+
+	connector := &cipherConnector{path: dbPath}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	d := &DB{db: db, meta: meta, path: dbPath, cipher: connector}
+	if err := d.migrateUnlockStore(); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Encrypted 返回数据库是否整体加密
+func (d *DB) Encrypted() bool {
+	return d.cipher != nil
+}
+
+// Path 返回数据库文件的路径
+func (d *DB) Path() string {
+	return d.path
+}
+
+// Unlock 用 key 打开整体加密的数据库并完成结构升级；未加密时不做任何事
+func (d *DB) Unlock(key []byte) error {
+	if d.cipher == nil {
+		return nil
+	}
+	if err := checkCipherKey(d.path, key); err != nil {
+		return err
+	}
+	d.cipher.setKey(append([]byte(nil), key...))
+	return d.migrate()
+}
+
+// Lock 忘记整体加密数据库的密钥并关闭空闲的连接，此后的查询返回 ErrLocked；未加密时不做任何事
+func (d *DB) Lock() {
+	if d.cipher == nil {
+		return
+	}
+	d.cipher.setKey(nil)
+	d.db.SetMaxIdleConns(0)
+	d.db.SetMaxIdleConns(1)
+}
+
+// Rekey 把整体加密的数据库改为用 key 加密，用于更换数据密钥
+func (d *DB) Rekey(key []byte) error {
+	if d.cipher == nil {
+		return nil
+	}
+	if _, err := d.db.Exec(fmt.Sprintf(`PRAGMA rekey = "x'%s'"`, strings.ToUpper(hex.EncodeToString(key)))); err != nil {
+		return err
+	}
+	d.cipher.setKey(append([]byte(nil), key...))
+	return nil
+}
+
+// ExportPlainToEncrypted 把 dbPath 处的明文数据库转换为以 key 整体加密的数据库，调用前需关闭该数据库。
+// 全部数据先导出到加密的临时文件，主密码信息与设置另存到解锁前的明文小库，再依次替换到位：
+// 中断时如果数据库仍是明文，下次打开会丢弃多出的小库，数据保持原样
+func ExportPlainToEncrypted(dbPath string, key []byte) error {
+	if cipherDriver == nil {
+		return ErrCipherUnavailable
+	}
+	plain, err := isPlainDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	if !plain {
+		return errors.New("数据库已经整体加密")
+	}
+
+	encPath := dbPath + ".enc.tmp"
+	storePath := UnlockStorePath(dbPath) + ".tmp"
+	os.Remove(encPath)
+	os.Remove(storePath)
+	cleanup := func(err error) error {
+		os.Remove(encPath)
+		os.Remove(storePath)
+		return err
+	}
+
+	if err := exportEncryptedCopy(dbPath, encPath, key); err != nil {
+		return cleanup(fmt.Errorf("导出加密数据库失败: %w", err))
+	}
+	if err := checkCipherKey(encPath, key); err != nil {
+		return cleanup(err)
+	}
+	if err := exportUnlockStore(dbPath, storePath); err != nil {
+		return cleanup(fmt.Errorf("导出主密码信息失败: %w", err))
+	}
+
+	if err := os.Rename(storePath, UnlockStorePath(dbPath)); err != nil {
+		return cleanup(err)
+	}
+	if err := os.Rename(encPath, dbPath); err != nil {
+		os.Remove(UnlockStorePath(dbPath))
+		return cleanup(err)
+	}
+	return nil
+}
+
+// exportEncryptedCopy 用 sqlcipher_export 把明文数据库复制为 encPath 处的加密数据库，并统一时间格式。
+// 主密码信息与设置不留在加密的数据库中，以解锁前的小库为准
+func exportEncryptedCopy(dbPath, encPath string, key []byte) error {
+	src := sql.OpenDB(&cipherConnector{path: dbPath, key: []byte{}})
+	src.SetMaxOpenConns(1)
+	defer src.Close()
+
+	hexKey := strings.ToUpper(hex.EncodeToString(key))
+	if _, err := src.Exec(fmt.Sprintf(`ATTACH DATABASE '%s' AS encrypted KEY "x'%s'"`, strings.ReplaceAll(encPath, "'", "''"), hexKey)); err != nil {
+		return err
+	}
+	if _, err := src.Exec(`SELECT sqlcipher_export('encrypted')`); err != nil {
+		return err
+	}
+	if _, err := src.Exec(`DETACH DATABASE encrypted`); err != nil {
+		return err
+	}
+
+	dst := sql.OpenDB(&cipherConnector{path: encPath, key: key})
+	dst.SetMaxOpenConns(1)
+	defer dst.Close()
+	if _, err := dst.Exec(`DROP TABLE IF EXISTS master_password; DROP TABLE IF EXISTS settings`); err != nil {
+		return err
+	}
+	for _, col := range dateTimeColumns {
+		if err := normalizeTimes(dst, col.table, col.column); err != nil {
+			return fmt.Errorf("%s.%s: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+// normalizeTimes 把 table.column 中的时间改写为 timeLayout 格式
+func normalizeTimes(db *sql.DB, table, column string) error {
+	rows, err := db.Query(fmt.Sprintf(`SELECT rowid, CAST(%s AS TEXT) FROM %s WHERE %s IS NOT NULL`, column, table, column))
+	if err != nil {
+		return err
+	}
+	values := make(map[int64]string)
+	for rows.Next() {
+		var rowid int64
+		var value string
+		if err := rows.Scan(&rowid, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		t, err := parseSQLiteTime(value)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if formatted := t.Format(timeLayout); formatted != value {
+			values[rowid] = formatted
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for rowid, value := range values {
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, table, column), value, rowid); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// exportUnlockStore 在 storePath 创建解锁前的明文小库，并从明文数据库复制主密码信息与设置
+func exportUnlockStore(dbPath, storePath string) error {
+	store, err := openPlain(storePath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	d := &DB{db: store, meta: store}
+	if err := d.migrateUnlockStore(); err != nil {
+		return err
+	}
+
+	if _, err := store.Exec(`ATTACH DATABASE ? AS source`, dbPath); err != nil {
+		return err
+	}
+	defer store.Exec(`DETACH DATABASE source`)
+	if _, err := store.Exec(`
+		INSERT OR REPLACE INTO master_password (id, salt, verifier, hint, encrypted_data_key, kdf_params, data_version, keyfile)
+		SELECT id, salt, verifier, hint, encrypted_data_key, kdf_params, data_version, keyfile FROM source.master_password
+	`); err != nil {
+		return err
+	}
+	_, err = store.Exec(`
+		INSERT OR REPLACE INTO settings (id, auto_lock_minutes, lock_on_minimize, lock_on_sleep,
+			backup_interval_hours, backup_dir, backup_keep_daily, backup_keep_weekly, wipe_after_failures)
+		SELECT id, auto_lock_minutes, lock_on_minimize, lock_on_sleep,
+			backup_interval_hours, backup_dir, backup_keep_daily, backup_keep_weekly, wipe_after_failures FROM source.settings
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = store.Exec(`
+		INSERT OR REPLACE INTO unlock_throttle (id, failures, last_failure, mac)
+		SELECT id, failures, last_failure, mac FROM source.unlock_throttle
+	`)
+	return err
+}
+
+// copyFile 把 src 复制到 dst（dst 不能已存在）
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,12 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+//go:build !sqlcipher
+
+package database
+
+import "database/sql/driver"
+
+// cipherDriver 为 nil：此构建不包含 SQLCipher 驱动，无法开启或打开整库加密
+var cipherDriver driver.Driver
@@ -0,0 +1,16 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+//go:build sqlcipher
+
+package database
+
+import (
+	"database/sql/driver"
+
+	sqlcipher "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+// cipherDriver 是打开整库加密数据库使用的 SQLCipher 驱动
+var cipherDriver driver.Driver = &sqlcipher.SQLiteDriver{}
@@ -6,6 +6,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
@@ -62,6 +63,10 @@ func parseSQLiteTime(v any) (time.Time, error) {
 
 type DB struct {
 	db *sql.DB
+	// meta 保存主密码信息与设置；整库加密时是解锁前可读的明文小库，否则与 db 相同
+	meta   *sql.DB
+	path   string
+	cipher *cipherConnector
 }
 
 type MasterPassword struct {
@@ -69,6 +74,9 @@ type MasterPassword struct {
 	Verifier         []byte
 	Hint             string
 	EncryptedDataKey []byte
+	KDFParams        string // JSON，空表示旧版固定参数
+	DataVersion      int    // 数据的加密格式版本
+	Keyfile          bool   // 解锁时除密码外还需要密钥文件
 }
 
 type NoteMeta struct {
@@ -84,10 +92,14 @@ type NoteMeta struct {
 	EncryptedPreview []byte
 }
 
+// Tag 的名称加密保存在 EncryptedName 中，NameIndex 是名称的带密钥哈希，用于保证名称唯一与按名称查找。
+// Name 是加密之前的旧数据中的明文名称，加密后为空
 type Tag struct {
-	ID    string
-	Name  string
-	Color string
+	ID            string
+	Name          string
+	Color         string
+	EncryptedName []byte
+	NameIndex     []byte
 }
 
 type NoteTag struct {
@@ -99,6 +111,22 @@ type Settings struct {
 	AutoLockMinutes int
 	LockOnMinimize  bool
 	LockOnSleep     bool
+
+	// 定时备份：间隔为 0 或目录为空时关闭
+	BackupIntervalHours int
+	BackupDir           string
+	BackupKeepDaily     int
+	BackupKeepWeekly    int
+
+	// 连续失败达到该次数时清除全部数据，0 表示关闭
+	WipeAfterFailures int
+}
+
+// UnlockThrottle 记录解锁与恢复密钥验证的连续失败，MAC 用于发现记录被改动
+type UnlockThrottle struct {
+	Failures    int
+	LastFailure time.Time
+	MAC         []byte
 }
 
 type NoteHistory struct {
@@ -108,26 +136,129 @@ type NoteHistory struct {
 	CreatedAt  time.Time
 }
 
+type SearchPosting struct {
+	Token []byte
+	TF    int
+}
+
+type Attachment struct {
+	ID                string
+	NoteID            string
+	EncryptedFilename []byte
+	Mime              string
+	Size              int64
+	SHA256            string
+	CipherPath        string
+	CreatedAt         time.Time
+}
+
+// SyncEntity 记录一个同步对象最近一次同步时的版本向量与内容摘要
+type SyncEntity struct {
+	Kind    string
+	ID      string
+	Vector  string // JSON 编码的版本向量
+	Hash    []byte
+	Deleted bool
+}
+
+// NoteQuery 描述一组针对 notes 元数据的过滤条件，各条件之间为 AND 关系
+type NoteQuery struct {
+	IDs                []string // 非 nil 时仅在这些笔记中筛选
+	RequireTagIDs      []string
+	ExcludeTagIDs      []string
+	NotebookID         *string
+	WithoutNotebook    bool
+	ExcludeNotebookIDs []string
+	Pinned             *bool
+	CreatedAfter       *time.Time
+	CreatedBefore      *time.Time
+	UpdatedAfter       *time.Time
+	UpdatedBefore      *time.Time
+}
+
+// Notebook 的 Name 与 Icon 是加密之前的旧数据中的明文，加密后为空
 type Notebook struct {
-	ID        string
-	Name      string
-	Icon      string
-	SortOrder int
-	Pinned    bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID            string
+	Name          string
+	Icon          string
+	SortOrder     int
+	Pinned        bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EncryptedName []byte
+	EncryptedIcon []byte
+	// 受保护的笔记本有自己的密钥：EncryptedKey 是用密码派生的密钥加密的笔记本密钥，不受保护时为 nil
+	KeySalt      []byte
+	KeyParams    string
+	EncryptedKey []byte
 }
 
+// SmartView 的 Name、Icon 与 FilterJSON 是加密之前的旧数据中的明文，加密后为空
 type SmartView struct {
-	ID         string
-	Name       string
-	Icon       string
-	FilterJSON string
-	SortOrder  int
+	ID              string
+	Name            string
+	Icon            string
+	FilterJSON      string
+	SortOrder       int
+	EncryptedName   []byte
+	EncryptedIcon   []byte
+	EncryptedFilter []byte
 }
 
 func New(dbPath string) (*DB, error) {
-	dsn := fmt.Sprintf("%s?_foreign_keys=on", dbPath)
+	encrypted, err := isEncryptedLayout(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return openEncrypted(dbPath)
+	}
+
+	db, err := openPlain(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DB{db: db, meta: db, path: dbPath}
+	if err := d.migrateUnlockStore(); err != nil {
+		return nil, err
+	}
+	if err := d.migrate(); err != nil {
+		return nil, err
+	}
+	if err := d.migrateTimes(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// isEncryptedLayout 判断 dbPath 是否为整库加密的数据：解锁前的明文小库存在且数据库不是明文。
+// 小库存在而数据库仍是明文，说明转换在替换数据库之前中断，删除多出的小库，按明文打开
+func isEncryptedLayout(dbPath string) (bool, error) {
+	storePath := UnlockStorePath(dbPath)
+	if _, err := os.Stat(storePath); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	plain, err := isPlainDatabase(dbPath)
+	if err != nil {
+		return false, err
+	}
+	if plain {
+		if err := os.Remove(storePath); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// openPlain 打开 path 处的明文数据库
+func openPlain(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s?_foreign_keys=on&_time_format=sqlite", path)
 	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, err
@@ -141,20 +272,69 @@ func New(dbPath string) (*DB, error) {
 		_ = db.Close()
 		return nil, err
 	}
+	return db, nil
+}
 
-	d := &DB{db: db}
-	if err := d.migrate(); err != nil {
-		return nil, err
+func (d *DB) Close() error {
+	if d.meta != d.db {
+		d.meta.Close()
 	}
+	return d.db.Close()
+}
 
-	return d, nil
+// SnapshotTo 把数据库的一致快照写到 path（path 不能已存在）。
+// 整库加密时快照同样是加密的，解锁前的明文小库另外写到 path 所在目录的 UnlockStoreFile；
+// 锁定时无法打开加密的数据库，直接复制密文文件
+func (d *DB) SnapshotTo(path string) error {
+	copied := false
+	if d.cipher != nil {
+		var err error
+		if copied, err = d.cipher.whileLocked(func() error { return copyFile(d.path, path) }); err != nil {
+			return err
+		}
+	}
+	if !copied {
+		if _, err := d.db.Exec(`VACUUM INTO ?`, path); err != nil {
+			return err
+		}
+	}
+	if d.cipher != nil {
+		if _, err := d.meta.Exec(`VACUUM INTO ?`, UnlockStorePath(path)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (d *DB) Close() error {
-	return d.db.Close()
+// IntegrityCheck 运行 SQLite 的完整性检查，数据库文件损坏时返回错误
+func (d *DB) IntegrityCheck() error {
+	rows, err := d.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
 }
 
-func (d *DB) migrate() error {
+// migrateUnlockStore 创建主密码信息与设置表，解锁前就需要读取
+func (d *DB) migrateUnlockStore() error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS master_password (
 		id INTEGER PRIMARY KEY CHECK (id = 1),
@@ -164,6 +344,52 @@ func (d *DB) migrate() error {
 		encrypted_data_key BLOB NOT NULL
 	);
 
+	CREATE TABLE IF NOT EXISTS settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		auto_lock_minutes INTEGER DEFAULT 5,
+		lock_on_minimize INTEGER DEFAULT 0,
+		lock_on_sleep INTEGER DEFAULT 1
+	);
+
+	INSERT OR IGNORE INTO settings (id, auto_lock_minutes, lock_on_minimize, lock_on_sleep) VALUES (1, 5, 0, 1);
+
+	CREATE TABLE IF NOT EXISTS unlock_throttle (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure INTEGER NOT NULL DEFAULT 0,
+		mac BLOB
+	);
+	`
+	if _, err := d.meta.Exec(schema); err != nil {
+		return err
+	}
+
+	d.addMasterPasswordColumns()
+	d.addSettingsColumns()
+	return nil
+}
+
+// migrateTimes 把旧版本以 time.Time.String() 格式写入的时间改写为 timeLayout 格式，
+// 使 SQLite 的日期函数可以解析，按时间筛选时能换算为 UTC 比较
+func (d *DB) migrateTimes() error {
+	for _, col := range dateTimeColumns {
+		var legacy bool
+		query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE %s IS NOT NULL AND julianday(%s) IS NULL)`, col.table, col.column, col.column)
+		if err := d.db.QueryRow(query).Scan(&legacy); err != nil {
+			return err
+		}
+		if !legacy {
+			continue
+		}
+		if err := normalizeTimes(d.db, col.table, col.column); err != nil {
+			return fmt.Errorf("%s.%s: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+func (d *DB) migrate() error {
+	schema := `
 	CREATE TABLE IF NOT EXISTS notes (
 		id TEXT PRIMARY KEY,
 		cipher_path TEXT NOT NULL,
@@ -187,13 +413,6 @@ func (d *DB) migrate() error {
 		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
 	);
 
-	CREATE TABLE IF NOT EXISTS settings (
-		id INTEGER PRIMARY KEY CHECK (id = 1),
-		auto_lock_minutes INTEGER DEFAULT 5,
-		lock_on_minimize INTEGER DEFAULT 0,
-		lock_on_sleep INTEGER DEFAULT 1
-	);
-
 	CREATE TABLE IF NOT EXISTS note_history (
 		id TEXT PRIMARY KEY,
 		note_id TEXT NOT NULL,
@@ -208,8 +427,6 @@ func (d *DB) migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_note_history_note_id ON note_history(note_id);
 	CREATE INDEX IF NOT EXISTS idx_note_tags_note_id ON note_tags(note_id);
 	CREATE INDEX IF NOT EXISTS idx_note_tags_tag_id ON note_tags(tag_id);
-
-	INSERT OR IGNORE INTO settings (id, auto_lock_minutes, lock_on_minimize, lock_on_sleep) VALUES (1, 5, 0, 1);
 	`
 	_, err := d.db.Exec(schema)
 	if err != nil {
@@ -244,6 +461,75 @@ func (d *DB) migrate() error {
 	}
 
 	d.addNotebookIdColumn()
+	d.addEncryptedNameColumns()
+	d.addNotebookKeyColumns()
+
+	searchSchema := `
+	CREATE TABLE IF NOT EXISTS search_docs (
+		note_id TEXT PRIMARY KEY,
+		length INTEGER NOT NULL,
+		FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS search_postings (
+		token BLOB NOT NULL,
+		note_id TEXT NOT NULL,
+		tf INTEGER NOT NULL,
+		PRIMARY KEY (token, note_id),
+		FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS search_meta (
+		key TEXT PRIMARY KEY,
+		value BLOB
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_search_postings_note_id ON search_postings(note_id);
+	`
+	_, err = d.db.Exec(searchSchema)
+	if err != nil {
+		return err
+	}
+
+	attachmentSchema := `
+	CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		note_id TEXT NOT NULL,
+		encrypted_filename BLOB NOT NULL,
+		mime TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		cipher_path TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_attachments_note_id ON attachments(note_id);
+	`
+	_, err = d.db.Exec(attachmentSchema)
+	if err != nil {
+		return err
+	}
+
+	syncSchema := `
+	CREATE TABLE IF NOT EXISTS sync_entities (
+		kind TEXT NOT NULL,
+		id TEXT NOT NULL,
+		vector TEXT NOT NULL,
+		hash BLOB,
+		deleted INTEGER DEFAULT 0,
+		PRIMARY KEY (kind, id)
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	`
+	_, err = d.db.Exec(syncSchema)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -287,31 +573,102 @@ func (d *DB) addNotebookIdColumn() {
 	d.db.Exec(`CREATE INDEX IF NOT EXISTS idx_notes_list ON notes(deleted_at, pinned DESC, sort_order ASC, updated_at DESC)`)
 }
 
+func (d *DB) addMasterPasswordColumns() {
+	var count int
+	err := d.meta.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('master_password') WHERE name='kdf_params'`).Scan(&count)
+	if err != nil || count == 0 {
+		d.meta.Exec(`ALTER TABLE master_password ADD COLUMN kdf_params TEXT DEFAULT ''`)
+		d.meta.Exec(`ALTER TABLE master_password ADD COLUMN data_version INTEGER DEFAULT 0`)
+	}
+
+	err = d.meta.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('master_password') WHERE name='keyfile'`).Scan(&count)
+	if err != nil || count == 0 {
+		d.meta.Exec(`ALTER TABLE master_password ADD COLUMN keyfile INTEGER DEFAULT 0`)
+	}
+}
+
+func (d *DB) addSettingsColumns() {
+	var count int
+	err := d.meta.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('settings') WHERE name='backup_interval_hours'`).Scan(&count)
+	if err != nil || count == 0 {
+		d.meta.Exec(`ALTER TABLE settings ADD COLUMN backup_interval_hours INTEGER DEFAULT 0`)
+		d.meta.Exec(`ALTER TABLE settings ADD COLUMN backup_dir TEXT DEFAULT ''`)
+		d.meta.Exec(`ALTER TABLE settings ADD COLUMN backup_keep_daily INTEGER DEFAULT 7`)
+		d.meta.Exec(`ALTER TABLE settings ADD COLUMN backup_keep_weekly INTEGER DEFAULT 4`)
+	}
+	err = d.meta.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('settings') WHERE name='wipe_after_failures'`).Scan(&count)
+	if err == nil && count == 0 {
+		d.meta.Exec(`ALTER TABLE settings ADD COLUMN wipe_after_failures INTEGER DEFAULT 0`)
+	}
+}
+
+// addEncryptedNameColumns 添加标签、笔记本与智能视图的加密字段。
+// 原有的明文列保留（SQLite 无法直接删除带约束的列），加密后标签的 name 列写入 ID 以满足 UNIQUE，其他明文列为空
+func (d *DB) addEncryptedNameColumns() {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('tags') WHERE name='encrypted_name'`).Scan(&count)
+	if err != nil || count == 0 {
+		d.db.Exec(`ALTER TABLE tags ADD COLUMN encrypted_name BLOB`)
+		d.db.Exec(`ALTER TABLE tags ADD COLUMN name_index BLOB`)
+		d.db.Exec(`ALTER TABLE notebooks ADD COLUMN encrypted_name BLOB`)
+		d.db.Exec(`ALTER TABLE notebooks ADD COLUMN encrypted_icon BLOB`)
+		d.db.Exec(`ALTER TABLE smart_views ADD COLUMN encrypted_name BLOB`)
+		d.db.Exec(`ALTER TABLE smart_views ADD COLUMN encrypted_icon BLOB`)
+		d.db.Exec(`ALTER TABLE smart_views ADD COLUMN encrypted_filter BLOB`)
+	}
+	d.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name_index ON tags(name_index)`)
+}
+
+// addNotebookKeyColumns 添加受保护笔记本的密钥字段
+func (d *DB) addNotebookKeyColumns() {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('notebooks') WHERE name='encrypted_key'`).Scan(&count)
+	if err != nil || count == 0 {
+		d.db.Exec(`ALTER TABLE notebooks ADD COLUMN key_salt BLOB`)
+		d.db.Exec(`ALTER TABLE notebooks ADD COLUMN key_params TEXT DEFAULT ''`)
+		d.db.Exec(`ALTER TABLE notebooks ADD COLUMN encrypted_key BLOB`)
+	}
+}
+
 func (d *DB) HasMasterPassword() bool {
 	var count int
-	d.db.QueryRow("SELECT COUNT(*) FROM master_password").Scan(&count)
+	d.meta.QueryRow("SELECT COUNT(*) FROM master_password").Scan(&count)
 	return count > 0
 }
 
-func (d *DB) SaveMasterPassword(salt, verifier []byte, hint string, encryptedDataKey []byte) error {
-	_, err := d.db.Exec(`
-		INSERT OR REPLACE INTO master_password (id, salt, verifier, hint, encrypted_data_key)
-		VALUES (1, ?, ?, ?, ?)
-	`, salt, verifier, hint, encryptedDataKey)
+// SaveMasterPassword 保存密码相关字段，不改变 data_version。keyfile 表示包装密钥混入了密钥文件
+func (d *DB) SaveMasterPassword(salt, verifier []byte, hint string, encryptedDataKey []byte, kdfParams string, keyfile bool) error {
+	_, err := d.meta.Exec(`
+		INSERT INTO master_password (id, salt, verifier, hint, encrypted_data_key, kdf_params, keyfile)
+		VALUES (1, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			salt = excluded.salt,
+			verifier = excluded.verifier,
+			hint = excluded.hint,
+			encrypted_data_key = excluded.encrypted_data_key,
+			kdf_params = excluded.kdf_params,
+			keyfile = excluded.keyfile
+	`, salt, verifier, hint, encryptedDataKey, kdfParams, keyfile)
 	return err
 }
 
 func (d *DB) GetMasterPassword() (*MasterPassword, error) {
 	var mp MasterPassword
-	err := d.db.QueryRow(`
-		SELECT salt, verifier, hint, encrypted_data_key FROM master_password WHERE id = 1
-	`).Scan(&mp.Salt, &mp.Verifier, &mp.Hint, &mp.EncryptedDataKey)
+	err := d.meta.QueryRow(`
+		SELECT salt, verifier, hint, encrypted_data_key, COALESCE(kdf_params, ''), COALESCE(data_version, 0), COALESCE(keyfile, 0)
+		FROM master_password WHERE id = 1
+	`).Scan(&mp.Salt, &mp.Verifier, &mp.Hint, &mp.EncryptedDataKey, &mp.KDFParams, &mp.DataVersion, &mp.Keyfile)
 	if err != nil {
 		return nil, err
 	}
 	return &mp, nil
 }
 
+func (d *DB) SetDataVersion(version int) error {
+	_, err := d.meta.Exec(`UPDATE master_password SET data_version = ? WHERE id = 1`, version)
+	return err
+}
+
 func (d *DB) CreateNote(note *NoteMeta) error {
 	_, err := d.db.Exec(`
 		INSERT INTO notes (id, cipher_path, created_at, updated_at, pinned, notebook_id, encrypted_title, encrypted_preview)
@@ -474,23 +831,102 @@ func (d *DB) ReorderNotes(ids []string) error {
 	return tx.Commit()
 }
 
+const tagColumns = `id, name, color, encrypted_name, name_index`
+
+func scanTag(row interface{ Scan(...any) error }, tag *Tag) error {
+	if err := row.Scan(&tag.ID, &tag.Name, &tag.Color, &tag.EncryptedName, &tag.NameIndex); err != nil {
+		return err
+	}
+	tag.clearPlainName()
+	return nil
+}
+
+// clearPlainName 清除加密后 name 列中的占位值
+func (t *Tag) clearPlainName() {
+	if t.EncryptedName != nil {
+		t.Name = ""
+	}
+}
+
+// plainName 返回写入 tags.name 列的值：加密后写入 ID，满足列的 UNIQUE NOT NULL 约束
+func (t *Tag) plainName() string {
+	if t.EncryptedName != nil {
+		return t.ID
+	}
+	return t.Name
+}
+
 func (d *DB) CreateTag(tag *Tag) error {
-	_, err := d.db.Exec(`INSERT INTO tags (id, name, color) VALUES (?, ?, ?)`, tag.ID, tag.Name, tag.Color)
+	_, err := d.db.Exec(`INSERT INTO tags (id, name, color, encrypted_name, name_index) VALUES (?, ?, ?, ?, ?)`,
+		tag.ID, tag.plainName(), tag.Color, tag.EncryptedName, tag.NameIndex)
 	return err
 }
 
 func (d *DB) UpdateTag(tag *Tag) error {
-	_, err := d.db.Exec(`UPDATE tags SET name = ?, color = ? WHERE id = ?`, tag.Name, tag.Color, tag.ID)
+	_, err := d.db.Exec(`UPDATE tags SET name = ?, color = ?, encrypted_name = ?, name_index = ? WHERE id = ?`,
+		tag.plainName(), tag.Color, tag.EncryptedName, tag.NameIndex, tag.ID)
 	return err
 }
 
+func (d *DB) GetTag(id string) (*Tag, error) {
+	var tag Tag
+	if err := scanTag(d.db.QueryRow(`SELECT `+tagColumns+` FROM tags WHERE id = ?`, id), &tag); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// GetTagByNameIndex 按名称的带密钥哈希查找标签
+func (d *DB) GetTagByNameIndex(index []byte) (*Tag, error) {
+	var tag Tag
+	if err := scanTag(d.db.QueryRow(`SELECT `+tagColumns+` FROM tags WHERE name_index = ?`, index), &tag); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// ReplaceTag 用 tag 替换 oldID 对应的标签（两者名称相同），并把旧标签的笔记关联转移到新标签
+func (d *DB) ReplaceTag(oldID string, tag *Tag) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 先让出唯一的名称与名称索引
+	if _, err := tx.Exec(`UPDATE tags SET name = name || '#' || id, name_index = NULL WHERE id = ?`, oldID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE tags SET name = ?, color = ?, encrypted_name = ?, name_index = ? WHERE id = ?`,
+		tag.plainName(), tag.Color, tag.EncryptedName, tag.NameIndex, tag.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := tx.Exec(`INSERT INTO tags (id, name, color, encrypted_name, name_index) VALUES (?, ?, ?, ?, ?)`,
+			tag.ID, tag.plainName(), tag.Color, tag.EncryptedName, tag.NameIndex); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO note_tags (note_id, tag_id) SELECT note_id, ? FROM note_tags WHERE tag_id = ?`, tag.ID, oldID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM note_tags WHERE tag_id = ?`, oldID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tags WHERE id = ?`, oldID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (d *DB) DeleteTag(id string) error {
 	_, err := d.db.Exec(`DELETE FROM tags WHERE id = ?`, id)
 	return err
 }
 
 func (d *DB) ListTags() ([]*Tag, error) {
-	rows, err := d.db.Query(`SELECT id, name, color FROM tags ORDER BY name`)
+	rows, err := d.db.Query(`SELECT ` + tagColumns + ` FROM tags`)
 	if err != nil {
 		return nil, err
 	}
@@ -499,7 +935,7 @@ func (d *DB) ListTags() ([]*Tag, error) {
 	var tags []*Tag
 	for rows.Next() {
 		var tag Tag
-		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color); err != nil {
+		if err := scanTag(rows, &tag); err != nil {
 			return nil, err
 		}
 		tags = append(tags, &tag)
@@ -520,6 +956,47 @@ func (d *DB) RemoveNoteTag(noteID, tagID string) error {
 	return err
 }
 
+// ListDanglingNoteTags 返回引用了不存在的笔记或标签的关联（例如外键约束未生效时留下的）
+func (d *DB) ListDanglingNoteTags() ([]*NoteTag, error) {
+	rows, err := d.db.Query(`
+		SELECT note_id, tag_id FROM note_tags
+		WHERE note_id NOT IN (SELECT id FROM notes) OR tag_id NOT IN (SELECT id FROM tags)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var noteTags []*NoteTag
+	for rows.Next() {
+		var nt NoteTag
+		if err := rows.Scan(&nt.NoteID, &nt.TagID); err != nil {
+			return nil, err
+		}
+		noteTags = append(noteTags, &nt)
+	}
+	return noteTags, rows.Err()
+}
+
+// SetNoteTags 把笔记的标签替换为 tagIDs
+func (d *DB) SetNoteTags(noteID string, tagIDs []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM note_tags WHERE note_id = ?`, noteID); err != nil {
+		return err
+	}
+	for _, tagID := range tagIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO note_tags (note_id, tag_id) VALUES (?, ?)`, noteID, tagID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (d *DB) RemoveTagFromAllNotes(tagID string) error {
 	_, err := d.db.Exec(`DELETE FROM note_tags WHERE tag_id = ?`, tagID)
 	return err
@@ -545,10 +1022,9 @@ func (d *DB) DeleteTagWithAssociations(tagID string) error {
 
 func (d *DB) GetNoteTags(noteID string) ([]*Tag, error) {
 	rows, err := d.db.Query(`
-		SELECT t.id, t.name, t.color FROM tags t
+		SELECT t.id, t.name, t.color, t.encrypted_name, t.name_index FROM tags t
 		INNER JOIN note_tags nt ON t.id = nt.tag_id
 		WHERE nt.note_id = ?
-		ORDER BY t.name
 	`, noteID)
 	if err != nil {
 		return nil, err
@@ -558,7 +1034,7 @@ func (d *DB) GetNoteTags(noteID string) ([]*Tag, error) {
 	var tags []*Tag
 	for rows.Next() {
 		var tag Tag
-		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Color); err != nil {
+		if err := scanTag(rows, &tag); err != nil {
 			return nil, err
 		}
 		tags = append(tags, &tag)
@@ -582,10 +1058,9 @@ func (d *DB) GetNoteTagsBatch(noteIDs []string) (map[string][]*Tag, error) {
 	}
 
 	query := fmt.Sprintf(`
-		SELECT nt.note_id, t.id, t.name, t.color FROM tags t
+		SELECT nt.note_id, t.id, t.name, t.color, t.encrypted_name, t.name_index FROM tags t
 		INNER JOIN note_tags nt ON t.id = nt.tag_id
 		WHERE nt.note_id IN (%s)
-		ORDER BY t.name
 	`, strings.Join(placeholders, ","))
 
 	rows, err := d.db.Query(query, args...)
@@ -598,9 +1073,10 @@ func (d *DB) GetNoteTagsBatch(noteIDs []string) (map[string][]*Tag, error) {
 	for rows.Next() {
 		var noteID string
 		var tag Tag
-		if err := rows.Scan(&noteID, &tag.ID, &tag.Name, &tag.Color); err != nil {
+		if err := rows.Scan(&noteID, &tag.ID, &tag.Name, &tag.Color, &tag.EncryptedName, &tag.NameIndex); err != nil {
 			return nil, err
 		}
+		tag.clearPlainName()
 		result[noteID] = append(result[noteID], &tag)
 	}
 	if err := rows.Err(); err != nil {
@@ -638,9 +1114,14 @@ func (d *DB) GetNotesByTag(tagID string) ([]*NoteMeta, error) {
 
 func (d *DB) GetSettings() (*Settings, error) {
 	var s Settings
-	err := d.db.QueryRow(`
-		SELECT auto_lock_minutes, lock_on_minimize, lock_on_sleep FROM settings WHERE id = 1
-	`).Scan(&s.AutoLockMinutes, &s.LockOnMinimize, &s.LockOnSleep)
+	err := d.meta.QueryRow(`
+		SELECT auto_lock_minutes, lock_on_minimize, lock_on_sleep,
+			backup_interval_hours, backup_dir, backup_keep_daily, backup_keep_weekly,
+			COALESCE(wipe_after_failures, 0)
+		FROM settings WHERE id = 1
+	`).Scan(&s.AutoLockMinutes, &s.LockOnMinimize, &s.LockOnSleep,
+		&s.BackupIntervalHours, &s.BackupDir, &s.BackupKeepDaily, &s.BackupKeepWeekly,
+		&s.WipeAfterFailures)
 	if err != nil {
 		return nil, err
 	}
@@ -648,9 +1129,45 @@ func (d *DB) GetSettings() (*Settings, error) {
 }
 
 func (d *DB) UpdateSettings(s *Settings) error {
-	_, err := d.db.Exec(`
-		UPDATE settings SET auto_lock_minutes = ?, lock_on_minimize = ?, lock_on_sleep = ? WHERE id = 1
-	`, s.AutoLockMinutes, s.LockOnMinimize, s.LockOnSleep)
+	_, err := d.meta.Exec(`
+		UPDATE settings SET auto_lock_minutes = ?, lock_on_minimize = ?, lock_on_sleep = ?,
+			backup_interval_hours = ?, backup_dir = ?, backup_keep_daily = ?, backup_keep_weekly = ?,
+			wipe_after_failures = ?
+		WHERE id = 1
+	`, s.AutoLockMinutes, s.LockOnMinimize, s.LockOnSleep,
+		s.BackupIntervalHours, s.BackupDir, s.BackupKeepDaily, s.BackupKeepWeekly,
+		s.WipeAfterFailures)
+	return err
+}
+
+// GetUnlockThrottle 返回失败记录，没有记录时返回 nil
+func (d *DB) GetUnlockThrottle() (*UnlockThrottle, error) {
+	var t UnlockThrottle
+	var lastFailure int64
+	err := d.meta.QueryRow(`
+		SELECT failures, last_failure, mac FROM unlock_throttle WHERE id = 1
+	`).Scan(&t.Failures, &lastFailure, &t.MAC)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastFailure != 0 {
+		t.LastFailure = time.UnixMilli(lastFailure)
+	}
+	return &t, nil
+}
+
+// SaveUnlockThrottle 保存失败记录，LastFailure 以毫秒精度保存
+func (d *DB) SaveUnlockThrottle(t *UnlockThrottle) error {
+	var lastFailure int64
+	if !t.LastFailure.IsZero() {
+		lastFailure = t.LastFailure.UnixMilli()
+	}
+	_, err := d.meta.Exec(`
+		INSERT OR REPLACE INTO unlock_throttle (id, failures, last_failure, mac) VALUES (1, ?, ?, ?)
+	`, t.Failures, lastFailure, t.MAC)
 	return err
 }
 
@@ -687,6 +1204,25 @@ func (d *DB) GetNoteHistory(noteID string) ([]*NoteHistory, error) {
 	return history, nil
 }
 
+// ListAllNoteHistory 返回所有笔记的历史版本
+func (d *DB) ListAllNoteHistory() ([]*NoteHistory, error) {
+	rows, err := d.db.Query(`SELECT id, note_id, cipher_path, created_at FROM note_history`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*NoteHistory
+	for rows.Next() {
+		var h NoteHistory
+		if err := rows.Scan(&h.ID, &h.NoteID, &h.CipherPath, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, &h)
+	}
+	return history, rows.Err()
+}
+
 func (d *DB) DeleteNoteHistory(noteID string) error {
 	_, err := d.db.Exec(`DELETE FROM note_history WHERE note_id = ?`, noteID)
 	return err
@@ -698,8 +1234,9 @@ func (d *DB) DeleteSingleHistory(historyID string) error {
 }
 
 func (d *DB) CreateNotebook(notebook *Notebook) error {
-	_, err := d.db.Exec(`INSERT INTO notebooks (id, name, icon, sort_order, pinned, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		notebook.ID, notebook.Name, notebook.Icon, notebook.SortOrder, notebook.Pinned, notebook.CreatedAt, notebook.UpdatedAt)
+	_, err := d.db.Exec(`INSERT INTO notebooks (id, name, icon, sort_order, pinned, created_at, updated_at, encrypted_name, encrypted_icon, key_salt, key_params, encrypted_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		notebook.ID, notebook.Name, notebook.Icon, notebook.SortOrder, notebook.Pinned, notebook.CreatedAt, notebook.UpdatedAt, notebook.EncryptedName, notebook.EncryptedIcon,
+		notebook.KeySalt, notebook.KeyParams, notebook.EncryptedKey)
 	return err
 }
 
@@ -707,8 +1244,8 @@ func (d *DB) GetNotebook(id string) (*Notebook, error) {
 	var notebook Notebook
 	var createdAtAny any
 	var updatedAtAny any
-	err := d.db.QueryRow(`SELECT id, name, icon, sort_order, COALESCE(pinned, 0), COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(updated_at, CURRENT_TIMESTAMP) FROM notebooks WHERE id = ?`, id).
-		Scan(&notebook.ID, &notebook.Name, &notebook.Icon, &notebook.SortOrder, &notebook.Pinned, &createdAtAny, &updatedAtAny)
+	err := d.db.QueryRow(`SELECT id, name, icon, sort_order, COALESCE(pinned, 0), COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(updated_at, CURRENT_TIMESTAMP), encrypted_name, encrypted_icon, key_salt, COALESCE(key_params, ''), encrypted_key FROM notebooks WHERE id = ?`, id).
+		Scan(&notebook.ID, &notebook.Name, &notebook.Icon, &notebook.SortOrder, &notebook.Pinned, &createdAtAny, &updatedAtAny, &notebook.EncryptedName, &notebook.EncryptedIcon, &notebook.KeySalt, &notebook.KeyParams, &notebook.EncryptedKey)
 	if err != nil {
 		return nil, err
 	}
@@ -722,18 +1259,46 @@ func (d *DB) GetNotebook(id string) (*Notebook, error) {
 }
 
 func (d *DB) UpdateNotebook(notebook *Notebook) error {
-	_, err := d.db.Exec(`UPDATE notebooks SET name = ?, icon = ?, sort_order = ?, pinned = ?, updated_at = ? WHERE id = ?`,
-		notebook.Name, notebook.Icon, notebook.SortOrder, notebook.Pinned, notebook.UpdatedAt, notebook.ID)
+	_, err := d.db.Exec(`UPDATE notebooks SET name = ?, icon = ?, sort_order = ?, pinned = ?, updated_at = ?, encrypted_name = ?, encrypted_icon = ?,
+		key_salt = ?, key_params = ?, encrypted_key = ? WHERE id = ?`,
+		notebook.Name, notebook.Icon, notebook.SortOrder, notebook.Pinned, notebook.UpdatedAt, notebook.EncryptedName, notebook.EncryptedIcon,
+		notebook.KeySalt, notebook.KeyParams, notebook.EncryptedKey, notebook.ID)
+	return err
+}
+
+// SetNotebookKey 设置笔记本的密钥字段，encryptedKey 为 nil 时取消保护
+func (d *DB) SetNotebookKey(id string, salt []byte, params string, encryptedKey []byte) error {
+	_, err := d.db.Exec(`UPDATE notebooks SET key_salt = ?, key_params = ?, encrypted_key = ? WHERE id = ?`, salt, params, encryptedKey, id)
 	return err
 }
 
+// ListNotebookNotes 返回笔记本中的全部笔记，包括回收站中的
+func (d *DB) ListNotebookNotes(notebookID string) ([]*NoteMeta, error) {
+	rows, err := d.db.Query(`SELECT id, cipher_path, created_at, updated_at, pinned, deleted_at, notebook_id, COALESCE(sort_order, 0), encrypted_title, encrypted_preview
+		FROM notes WHERE notebook_id = ?`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []*NoteMeta
+	for rows.Next() {
+		var note NoteMeta
+		if err := rows.Scan(&note.ID, &note.CipherPath, &note.CreatedAt, &note.UpdatedAt, &note.Pinned, &note.DeletedAt, &note.NotebookID, &note.SortOrder, &note.EncryptedTitle, &note.EncryptedPreview); err != nil {
+			return nil, err
+		}
+		notes = append(notes, &note)
+	}
+	return notes, rows.Err()
+}
+
 func (d *DB) DeleteNotebook(id string) error {
 	_, err := d.db.Exec(`DELETE FROM notebooks WHERE id = ?`, id)
 	return err
 }
 
 func (d *DB) ListNotebooks() ([]*Notebook, error) {
-	rows, err := d.db.Query(`SELECT id, name, icon, sort_order, COALESCE(pinned, 0), COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(updated_at, CURRENT_TIMESTAMP) FROM notebooks ORDER BY pinned DESC, sort_order, name`)
+	rows, err := d.db.Query(`SELECT id, name, icon, sort_order, COALESCE(pinned, 0), COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(updated_at, CURRENT_TIMESTAMP), encrypted_name, encrypted_icon, key_salt, COALESCE(key_params, ''), encrypted_key FROM notebooks ORDER BY pinned DESC, sort_order, name`)
 	if err != nil {
 		return nil, err
 	}
@@ -744,7 +1309,7 @@ func (d *DB) ListNotebooks() ([]*Notebook, error) {
 		var n Notebook
 		var createdAtAny any
 		var updatedAtAny any
-		if err := rows.Scan(&n.ID, &n.Name, &n.Icon, &n.SortOrder, &n.Pinned, &createdAtAny, &updatedAtAny); err != nil {
+		if err := rows.Scan(&n.ID, &n.Name, &n.Icon, &n.SortOrder, &n.Pinned, &createdAtAny, &updatedAtAny, &n.EncryptedName, &n.EncryptedIcon, &n.KeySalt, &n.KeyParams, &n.EncryptedKey); err != nil {
 			return nil, err
 		}
 		if n.CreatedAt, err = parseSQLiteTime(createdAtAny); err != nil {
@@ -819,15 +1384,15 @@ func (d *DB) SetNotesNotebook(noteIDs []string, notebookID *string) error {
 }
 
 func (d *DB) CreateSmartView(sv *SmartView) error {
-	_, err := d.db.Exec(`INSERT INTO smart_views (id, name, icon, filter_json, sort_order) VALUES (?, ?, ?, ?, ?)`,
-		sv.ID, sv.Name, sv.Icon, sv.FilterJSON, sv.SortOrder)
+	_, err := d.db.Exec(`INSERT INTO smart_views (id, name, icon, filter_json, sort_order, encrypted_name, encrypted_icon, encrypted_filter) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sv.ID, sv.Name, sv.Icon, sv.FilterJSON, sv.SortOrder, sv.EncryptedName, sv.EncryptedIcon, sv.EncryptedFilter)
 	return err
 }
 
 func (d *DB) GetSmartView(id string) (*SmartView, error) {
 	var sv SmartView
-	err := d.db.QueryRow(`SELECT id, name, icon, filter_json, sort_order FROM smart_views WHERE id = ?`, id).
-		Scan(&sv.ID, &sv.Name, &sv.Icon, &sv.FilterJSON, &sv.SortOrder)
+	err := d.db.QueryRow(`SELECT id, name, icon, filter_json, sort_order, encrypted_name, encrypted_icon, encrypted_filter FROM smart_views WHERE id = ?`, id).
+		Scan(&sv.ID, &sv.Name, &sv.Icon, &sv.FilterJSON, &sv.SortOrder, &sv.EncryptedName, &sv.EncryptedIcon, &sv.EncryptedFilter)
 	if err != nil {
 		return nil, err
 	}
@@ -835,8 +1400,8 @@ func (d *DB) GetSmartView(id string) (*SmartView, error) {
 }
 
 func (d *DB) UpdateSmartView(sv *SmartView) error {
-	_, err := d.db.Exec(`UPDATE smart_views SET name = ?, icon = ?, filter_json = ?, sort_order = ? WHERE id = ?`,
-		sv.Name, sv.Icon, sv.FilterJSON, sv.SortOrder, sv.ID)
+	_, err := d.db.Exec(`UPDATE smart_views SET name = ?, icon = ?, filter_json = ?, sort_order = ?, encrypted_name = ?, encrypted_icon = ?, encrypted_filter = ? WHERE id = ?`,
+		sv.Name, sv.Icon, sv.FilterJSON, sv.SortOrder, sv.EncryptedName, sv.EncryptedIcon, sv.EncryptedFilter, sv.ID)
 	return err
 }
 
@@ -846,7 +1411,7 @@ func (d *DB) DeleteSmartView(id string) error {
 }
 
 func (d *DB) ListSmartViews() ([]*SmartView, error) {
-	rows, err := d.db.Query(`SELECT id, name, icon, filter_json, sort_order FROM smart_views ORDER BY sort_order, name`)
+	rows, err := d.db.Query(`SELECT id, name, icon, filter_json, sort_order, encrypted_name, encrypted_icon, encrypted_filter FROM smart_views ORDER BY sort_order, name`)
 	if err != nil {
 		return nil, err
 	}
@@ -855,7 +1420,7 @@ func (d *DB) ListSmartViews() ([]*SmartView, error) {
 	var views []*SmartView
 	for rows.Next() {
 		var sv SmartView
-		if err := rows.Scan(&sv.ID, &sv.Name, &sv.Icon, &sv.FilterJSON, &sv.SortOrder); err != nil {
+		if err := rows.Scan(&sv.ID, &sv.Name, &sv.Icon, &sv.FilterJSON, &sv.SortOrder, &sv.EncryptedName, &sv.EncryptedIcon, &sv.EncryptedFilter); err != nil {
 			return nil, err
 		}
 		views = append(views, &sv)
@@ -874,3 +1439,380 @@ func (d *DB) GetNextSmartViewSortOrder() (int, error) {
 	}
 	return int(maxOrder.Int64) + 1, nil
 }
+
+func (d *DB) ReplaceSearchPostings(noteID string, length int, postings []SearchPosting) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM search_postings WHERE note_id = ?`, noteID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO search_docs (note_id, length) VALUES (?, ?)`, noteID, length); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO search_postings (token, note_id, tf) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range postings {
+		if _, err := stmt.Exec(p.Token, noteID, p.TF); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) DeleteSearchPostings(noteID string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM search_postings WHERE note_id = ?`, noteID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM search_docs WHERE note_id = ?`, noteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) ClearSearchIndex() error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM search_postings`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM search_docs`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM search_meta`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSearchPostings 返回某个 token 对应的 note_id -> 词频
+func (d *DB) GetSearchPostings(token []byte) (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT note_id, tf FROM search_postings WHERE token = ?`, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]int)
+	for rows.Next() {
+		var noteID string
+		var tf int
+		if err := rows.Scan(&noteID, &tf); err != nil {
+			return nil, err
+		}
+		result[noteID] = tf
+	}
+	return result, rows.Err()
+}
+
+// GetSearchDocLengths 返回所有已索引文档的 note_id -> 文档长度
+func (d *DB) GetSearchDocLengths() (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT note_id, length FROM search_docs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]int)
+	for rows.Next() {
+		var noteID string
+		var length int
+		if err := rows.Scan(&noteID, &length); err != nil {
+			return nil, err
+		}
+		result[noteID] = length
+	}
+	return result, rows.Err()
+}
+
+func (d *DB) GetSearchMeta(key string) ([]byte, error) {
+	var value []byte
+	err := d.db.QueryRow(`SELECT value FROM search_meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (d *DB) SetSearchMeta(key string, value []byte) error {
+	_, err := d.db.Exec(`INSERT OR REPLACE INTO search_meta (key, value) VALUES (?, ?)`, key, value)
+	return err
+}
+
+func (d *DB) GetNotesByIDs(ids []string) ([]*NoteMeta, error) {
+	const chunkSize = 500
+
+	var notes []*NoteMeta
+	for start := 0; start < len(ids); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunk := ids[start:end]
+
+		placeholders := make([]string, len(chunk))
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			placeholders[i] = "?"
+			args[i] = id
+		}
+
+		query := fmt.Sprintf(`SELECT id, cipher_path, created_at, updated_at, pinned, deleted_at, notebook_id, COALESCE(sort_order, 0), encrypted_title, encrypted_preview
+			FROM notes WHERE id IN (%s)`, strings.Join(placeholders, ","))
+
+		rows, err := d.db.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var note NoteMeta
+			if err := rows.Scan(&note.ID, &note.CipherPath, &note.CreatedAt, &note.UpdatedAt, &note.Pinned, &note.DeletedAt, &note.NotebookID, &note.SortOrder, &note.EncryptedTitle, &note.EncryptedPreview); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			notes = append(notes, &note)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return notes, nil
+}
+
+// QueryNotes 按条件查询未删除的笔记，limit < 0 表示不分页
+func (d *DB) QueryNotes(q *NoteQuery, limit, offset int) ([]*NoteMeta, int, error) {
+	where := []string{"deleted_at IS NULL"}
+	var args []interface{}
+
+	in := func(ids []string) string {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		return strings.Join(placeholders, ",")
+	}
+
+	if q.IDs != nil {
+		if len(q.IDs) == 0 {
+			return nil, 0, nil
+		}
+		where = append(where, fmt.Sprintf("id IN (%s)", in(q.IDs)))
+	}
+	for _, tagID := range q.RequireTagIDs {
+		where = append(where, "EXISTS (SELECT 1 FROM note_tags nt WHERE nt.note_id = notes.id AND nt.tag_id = ?)")
+		args = append(args, tagID)
+	}
+	if len(q.ExcludeTagIDs) > 0 {
+		where = append(where, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM note_tags nt WHERE nt.note_id = notes.id AND nt.tag_id IN (%s))", in(q.ExcludeTagIDs)))
+	}
+	if q.NotebookID != nil {
+		where = append(where, "notebook_id = ?")
+		args = append(args, *q.NotebookID)
+	}
+	if q.WithoutNotebook {
+		where = append(where, "notebook_id IS NULL")
+	}
+	if len(q.ExcludeNotebookIDs) > 0 {
+		where = append(where, fmt.Sprintf("(notebook_id IS NULL OR notebook_id NOT IN (%s))", in(q.ExcludeNotebookIDs)))
+	}
+	if q.Pinned != nil {
+		where = append(where, "pinned = ?")
+		args = append(args, *q.Pinned)
+	}
+	if q.CreatedAfter != nil {
+		where = append(where, "julianday(created_at) >= julianday(?)")
+		args = append(args, q.CreatedAfter.UTC().Format(timeLayout))
+	}
+	if q.CreatedBefore != nil {
+		where = append(where, "julianday(created_at) < julianday(?)")
+		args = append(args, q.CreatedBefore.UTC().Format(timeLayout))
+	}
+	if q.UpdatedAfter != nil {
+		where = append(where, "julianday(updated_at) >= julianday(?)")
+		args = append(args, q.UpdatedAfter.UTC().Format(timeLayout))
+	}
+	if q.UpdatedBefore != nil {
+		where = append(where, "julianday(updated_at) < julianday(?)")
+		args = append(args, q.UpdatedBefore.UTC().Format(timeLayout))
+	}
+
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM notes WHERE `+whereSQL, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, cipher_path, created_at, updated_at, pinned, deleted_at, notebook_id, COALESCE(sort_order, 0), encrypted_title, encrypted_preview
+		FROM notes WHERE ` + whereSQL + `
+		ORDER BY pinned DESC, sort_order ASC, updated_at DESC`
+	if limit >= 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var notes []*NoteMeta
+	for rows.Next() {
+		var note NoteMeta
+		if err := rows.Scan(&note.ID, &note.CipherPath, &note.CreatedAt, &note.UpdatedAt, &note.Pinned, &note.DeletedAt, &note.NotebookID, &note.SortOrder, &note.EncryptedTitle, &note.EncryptedPreview); err != nil {
+			return nil, 0, err
+		}
+		notes = append(notes, &note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return notes, total, nil
+}
+
+func (d *DB) CreateAttachment(a *Attachment) error {
+	_, err := d.db.Exec(`
+		INSERT INTO attachments (id, note_id, encrypted_filename, mime, size, sha256, cipher_path, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.NoteID, a.EncryptedFilename, a.Mime, a.Size, a.SHA256, a.CipherPath, a.CreatedAt)
+	return err
+}
+
+func (d *DB) GetAttachment(id string) (*Attachment, error) {
+	var a Attachment
+	err := d.db.QueryRow(`
+		SELECT id, note_id, encrypted_filename, mime, size, sha256, cipher_path, created_at
+		FROM attachments WHERE id = ?
+	`, id).Scan(&a.ID, &a.NoteID, &a.EncryptedFilename, &a.Mime, &a.Size, &a.SHA256, &a.CipherPath, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (d *DB) ListAttachments(noteID string) ([]*Attachment, error) {
+	return d.queryAttachments(`
+		SELECT id, note_id, encrypted_filename, mime, size, sha256, cipher_path, created_at
+		FROM attachments WHERE note_id = ?
+		ORDER BY created_at ASC
+	`, noteID)
+}
+
+// ListAllAttachments 返回所有笔记的附件
+func (d *DB) ListAllAttachments() ([]*Attachment, error) {
+	return d.queryAttachments(`
+		SELECT id, note_id, encrypted_filename, mime, size, sha256, cipher_path, created_at
+		FROM attachments ORDER BY created_at ASC
+	`)
+}
+
+func (d *DB) queryAttachments(query string, args ...interface{}) ([]*Attachment, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.NoteID, &a.EncryptedFilename, &a.Mime, &a.Size, &a.SHA256, &a.CipherPath, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &a)
+	}
+	return attachments, rows.Err()
+}
+
+// UpdateAttachmentEncryption 更新附件的加密文件名与校验值（更换数据密钥后）
+func (d *DB) UpdateAttachmentEncryption(id string, encryptedFilename []byte, checksum string) error {
+	_, err := d.db.Exec(`UPDATE attachments SET encrypted_filename = ?, sha256 = ? WHERE id = ?`, encryptedFilename, checksum, id)
+	return err
+}
+
+func (d *DB) DeleteAttachment(id string) error {
+	_, err := d.db.Exec(`DELETE FROM attachments WHERE id = ?`, id)
+	return err
+}
+
+func (d *DB) ListSyncEntities() ([]*SyncEntity, error) {
+	rows, err := d.db.Query(`SELECT kind, id, vector, hash, deleted FROM sync_entities`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entities []*SyncEntity
+	for rows.Next() {
+		var e SyncEntity
+		if err := rows.Scan(&e.Kind, &e.ID, &e.Vector, &e.Hash, &e.Deleted); err != nil {
+			return nil, err
+		}
+		entities = append(entities, &e)
+	}
+	return entities, rows.Err()
+}
+
+func (d *DB) GetSyncEntity(kind, id string) (*SyncEntity, error) {
+	var e SyncEntity
+	err := d.db.QueryRow(`SELECT kind, id, vector, hash, deleted FROM sync_entities WHERE kind = ? AND id = ?`, kind, id).
+		Scan(&e.Kind, &e.ID, &e.Vector, &e.Hash, &e.Deleted)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (d *DB) PutSyncEntity(e *SyncEntity) error {
+	_, err := d.db.Exec(`
+		INSERT OR REPLACE INTO sync_entities (kind, id, vector, hash, deleted)
+		VALUES (?, ?, ?, ?, ?)
+	`, e.Kind, e.ID, e.Vector, e.Hash, e.Deleted)
+	return err
+}
+
+// DeleteSyncEntity 删除对象的同步状态
+func (d *DB) DeleteSyncEntity(kind, id string) error {
+	_, err := d.db.Exec(`DELETE FROM sync_entities WHERE kind = ? AND id = ?`, kind, id)
+	return err
+}
+
+func (d *DB) GetSyncMeta(key string) (string, error) {
+	var value string
+	err := d.db.QueryRow(`SELECT value FROM sync_meta WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (d *DB) SetSyncMeta(key, value string) error {
+	_, err := d.db.Exec(`INSERT OR REPLACE INTO sync_meta (key, value) VALUES (?, ?)`, key, value)
+	return err
+}
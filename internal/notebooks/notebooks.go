@@ -4,14 +4,34 @@
 package notebooks
 
 import (
+	"errors"
+	"fmt"
+	"locknote/internal/crypto"
 	"locknote/internal/database"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// 笔记本的名称与图标用数据密钥加密，分别绑定笔记本 ID 与字段
+
+const (
+	fieldName = "name"
+	fieldIcon = "icon"
+)
+
 type Service struct {
-	db *database.DB
+	db        *database.DB
+	crypto    *crypto.Service
+	masterKey []byte
+	mu        sync.RWMutex
+
+	// 已解锁的受保护笔记本的密钥
+	unlocked     map[string]*unlockedNotebook
+	keysMu       sync.Mutex
+	lockCallback func(id string)
 }
 
 type Notebook struct {
@@ -22,6 +42,8 @@ type Notebook struct {
 	Pinned    bool   `json:"pinned"`
 	CreatedAt string `json:"createdAt"`
 	UpdatedAt string `json:"updatedAt"`
+	Protected bool   `json:"protected"` // 有自己的密码
+	Locked    bool   `json:"locked"`    // 受保护且尚未解锁
 }
 
 func formatTime(t time.Time) string {
@@ -29,10 +51,87 @@ func formatTime(t time.Time) string {
 }
 
 func NewService(db *database.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, crypto: crypto.NewService(), unlocked: make(map[string]*unlockedNotebook)}
+}
+
+// SetMasterKey 设置数据密钥，key 为 nil（应用锁定）时同时锁定所有笔记本
+func (s *Service) SetMasterKey(key []byte) {
+	s.mu.Lock()
+	s.masterKey = key
+	s.mu.Unlock()
+	if key == nil {
+		s.LockAll()
+	}
+}
+
+func (s *Service) getMasterKey() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.masterKey == nil {
+		return nil, errors.New("not unlocked")
+	}
+	return s.masterKey, nil
+}
+
+func notebookAAD(field, id string) []byte {
+	return []byte("locknote-notebook\x00" + field + "\x00" + id)
+}
+
+// seal 加密 name 与 icon 并写入 nb 的加密字段，清空明文字段
+func (s *Service) seal(key []byte, nb *database.Notebook, name, icon string) error {
+	encryptedName, err := s.crypto.EncryptWithAAD(key, []byte(name), notebookAAD(fieldName, nb.ID))
+	if err != nil {
+		return err
+	}
+	encryptedIcon, err := s.crypto.EncryptWithAAD(key, []byte(icon), notebookAAD(fieldIcon, nb.ID))
+	if err != nil {
+		return err
+	}
+	nb.Name, nb.Icon = "", ""
+	nb.EncryptedName, nb.EncryptedIcon = encryptedName, encryptedIcon
+	return nil
+}
+
+// openFields 返回笔记本的名称与图标，加密之前的旧数据直接返回明文
+func (s *Service) openFields(key []byte, nb *database.Notebook) (name, icon string, err error) {
+	if nb.EncryptedName == nil {
+		return nb.Name, nb.Icon, nil
+	}
+	nameData, err := s.crypto.DecryptWithAAD(key, nb.EncryptedName, notebookAAD(fieldName, nb.ID))
+	if err != nil {
+		return "", "", fmt.Errorf("笔记本名称无法解密 (id=%s): %w", nb.ID, err)
+	}
+	iconData, err := s.crypto.DecryptWithAAD(key, nb.EncryptedIcon, notebookAAD(fieldIcon, nb.ID))
+	if err != nil {
+		return "", "", fmt.Errorf("笔记本图标无法解密 (id=%s): %w", nb.ID, err)
+	}
+	return string(nameData), string(iconData), nil
+}
+
+func (s *Service) open(key []byte, nb *database.Notebook) (*Notebook, error) {
+	name, icon, err := s.openFields(key, nb)
+	if err != nil {
+		return nil, err
+	}
+	protected := nb.EncryptedKey != nil
+	return &Notebook{
+		ID:        nb.ID,
+		Name:      name,
+		Icon:      icon,
+		SortOrder: nb.SortOrder,
+		Pinned:    nb.Pinned,
+		CreatedAt: formatTime(nb.CreatedAt),
+		UpdatedAt: formatTime(nb.UpdatedAt),
+		Protected: protected,
+		Locked:    protected && !s.IsUnlocked(nb.ID),
+	}, nil
 }
 
 func (s *Service) Create(name, icon string) (*Notebook, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
 	if icon == "" {
 		icon = "📓"
 	}
@@ -45,12 +144,13 @@ func (s *Service) Create(name, icon string) (*Notebook, error) {
 	now := time.Now()
 	notebook := &database.Notebook{
 		ID:        uuid.New().String(),
-		Name:      name,
-		Icon:      icon,
 		SortOrder: sortOrder,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
+	if err := s.seal(key, notebook, name, icon); err != nil {
+		return nil, err
+	}
 
 	if err := s.db.CreateNotebook(notebook); err != nil {
 		return nil, err
@@ -58,8 +158,8 @@ func (s *Service) Create(name, icon string) (*Notebook, error) {
 
 	return &Notebook{
 		ID:        notebook.ID,
-		Name:      notebook.Name,
-		Icon:      notebook.Icon,
+		Name:      name,
+		Icon:      icon,
 		SortOrder: notebook.SortOrder,
 		Pinned:    notebook.Pinned,
 		CreatedAt: formatTime(notebook.CreatedAt),
@@ -68,14 +168,22 @@ func (s *Service) Create(name, icon string) (*Notebook, error) {
 }
 
 func (s *Service) Update(id, name, icon string) (*Notebook, error) {
-	notebook, err := s.db.GetNotebook(id)
+	key, err := s.getMasterKey()
 	if err != nil {
 		return nil, err
 	}
 
-	notebook.Name = name
-	if icon != "" {
-		notebook.Icon = icon
+	notebook, err := s.db.GetNotebook(id)
+	if err != nil {
+		return nil, err
+	}
+	if icon == "" {
+		if _, icon, err = s.openFields(key, notebook); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.seal(key, notebook, name, icon); err != nil {
+		return nil, err
 	}
 	notebook.UpdatedAt = time.Now()
 
@@ -83,22 +191,36 @@ func (s *Service) Update(id, name, icon string) (*Notebook, error) {
 		return nil, err
 	}
 
+	protected := notebook.EncryptedKey != nil
 	return &Notebook{
 		ID:        notebook.ID,
-		Name:      notebook.Name,
-		Icon:      notebook.Icon,
+		Name:      name,
+		Icon:      icon,
 		SortOrder: notebook.SortOrder,
 		Pinned:    notebook.Pinned,
 		CreatedAt: formatTime(notebook.CreatedAt),
 		UpdatedAt: formatTime(notebook.UpdatedAt),
+		Protected: protected,
+		Locked:    protected && !s.IsUnlocked(notebook.ID),
 	}, nil
 }
 
+// Delete 删除笔记本，其中的笔记移出笔记本。受保护的笔记本需要先取消保护，
+// 否则其中用笔记本密钥加密的笔记将无法再解密
 func (s *Service) Delete(id string) error {
+	if nb, err := s.db.GetNotebook(id); err == nil && nb.EncryptedKey != nil {
+		return errors.New("受保护的笔记本需要先取消保护才能删除")
+	}
 	return s.db.DeleteNotebook(id)
 }
 
+// List 返回全部笔记本，置顶的在前，其余按排序号与名称排列
 func (s *Service) List() ([]*Notebook, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
 	dbNotebooks, err := s.db.ListNotebooks()
 	if err != nil {
 		return nil, err
@@ -106,20 +228,36 @@ func (s *Service) List() ([]*Notebook, error) {
 
 	notebooks := make([]*Notebook, len(dbNotebooks))
 	for i, n := range dbNotebooks {
-		notebooks[i] = &Notebook{
-			ID:        n.ID,
-			Name:      n.Name,
-			Icon:      n.Icon,
-			SortOrder: n.SortOrder,
-			Pinned:    n.Pinned,
-			CreatedAt: formatTime(n.CreatedAt),
-			UpdatedAt: formatTime(n.UpdatedAt),
+		if notebooks[i], err = s.open(key, n); err != nil {
+			return nil, err
 		}
 	}
+	sort.SliceStable(notebooks, func(i, j int) bool {
+		a, b := notebooks[i], notebooks[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if a.SortOrder != b.SortOrder {
+			return a.SortOrder < b.SortOrder
+		}
+		return a.Name < b.Name
+	})
 
 	return notebooks, nil
 }
 
+func (s *Service) Get(id string) (*Notebook, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	nb, err := s.db.GetNotebook(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(key, nb)
+}
+
 func (s *Service) SetPinned(id string, pinned bool) error {
 	return s.db.SetNotebookPinned(id, pinned)
 }
@@ -131,3 +269,33 @@ func (s *Service) UpdateSortOrder(id string, sortOrder int) error {
 func (s *Service) ReorderNotebooks(ids []string) error {
 	return s.db.ReorderNotebooks(ids)
 }
+
+// Rekey 把笔记本的名称与图标从 oldKey 重新加密为 newKey，返回改写的笔记本数。
+// 明文的旧数据直接加密；已经能用 newKey 解密的跳过，因此可以重复调用。两个密钥都无法解密的保持原样
+func (s *Service) Rekey(oldKey, newKey []byte) (int, error) {
+	dbNotebooks, err := s.db.ListNotebooks()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, nb := range dbNotebooks {
+		if nb.EncryptedName != nil {
+			if _, _, err := s.openFields(newKey, nb); err == nil {
+				continue
+			}
+		}
+		name, icon, err := s.openFields(oldKey, nb)
+		if err != nil {
+			continue
+		}
+		if err := s.seal(newKey, nb, name, icon); err != nil {
+			return count, err
+		}
+		if err := s.db.UpdateNotebook(nb); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,251 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notebooks
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"locknote/internal/crypto"
+	"time"
+)
+
+// 受保护的笔记本有自己的随机密钥，其中的笔记用它代替数据密钥加密。笔记本密钥用由笔记本密码经 Argon2id
+// 派生的密钥包装后保存，名称与图标仍用数据密钥加密，锁定时也能显示。解锁后密钥只保存在内存中，
+// 空闲 RelockAfter 后或应用锁定时清除。忘记笔记本密码时其中的笔记无法恢复，恢复密钥也不能解开。
+
+// RelockAfter 是已解锁的笔记本在没有访问后自动锁定的时间
+const RelockAfter = 5 * time.Minute
+
+const fieldKey = "key"
+
+var (
+	// ErrLocked 表示笔记本受保护且尚未解锁
+	ErrLocked = errors.New("笔记本已锁定")
+	// ErrWrongPassword 表示笔记本密码不正确
+	ErrWrongPassword = errors.New("笔记本密码不正确")
+)
+
+type unlockedNotebook struct {
+	key   []byte
+	timer *time.Timer
+}
+
+// SetLockCallback 设置笔记本自动锁定时的回调，应用锁定时的统一锁定不回调
+func (s *Service) SetLockCallback(cb func(id string)) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	s.lockCallback = cb
+}
+
+// wrapKey 由密码派生包装笔记本密钥的密钥
+func (s *Service) wrapKey(password string, salt []byte, params crypto.KDFParams) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("笔记本密码不能为空")
+	}
+	return s.crypto.DeriveKeyWithParams(password, salt, params)
+}
+
+// Protect 为笔记本设置密码并生成笔记本密钥，完成后笔记本处于解锁状态。
+// 笔记本已受保护时只验证密码并解锁，便于继续上次中断的保护。
+// 其中已有笔记的重新加密由调用方完成
+func (s *Service) Protect(id, password string) error {
+	if _, err := s.getMasterKey(); err != nil {
+		return err
+	}
+	nb, err := s.db.GetNotebook(id)
+	if err != nil {
+		return err
+	}
+	if nb.EncryptedKey != nil {
+		return s.Unlock(id, password)
+	}
+
+	salt, err := s.crypto.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	params := crypto.DefaultKDFParams
+	wrapKey, err := s.wrapKey(password, salt, params)
+	if err != nil {
+		return err
+	}
+	key, err := s.crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	encryptedKey, err := s.crypto.EncryptWithAAD(wrapKey, key, notebookAAD(fieldKey, id))
+	if err != nil {
+		return err
+	}
+	if err := s.db.SetNotebookKey(id, salt, params.String(), encryptedKey); err != nil {
+		return err
+	}
+	s.remember(id, key)
+	return nil
+}
+
+// Unprotect 取消笔记本的保护并锁定它。调用方需先把其中的笔记重新加密为数据密钥
+func (s *Service) Unprotect(id string) error {
+	if err := s.db.SetNotebookKey(id, nil, "", nil); err != nil {
+		return err
+	}
+	s.Lock(id)
+	return nil
+}
+
+// Unlock 用笔记本密码解锁笔记本，不受保护的笔记本直接返回
+func (s *Service) Unlock(id, password string) error {
+	if _, err := s.getMasterKey(); err != nil {
+		return err
+	}
+	nb, err := s.db.GetNotebook(id)
+	if err != nil {
+		return err
+	}
+	if nb.EncryptedKey == nil {
+		return nil
+	}
+
+	params, err := crypto.ParseKDFParams(nb.KeyParams)
+	if err != nil {
+		return err
+	}
+	wrapKey, err := s.wrapKey(password, nb.KeySalt, params)
+	if err != nil {
+		return err
+	}
+	key, err := s.crypto.DecryptWithAAD(wrapKey, nb.EncryptedKey, notebookAAD(fieldKey, id))
+	if err != nil {
+		return ErrWrongPassword
+	}
+	s.remember(id, key)
+	return nil
+}
+
+// remember 保存已解锁的笔记本密钥并开始空闲计时
+func (s *Service) remember(id string, key []byte) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if u, ok := s.unlocked[id]; ok {
+		u.timer.Stop()
+		clear(u.key)
+	}
+	s.unlocked[id] = &unlockedNotebook{key: key, timer: s.relockTimer(id)}
+}
+
+// relockTimer 在 RelockAfter 后锁定笔记本并通知回调，调用方需持有 s.keysMu
+func (s *Service) relockTimer(id string) *time.Timer {
+	var timer *time.Timer
+	timer = time.AfterFunc(RelockAfter, func() {
+		s.keysMu.Lock()
+		u, ok := s.unlocked[id]
+		// 笔记本已锁定，或重新解锁时换了计时器
+		if !ok || u.timer != timer {
+			s.keysMu.Unlock()
+			return
+		}
+		delete(s.unlocked, id)
+		clear(u.key)
+		cb := s.lockCallback
+		s.keysMu.Unlock()
+
+		if cb != nil {
+			cb(id)
+		}
+	})
+	return timer
+}
+
+// Lock 锁定笔记本，清除内存中的笔记本密钥
+func (s *Service) Lock(id string) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	if u, ok := s.unlocked[id]; ok {
+		u.timer.Stop()
+		clear(u.key)
+		delete(s.unlocked, id)
+	}
+}
+
+// LockAll 锁定所有笔记本
+func (s *Service) LockAll() {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	for id, u := range s.unlocked {
+		u.timer.Stop()
+		clear(u.key)
+		delete(s.unlocked, id)
+	}
+}
+
+// IsUnlocked 返回受保护的笔记本 id 当前是否已解锁
+func (s *Service) IsUnlocked(id string) bool {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	_, ok := s.unlocked[id]
+	return ok
+}
+
+// IsProtected 返回笔记本 id 是否受保护，笔记本不存在时返回 false
+func (s *Service) IsProtected(id string) (bool, error) {
+	protected, err := s.ProtectedIDs()
+	if err != nil {
+		return false, err
+	}
+	return protected[id], nil
+}
+
+// ProtectedIDs 返回全部受保护笔记本的 ID
+func (s *Service) ProtectedIDs() (map[string]bool, error) {
+	dbNotebooks, err := s.db.ListNotebooks()
+	if err != nil {
+		return nil, err
+	}
+	protected := make(map[string]bool)
+	for _, nb := range dbNotebooks {
+		if nb.EncryptedKey != nil {
+			protected[nb.ID] = true
+		}
+	}
+	return protected, nil
+}
+
+// Key 返回加密笔记本 id 中笔记所用的笔记本密钥，并重新开始空闲计时。
+// 笔记本不受保护或不存在时返回 nil，受保护但尚未解锁时返回 ErrLocked
+func (s *Service) Key(id string) ([]byte, error) {
+	if _, err := s.getMasterKey(); err != nil {
+		return nil, err
+	}
+	nb, err := s.db.GetNotebook(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if nb.EncryptedKey == nil {
+		return nil, nil
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	u, ok := s.unlocked[id]
+	if !ok {
+		return nil, ErrLocked
+	}
+	u.timer.Reset(RelockAfter)
+	return bytes.Clone(u.key), nil
+}
+
+// UnlockedKeys 返回全部已解锁的笔记本密钥
+func (s *Service) UnlockedKeys() [][]byte {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+	keys := make([][]byte, 0, len(s.unlocked))
+	for _, u := range s.unlocked {
+		keys = append(keys, bytes.Clone(u.key))
+	}
+	return keys
+}
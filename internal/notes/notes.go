@@ -4,15 +4,17 @@
 package notes
 
 import (
-	"archive/zip"
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
-	"io"
 	"locknote/internal/crypto"
 	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"locknote/internal/tags"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
@@ -23,6 +25,7 @@ type Service struct {
 	db        *database.DB
 	dataDir   string
 	crypto    *crypto.Service
+	notebooks *notebooks.Service
 	masterKey []byte
 	mu        sync.RWMutex
 }
@@ -37,6 +40,7 @@ type Note struct {
 	DeletedAt  *string `json:"deletedAt,omitempty"`
 	NotebookID *string `json:"notebookId,omitempty"`
 	Tags       []Tag   `json:"tags"`
+	Locked     bool    `json:"locked,omitempty"` // 在锁定的笔记本中，只有元数据
 }
 
 func formatTime(t time.Time) string {
@@ -62,11 +66,13 @@ type NoteContent struct {
 	Content string `json:"content"`
 }
 
-func NewService(db *database.DB, dataDir string) *Service {
+// NewService 创建笔记服务，nb 用于取得受保护笔记本的密钥
+func NewService(db *database.DB, dataDir string, nb *notebooks.Service) *Service {
 	return &Service{
-		db:      db,
-		dataDir: dataDir,
-		crypto:  crypto.NewService(),
+		db:        db,
+		dataDir:   dataDir,
+		crypto:    crypto.NewService(),
+		notebooks: nb,
 	}
 }
 
@@ -109,18 +115,18 @@ func (s *Service) Create(title, content string) (*Note, error) {
 		return nil, err
 	}
 
-	ciphertext, err := s.crypto.Encrypt(key, plaintext)
+	ciphertext, err := s.sealField(key, fieldContent, id, "", plaintext)
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedTitle, err := s.crypto.Encrypt(key, []byte(title))
+	encryptedTitle, err := s.sealField(key, fieldTitle, id, "", []byte(title))
 	if err != nil {
 		return nil, err
 	}
 
 	preview := s.extractPreview(content)
-	encryptedPreview, err := s.crypto.Encrypt(key, []byte(preview))
+	encryptedPreview, err := s.sealField(key, fieldPreview, id, "", []byte(preview))
 	if err != nil {
 		return nil, err
 	}
@@ -156,6 +162,9 @@ func (s *Service) Create(title, content string) (*Note, error) {
 		return nil, err
 	}
 
+	// 索引失败不影响保存，可通过 RebuildSearchIndex 修复
+	_ = s.indexNote(key, id, title, content)
+
 	return &Note{
 		ID:         id,
 		Title:      title,
@@ -173,30 +182,79 @@ func (s *Service) buildCipherPath(dir, id string) string {
 	return filepath.Join(dir, prefix, id+".enc")
 }
 
-func (s *Service) Get(id string) (*Note, error) {
-	key, err := s.getMasterKey()
+// 笔记的各个密文在加密时绑定笔记 ID、字段与历史 ID，
+// 防止密文被调换到其他笔记或字段后仍能正常解密
+const (
+	fieldContent = "content"
+	fieldTitle   = "title"
+	fieldPreview = "preview"
+	fieldHistory = "history"
+)
+
+func noteAAD(field, noteID, historyID string) []byte {
+	return []byte("locknote-note\x00" + field + "\x00" + noteID + "\x00" + historyID)
+}
+
+func (s *Service) sealField(key []byte, field, noteID, historyID string, plaintext []byte) ([]byte, error) {
+	return s.crypto.EncryptWithAAD(key, plaintext, noteAAD(field, noteID, historyID))
+}
+
+func (s *Service) openField(key []byte, field, noteID, historyID string, ciphertext []byte) ([]byte, error) {
+	return s.crypto.DecryptWithAAD(key, ciphertext, noteAAD(field, noteID, historyID))
+}
+
+// noteTags 转换数据库中的标签并按名称排序，名称无法解密的标签名称为空
+func (s *Service) noteTags(key []byte, dbTags []*database.Tag) []Tag {
+	result := make([]Tag, len(dbTags))
+	for i, t := range dbTags {
+		name, _ := tags.OpenName(s.crypto, key, t)
+		result[i] = Tag{ID: t.ID, Name: name, Color: t.Color}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (s *Service) decodeContent(key []byte, field, noteID, historyID string, ciphertext []byte) (*NoteContent, error) {
+	plaintext, err := s.openField(key, field, noteID, historyID, ciphertext)
 	if err != nil {
 		return nil, err
 	}
+	var noteContent NoteContent
+	if err := json.Unmarshal(plaintext, &noteContent); err != nil {
+		return nil, err
+	}
+	return &noteContent, nil
+}
 
-	meta, err := s.db.GetNote(id)
+// DecryptContent 解密笔记本 notebookID 中笔记 id 的正文密文（例如同步收到的密文）
+func (s *Service) DecryptContent(id string, notebookID *string, ciphertext []byte) (*NoteContent, error) {
+	key, _, err := s.noteKey(notebookID)
 	if err != nil {
 		return nil, err
 	}
+	return s.decodeContent(key, fieldContent, id, "", ciphertext)
+}
 
-	fullPath := filepath.Join(s.dataDir, meta.CipherPath)
-	ciphertext, err := os.ReadFile(fullPath)
+func (s *Service) Get(id string) (*Note, error) {
+	key, err := s.getMasterKey()
 	if err != nil {
 		return nil, err
 	}
 
-	plaintext, err := s.crypto.Decrypt(key, ciphertext)
+	meta, err := s.db.GetNote(id)
 	if err != nil {
 		return nil, err
 	}
 
-	var noteContent NoteContent
-	if err := json.Unmarshal(plaintext, &noteContent); err != nil {
+	contentKey, _, err := s.noteKey(meta.NotebookID)
+	if errors.Is(err, notebooks.ErrLocked) {
+		return lockedNote(meta), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	noteContent, err := s.readContent(contentKey, meta)
+	if err != nil {
 		return nil, err
 	}
 
@@ -205,10 +263,7 @@ func (s *Service) Get(id string) (*Note, error) {
 		return nil, err
 	}
 
-	tags := make([]Tag, len(dbTags))
-	for i, t := range dbTags {
-		tags[i] = Tag{ID: t.ID, Name: t.Name, Color: t.Color}
-	}
+	tags := s.noteTags(key, dbTags)
 
 	return &Note{
 		ID:         meta.ID,
@@ -229,7 +284,7 @@ const (
 )
 
 func (s *Service) Update(id, title, content string) (*Note, error) {
-	key, err := s.getMasterKey()
+	masterKey, err := s.getMasterKey()
 	if err != nil {
 		return nil, err
 	}
@@ -238,6 +293,10 @@ func (s *Service) Update(id, title, content string) (*Note, error) {
 	if err != nil {
 		return nil, err
 	}
+	key, protected, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return nil, err
+	}
 
 	var historyRecord *database.NoteHistory
 	var oldContent NoteContent
@@ -246,45 +305,19 @@ func (s *Service) Update(id, title, content string) (*Note, error) {
 	oldPath := filepath.Join(s.dataDir, meta.CipherPath)
 	oldCiphertext, err := os.ReadFile(oldPath)
 	if err == nil {
-		oldPlaintext, decErr := s.crypto.Decrypt(key, oldCiphertext)
+		oldPlaintext, decErr := s.openField(key, fieldContent, id, "", oldCiphertext)
+		if decErr != nil && protected {
+			// 保护笔记本时中断，正文可能仍是数据密钥加密的
+			oldPlaintext, decErr = s.openField(masterKey, fieldContent, id, "", oldCiphertext)
+		}
 		if decErr == nil {
 			json.Unmarshal(oldPlaintext, &oldContent)
 		}
 		contentChanged = oldContent.Title != title || oldContent.Content != content
 
-		if contentChanged {
-			shouldCreateHistory := true
-
-			existingHistory, _ := s.db.GetNoteHistory(id)
-			if len(existingHistory) > 0 {
-				lastHistory := existingHistory[0]
-				if time.Since(lastHistory.CreatedAt) < historyMinInterval {
-					shouldCreateHistory = false
-				}
-			}
-
-			if shouldCreateHistory {
-				historyID := uuid.New().String()
-				historyPath := s.buildCipherPath("history", historyID)
-				historyFullPath := filepath.Join(s.dataDir, historyPath)
-				if err := os.MkdirAll(filepath.Dir(historyFullPath), 0700); err == nil {
-					if err := os.WriteFile(historyFullPath, oldCiphertext, 0600); err == nil {
-						historyRecord = &database.NoteHistory{
-							ID:         historyID,
-							NoteID:     id,
-							CipherPath: historyPath,
-							CreatedAt:  time.Now(),
-						}
-					}
-				}
-
-				if len(existingHistory) >= historyMaxCount {
-					for i := historyMaxCount - 1; i < len(existingHistory); i++ {
-						os.Remove(filepath.Join(s.dataDir, existingHistory[i].CipherPath))
-						s.db.DeleteSingleHistory(existingHistory[i].ID)
-					}
-				}
-			}
+		// 无法解密的旧版本不能重新绑定到历史记录，不保存
+		if contentChanged && decErr == nil {
+			historyRecord = s.prepareHistory(key, id, oldPlaintext)
 		}
 	}
 
@@ -294,18 +327,18 @@ func (s *Service) Update(id, title, content string) (*Note, error) {
 		return nil, err
 	}
 
-	ciphertext, err := s.crypto.Encrypt(key, plaintext)
+	ciphertext, err := s.sealField(key, fieldContent, id, "", plaintext)
 	if err != nil {
 		return nil, err
 	}
 
-	encryptedTitle, err := s.crypto.Encrypt(key, []byte(title))
+	encryptedTitle, err := s.sealField(key, fieldTitle, id, "", []byte(title))
 	if err != nil {
 		return nil, err
 	}
 
 	preview := s.extractPreview(content)
-	encryptedPreview, err := s.crypto.Encrypt(key, []byte(preview))
+	encryptedPreview, err := s.sealField(key, fieldPreview, id, "", []byte(preview))
 	if err != nil {
 		return nil, err
 	}
@@ -327,11 +360,10 @@ func (s *Service) Update(id, title, content string) (*Note, error) {
 		return nil, err
 	}
 
+	_ = s.updateIndex(protected, id, title, content)
+
 	dbTags, _ := s.db.GetNoteTags(id)
-	tags := make([]Tag, len(dbTags))
-	for i, t := range dbTags {
-		tags[i] = Tag{ID: t.ID, Name: t.Name, Color: t.Color}
-	}
+	tags := s.noteTags(masterKey, dbTags)
 
 	return &Note{
 		ID:         meta.ID,
@@ -346,6 +378,109 @@ func (s *Service) Update(id, title, content string) (*Note, error) {
 	}, nil
 }
 
+// prepareHistory 把旧版本加密写入历史目录并清理超出数量的历史，返回待插入的历史记录；
+// 距上一个历史版本不足 historyMinInterval 时返回 nil
+func (s *Service) prepareHistory(key []byte, id string, oldPlaintext []byte) *database.NoteHistory {
+	existingHistory, _ := s.db.GetNoteHistory(id)
+	if len(existingHistory) > 0 {
+		lastHistory := existingHistory[0]
+		if time.Since(lastHistory.CreatedAt) < historyMinInterval {
+			return nil
+		}
+	}
+
+	var historyRecord *database.NoteHistory
+	historyID := uuid.New().String()
+	historyPath := s.buildCipherPath("history", historyID)
+	historyFullPath := filepath.Join(s.dataDir, historyPath)
+	historyCiphertext, err := s.sealField(key, fieldHistory, id, historyID, oldPlaintext)
+	if err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(historyFullPath), 0700); err == nil {
+		if err := os.WriteFile(historyFullPath, historyCiphertext, 0600); err == nil {
+			historyRecord = &database.NoteHistory{
+				ID:         historyID,
+				NoteID:     id,
+				CipherPath: historyPath,
+				CreatedAt:  time.Now(),
+			}
+		}
+	}
+
+	if len(existingHistory) >= historyMaxCount {
+		for i := historyMaxCount - 1; i < len(existingHistory); i++ {
+			os.Remove(filepath.Join(s.dataDir, existingHistory[i].CipherPath))
+			s.db.DeleteSingleHistory(existingHistory[i].ID)
+		}
+	}
+
+	return historyRecord
+}
+
+// PutEncrypted 用已加密的正文创建或覆盖笔记（供同步使用），正文必须能用当前数据密钥
+// 或所在笔记本的密钥解密。meta 中的 CipherPath 会被忽略；覆盖已有笔记时旧版本保存到历史。
+// 笔记本锁定时无法验证正文，原样写入，不保存历史
+func (s *Service) PutEncrypted(meta *database.NoteMeta, ciphertext []byte) error {
+	key, protected, err := s.noteKey(meta.NotebookID)
+	locked := errors.Is(err, notebooks.ErrLocked)
+	if err != nil && !locked {
+		return err
+	}
+
+	var noteContent *NoteContent
+	if !locked {
+		if noteContent, err = s.decodeContent(key, fieldContent, meta.ID, "", ciphertext); err != nil {
+			return errors.New("note ciphertext does not match the current data key")
+		}
+	}
+
+	existing, err := s.db.GetNote(meta.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var historyRecord *database.NoteHistory
+	if existing != nil {
+		meta.CipherPath = existing.CipherPath
+		if oldCiphertext, err := os.ReadFile(filepath.Join(s.dataDir, existing.CipherPath)); err == nil && !locked && !bytes.Equal(oldCiphertext, ciphertext) {
+			if oldPlaintext, err := s.openField(key, fieldContent, meta.ID, "", oldCiphertext); err == nil {
+				historyRecord = s.prepareHistory(key, meta.ID, oldPlaintext)
+			}
+		}
+	} else {
+		meta.CipherPath = s.buildCipherPath("notes", meta.ID)
+	}
+
+	fullPath := filepath.Join(s.dataDir, meta.CipherPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return err
+	}
+	tempPath := fullPath + ".tmp"
+	if err := os.WriteFile(tempPath, ciphertext, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, fullPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if existing != nil {
+		err = s.db.UpdateNoteAndCreateHistory(meta, historyRecord)
+	} else if err = s.db.CreateNote(meta); err == nil && meta.DeletedAt != nil {
+		err = s.db.UpdateNote(meta)
+	}
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return s.db.ReplaceSearchPostings(meta.ID, 0, nil)
+	}
+	_ = s.updateIndex(protected, meta.ID, noteContent.Title, noteContent.Content)
+	return nil
+}
+
 func (s *Service) SetPinned(id string, pinned bool) error {
 	meta, err := s.db.GetNote(id)
 	if err != nil {
@@ -390,17 +525,28 @@ func (s *Service) Delete(id string) error {
 		os.Remove(filepath.Join(s.dataDir, h.CipherPath))
 	}
 	s.db.DeleteNoteHistory(id)
+	s.db.DeleteSearchPostings(id)
+
+	attachments, _ := s.db.ListAttachments(id)
+	for _, a := range attachments {
+		os.Remove(filepath.Join(s.dataDir, a.CipherPath))
+	}
 
 	return s.db.DeleteNotePermanently(id)
 }
 
 func (s *Service) List() ([]*Note, error) {
-	key, err := s.getMasterKey()
+	metas, err := s.db.ListNotes(false)
 	if err != nil {
 		return nil, err
 	}
 
-	metas, err := s.db.ListNotes(false)
+	return s.ListFromMetas(metas)
+}
+
+// ListFromMetas 把元数据转换为列表用的笔记（标题与摘要），优先使用缓存的加密标题
+func (s *Service) ListFromMetas(metas []*database.NoteMeta) ([]*Note, error) {
+	key, err := s.getMasterKey()
 	if err != nil {
 		return nil, err
 	}
@@ -412,49 +558,26 @@ func (s *Service) List() ([]*Note, error) {
 	}
 	tagsByNoteID, _ := s.db.GetNoteTagsBatch(noteIDs)
 
+	resolve := s.keyResolver()
 	notes := make([]*Note, 0, len(metas))
 	for _, meta := range metas {
-		var title, preview string
-
-		// Try to use cached encrypted title/preview first (fast path)
-		if meta.EncryptedTitle != nil {
-			if decrypted, err := s.crypto.Decrypt(key, meta.EncryptedTitle); err == nil {
-				title = string(decrypted)
-			}
+		contentKey, _, err := resolve(meta.NotebookID)
+		if errors.Is(err, notebooks.ErrLocked) {
+			notes = append(notes, lockedNote(meta))
+			continue
 		}
-		if meta.EncryptedPreview != nil {
-			if decrypted, err := s.crypto.Decrypt(key, meta.EncryptedPreview); err == nil {
-				preview = string(decrypted)
-			}
+		if err != nil {
+			return nil, err
 		}
 
-		// Fallback to reading file if cache is empty (for old notes)
-		if title == "" {
-			fullPath := filepath.Join(s.dataDir, meta.CipherPath)
-			ciphertext, err := os.ReadFile(fullPath)
-			if err != nil {
-				continue
-			}
-
-			plaintext, err := s.crypto.Decrypt(key, ciphertext)
-			if err != nil {
-				continue
-			}
-
-			var noteContent NoteContent
-			if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-				continue
-			}
-			title = noteContent.Title
-			preview = s.extractPreview(noteContent.Content)
+		title, preview, ok := s.listFields(contentKey, meta)
+		if !ok {
+			continue
 		}
 
 		// Get tags from batch result
 		dbTags := tagsByNoteID[meta.ID]
-		tags := make([]Tag, len(dbTags))
-		for i, t := range dbTags {
-			tags[i] = Tag{ID: t.ID, Name: t.Name, Color: t.Color}
-		}
+		tags := s.noteTags(key, dbTags)
 
 		notes = append(notes, &Note{
 			ID:         meta.ID,
@@ -472,14 +595,22 @@ func (s *Service) List() ([]*Note, error) {
 	return notes, nil
 }
 
+// ReadContent 解密笔记正文，笔记本锁定时返回 notebooks.ErrLocked
+func (s *Service) ReadContent(meta *database.NoteMeta) (*NoteContent, error) {
+	key, _, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return nil, err
+	}
+	return s.readContent(key, meta)
+}
+
 type ListResult struct {
 	Notes []*Note `json:"notes"`
 	Total int     `json:"total"`
 }
 
 func (s *Service) ListPaginated(limit, offset int) (*ListResult, error) {
-	key, err := s.getMasterKey()
-	if err != nil {
+	if _, err := s.getMasterKey(); err != nil {
 		return nil, err
 	}
 
@@ -488,84 +619,56 @@ func (s *Service) ListPaginated(limit, offset int) (*ListResult, error) {
 		return nil, err
 	}
 
-	// Batch fetch all tags to avoid N+1 queries
-	noteIDs := make([]string, len(metas))
-	for i, meta := range metas {
-		noteIDs[i] = meta.ID
-	}
-	tagsByNoteID, _ := s.db.GetNoteTagsBatch(noteIDs)
-
-	notes := make([]*Note, 0, len(metas))
-	for _, meta := range metas {
-		var title, preview string
-
-		// Try to use cached encrypted title/preview first (fast path)
-		if meta.EncryptedTitle != nil {
-			if decrypted, err := s.crypto.Decrypt(key, meta.EncryptedTitle); err == nil {
-				title = string(decrypted)
-			}
-		}
-		if meta.EncryptedPreview != nil {
-			if decrypted, err := s.crypto.Decrypt(key, meta.EncryptedPreview); err == nil {
-				preview = string(decrypted)
-			}
-		}
-
-		// Fallback to reading file if cache is empty (for old notes)
-		if title == "" {
-			fullPath := filepath.Join(s.dataDir, meta.CipherPath)
-			ciphertext, err := os.ReadFile(fullPath)
-			if err != nil {
-				continue
-			}
-
-			plaintext, err := s.crypto.Decrypt(key, ciphertext)
-			if err != nil {
-				continue
-			}
-
-			var noteContent NoteContent
-			if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-				continue
-			}
-			title = noteContent.Title
-			preview = s.extractPreview(noteContent.Content)
-		}
-
-		// Get tags from batch result
-		dbTags := tagsByNoteID[meta.ID]
-		tags := make([]Tag, len(dbTags))
-		for i, t := range dbTags {
-			tags[i] = Tag{ID: t.ID, Name: t.Name, Color: t.Color}
-		}
-
-		notes = append(notes, &Note{
-			ID:         meta.ID,
-			Title:      title,
-			Content:    preview,
-			CreatedAt:  formatTime(meta.CreatedAt),
-			UpdatedAt:  formatTime(meta.UpdatedAt),
-			Pinned:     meta.Pinned,
-			DeletedAt:  formatTimePtr(meta.DeletedAt),
-			NotebookID: meta.NotebookID,
-			Tags:       tags,
-		})
+	notes, err := s.ListFromMetas(metas)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ListResult{Notes: notes, Total: total}, nil
 }
 
+// SetNotebook 把笔记移到 notebookID（nil 表示移出笔记本），进出受保护的笔记本时重新加密，
+// 涉及的受保护笔记本需要已解锁
 func (s *Service) SetNotebook(id string, notebookID *string) error {
-	return s.db.SetNoteNotebook(id, notebookID)
+	meta, err := s.db.GetNote(id)
+	if err != nil {
+		return err
+	}
+	return s.moveNote(meta, notebookID)
 }
 
+// SetNotesNotebook 批量移动笔记，规则同 SetNotebook
 func (s *Service) SetNotesNotebook(noteIDs []string, notebookID *string) error {
-	return s.db.SetNotesNotebook(noteIDs, notebookID)
+	newKey, _, err := s.noteKey(notebookID)
+	if err != nil {
+		return err
+	}
+	metas, err := s.db.GetNotesByIDs(noteIDs)
+	if err != nil {
+		return err
+	}
+
+	// 不需要重新加密的笔记在一个事务中移动
+	resolve := s.keyResolver()
+	var unchanged []string
+	for _, meta := range metas {
+		oldKey, _, err := resolve(meta.NotebookID)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(oldKey, newKey) {
+			unchanged = append(unchanged, meta.ID)
+			continue
+		}
+		if err := s.moveNote(meta, notebookID); err != nil {
+			return err
+		}
+	}
+	return s.db.SetNotesNotebook(unchanged, notebookID)
 }
 
 func (s *Service) ListDeleted() ([]*Note, error) {
-	key, err := s.getMasterKey()
-	if err != nil {
+	if _, err := s.getMasterKey(); err != nil {
 		return nil, err
 	}
 
@@ -574,41 +677,21 @@ func (s *Service) ListDeleted() ([]*Note, error) {
 		return nil, err
 	}
 
+	resolve := s.keyResolver()
 	notes := make([]*Note, 0, len(metas))
 	for _, meta := range metas {
-		var title, preview string
-
-		// Try to use cached encrypted title/preview first
-		if meta.EncryptedTitle != nil {
-			if decrypted, err := s.crypto.Decrypt(key, meta.EncryptedTitle); err == nil {
-				title = string(decrypted)
-			}
+		key, _, err := resolve(meta.NotebookID)
+		if errors.Is(err, notebooks.ErrLocked) {
+			notes = append(notes, lockedNote(meta))
+			continue
 		}
-		if meta.EncryptedPreview != nil {
-			if decrypted, err := s.crypto.Decrypt(key, meta.EncryptedPreview); err == nil {
-				preview = string(decrypted)
-			}
+		if err != nil {
+			return nil, err
 		}
 
-		// Fallback to reading file if cache is empty
-		if title == "" {
-			fullPath := filepath.Join(s.dataDir, meta.CipherPath)
-			ciphertext, err := os.ReadFile(fullPath)
-			if err != nil {
-				continue
-			}
-
-			plaintext, err := s.crypto.Decrypt(key, ciphertext)
-			if err != nil {
-				continue
-			}
-
-			var noteContent NoteContent
-			if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-				continue
-			}
-			title = noteContent.Title
-			preview = s.extractPreview(noteContent.Content)
+		title, preview, ok := s.listFields(key, meta)
+		if !ok {
+			continue
 		}
 
 		notes = append(notes, &Note{
@@ -627,7 +710,7 @@ func (s *Service) ListDeleted() ([]*Note, error) {
 }
 
 func (s *Service) GetHistory(noteID string) ([]*Note, error) {
-	key, err := s.getMasterKey()
+	key, err := s.historyKey(noteID)
 	if err != nil {
 		return nil, err
 	}
@@ -645,16 +728,11 @@ func (s *Service) GetHistory(noteID string) ([]*Note, error) {
 			continue
 		}
 
-		plaintext, err := s.crypto.Decrypt(key, ciphertext)
+		noteContent, err := s.decodeContent(key, fieldHistory, noteID, h.ID, ciphertext)
 		if err != nil {
 			continue
 		}
 
-		var noteContent NoteContent
-		if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-			continue
-		}
-
 		notes = append(notes, &Note{
 			ID:        h.ID,
 			Title:     noteContent.Title,
@@ -669,7 +747,7 @@ func (s *Service) GetHistory(noteID string) ([]*Note, error) {
 }
 
 func (s *Service) RestoreFromHistory(noteID, historyID string) (*Note, error) {
-	key, err := s.getMasterKey()
+	key, err := s.historyKey(noteID)
 	if err != nil {
 		return nil, err
 	}
@@ -697,16 +775,11 @@ func (s *Service) RestoreFromHistory(noteID, historyID string) (*Note, error) {
 		return nil, err
 	}
 
-	plaintext, err := s.crypto.Decrypt(key, ciphertext)
+	noteContent, err := s.decodeContent(key, fieldHistory, noteID, historyID, ciphertext)
 	if err != nil {
 		return nil, err
 	}
 
-	var noteContent NoteContent
-	if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-		return nil, err
-	}
-
 	return s.Update(noteID, noteContent.Title, noteContent.Content)
 }
 
@@ -714,116 +787,6 @@ func (s *Service) ReorderNotes(ids []string) error {
 	return s.db.ReorderNotes(ids)
 }
 
-func (s *Service) ImportFromBackup(backupPath, displayKey string) (int, error) {
-	_, err := s.getMasterKey()
-	if err != nil {
-		return 0, err
-	}
-
-	importKey, err := s.crypto.ParseDisplayKey(displayKey)
-	if err != nil {
-		return 0, errors.New("无效的密钥格式")
-	}
-
-	tempDir, err := os.MkdirTemp("", "locknote-import-*")
-	if err != nil {
-		return 0, err
-	}
-	defer os.RemoveAll(tempDir)
-
-	if err := s.extractZip(backupPath, tempDir); err != nil {
-		return 0, err
-	}
-
-	notesDir := filepath.Join(tempDir, "notes")
-	entries, err := os.ReadDir(notesDir)
-	if err != nil {
-		return 0, errors.New("备份文件格式无效：找不到笔记目录")
-	}
-
-	importedCount := 0
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".enc") {
-			continue
-		}
-
-		encPath := filepath.Join(notesDir, entry.Name())
-		ciphertext, err := os.ReadFile(encPath)
-		if err != nil {
-			continue
-		}
-
-		plaintext, err := s.crypto.Decrypt(importKey, ciphertext)
-		if err != nil {
-			continue
-		}
-
-		var noteContent NoteContent
-		if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-			continue
-		}
-
-		_, err = s.Create(noteContent.Title, noteContent.Content)
-		if err != nil {
-			continue
-		}
-		importedCount++
-	}
-
-	if importedCount == 0 {
-		return 0, errors.New("无法导入任何笔记，请检查密钥是否正确")
-	}
-
-	return importedCount, nil
-}
-
-func (s *Service) extractZip(zipPath, destDir string) error {
-	reader, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
-	for _, file := range reader.File {
-		destPath := filepath.Join(destDir, file.Name)
-		cleanDestPath := filepath.Clean(destPath)
-
-		if !strings.HasPrefix(cleanDestPath, filepath.Clean(destDir)+string(os.PathSeparator)) {
-			continue
-		}
-
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(cleanDestPath, 0700)
-			continue
-		}
-
-		if err := os.MkdirAll(filepath.Dir(cleanDestPath), 0700); err != nil {
-			return err
-		}
-
-		destFile, err := os.OpenFile(cleanDestPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-		if err != nil {
-			return err
-		}
-
-		srcFile, err := file.Open()
-		if err != nil {
-			destFile.Close()
-			return err
-		}
-
-		_, err = io.Copy(destFile, srcFile)
-		srcFile.Close()
-		destFile.Close()
-
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 func (s *Service) MigrateOldNotes() (int, error) {
 	key, err := s.getMasterKey()
 	if err != nil {
@@ -877,23 +840,18 @@ func (s *Service) MigrateOldNotes() (int, error) {
 				continue
 			}
 
-			plaintext, err := s.crypto.Decrypt(key, ciphertext)
+			noteContent, err := s.decodeContent(key, fieldContent, meta.ID, "", ciphertext)
 			if err != nil {
 				continue
 			}
 
-			var noteContent NoteContent
-			if err := json.Unmarshal(plaintext, &noteContent); err != nil {
-				continue
-			}
-
-			encryptedTitle, err := s.crypto.Encrypt(key, []byte(noteContent.Title))
+			encryptedTitle, err := s.sealField(key, fieldTitle, meta.ID, "", []byte(noteContent.Title))
 			if err != nil {
 				continue
 			}
 
 			preview := s.extractPreview(noteContent.Content)
-			encryptedPreview, err := s.crypto.Encrypt(key, []byte(preview))
+			encryptedPreview, err := s.sealField(key, fieldPreview, meta.ID, "", []byte(preview))
 			if err != nil {
 				continue
 			}
@@ -0,0 +1,235 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"bytes"
+	"errors"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"os"
+	"path/filepath"
+)
+
+// 受保护笔记本中笔记的正文、标题、预览与历史版本用笔记本密钥代替数据密钥加密，绑定方式不变。
+// 笔记本锁定时列表与 Get 只返回占位，读取内容的操作返回 notebooks.ErrLocked。
+// 这些笔记不进入全文索引，只登记为空文档；标签与附件仍使用数据密钥。
+
+// noteKey 返回笔记本 notebookID 中笔记内容使用的密钥：受保护的笔记本用笔记本密钥，其余用数据密钥。
+// protected 表示笔记本受保护，尚未解锁时返回 notebooks.ErrLocked
+func (s *Service) noteKey(notebookID *string) (key []byte, protected bool, err error) {
+	key, err = s.getMasterKey()
+	if err != nil || notebookID == nil {
+		return key, false, err
+	}
+	nbKey, err := s.notebooks.Key(*notebookID)
+	if err != nil {
+		return nil, errors.Is(err, notebooks.ErrLocked), err
+	}
+	if nbKey == nil {
+		return key, false, nil
+	}
+	return nbKey, true, nil
+}
+
+// keyResolver 返回按笔记本缓存结果的 noteKey，用于批量处理笔记
+func (s *Service) keyResolver() func(notebookID *string) ([]byte, bool, error) {
+	type resolved struct {
+		key       []byte
+		protected bool
+		err       error
+	}
+	cache := make(map[string]resolved)
+	return func(notebookID *string) ([]byte, bool, error) {
+		if notebookID == nil {
+			return s.noteKey(nil)
+		}
+		r, ok := cache[*notebookID]
+		if !ok {
+			r.key, r.protected, r.err = s.noteKey(notebookID)
+			cache[*notebookID] = r
+		}
+		return r.key, r.protected, r.err
+	}
+}
+
+// historyKey 返回笔记 noteID 的历史版本使用的密钥
+func (s *Service) historyKey(noteID string) ([]byte, error) {
+	meta, err := s.db.GetNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := s.noteKey(meta.NotebookID)
+	return key, err
+}
+
+// lockedNote 返回锁定的笔记本中笔记的占位，只有时间等元数据
+func lockedNote(meta *database.NoteMeta) *Note {
+	return &Note{
+		ID:         meta.ID,
+		CreatedAt:  formatTime(meta.CreatedAt),
+		UpdatedAt:  formatTime(meta.UpdatedAt),
+		Pinned:     meta.Pinned,
+		DeletedAt:  formatTimePtr(meta.DeletedAt),
+		NotebookID: meta.NotebookID,
+		Tags:       []Tag{},
+		Locked:     true,
+	}
+}
+
+// readContent 用 key 解密笔记正文。保护笔记本或移动笔记中断时正文可能仍是另一个密钥加密的，
+// 因此失败后再依次尝试数据密钥与已解锁的笔记本密钥
+func (s *Service) readContent(key []byte, meta *database.NoteMeta) (*NoteContent, error) {
+	content, err := s.readNoteContent(key, meta)
+	if err == nil || os.IsNotExist(err) {
+		return content, err
+	}
+	candidates := s.notebooks.UnlockedKeys()
+	if masterKey, err := s.getMasterKey(); err == nil {
+		candidates = append([][]byte{masterKey}, candidates...)
+	}
+	for _, k := range candidates {
+		if bytes.Equal(k, key) {
+			continue
+		}
+		if c, err := s.readNoteContent(k, meta); err == nil {
+			return c, nil
+		}
+	}
+	return nil, err
+}
+
+// listFields 返回列表用的标题与预览，优先使用缓存，缓存缺失时读取正文；正文也无法解密时 ok 为 false
+func (s *Service) listFields(key []byte, meta *database.NoteMeta) (title, preview string, ok bool) {
+	if meta.EncryptedTitle != nil {
+		if decrypted, err := s.openField(key, fieldTitle, meta.ID, "", meta.EncryptedTitle); err == nil {
+			title = string(decrypted)
+		}
+	}
+	if meta.EncryptedPreview != nil {
+		if decrypted, err := s.openField(key, fieldPreview, meta.ID, "", meta.EncryptedPreview); err == nil {
+			preview = string(decrypted)
+		}
+	}
+	if title != "" {
+		return title, preview, true
+	}
+
+	// 旧笔记没有缓存
+	noteContent, err := s.readContent(key, meta)
+	if err != nil {
+		return "", "", false
+	}
+	return noteContent.Title, s.extractPreview(noteContent.Content), true
+}
+
+// updateIndex 更新笔记的全文索引，受保护笔记本中的笔记只登记为空文档
+func (s *Service) updateIndex(protected bool, id, title, content string) error {
+	if protected {
+		return s.db.ReplaceSearchPostings(id, 0, nil)
+	}
+	key, err := s.getMasterKey()
+	if err != nil {
+		return err
+	}
+	return s.indexNote(key, id, title, content)
+}
+
+// moveNote 把笔记移到 notebookID，密钥不同时先重新加密
+func (s *Service) moveNote(meta *database.NoteMeta, notebookID *string) error {
+	oldKey, _, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return err
+	}
+	newKey, protected, err := s.noteKey(notebookID)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(oldKey, newKey) {
+		return s.db.SetNoteNotebook(meta.ID, notebookID)
+	}
+	meta.NotebookID = notebookID
+	return s.resealNote(meta, oldKey, newKey, protected)
+}
+
+// resealNote 把笔记的正文与历史版本从 oldKey 重新加密为 newKey，重新生成标题与预览缓存后写入 meta。
+// 已经是 newKey 加密的对象保持不变，因此中断后可以重复调用；两个密钥都无法解密的对象保持原样
+func (s *Service) resealNote(meta *database.NoteMeta, oldKey, newKey []byte, protected bool) error {
+	if _, err := s.rekeyFile(filepath.Join(s.dataDir, meta.CipherPath), oldKey, newKey, noteAAD(fieldContent, meta.ID, ""), false); err != nil {
+		return err
+	}
+	history, err := s.db.GetNoteHistory(meta.ID)
+	if err != nil {
+		return err
+	}
+	for _, h := range history {
+		if _, err := s.rekeyFile(filepath.Join(s.dataDir, h.CipherPath), oldKey, newKey, noteAAD(fieldHistory, meta.ID, h.ID), false); err != nil {
+			return err
+		}
+	}
+
+	content, err := s.readNoteContent(newKey, meta)
+	if err != nil {
+		// 正文缺失或损坏，只重新加密原有的缓存
+		meta.EncryptedTitle, _ = s.rekeyBlob(meta.EncryptedTitle, oldKey, newKey, noteAAD(fieldTitle, meta.ID, ""), false)
+		meta.EncryptedPreview, _ = s.rekeyBlob(meta.EncryptedPreview, oldKey, newKey, noteAAD(fieldPreview, meta.ID, ""), false)
+		if err := s.db.UpdateNote(meta); err != nil {
+			return err
+		}
+		return s.db.ReplaceSearchPostings(meta.ID, 0, nil)
+	}
+
+	if meta.EncryptedTitle, err = s.sealField(newKey, fieldTitle, meta.ID, "", []byte(content.Title)); err != nil {
+		return err
+	}
+	if meta.EncryptedPreview, err = s.sealField(newKey, fieldPreview, meta.ID, "", []byte(s.extractPreview(content.Content))); err != nil {
+		return err
+	}
+	if err := s.db.UpdateNote(meta); err != nil {
+		return err
+	}
+	return s.updateIndex(protected, meta.ID, content.Title, content.Content)
+}
+
+// SealNotebook 把受保护笔记本 notebookID 中的笔记（包括回收站中的）从数据密钥重新加密为笔记本密钥，
+// 用于保护笔记本之后；笔记本需已解锁，可以重复调用
+func (s *Service) SealNotebook(notebookID string) error {
+	return s.resealNotebook(notebookID, true)
+}
+
+// UnsealNotebook 把受保护笔记本 notebookID 中的笔记重新加密为数据密钥，用于取消保护之前；
+// 笔记本需已解锁，可以重复调用
+func (s *Service) UnsealNotebook(notebookID string) error {
+	return s.resealNotebook(notebookID, false)
+}
+
+func (s *Service) resealNotebook(notebookID string, seal bool) error {
+	masterKey, err := s.getMasterKey()
+	if err != nil {
+		return err
+	}
+	nbKey, protected, err := s.noteKey(&notebookID)
+	if err != nil {
+		return err
+	}
+	if !protected {
+		return errors.New("笔记本未受保护")
+	}
+
+	metas, err := s.db.ListNotebookNotes(notebookID)
+	if err != nil {
+		return err
+	}
+	for _, meta := range metas {
+		if seal {
+			err = s.resealNote(meta, masterKey, nbKey, true)
+		} else {
+			err = s.resealNote(meta, nbKey, masterKey, false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"locknote/internal/database"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Record 是一篇笔记的完整明文：元数据、正文与历史版本，用于在两份数据之间复制笔记
+// （例如从备份中选择性恢复）。Meta 中的 CipherPath 与加密缓存在写入时重新生成。
+type Record struct {
+	Meta    database.NoteMeta
+	Content NoteContent
+	History []HistoryVersion // 从新到旧
+}
+
+// HistoryVersion 是笔记的一个历史版本
+type HistoryVersion struct {
+	CreatedAt time.Time
+	Content   NoteContent
+}
+
+// ReadRecord 解密笔记 id 的正文与全部历史版本，无法解密的历史版本被跳过
+func (s *Service) ReadRecord(id string) (*Record, error) {
+	meta, err := s.db.GetNote(id)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.readContent(key, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{Meta: *meta, Content: *content}
+	history, err := s.db.GetNoteHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range history {
+		ciphertext, err := os.ReadFile(filepath.Join(s.dataDir, h.CipherPath))
+		if err != nil {
+			continue
+		}
+		hc, err := s.decodeContent(key, fieldHistory, id, h.ID, ciphertext)
+		if err != nil {
+			continue
+		}
+		record.History = append(record.History, HistoryVersion{CreatedAt: h.CreatedAt, Content: *hc})
+	}
+	return record, nil
+}
+
+// PutRecord 用当前数据密钥（或 record 所在笔记本的密钥）写入 record，ID 已存在时覆盖该笔记。
+// 被覆盖的版本与 record 中尚不存在的历史版本都保存到历史，超出数量的最旧历史被清理。
+func (s *Service) PutRecord(record *Record) error {
+	meta := record.Meta
+	id := meta.ID
+	key, protected, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return err
+	}
+	existing, err := s.db.GetNote(id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var history []HistoryVersion
+	existingTimes := make(map[int64]bool)
+	if existing != nil {
+		meta.CipherPath = existing.CipherPath
+		meta.SortOrder = existing.SortOrder
+		existingKey, _, err := s.noteKey(existing.NotebookID)
+		if err != nil {
+			return err
+		}
+		if current, err := s.readContent(existingKey, existing); err == nil && *current != record.Content {
+			history = append(history, HistoryVersion{CreatedAt: time.Now(), Content: *current})
+		}
+		existingHistory, err := s.db.GetNoteHistory(id)
+		if err != nil {
+			return err
+		}
+		for _, h := range existingHistory {
+			existingTimes[h.CreatedAt.UnixNano()] = true
+		}
+		if !bytes.Equal(existingKey, key) {
+			// 已有的历史版本随笔记换用 record 所在笔记本的密钥
+			for _, h := range existingHistory {
+				if _, err := s.rekeyFile(filepath.Join(s.dataDir, h.CipherPath), existingKey, key, noteAAD(fieldHistory, id, h.ID), false); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		meta.CipherPath = s.buildCipherPath("notes", id)
+	}
+	for _, v := range record.History {
+		if !existingTimes[v.CreatedAt.UnixNano()] {
+			history = append(history, v)
+		}
+	}
+
+	plaintext, err := json.Marshal(record.Content)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.sealField(key, fieldContent, id, "", plaintext)
+	if err != nil {
+		return err
+	}
+	if meta.EncryptedTitle, err = s.sealField(key, fieldTitle, id, "", []byte(record.Content.Title)); err != nil {
+		return err
+	}
+	preview := s.extractPreview(record.Content.Content)
+	if meta.EncryptedPreview, err = s.sealField(key, fieldPreview, id, "", []byte(preview)); err != nil {
+		return err
+	}
+
+	fullPath := filepath.Join(s.dataDir, meta.CipherPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return err
+	}
+	tempPath := fullPath + ".tmp"
+	if err := os.WriteFile(tempPath, ciphertext, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, fullPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if existing != nil {
+		err = s.db.UpdateNote(&meta)
+	} else if err = s.db.CreateNote(&meta); err == nil && meta.DeletedAt != nil {
+		err = s.db.UpdateNote(&meta)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, v := range history {
+		if err := s.addHistory(key, id, v); err != nil {
+			return err
+		}
+	}
+	if err := s.trimHistory(id); err != nil {
+		return err
+	}
+
+	_ = s.updateIndex(protected, id, record.Content.Title, record.Content.Content)
+	return nil
+}
+
+// addHistory 把 v 加密写入历史目录并插入历史记录
+func (s *Service) addHistory(key []byte, id string, v HistoryVersion) error {
+	plaintext, err := json.Marshal(v.Content)
+	if err != nil {
+		return err
+	}
+	historyID := uuid.New().String()
+	ciphertext, err := s.sealField(key, fieldHistory, id, historyID, plaintext)
+	if err != nil {
+		return err
+	}
+
+	historyPath := s.buildCipherPath("history", historyID)
+	fullPath := filepath.Join(s.dataDir, historyPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(fullPath, ciphertext, 0600); err != nil {
+		return err
+	}
+	if err := s.db.CreateNoteHistory(&database.NoteHistory{
+		ID:         historyID,
+		NoteID:     id,
+		CipherPath: historyPath,
+		CreatedAt:  v.CreatedAt,
+	}); err != nil {
+		os.Remove(fullPath)
+		return err
+	}
+	return nil
+}
+
+// trimHistory 只保留最新的 historyMaxCount 个历史版本
+func (s *Service) trimHistory(id string) error {
+	history, err := s.db.GetNoteHistory(id)
+	if err != nil {
+		return err
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].CreatedAt.After(history[j].CreatedAt) })
+	for i := historyMaxCount; i < len(history); i++ {
+		os.Remove(filepath.Join(s.dataDir, history[i].CipherPath))
+		if err := s.db.DeleteSingleHistory(history[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// RekeyResult 是重新加密的统计
+type RekeyResult struct {
+	Notes   int `json:"notes"`
+	History int `json:"history"`
+	Skipped int `json:"skipped"` // 用新旧密钥都无法解密（已损坏）而跳过的对象
+}
+
+// Rekey 把所有笔记正文、标题与预览以及历史版本从 oldKey 重新加密为 newKey，并绑定各自的附加数据。
+// 已经能用 newKey 按绑定方式解密的对象视为已完成，因此中断后可以重复调用继续。
+// 没有绑定附加数据的旧格式不被接受，计入 Skipped，见 UpgradeFormat。
+// 受保护笔记本中用笔记本密钥加密的笔记不受数据密钥影响，保持原样且不计入 Skipped。
+func (s *Service) Rekey(oldKey, newKey []byte) (*RekeyResult, error) {
+	return s.rekey(oldKey, newKey, false)
+}
+
+// UpgradeFormat 把旧格式的笔记与历史版本升级为用 key 加密并绑定附加数据的当前格式。
+// 只在数据版本低于当前版本时调用，之后出现的旧格式数据可能是被替换进来的，不再接受
+func (s *Service) UpgradeFormat(key []byte) (*RekeyResult, error) {
+	return s.rekey(key, key, true)
+}
+
+func (s *Service) rekey(oldKey, newKey []byte, legacy bool) (*RekeyResult, error) {
+	result := &RekeyResult{}
+
+	metas, err := s.db.ListNotes(true)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := s.notebooks.ProtectedIDs()
+	if err != nil {
+		return nil, err
+	}
+	protectedNotes := make(map[string]bool)
+	for _, meta := range metas {
+		if meta.NotebookID != nil && protected[*meta.NotebookID] {
+			protectedNotes[meta.ID] = true
+		}
+	}
+
+	for _, meta := range metas {
+		ok, err := s.rekeyFile(filepath.Join(s.dataDir, meta.CipherPath), oldKey, newKey, noteAAD(fieldContent, meta.ID, ""), legacy)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			if !protectedNotes[meta.ID] {
+				result.Skipped++
+			}
+			continue
+		}
+
+		title, titleOK := s.rekeyBlob(meta.EncryptedTitle, oldKey, newKey, noteAAD(fieldTitle, meta.ID, ""), legacy)
+		preview, previewOK := s.rekeyBlob(meta.EncryptedPreview, oldKey, newKey, noteAAD(fieldPreview, meta.ID, ""), legacy)
+		if !titleOK || !previewOK {
+			// 标题与预览可以从正文重新生成
+			content, err := s.readNoteContent(newKey, meta)
+			if err != nil {
+				return result, err
+			}
+			if title, err = s.sealField(newKey, fieldTitle, meta.ID, "", []byte(content.Title)); err != nil {
+				return result, err
+			}
+			if preview, err = s.sealField(newKey, fieldPreview, meta.ID, "", []byte(s.extractPreview(content.Content))); err != nil {
+				return result, err
+			}
+		}
+		meta.EncryptedTitle = title
+		meta.EncryptedPreview = preview
+		if err := s.db.UpdateNote(meta); err != nil {
+			return result, err
+		}
+		result.Notes++
+	}
+
+	history, err := s.db.ListAllNoteHistory()
+	if err != nil {
+		return result, err
+	}
+	for _, h := range history {
+		ok, err := s.rekeyFile(filepath.Join(s.dataDir, h.CipherPath), oldKey, newKey, noteAAD(fieldHistory, h.NoteID, h.ID), legacy)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			if !protectedNotes[h.NoteID] {
+				result.Skipped++
+			}
+			continue
+		}
+		result.History++
+	}
+
+	return result, nil
+}
+
+var errUndecryptable = errors.New("cannot decrypt with either key")
+
+// reseal 返回用 newKey 加密并绑定 aad 的 data；data 已经如此时 changed 为 false。
+// 同时接受 oldKey 加密的数据；legacy 为 true 时还接受没有绑定附加数据的旧格式，只用于升级数据格式。
+func (s *Service) reseal(data, oldKey, newKey, aad []byte, legacy bool) (out []byte, changed bool, err error) {
+	if _, err := s.crypto.DecryptWithAAD(newKey, data, aad); err == nil {
+		return data, false, nil
+	}
+
+	plaintext, err := s.crypto.DecryptWithAAD(oldKey, data, aad)
+	if err != nil {
+		if !legacy {
+			return nil, false, errUndecryptable
+		}
+		// 绑定附加数据之前的格式
+		if plaintext, err = s.crypto.Decrypt(newKey, data); err != nil {
+			if plaintext, err = s.crypto.Decrypt(oldKey, data); err != nil {
+				return nil, false, errUndecryptable
+			}
+		}
+	}
+
+	out, err = s.crypto.EncryptWithAAD(newKey, plaintext, aad)
+	return out, true, err
+}
+
+// rekeyBlob 重新加密数据库中的单个字段，无法解密时返回 false
+func (s *Service) rekeyBlob(data, oldKey, newKey, aad []byte, legacy bool) ([]byte, bool) {
+	if data == nil {
+		return nil, false
+	}
+	out, _, err := s.reseal(data, oldKey, newKey, aad, legacy)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// rekeyFile 原子地重新加密单个文件；文件缺失或用新旧密钥都无法解密时返回 false
+func (s *Service) rekeyFile(path string, oldKey, newKey, aad []byte, legacy bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	ciphertext, changed, err := s.reseal(data, oldKey, newKey, aad, legacy)
+	if err != nil {
+		if errors.Is(err, errUndecryptable) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !changed {
+		return true, nil
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, ciphertext, 0600); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return false, err
+	}
+	return true, nil
+}
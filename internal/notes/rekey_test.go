@@ -0,0 +1,67 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"errors"
+	"locknote/internal/crypto"
+	"testing"
+)
+
+func TestReseal(t *testing.T) {
+	c := crypto.NewService()
+	s := &Service{crypto: c}
+	oldKey, _ := c.GenerateKey()
+	newKey, _ := c.GenerateKey()
+	aad := noteAAD(fieldContent, "note-1", "")
+
+	seal := func(key, aad []byte) []byte {
+		data, err := c.EncryptWithAAD(key, []byte("body"), aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		legacy  bool
+		changed bool
+		wantErr bool
+	}{
+		{name: "already new key", data: seal(newKey, aad)},
+		{name: "old key", data: seal(oldKey, aad), changed: true},
+		{name: "other note", data: seal(oldKey, noteAAD(fieldContent, "note-2", "")), wantErr: true},
+		{name: "other field", data: seal(newKey, noteAAD(fieldTitle, "note-1", "")), wantErr: true},
+		{name: "unbound", data: seal(oldKey, nil), wantErr: true},
+		{name: "unbound while upgrading", data: seal(oldKey, nil), legacy: true, changed: true},
+		{name: "unbound new key while upgrading", data: seal(newKey, nil), legacy: true, changed: true},
+		{name: "unknown key while upgrading", data: seal(make([]byte, 32), nil), legacy: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, changed, err := s.reseal(tt.data, oldKey, newKey, aad, tt.legacy)
+			if tt.wantErr {
+				if !errors.Is(err, errUndecryptable) {
+					t.Fatalf("expected errUndecryptable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.changed {
+				t.Fatalf("changed = %v, want %v", changed, tt.changed)
+			}
+			plaintext, err := c.DecryptWithAAD(newKey, out, aad)
+			if err != nil {
+				t.Fatalf("result is not bound to the note: %v", err)
+			}
+			if string(plaintext) != "body" {
+				t.Fatalf("got %q", plaintext)
+			}
+		})
+	}
+}
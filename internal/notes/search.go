@@ -0,0 +1,645 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"bytes"
+	"locknote/internal/database"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 全文索引：词条先用从数据密钥派生的子密钥做 HMAC，再写入 SQLite，
+// 数据库中不会出现任何明文词条。
+//
+// 词条类型：
+//
+//	w:<word>   拉丁文单词
+//	p:<prefix> 拉丁文单词前缀（用于 foo* 查询）
+//	u:<char>   中日韩单字
+//	b:<pair>   中日韩相邻二字
+const (
+	searchIndexPurpose = "locknote-search-index-v1"
+	searchKeyCheckKey  = "key_check"
+	searchKeyCheckData = "LOCKNOTE_SEARCH_CHECK"
+
+	searchMinPrefixLen = 2
+	searchMaxPrefixLen = 16
+	searchTitleWeight  = 3
+	searchSnippetRunes = 60
+	searchDefaultLimit = 50
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type SearchOptions struct {
+	Limit      int     `json:"limit"`
+	Offset     int     `json:"offset"`
+	NotebookID *string `json:"notebookId,omitempty"`
+}
+
+type SearchHit struct {
+	Note    *Note   `json:"note"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchResult struct {
+	Hits  []*SearchHit `json:"hits"`
+	Total int          `json:"total"`
+}
+
+type searchUnit struct {
+	text string
+	cjk  bool
+}
+
+// searchClause 是查询中的一个条件，多个条件之间为 AND 关系
+type searchClause struct {
+	terms  []string
+	needle string // 规范化后的原文，用于短语校验与摘要定位
+	verify bool   // 仅靠索引无法确定命中，需要解密正文校验
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// splitSearchUnits 把文本切分为拉丁单词与中日韩连续片段
+func splitSearchUnits(text string) []searchUnit {
+	var units []searchUnit
+	var buf []rune
+	bufCJK := false
+
+	flush := func() {
+		if len(buf) > 0 {
+			units = append(units, searchUnit{text: string(buf), cjk: bufCJK})
+			buf = buf[:0]
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			if !bufCJK {
+				flush()
+				bufCJK = true
+			}
+			buf = append(buf, r)
+		case isWordRune(r):
+			if bufCJK {
+				flush()
+				bufCJK = false
+			}
+			buf = append(buf, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return units
+}
+
+// normalizeSearchText 转为小写并把所有分隔符折叠为单个空格，用于短语校验
+func normalizeSearchText(text string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range text {
+		if isWordRune(r) {
+			b.WriteRune(unicode.ToLower(r))
+			space = false
+		} else if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func prefixTerm(word string) string {
+	runes := []rune(word)
+	if len(runes) > searchMaxPrefixLen {
+		runes = runes[:searchMaxPrefixLen]
+	}
+	return "p:" + string(runes)
+}
+
+// indexTerms 计算文本中每个词条的词频，并返回文档长度
+func indexTerms(text string, weight int, tf map[string]int) int {
+	length := 0
+	for _, u := range splitSearchUnits(text) {
+		runes := []rune(u.text)
+		if u.cjk {
+			for i, r := range runes {
+				tf["u:"+string(r)] += weight
+				if i+1 < len(runes) {
+					tf["b:"+string(runes[i:i+2])] += weight
+				}
+			}
+			length += len(runes)
+			continue
+		}
+
+		tf["w:"+u.text] += weight
+		for n := searchMinPrefixLen; n <= len(runes) && n <= searchMaxPrefixLen; n++ {
+			tf["p:"+string(runes[:n])] += weight
+		}
+		length++
+	}
+	return length
+}
+
+// parseSearchQuery 解析查询：空格分隔的词为 AND，"..." 为短语，词尾 * 为前缀匹配。
+// 索引只能匹配整词或前缀，因此最后一个不在引号中的词也按前缀匹配，便于边输入边搜索
+func parseSearchQuery(query string) []searchClause {
+	var raw []string
+	var phrases []bool
+	for {
+		start := strings.IndexByte(query, '"')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(query[start+1:], '"')
+		if end < 0 {
+			break
+		}
+		for _, f := range strings.Fields(query[:start]) {
+			raw = append(raw, f)
+			phrases = append(phrases, false)
+		}
+		raw = append(raw, query[start+1:start+1+end])
+		phrases = append(phrases, true)
+		query = query[start+1+end+1:]
+	}
+	for _, f := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		raw = append(raw, f)
+		phrases = append(phrases, false)
+	}
+
+	var clauses []searchClause
+	for i, text := range raw {
+		prefix := !phrases[i] && strings.HasSuffix(text, "*")
+		if prefix {
+			text = strings.TrimRight(text, "*")
+		}
+		typing := !phrases[i] && !prefix && i == len(raw)-1
+
+		units := splitSearchUnits(text)
+		if len(units) == 0 {
+			continue
+		}
+
+		clause := searchClause{
+			needle: normalizeSearchText(text),
+			verify: len(units) > 1,
+		}
+		valid := true
+		for j, u := range units {
+			runes := []rune(u.text)
+			switch {
+			case u.cjk && len(runes) == 1:
+				clause.terms = append(clause.terms, "u:"+u.text)
+			case u.cjk:
+				for k := 0; k+1 < len(runes); k++ {
+					clause.terms = append(clause.terms, "b:"+string(runes[k:k+2]))
+				}
+				if len(runes) > 2 {
+					clause.verify = true
+				}
+			case typing && j == len(units)-1 && len(runes) < searchMinPrefixLen:
+				clause.terms = append(clause.terms, "w:"+u.text)
+			case (prefix || typing) && j == len(units)-1:
+				if len(runes) < searchMinPrefixLen {
+					valid = false
+					break
+				}
+				clause.terms = append(clause.terms, prefixTerm(u.text))
+				if len(runes) > searchMaxPrefixLen {
+					clause.verify = true
+				}
+			default:
+				clause.terms = append(clause.terms, "w:"+u.text)
+			}
+		}
+		if valid {
+			clauses = append(clauses, clause)
+		}
+	}
+
+	return clauses
+}
+
+func (s *Service) searchKey(key []byte) []byte {
+	return s.crypto.DeriveSubKey(key, searchIndexPurpose)
+}
+
+func (s *Service) hashTerm(indexKey []byte, term string) []byte {
+	return s.crypto.HMAC(indexKey, []byte(term))
+}
+
+func (s *Service) indexNote(key []byte, id, title, content string) error {
+	tf := make(map[string]int)
+	length := indexTerms(title, searchTitleWeight, tf)
+	length += indexTerms(content, 1, tf)
+
+	indexKey := s.searchKey(key)
+	postings := make([]database.SearchPosting, 0, len(tf))
+	for term, n := range tf {
+		postings = append(postings, database.SearchPosting{
+			Token: s.hashTerm(indexKey, term),
+			TF:    n,
+		})
+	}
+
+	return s.db.ReplaceSearchPostings(id, length, postings)
+}
+
+func (s *Service) readNoteContent(key []byte, meta *database.NoteMeta) (*NoteContent, error) {
+	ciphertext, err := os.ReadFile(filepath.Join(s.dataDir, meta.CipherPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.decodeContent(key, fieldContent, meta.ID, "", ciphertext)
+}
+
+// RebuildSearchIndex 清空并重建全文索引，适用于导入、恢复备份之后
+func (s *Service) RebuildSearchIndex() (int, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return 0, err
+	}
+
+	metas, err := s.db.ListNotes(true)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.db.ClearSearchIndex(); err != nil {
+		return 0, err
+	}
+
+	protected, err := s.notebooks.ProtectedIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for _, meta := range metas {
+		var noteContent *NoteContent
+		if meta.NotebookID == nil || !protected[*meta.NotebookID] {
+			noteContent, err = s.readNoteContent(key, meta)
+		}
+		if noteContent == nil || err != nil {
+			// 受保护或无法解密的笔记也登记为空文档，避免每次解锁都触发重建
+			if err := s.db.ReplaceSearchPostings(meta.ID, 0, nil); err != nil {
+				return indexed, err
+			}
+			continue
+		}
+		if err := s.indexNote(key, meta.ID, noteContent.Title, noteContent.Content); err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+
+	check := s.crypto.HMAC(s.searchKey(key), []byte(searchKeyCheckData))
+	if err := s.db.SetSearchMeta(searchKeyCheckKey, check); err != nil {
+		return indexed, err
+	}
+
+	return indexed, nil
+}
+
+// EnsureSearchIndex 在索引缺失、不完整或由其他数据密钥生成时重建索引
+func (s *Service) EnsureSearchIndex() error {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return err
+	}
+
+	check, err := s.db.GetSearchMeta(searchKeyCheckKey)
+	if err != nil {
+		return err
+	}
+	expected := s.crypto.HMAC(s.searchKey(key), []byte(searchKeyCheckData))
+
+	if bytes.Equal(check, expected) {
+		metas, err := s.db.ListNotes(true)
+		if err != nil {
+			return err
+		}
+		lengths, err := s.db.GetSearchDocLengths()
+		if err != nil {
+			return err
+		}
+		if len(lengths) == len(metas) {
+			return nil
+		}
+	}
+
+	_, err = s.RebuildSearchIndex()
+	return err
+}
+
+// Search 在加密索引上执行全文搜索，返回按相关度排序的结果与摘要
+func (s *Service) Search(query string, opts SearchOptions) (*SearchResult, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = searchDefaultLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	clauses := parseSearchQuery(query)
+	if len(clauses) == 0 {
+		return &SearchResult{Hits: []*SearchHit{}, Total: 0}, nil
+	}
+
+	hits, err := s.matchQuery(key, clauses, opts.NotebookID)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(hits)
+	if opts.Offset >= total {
+		return &SearchResult{Hits: []*SearchHit{}, Total: total}, nil
+	}
+	end := opts.Offset + opts.Limit
+	if end > total {
+		end = total
+	}
+	page := hits[opts.Offset:end]
+
+	pageIDs := make([]string, len(page))
+	for i, h := range page {
+		pageIDs[i] = h.meta.ID
+	}
+	tagsByNoteID, _ := s.db.GetNoteTagsBatch(pageIDs)
+
+	needles := make([]string, 0, len(clauses))
+	for _, c := range clauses {
+		needles = append(needles, c.needle)
+		if fields := strings.Fields(c.needle); len(fields) > 1 {
+			needles = append(needles, fields[0])
+		}
+	}
+
+	result := &SearchResult{Hits: make([]*SearchHit, 0, len(page)), Total: total}
+	for _, h := range page {
+		content := h.content
+		if content == nil {
+			content, err = s.readNoteContent(key, h.meta)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		dbTags := tagsByNoteID[h.meta.ID]
+		tags := s.noteTags(key, dbTags)
+
+		result.Hits = append(result.Hits, &SearchHit{
+			Note: &Note{
+				ID:         h.meta.ID,
+				Title:      content.Title,
+				Content:    s.extractPreview(content.Content),
+				CreatedAt:  formatTime(h.meta.CreatedAt),
+				UpdatedAt:  formatTime(h.meta.UpdatedAt),
+				Pinned:     h.meta.Pinned,
+				DeletedAt:  formatTimePtr(h.meta.DeletedAt),
+				NotebookID: h.meta.NotebookID,
+				Tags:       tags,
+			},
+			Score:   h.score,
+			Snippet: buildSnippet(content.Content, needles),
+		})
+	}
+
+	return result, nil
+}
+
+type scoredNote struct {
+	meta    *database.NoteMeta
+	score   float64
+	content *NoteContent
+}
+
+// matchQuery 返回满足所有查询条件的未删除笔记，按相关度降序排列
+func (s *Service) matchQuery(key []byte, clauses []searchClause, notebookID *string) ([]scoredNote, error) {
+	indexKey := s.searchKey(key)
+	postingsByTerm := make(map[string]map[string]int)
+	for _, c := range clauses {
+		for _, term := range c.terms {
+			if _, ok := postingsByTerm[term]; ok {
+				continue
+			}
+			postings, err := s.db.GetSearchPostings(s.hashTerm(indexKey, term))
+			if err != nil {
+				return nil, err
+			}
+			postingsByTerm[term] = postings
+		}
+	}
+
+	// 从最短的倒排列表开始求交集
+	lists := make([]map[string]int, 0, len(postingsByTerm))
+	for _, p := range postingsByTerm {
+		lists = append(lists, p)
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	candidates := make([]string, 0, len(lists[0]))
+	for id := range lists[0] {
+		matched := true
+		for _, p := range lists[1:] {
+			if _, ok := p[id]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			candidates = append(candidates, id)
+		}
+	}
+
+	metas, err := s.db.GetNotesByIDs(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	needsVerify := false
+	for _, c := range clauses {
+		if c.verify {
+			needsVerify = true
+			break
+		}
+	}
+
+	docLengths, err := s.db.GetSearchDocLengths()
+	if err != nil {
+		return nil, err
+	}
+	totalDocs := len(docLengths)
+	avgLength := 0.0
+	for _, l := range docLengths {
+		avgLength += float64(l)
+	}
+	if totalDocs > 0 {
+		avgLength /= float64(totalDocs)
+	}
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	hits := make([]scoredNote, 0, len(metas))
+	for _, meta := range metas {
+		if meta.DeletedAt != nil {
+			continue
+		}
+		if notebookID != nil && (meta.NotebookID == nil || *meta.NotebookID != *notebookID) {
+			continue
+		}
+
+		var content *NoteContent
+		if needsVerify {
+			content, err = s.readNoteContent(key, meta)
+			if err != nil {
+				continue
+			}
+			haystack := normalizeSearchText(content.Title + "\n" + content.Content)
+			ok := true
+			for _, c := range clauses {
+				if c.verify && !strings.Contains(haystack, c.needle) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		docLen := float64(docLengths[meta.ID])
+		score := 0.0
+		for _, postings := range postingsByTerm {
+			tf := float64(postings[meta.ID])
+			df := float64(len(postings))
+			idf := math.Log(1 + (float64(totalDocs)-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*docLen/avgLength))
+		}
+
+		hits = append(hits, scoredNote{meta: meta, score: score, content: content})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].meta.UpdatedAt.After(hits[j].meta.UpdatedAt)
+	})
+
+	return hits, nil
+}
+
+// MatchNoteIDs 返回匹配查询的全部笔记 ID（按相关度排序），供智能视图等场景复用索引
+func (s *Service) MatchNoteIDs(query string) ([]string, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	clauses := parseSearchQuery(query)
+	if len(clauses) == 0 {
+		return []string{}, nil
+	}
+
+	hits, err := s.matchQuery(key, clauses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.meta.ID
+	}
+	return ids, nil
+}
+
+// buildSnippet 截取正文中第一个命中位置附近的片段
+func buildSnippet(content string, needles []string) string {
+	runes := []rune(content)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		if isWordRune(r) {
+			lower[i] = unicode.ToLower(r)
+		} else {
+			lower[i] = ' '
+		}
+	}
+
+	pos := -1
+	for _, needle := range needles {
+		if idx := indexRunes(lower, []rune(needle)); idx >= 0 && (pos < 0 || idx < pos) {
+			pos = idx
+		}
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	start := pos - searchSnippetRunes/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + searchSnippetRunes*2
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+func indexRunes(haystack, needle []rune) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j, r := range needle {
+			if haystack[i+j] != r {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
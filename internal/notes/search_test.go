@@ -0,0 +1,52 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		terms [][]string
+	}{
+		{"", nil},
+		{"hello", [][]string{{"p:hello"}}},
+		{"hello wor", [][]string{{"w:hello"}, {"p:wor"}}},
+		{"Hello World", [][]string{{"w:hello"}, {"p:world"}}},
+		{"hello w", [][]string{{"w:hello"}, {"w:w"}}},
+		{"wor* hello", [][]string{{"p:wor"}, {"p:hello"}}},
+		{"w* hello", [][]string{{"p:hello"}}},
+		{`hello "big world"`, [][]string{{"w:hello"}, {"w:big", "w:world"}}},
+		{`"big world" hello`, [][]string{{"w:big", "w:world"}, {"p:hello"}}},
+		{"笔记", [][]string{{"b:笔记"}}},
+		{"加密 笔", [][]string{{"b:加密"}, {"u:笔"}}},
+		{"abcdefghijklmnopqrst", [][]string{{"p:abcdefghijklmnop"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got [][]string
+			for _, c := range parseSearchQuery(tt.query) {
+				got = append(got, c.terms)
+			}
+			if !reflect.DeepEqual(got, tt.terms) {
+				t.Fatalf("terms = %v, want %v", got, tt.terms)
+			}
+		})
+	}
+}
+
+func TestIndexTermsMatchesPrefixQuery(t *testing.T) {
+	tf := make(map[string]int)
+	indexTerms("Encrypted notebooks", 1, tf)
+	for _, c := range parseSearchQuery("encrypted note") {
+		for _, term := range c.terms {
+			if tf[term] == 0 {
+				t.Fatalf("term %q is not in the index", term)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package notes
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"os"
+	"path/filepath"
+)
+
+// ObjectState 是单个密文对象的检查结果
+type ObjectState int
+
+const (
+	StateOK            ObjectState = iota
+	StateMissing                   // 密文文件不存在
+	StateUndecryptable             // 无法用当前数据密钥解密，或解密后内容无效
+	StateLegacy                    // 能解密，但仍是没有绑定附加数据的旧格式
+	StateLocked                    // 在锁定的笔记本中，无法检查
+)
+
+// NoteCheck 是单篇笔记的检查结果
+type NoteCheck struct {
+	Content       ObjectState
+	CacheMismatch bool // 标题或预览缓存缺失、无法解密或与正文不一致
+}
+
+// openChecked 按绑定方式解密，失败时再尝试旧格式
+func (s *Service) openChecked(key, data, aad []byte) ([]byte, ObjectState) {
+	if plaintext, err := s.crypto.DecryptWithAAD(key, data, aad); err == nil {
+		return plaintext, StateOK
+	}
+	if plaintext, err := s.crypto.Decrypt(key, data); err == nil {
+		return plaintext, StateLegacy
+	}
+	return nil, StateUndecryptable
+}
+
+func (s *Service) readChecked(key []byte, path string, aad []byte) (*NoteContent, ObjectState, error) {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, StateMissing, nil
+		}
+		return nil, StateOK, err
+	}
+
+	plaintext, state := s.openChecked(key, data, aad)
+	if state == StateUndecryptable {
+		return nil, state, nil
+	}
+	var content NoteContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return nil, StateUndecryptable, nil
+	}
+	return &content, state, nil
+}
+
+// CheckNote 检查笔记正文能否解密，以及标题与预览缓存是否与正文一致
+func (s *Service) CheckNote(meta *database.NoteMeta) (*NoteCheck, error) {
+	key, protected, err := s.noteKey(meta.NotebookID)
+	if errors.Is(err, notebooks.ErrLocked) {
+		return &NoteCheck{Content: StateLocked}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, state, err := s.readChecked(key, meta.CipherPath, noteAAD(fieldContent, meta.ID, ""))
+	if err != nil {
+		return nil, err
+	}
+	if state == StateUndecryptable && protected {
+		// 保护笔记本时中断，仍是数据密钥加密的笔记可以读取，再次保护时会重新加密
+		masterKey, err := s.getMasterKey()
+		if err != nil {
+			return nil, err
+		}
+		if c, st, err := s.readChecked(masterKey, meta.CipherPath, noteAAD(fieldContent, meta.ID, "")); err == nil && st != StateUndecryptable {
+			key, content, state = masterKey, c, st
+		}
+	}
+	check := &NoteCheck{Content: state}
+	if content == nil {
+		return check, nil
+	}
+
+	title, titleState := s.openChecked(key, meta.EncryptedTitle, noteAAD(fieldTitle, meta.ID, ""))
+	preview, previewState := s.openChecked(key, meta.EncryptedPreview, noteAAD(fieldPreview, meta.ID, ""))
+	check.CacheMismatch = titleState == StateUndecryptable || previewState == StateUndecryptable ||
+		string(title) != content.Title || string(preview) != s.extractPreview(content.Content)
+	if titleState == StateLegacy || previewState == StateLegacy {
+		check.Content = StateLegacy
+	}
+	return check, nil
+}
+
+// CheckHistory 检查历史版本能否解密，所属笔记不存在时按数据密钥检查
+func (s *Service) CheckHistory(h *database.NoteHistory) (ObjectState, error) {
+	key, err := s.historyKey(h.NoteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		key, err = s.getMasterKey()
+	}
+	if errors.Is(err, notebooks.ErrLocked) {
+		return StateLocked, nil
+	}
+	if err != nil {
+		return StateOK, err
+	}
+	_, state, err := s.readChecked(key, h.CipherPath, noteAAD(fieldHistory, h.NoteID, h.ID))
+	if err == nil && state == StateUndecryptable {
+		// 同 CheckNote，保护笔记本中断时历史版本可能仍是数据密钥加密的
+		if masterKey, err := s.getMasterKey(); err == nil && !bytes.Equal(masterKey, key) {
+			if _, st, err := s.readChecked(masterKey, h.CipherPath, noteAAD(fieldHistory, h.NoteID, h.ID)); err == nil && st != StateUndecryptable {
+				return st, nil
+			}
+		}
+	}
+	return state, err
+}
+
+// RefreshCache 从正文重新生成笔记的标题与预览缓存，并更新全文索引
+func (s *Service) RefreshCache(meta *database.NoteMeta) error {
+	key, protected, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return err
+	}
+
+	content, err := s.readContent(key, meta)
+	if err != nil {
+		return err
+	}
+	if meta.EncryptedTitle, err = s.sealField(key, fieldTitle, meta.ID, "", []byte(content.Title)); err != nil {
+		return err
+	}
+	if meta.EncryptedPreview, err = s.sealField(key, fieldPreview, meta.ID, "", []byte(s.extractPreview(content.Content))); err != nil {
+		return err
+	}
+	if err := s.db.UpdateNote(meta); err != nil {
+		return err
+	}
+
+	_ = s.updateIndex(protected, meta.ID, content.Title, content.Content)
+	return nil
+}
+
+// RecoverFromHistory 在笔记正文丢失或损坏时，用最新一个能解密的历史版本重写正文。
+// 没有可用的历史版本时返回 false。
+func (s *Service) RecoverFromHistory(meta *database.NoteMeta) (bool, error) {
+	key, _, err := s.noteKey(meta.NotebookID)
+	if err != nil {
+		return false, err
+	}
+
+	history, err := s.db.GetNoteHistory(meta.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, h := range history {
+		content, state, err := s.readChecked(key, h.CipherPath, noteAAD(fieldHistory, meta.ID, h.ID))
+		if err != nil {
+			return false, err
+		}
+		if content == nil || state == StateUndecryptable {
+			continue
+		}
+
+		plaintext, err := json.Marshal(content)
+		if err != nil {
+			return false, err
+		}
+		ciphertext, err := s.sealField(key, fieldContent, meta.ID, "", plaintext)
+		if err != nil {
+			return false, err
+		}
+
+		fullPath := filepath.Join(s.dataDir, meta.CipherPath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+			return false, err
+		}
+		tempPath := fullPath + ".tmp"
+		if err := os.WriteFile(tempPath, ciphertext, 0600); err != nil {
+			return false, err
+		}
+		if err := os.Rename(tempPath, fullPath); err != nil {
+			os.Remove(tempPath)
+			return false, err
+		}
+
+		return true, s.RefreshCache(meta)
+	}
+	return false, nil
+}
@@ -0,0 +1,192 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"time"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// 把笔记的 Markdown 渲染为可以单独打开、分享或打印为 PDF 的 HTML 文档：
+// CommonMark 与 GFM（表格、删除线、任务列表、自动链接），代码块按语言高亮，样式全部内联。
+// 笔记中的原始 HTML 不输出，javascript: 等危险链接被清空。
+
+// codeStyle 是代码高亮使用的 chroma 样式
+const codeStyle = "github"
+
+// URLResolver 改写链接与图片的地址，image 表示是否为图片。
+// 返回空字符串时去掉链接或图片，只保留其中的文字
+type URLResolver func(dest string, image bool) string
+
+// Markdown 把 src 渲染为 HTML 片段，resolve 为 nil 时不改写地址
+func Markdown(src string, resolve URLResolver) (template.HTML, error) {
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle(codeStyle),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(false)),
+			),
+		),
+	)
+	if resolve != nil {
+		md.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&urlTransformer{resolve: resolve}, 100)))
+	}
+
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// urlTransformer 在渲染前改写链接与图片的地址
+type urlTransformer struct {
+	resolve URLResolver
+}
+
+func (t *urlTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var unwrap []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Link:
+			if node.Destination = []byte(t.resolve(string(node.Destination), false)); len(node.Destination) == 0 {
+				unwrap = append(unwrap, node)
+			}
+		case *ast.Image:
+			if node.Destination = []byte(t.resolve(string(node.Destination), true)); len(node.Destination) == 0 {
+				unwrap = append(unwrap, node)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// 去掉地址为空的链接与图片，子节点（文字、图片的替代文本）移到原位置
+	for _, n := range unwrap {
+		parent := n.Parent()
+		for child := n.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			parent.InsertBefore(parent, n, child)
+			child = next
+		}
+		parent.RemoveChild(parent, n)
+	}
+}
+
+// Note 是文档中的一篇笔记
+type Note struct {
+	ID       string
+	Title    string
+	Created  time.Time
+	Updated  time.Time
+	Tags     []string
+	Notebook string
+	Body     template.HTML // Markdown 渲染后的正文
+}
+
+// Document 生成包含 notes 的完整 HTML 文档；toc 为 true 时在开头生成目录，每篇笔记从新的一页开始打印
+func Document(title string, notes []Note, toc bool) ([]byte, error) {
+	var buf bytes.Buffer
+	err := documentTemplate.Execute(&buf, struct {
+		Title string
+		Notes []Note
+		TOC   bool
+		CSS   template.CSS
+	}{title, notes, toc, documentCSS})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var documentTemplate = template.Must(template.New("document").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="generator" content="LockNote">
+<title>{{.Title}}</title>
+<style>{{.CSS}}</style>
+</head>
+<body>
+{{- if .TOC}}
+<nav class="toc">
+<h1>{{.Title}}</h1>
+<ol>
+{{- range .Notes}}
+<li><a href="#note-{{.ID}}">{{if .Title}}{{.Title}}{{else}}无标题{{end}}</a></li>
+{{- end}}
+</ol>
+</nav>
+{{- end}}
+{{- range .Notes}}
+<article id="note-{{.ID}}">
+<header>
+<h1 class="title">{{if .Title}}{{.Title}}{{else}}无标题{{end}}</h1>
+<p class="meta">
+{{- if .Notebook}}<span>{{.Notebook}}</span> · {{end -}}
+<span>创建于 {{date .Created}}</span> · <span>更新于 {{date .Updated}}</span>
+{{- range .Tags}} <span class="tag">#{{.}}</span>{{end -}}
+</p>
+</header>
+{{.Body}}
+</article>
+{{- end}}
+</body>
+</html>
+`))
+
+const documentCSS = template.CSS(`
+:root { color-scheme: light; }
+body { max-width: 820px; margin: 0 auto; padding: 32px 24px; color: #1f2937; background: #fff;
+  font: 16px/1.7 -apple-system, BlinkMacSystemFont, "Segoe UI", "PingFang SC", "Hiragino Sans GB", "Microsoft YaHei", "Noto Sans CJK SC", sans-serif; }
+a { color: #2563eb; text-decoration: none; }
+a:hover { text-decoration: underline; }
+h1, h2, h3, h4, h5, h6 { line-height: 1.3; margin: 1.4em 0 0.6em; }
+h1 { font-size: 1.8em; } h2 { font-size: 1.45em; border-bottom: 1px solid #e5e7eb; padding-bottom: .2em; }
+h3 { font-size: 1.2em; }
+p, ul, ol, blockquote, pre, table { margin: 0 0 1em; }
+img { max-width: 100%; height: auto; }
+blockquote { margin-left: 0; padding: 0 1em; color: #4b5563; border-left: 4px solid #d1d5db; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: .9em;
+  background: #f3f4f6; padding: .15em .35em; border-radius: 4px; }
+pre { padding: 12px 16px; overflow-x: auto; border-radius: 6px; background: #f6f8fa; border: 1px solid #e5e7eb; }
+pre code { background: none; padding: 0; font-size: .85em; }
+table { border-collapse: collapse; width: auto; }
+th, td { border: 1px solid #d1d5db; padding: 6px 12px; }
+th { background: #f9fafb; }
+hr { border: 0; border-top: 1px solid #e5e7eb; margin: 2em 0; }
+li > input[type=checkbox] { margin-right: .4em; }
+li:has(> input[type=checkbox]) { list-style: none; }
+article > header .title { margin-top: 0; }
+article > header .meta { color: #6b7280; font-size: .85em; margin-top: -.4em; }
+article > header .tag { color: #059669; }
+article + article { margin-top: 3em; padding-top: 2em; border-top: 2px solid #e5e7eb; }
+nav.toc ol { padding-left: 1.5em; }
+nav.toc + article { margin-top: 3em; }
+@media print {
+  body { max-width: none; padding: 0; font-size: 11pt; }
+  a { color: inherit; }
+  pre, blockquote, table, img { page-break-inside: avoid; }
+  h1, h2, h3 { page-break-after: avoid; }
+  nav.toc, article + article { page-break-before: always; }
+  nav.toc + article { page-break-before: always; margin-top: 0; }
+  article + article { border-top: 0; margin-top: 0; padding-top: 0; }
+}
+`)
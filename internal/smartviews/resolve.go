@@ -0,0 +1,267 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package smartviews
+
+import (
+	"fmt"
+	"locknote/internal/database"
+	"locknote/internal/notes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 条件字段
+const (
+	FieldTitle     = "title"
+	FieldContent   = "content"
+	FieldTag       = "tag"
+	FieldNotebook  = "notebook"
+	FieldPinned    = "pinned"
+	FieldCreatedAt = "createdAt"
+	FieldUpdatedAt = "updatedAt"
+)
+
+// 条件运算符
+const (
+	OpContains    = "contains"
+	OpNotContains = "notContains"
+	OpEquals      = "equals"
+	OpNotEquals   = "notEquals"
+	OpStartsWith  = "startsWith"
+	OpEndsWith    = "endsWith"
+	OpIsEmpty     = "isEmpty"
+	OpBefore      = "before"
+	OpAfter       = "after"
+	OpWithinDays  = "withinDays"
+)
+
+// compiledFilter 是 Filter 编译后的结果：元数据部分交给 SQL，内容部分在解密后匹配
+type compiledFilter struct {
+	query   database.NoteQuery
+	content []FilterCondition
+	empty   bool // 条件互相矛盾，结果必然为空
+}
+
+func parseFilterTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func compileFilter(filter Filter, now time.Time) (*compiledFilter, error) {
+	c := &compiledFilter{}
+	q := &c.query
+
+	q.RequireTagIDs = append(q.RequireTagIDs, filter.TagIDs...)
+	if filter.NotebookID != nil {
+		id := *filter.NotebookID
+		q.NotebookID = &id
+	}
+	if filter.DaysRecent != nil && *filter.DaysRecent > 0 {
+		after := now.AddDate(0, 0, -*filter.DaysRecent)
+		q.UpdatedAfter = &after
+	}
+
+	for _, cond := range filter.Conditions {
+		switch cond.Field {
+		case FieldTitle, FieldContent:
+			switch cond.Operator {
+			case OpContains, OpNotContains, OpEquals, OpNotEquals, OpStartsWith, OpEndsWith, OpIsEmpty:
+				c.content = append(c.content, cond)
+			default:
+				return nil, fmt.Errorf("unsupported operator %q for field %q", cond.Operator, cond.Field)
+			}
+
+		case FieldTag:
+			switch cond.Operator {
+			case OpEquals:
+				q.RequireTagIDs = append(q.RequireTagIDs, cond.Value)
+			case OpNotEquals:
+				q.ExcludeTagIDs = append(q.ExcludeTagIDs, cond.Value)
+			default:
+				return nil, fmt.Errorf("unsupported operator %q for field %q", cond.Operator, cond.Field)
+			}
+
+		case FieldNotebook:
+			switch cond.Operator {
+			case OpEquals:
+				if q.NotebookID != nil && *q.NotebookID != cond.Value {
+					c.empty = true
+				}
+				id := cond.Value
+				q.NotebookID = &id
+			case OpNotEquals:
+				q.ExcludeNotebookIDs = append(q.ExcludeNotebookIDs, cond.Value)
+			case OpIsEmpty:
+				q.WithoutNotebook = true
+			default:
+				return nil, fmt.Errorf("unsupported operator %q for field %q", cond.Operator, cond.Field)
+			}
+
+		case FieldPinned:
+			pinned, err := strconv.ParseBool(cond.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for field %q", cond.Value, cond.Field)
+			}
+			switch cond.Operator {
+			case OpEquals:
+			case OpNotEquals:
+				pinned = !pinned
+			default:
+				return nil, fmt.Errorf("unsupported operator %q for field %q", cond.Operator, cond.Field)
+			}
+			if q.Pinned != nil && *q.Pinned != pinned {
+				c.empty = true
+			}
+			q.Pinned = &pinned
+
+		case FieldCreatedAt, FieldUpdatedAt:
+			var bound time.Time
+			switch cond.Operator {
+			case OpBefore, OpAfter:
+				t, err := parseFilterTime(cond.Value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q for field %q", cond.Value, cond.Field)
+				}
+				bound = t
+			case OpWithinDays:
+				days, err := strconv.Atoi(cond.Value)
+				if err != nil || days < 0 {
+					return nil, fmt.Errorf("invalid value %q for field %q", cond.Value, cond.Field)
+				}
+				bound = now.AddDate(0, 0, -days)
+			default:
+				return nil, fmt.Errorf("unsupported operator %q for field %q", cond.Operator, cond.Field)
+			}
+
+			after, before := &q.CreatedAfter, &q.CreatedBefore
+			if cond.Field == FieldUpdatedAt {
+				after, before = &q.UpdatedAfter, &q.UpdatedBefore
+			}
+			if cond.Operator == OpBefore {
+				if *before == nil || bound.Before(**before) {
+					*before = &bound
+				}
+			} else if *after == nil || bound.After(**after) {
+				*after = &bound
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported filter field %q", cond.Field)
+		}
+	}
+
+	return c, nil
+}
+
+func matchContent(content *notes.NoteContent, conditions []FilterCondition) bool {
+	for _, cond := range conditions {
+		text := content.Title
+		if cond.Field == FieldContent {
+			text = content.Content
+		}
+		text = strings.ToLower(text)
+		value := strings.ToLower(cond.Value)
+
+		var ok bool
+		switch cond.Operator {
+		case OpContains:
+			ok = strings.Contains(text, value)
+		case OpNotContains:
+			ok = !strings.Contains(text, value)
+		case OpEquals:
+			ok = strings.TrimSpace(text) == strings.TrimSpace(value)
+		case OpNotEquals:
+			ok = strings.TrimSpace(text) != strings.TrimSpace(value)
+		case OpStartsWith:
+			ok = strings.HasPrefix(strings.TrimSpace(text), value)
+		case OpEndsWith:
+			ok = strings.HasSuffix(strings.TrimSpace(text), value)
+		case OpIsEmpty:
+			ok = strings.TrimSpace(text) == ""
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve 计算智能视图当前包含的笔记，返回分页结果
+func (s *Service) Resolve(viewID string, limit, offset int) (*notes.ListResult, error) {
+	view, err := s.Get(viewID)
+	if err != nil {
+		return nil, err
+	}
+	return s.ResolveFilter(view.Filter, limit, offset)
+}
+
+// ResolveFilter 按过滤条件查询笔记：元数据条件编译为 SQL，标题/正文条件在解密后匹配
+func (s *Service) ResolveFilter(filter Filter, limit, offset int) (*notes.ListResult, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	compiled, err := compileFilter(filter, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if compiled.empty {
+		return &notes.ListResult{Notes: []*notes.Note{}, Total: 0}, nil
+	}
+
+	if filter.SearchQuery != nil && strings.TrimSpace(*filter.SearchQuery) != "" {
+		ids, err := s.notes.MatchNoteIDs(*filter.SearchQuery)
+		if err != nil {
+			return nil, err
+		}
+		compiled.query.IDs = ids
+	}
+
+	var metas []*database.NoteMeta
+	var total int
+	if len(compiled.content) == 0 {
+		metas, total, err = s.db.QueryNotes(&compiled.query, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		candidates, _, err := s.db.QueryNotes(&compiled.query, -1, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := make([]*database.NoteMeta, 0, len(candidates))
+		for _, meta := range candidates {
+			content, err := s.notes.ReadContent(meta)
+			if err != nil {
+				continue
+			}
+			if matchContent(content, compiled.content) {
+				matched = append(matched, meta)
+			}
+		}
+
+		total = len(matched)
+		if offset < total {
+			end := offset + limit
+			if end > total {
+				end = total
+			}
+			metas = matched[offset:end]
+		}
+	}
+
+	list, err := s.notes.ListFromMetas(metas)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notes.ListResult{Notes: list, Total: total}, nil
+}
@@ -0,0 +1,264 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package smartviews
+
+import (
+	"locknote/internal/crypto"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"locknote/internal/notes"
+	"locknote/internal/tags"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCompileFilter(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(s string) *time.Time {
+		tt, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &tt
+	}
+	str := func(s string) *string { return &s }
+	days := func(n int) *int { return &n }
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   database.NoteQuery
+		empty  bool
+	}{
+		{
+			name: "created range keeps the tightest bounds",
+			filter: Filter{Conditions: []FilterCondition{
+				{Field: FieldCreatedAt, Operator: OpAfter, Value: "2024-01-01T00:00:00Z"},
+				{Field: FieldCreatedAt, Operator: OpAfter, Value: "2024-02-01T00:00:00+08:00"},
+				{Field: FieldCreatedAt, Operator: OpBefore, Value: "2024-03-01T00:00:00Z"},
+				{Field: FieldCreatedAt, Operator: OpBefore, Value: "2024-04-01T00:00:00Z"},
+			}},
+			want: database.NoteQuery{
+				CreatedAfter:  at("2024-02-01T00:00:00+08:00"),
+				CreatedBefore: at("2024-03-01T00:00:00Z"),
+			},
+		},
+		{
+			name: "updated within days and days recent",
+			filter: Filter{
+				DaysRecent: days(30),
+				Conditions: []FilterCondition{
+					{Field: FieldUpdatedAt, Operator: OpWithinDays, Value: "7"},
+					{Field: FieldUpdatedAt, Operator: OpBefore, Value: "2024-03-09T18:00:00Z"},
+				},
+			},
+			want: database.NoteQuery{
+				UpdatedAfter:  at("2024-03-03T12:00:00Z"),
+				UpdatedBefore: at("2024-03-09T18:00:00Z"),
+			},
+		},
+		{
+			name: "exclusions",
+			filter: Filter{
+				TagIDs: []string{"t1"},
+				Conditions: []FilterCondition{
+					{Field: FieldTag, Operator: OpNotEquals, Value: "t2"},
+					{Field: FieldTag, Operator: OpNotEquals, Value: "t3"},
+					{Field: FieldNotebook, Operator: OpNotEquals, Value: "nb1"},
+					{Field: FieldPinned, Operator: OpNotEquals, Value: "true"},
+				},
+			},
+			want: database.NoteQuery{
+				RequireTagIDs:      []string{"t1"},
+				ExcludeTagIDs:      []string{"t2", "t3"},
+				ExcludeNotebookIDs: []string{"nb1"},
+				Pinned:             new(bool),
+			},
+		},
+		{
+			name: "conflicting notebooks",
+			filter: Filter{
+				NotebookID: str("nb1"),
+				Conditions: []FilterCondition{
+					{Field: FieldNotebook, Operator: OpEquals, Value: "nb2"},
+				},
+			},
+			want:  database.NoteQuery{NotebookID: str("nb2")},
+			empty: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileFilter(tt.filter, now)
+			if err != nil {
+				t.Fatalf("compileFilter: %v", err)
+			}
+			if c.empty != tt.empty {
+				t.Errorf("empty = %v, want %v", c.empty, tt.empty)
+			}
+			if !reflect.DeepEqual(c.query, tt.want) {
+				t.Errorf("query = %+v, want %+v", c.query, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []FilterCondition{
+		{Field: FieldCreatedAt, Operator: OpAfter, Value: "yesterday"},
+		{Field: FieldUpdatedAt, Operator: OpWithinDays, Value: "-1"},
+		{Field: FieldUpdatedAt, Operator: OpContains, Value: "2024"},
+		{Field: FieldTag, Operator: OpContains, Value: "t1"},
+		{Field: FieldPinned, Operator: OpEquals, Value: "maybe"},
+		{Field: "color", Operator: OpEquals, Value: "red"},
+	}
+	for _, cond := range tests {
+		if _, err := compileFilter(Filter{Conditions: []FilterCondition{cond}}, time.Now()); err == nil {
+			t.Errorf("compileFilter(%+v) succeeded", cond)
+		}
+	}
+}
+
+func TestResolveFilter(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"notes", "history", "attachments"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := database.New(filepath.Join(dir, "locknote.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	key, err := crypto.NewService().GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nb := notebooks.NewService(db)
+	nb.SetMasterKey(key)
+	ns := notes.NewService(db, dir, nb)
+	ns.SetMasterKey(key)
+	ts := tags.NewService(db)
+	ts.SetMasterKey(key)
+	s := NewService(db, ns)
+	s.SetMasterKey(key)
+
+	work, err := nb.Create("工作", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, err := nb.Create("家庭", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	red, err := ts.Create("red", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blue, err := ts.Create("blue", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 三篇笔记的时间以不同的时区写入，按 UTC 依次为 17:00、17:30、18:30
+	east := time.FixedZone("UTC+8", 8*3600)
+	west := time.FixedZone("UTC-5", -5*3600)
+	put := func(id string, created time.Time, notebookID *string, tagIDs ...string) {
+		t.Helper()
+		record := &notes.Record{
+			Meta:    database.NoteMeta{ID: id, CreatedAt: created, UpdatedAt: created.Add(time.Hour), NotebookID: notebookID},
+			Content: notes.NoteContent{Title: id, Content: id},
+		}
+		if err := ns.PutRecord(record); err != nil {
+			t.Fatal(err)
+		}
+		for _, tagID := range tagIDs {
+			if err := ts.AddToNote(id, tagID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put("east", time.Date(2024, 3, 10, 1, 30, 0, 0, east), &work.ID, red.ID)
+	put("west", time.Date(2024, 3, 9, 12, 0, 0, 0, west), &home.ID, blue.ID)
+	put("utc", time.Date(2024, 3, 9, 18, 30, 0, 0, time.UTC), nil, red.ID, blue.ID)
+
+	tests := []struct {
+		name       string
+		conditions []FilterCondition
+		want       []string
+	}{
+		{
+			name:       "created after",
+			conditions: []FilterCondition{{Field: FieldCreatedAt, Operator: OpAfter, Value: "2024-03-09T18:00:00Z"}},
+			want:       []string{"utc"},
+		},
+		{
+			name: "created range",
+			conditions: []FilterCondition{
+				{Field: FieldCreatedAt, Operator: OpAfter, Value: "2024-03-09T17:15:00Z"},
+				{Field: FieldCreatedAt, Operator: OpBefore, Value: "2024-03-09T18:00:00Z"},
+			},
+			want: []string{"east"},
+		},
+		{
+			name:       "created before with offset",
+			conditions: []FilterCondition{{Field: FieldCreatedAt, Operator: OpBefore, Value: "2024-03-10T01:15:00+08:00"}},
+			want:       []string{"west"},
+		},
+		{
+			name: "updated range",
+			conditions: []FilterCondition{
+				{Field: FieldUpdatedAt, Operator: OpAfter, Value: "2024-03-09T13:00:00-05:00"},
+				{Field: FieldUpdatedAt, Operator: OpBefore, Value: "2024-03-09T19:30:00Z"},
+			},
+			want: []string{"east", "west"},
+		},
+		{
+			name:       "excluded tag",
+			conditions: []FilterCondition{{Field: FieldTag, Operator: OpNotEquals, Value: blue.ID}},
+			want:       []string{"east"},
+		},
+		{
+			name:       "excluded notebook",
+			conditions: []FilterCondition{{Field: FieldNotebook, Operator: OpNotEquals, Value: work.ID}},
+			want:       []string{"utc", "west"},
+		},
+		{
+			name:       "without notebook",
+			conditions: []FilterCondition{{Field: FieldNotebook, Operator: OpIsEmpty}},
+			want:       []string{"utc"},
+		},
+		{
+			name: "tag with excluded notebook and title",
+			conditions: []FilterCondition{
+				{Field: FieldTag, Operator: OpEquals, Value: red.ID},
+				{Field: FieldNotebook, Operator: OpNotEquals, Value: work.ID},
+				{Field: FieldTitle, Operator: OpNotContains, Value: "west"},
+			},
+			want: []string{"utc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.ResolveFilter(Filter{Conditions: tt.conditions}, 50, 0)
+			if err != nil {
+				t.Fatalf("ResolveFilter: %v", err)
+			}
+			var got []string
+			for _, n := range result.Notes {
+				got = append(got, n.ID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) || result.Total != len(tt.want) {
+				t.Errorf("got %v (total %d), want %v", got, result.Total, tt.want)
+			}
+		})
+	}
+}
@@ -5,13 +5,31 @@ package smartviews
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"locknote/internal/crypto"
 	"locknote/internal/database"
+	"locknote/internal/notes"
+	"sort"
+	"sync"
 
 	"github.com/google/uuid"
 )
 
+// 智能视图的名称、图标与筛选条件用数据密钥加密，分别绑定智能视图 ID 与字段
+
+const (
+	fieldName   = "name"
+	fieldIcon   = "icon"
+	fieldFilter = "filter"
+)
+
 type Service struct {
-	db *database.DB
+	db        *database.DB
+	notes     *notes.Service
+	crypto    *crypto.Service
+	masterKey []byte
+	mu        sync.RWMutex
 }
 
 type SmartView struct {
@@ -36,11 +54,133 @@ type Filter struct {
 	SearchQuery *string           `json:"searchQuery,omitempty"`
 }
 
-func NewService(db *database.DB) *Service {
-	return &Service{db: db}
+// RemapIDs 返回用 tagID 与 notebookID 替换其中标签与笔记本 ID 后的筛选条件，
+// 用于把智能视图复制到另一份数据
+func (f Filter) RemapIDs(tagID, notebookID func(string) string) Filter {
+	out := f
+	out.TagIDs = make([]string, len(f.TagIDs))
+	for i, id := range f.TagIDs {
+		out.TagIDs[i] = tagID(id)
+	}
+	if f.NotebookID != nil {
+		id := notebookID(*f.NotebookID)
+		out.NotebookID = &id
+	}
+	out.Conditions = make([]FilterCondition, len(f.Conditions))
+	for i, cond := range f.Conditions {
+		switch cond.Field {
+		case FieldTag:
+			cond.Value = tagID(cond.Value)
+		case FieldNotebook:
+			if cond.Operator != OpIsEmpty {
+				cond.Value = notebookID(cond.Value)
+			}
+		}
+		out.Conditions[i] = cond
+	}
+	if len(f.TagIDs) == 0 {
+		out.TagIDs = nil
+	}
+	if len(f.Conditions) == 0 {
+		out.Conditions = nil
+	}
+	return out
+}
+
+func NewService(db *database.DB, noteService *notes.Service) *Service {
+	return &Service{db: db, notes: noteService, crypto: crypto.NewService()}
+}
+
+func (s *Service) SetMasterKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.masterKey = key
+}
+
+func (s *Service) getMasterKey() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.masterKey == nil {
+		return nil, errors.New("not unlocked")
+	}
+	return s.masterKey, nil
+}
+
+func smartViewAAD(field, id string) []byte {
+	return []byte("locknote-smart-view\x00" + field + "\x00" + id)
+}
+
+// seal 加密名称、图标与筛选条件并写入 sv 的加密字段，清空明文字段
+func (s *Service) seal(key []byte, sv *database.SmartView, name, icon, filterJSON string) error {
+	fields := []struct {
+		field string
+		value string
+		out   *[]byte
+	}{
+		{fieldName, name, &sv.EncryptedName},
+		{fieldIcon, icon, &sv.EncryptedIcon},
+		{fieldFilter, filterJSON, &sv.EncryptedFilter},
+	}
+	for _, f := range fields {
+		encrypted, err := s.crypto.EncryptWithAAD(key, []byte(f.value), smartViewAAD(f.field, sv.ID))
+		if err != nil {
+			return err
+		}
+		*f.out = encrypted
+	}
+	sv.Name, sv.Icon, sv.FilterJSON = "", "", ""
+	return nil
+}
+
+// openFields 返回智能视图的名称、图标与筛选条件 JSON，加密之前的旧数据直接返回明文
+func (s *Service) openFields(key []byte, sv *database.SmartView) (name, icon, filterJSON string, err error) {
+	if sv.EncryptedName == nil {
+		return sv.Name, sv.Icon, sv.FilterJSON, nil
+	}
+	fields := []struct {
+		field string
+		data  []byte
+		out   *string
+	}{
+		{fieldName, sv.EncryptedName, &name},
+		{fieldIcon, sv.EncryptedIcon, &icon},
+		{fieldFilter, sv.EncryptedFilter, &filterJSON},
+	}
+	for _, f := range fields {
+		plaintext, err := s.crypto.DecryptWithAAD(key, f.data, smartViewAAD(f.field, sv.ID))
+		if err != nil {
+			return "", "", "", fmt.Errorf("智能视图无法解密 (id=%s): %w", sv.ID, err)
+		}
+		*f.out = string(plaintext)
+	}
+	return name, icon, filterJSON, nil
+}
+
+func (s *Service) open(key []byte, sv *database.SmartView) (*SmartView, error) {
+	name, icon, filterJSON, err := s.openFields(key, sv)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter Filter
+	if err := json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+		return nil, err
+	}
+
+	return &SmartView{
+		ID:        sv.ID,
+		Name:      name,
+		Icon:      icon,
+		Filter:    filter,
+		SortOrder: sv.SortOrder,
+	}, nil
 }
 
 func (s *Service) Create(name, icon string, filter Filter) (*SmartView, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
 	if icon == "" {
 		icon = "🔍"
 	}
@@ -56,11 +196,11 @@ func (s *Service) Create(name, icon string, filter Filter) (*SmartView, error) {
 	}
 
 	sv := &database.SmartView{
-		ID:         uuid.New().String(),
-		Name:       name,
-		Icon:       icon,
-		FilterJSON: string(filterJSON),
-		SortOrder:  sortOrder,
+		ID:        uuid.New().String(),
+		SortOrder: sortOrder,
+	}
+	if err := s.seal(key, sv, name, icon, string(filterJSON)); err != nil {
+		return nil, err
 	}
 
 	if err := s.db.CreateSmartView(sv); err != nil {
@@ -69,14 +209,19 @@ func (s *Service) Create(name, icon string, filter Filter) (*SmartView, error) {
 
 	return &SmartView{
 		ID:        sv.ID,
-		Name:      sv.Name,
-		Icon:      sv.Icon,
+		Name:      name,
+		Icon:      icon,
 		Filter:    filter,
 		SortOrder: sv.SortOrder,
 	}, nil
 }
 
 func (s *Service) Update(id, name, icon string, filter Filter) (*SmartView, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
 	sv, err := s.db.GetSmartView(id)
 	if err != nil {
 		return nil, err
@@ -87,11 +232,14 @@ func (s *Service) Update(id, name, icon string, filter Filter) (*SmartView, erro
 		return nil, err
 	}
 
-	sv.Name = name
-	if icon != "" {
-		sv.Icon = icon
+	if icon == "" {
+		if _, icon, _, err = s.openFields(key, sv); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.seal(key, sv, name, icon, string(filterJSON)); err != nil {
+		return nil, err
 	}
-	sv.FilterJSON = string(filterJSON)
 
 	if err := s.db.UpdateSmartView(sv); err != nil {
 		return nil, err
@@ -99,8 +247,8 @@ func (s *Service) Update(id, name, icon string, filter Filter) (*SmartView, erro
 
 	return &SmartView{
 		ID:        sv.ID,
-		Name:      sv.Name,
-		Icon:      sv.Icon,
+		Name:      name,
+		Icon:      icon,
 		Filter:    filter,
 		SortOrder: sv.SortOrder,
 	}, nil
@@ -110,7 +258,13 @@ func (s *Service) Delete(id string) error {
 	return s.db.DeleteSmartView(id)
 }
 
+// List 返回全部智能视图，按排序号与名称排列；无法解密或解析的跳过
 func (s *Service) List() ([]*SmartView, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
 	dbViews, err := s.db.ListSmartViews()
 	if err != nil {
 		return nil, err
@@ -118,39 +272,61 @@ func (s *Service) List() ([]*SmartView, error) {
 
 	views := make([]*SmartView, 0, len(dbViews))
 	for _, sv := range dbViews {
-		var filter Filter
-		if err := json.Unmarshal([]byte(sv.FilterJSON), &filter); err != nil {
+		view, err := s.open(key, sv)
+		if err != nil {
 			continue
 		}
-
-		views = append(views, &SmartView{
-			ID:        sv.ID,
-			Name:      sv.Name,
-			Icon:      sv.Icon,
-			Filter:    filter,
-			SortOrder: sv.SortOrder,
-		})
+		views = append(views, view)
 	}
+	sort.SliceStable(views, func(i, j int) bool {
+		if views[i].SortOrder != views[j].SortOrder {
+			return views[i].SortOrder < views[j].SortOrder
+		}
+		return views[i].Name < views[j].Name
+	})
 
 	return views, nil
 }
 
 func (s *Service) Get(id string) (*SmartView, error) {
-	sv, err := s.db.GetSmartView(id)
+	key, err := s.getMasterKey()
 	if err != nil {
 		return nil, err
 	}
 
-	var filter Filter
-	if err := json.Unmarshal([]byte(sv.FilterJSON), &filter); err != nil {
+	sv, err := s.db.GetSmartView(id)
+	if err != nil {
 		return nil, err
 	}
+	return s.open(key, sv)
+}
 
-	return &SmartView{
-		ID:        sv.ID,
-		Name:      sv.Name,
-		Icon:      sv.Icon,
-		Filter:    filter,
-		SortOrder: sv.SortOrder,
-	}, nil
+// Rekey 把智能视图的名称、图标与筛选条件从 oldKey 重新加密为 newKey，返回改写的智能视图数。
+// 明文的旧数据直接加密；已经能用 newKey 解密的跳过，因此可以重复调用。两个密钥都无法解密的保持原样
+func (s *Service) Rekey(oldKey, newKey []byte) (int, error) {
+	dbViews, err := s.db.ListSmartViews()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, sv := range dbViews {
+		if sv.EncryptedName != nil {
+			if _, _, _, err := s.openFields(newKey, sv); err == nil {
+				continue
+			}
+		}
+		name, icon, filterJSON, err := s.openFields(oldKey, sv)
+		if err != nil {
+			continue
+		}
+		if err := s.seal(newKey, sv, name, icon, filterJSON); err != nil {
+			return count, err
+		}
+		if err := s.db.UpdateSmartView(sv); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
 }
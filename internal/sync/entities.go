@@ -0,0 +1,629 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const conflictSuffix = " (冲突副本)"
+
+// 各类对象在 Record.Payload 中的内容。排序号属于各设备自己的排列，不参与同步。
+// 标签、笔记本与智能视图的名称等字段与笔记标题一样以数据密钥加密后的原样传输；
+// 明文字段只出现在名称加密之前的版本推送的记录中
+
+type tagPayload struct {
+	Name          string `json:"name,omitempty"`
+	Color         string `json:"color"`
+	EncryptedName []byte `json:"encryptedName,omitempty"`
+	NameIndex     []byte `json:"nameIndex,omitempty"`
+}
+
+type notebookPayload struct {
+	Name          string    `json:"name,omitempty"`
+	Icon          string    `json:"icon,omitempty"`
+	Pinned        bool      `json:"pinned"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	EncryptedName []byte    `json:"encryptedName,omitempty"`
+	EncryptedIcon []byte    `json:"encryptedIcon,omitempty"`
+	// 受保护笔记本的笔记本密钥，以笔记本密码派生的密钥加密
+	KeySalt      []byte `json:"keySalt,omitempty"`
+	KeyParams    string `json:"keyParams,omitempty"`
+	EncryptedKey []byte `json:"encryptedKey,omitempty"`
+}
+
+type smartViewPayload struct {
+	Name            string `json:"name,omitempty"`
+	Icon            string `json:"icon,omitempty"`
+	FilterJSON      string `json:"filterJson,omitempty"`
+	EncryptedName   []byte `json:"encryptedName,omitempty"`
+	EncryptedIcon   []byte `json:"encryptedIcon,omitempty"`
+	EncryptedFilter []byte `json:"encryptedFilter,omitempty"`
+}
+
+type notePayload struct {
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	Pinned           bool       `json:"pinned"`
+	DeletedAt        *time.Time `json:"deletedAt,omitempty"`
+	NotebookID       *string    `json:"notebookId,omitempty"`
+	TagIDs           []string   `json:"tagIds"`
+	EncryptedTitle   []byte     `json:"encryptedTitle,omitempty"`
+	EncryptedPreview []byte     `json:"encryptedPreview,omitempty"`
+	Ciphertext       []byte     `json:"ciphertext"` // 笔记文件的原始密文
+}
+
+// entity 是对象的当前快照
+type entity struct {
+	payload interface{}
+	hash    []byte
+}
+
+func newEntity(kind string, payload interface{}) (*entity, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write(data)
+	return &entity{payload: payload, hash: h.Sum(nil)}, nil
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
+
+func notePayloadFromMeta(meta *database.NoteMeta, tags []*database.Tag, ciphertext []byte) *notePayload {
+	tagIDs := make([]string, len(tags))
+	for i, t := range tags {
+		tagIDs[i] = t.ID
+	}
+	sort.Strings(tagIDs)
+
+	return &notePayload{
+		CreatedAt:        meta.CreatedAt,
+		UpdatedAt:        meta.UpdatedAt,
+		Pinned:           meta.Pinned,
+		DeletedAt:        meta.DeletedAt,
+		NotebookID:       meta.NotebookID,
+		TagIDs:           tagIDs,
+		EncryptedTitle:   meta.EncryptedTitle,
+		EncryptedPreview: meta.EncryptedPreview,
+		Ciphertext:       ciphertext,
+	}
+}
+
+// snapshot 返回所有本地对象的快照；正文文件无法读取的笔记放在 unreadable 中，
+// 既不推送也不会被当作已删除
+func (s *Service) snapshot() (map[entityKey]*entity, map[entityKey]bool, error) {
+	current := make(map[entityKey]*entity)
+	unreadable := make(map[entityKey]bool)
+	add := func(kind, id string, payload interface{}) error {
+		e, err := newEntity(kind, payload)
+		if err != nil {
+			return err
+		}
+		current[entityKey{kind, id}] = e
+		return nil
+	}
+
+	tags, err := s.db.ListTags()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range tags {
+		if err := add(KindTag, t.ID, tagPayloadFrom(t)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	notebooks, err := s.db.ListNotebooks()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, nb := range notebooks {
+		if err := add(KindNotebook, nb.ID, notebookPayloadFrom(nb)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	views, err := s.db.ListSmartViews()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, sv := range views {
+		if err := add(KindSmartView, sv.ID, smartViewPayloadFrom(sv)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	metas, err := s.db.ListNotes(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]string, len(metas))
+	for i, m := range metas {
+		ids[i] = m.ID
+	}
+	tagsByNote, err := s.db.GetNoteTagsBatch(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, meta := range metas {
+		ciphertext, err := os.ReadFile(filepath.Join(s.dataDir, meta.CipherPath))
+		if err != nil {
+			unreadable[entityKey{KindNote, meta.ID}] = true
+			continue
+		}
+		if err := add(KindNote, meta.ID, notePayloadFromMeta(meta, tagsByNote[meta.ID], ciphertext)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return current, unreadable, nil
+}
+
+func tagPayloadFrom(t *database.Tag) *tagPayload {
+	return &tagPayload{
+		Name:          t.Name,
+		Color:         t.Color,
+		EncryptedName: t.EncryptedName,
+		NameIndex:     t.NameIndex,
+	}
+}
+
+func notebookPayloadFrom(nb *database.Notebook) *notebookPayload {
+	return &notebookPayload{
+		Name:          nb.Name,
+		Icon:          nb.Icon,
+		Pinned:        nb.Pinned,
+		CreatedAt:     nb.CreatedAt,
+		UpdatedAt:     nb.UpdatedAt,
+		EncryptedName: nb.EncryptedName,
+		EncryptedIcon: nb.EncryptedIcon,
+		KeySalt:       nb.KeySalt,
+		KeyParams:     nb.KeyParams,
+		EncryptedKey:  nb.EncryptedKey,
+	}
+}
+
+func smartViewPayloadFrom(sv *database.SmartView) *smartViewPayload {
+	return &smartViewPayload{
+		Name:            sv.Name,
+		Icon:            sv.Icon,
+		FilterJSON:      sv.FilterJSON,
+		EncryptedName:   sv.EncryptedName,
+		EncryptedIcon:   sv.EncryptedIcon,
+		EncryptedFilter: sv.EncryptedFilter,
+	}
+}
+
+// snapshotOne 返回单个对象的快照，对象不存在时返回 nil
+func (s *Service) snapshotOne(k entityKey) (*entity, error) {
+	var payload interface{}
+
+	switch k.kind {
+	case KindTag:
+		t, err := s.db.GetTag(k.id)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		payload = tagPayloadFrom(t)
+
+	case KindNotebook:
+		nb, err := s.db.GetNotebook(k.id)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		payload = notebookPayloadFrom(nb)
+
+	case KindSmartView:
+		sv, err := s.db.GetSmartView(k.id)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		payload = smartViewPayloadFrom(sv)
+
+	case KindNote:
+		metas, err := s.db.GetNotesByIDs([]string{k.id})
+		if err != nil {
+			return nil, err
+		}
+		if len(metas) == 0 {
+			return nil, nil
+		}
+		tags, err := s.db.GetNoteTags(k.id)
+		if err != nil {
+			return nil, err
+		}
+		ciphertext, err := os.ReadFile(filepath.Join(s.dataDir, metas[0].CipherPath))
+		if err != nil {
+			return nil, err
+		}
+		payload = notePayloadFromMeta(metas[0], tags, ciphertext)
+
+	default:
+		return nil, fmt.Errorf("sync: unknown kind %q", k.kind)
+	}
+
+	return newEntity(k.kind, payload)
+}
+
+// export 把本地对象打包成 Record，元数据用同步密钥加密
+func (s *Service) export(k entityKey, st *state) (*Record, error) {
+	rec := &Record{Header: Header{Kind: k.kind, ID: k.id, Vector: st.vector, Deleted: st.deleted}}
+	if st.deleted {
+		return rec, s.sign(rec)
+	}
+
+	e, err := s.snapshotOne(k)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		// 扫描之后被删除，按墓碑发送，下次扫描会补上本地的删除
+		rec.Deleted = true
+		return rec, s.sign(rec)
+	}
+
+	plaintext, err := json.Marshal(e.payload)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.syncKey()
+	if err != nil {
+		return nil, err
+	}
+	if rec.Payload, err = s.crypto.Encrypt(key, plaintext); err != nil {
+		return nil, err
+	}
+	return rec, s.sign(rec)
+}
+
+func (s *Service) openPayload(rec *Record, v interface{}) error {
+	key, err := s.syncKey()
+	if err != nil {
+		return err
+	}
+	plaintext, err := s.crypto.Decrypt(key, rec.Payload)
+	if err != nil {
+		return ErrKeyMismatch
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// apply 把远端记录写入本地，并以记录的版本向量作为本地同步状态。调用方需已用 verify 校验记录
+func (s *Service) apply(rec *Record) error {
+	if err := validateKey(rec.Kind, rec.ID); err != nil {
+		return err
+	}
+	k := entityKey{rec.Kind, rec.ID}
+
+	var err error
+	if rec.Deleted {
+		err = s.applyDelete(k)
+	} else {
+		switch k.kind {
+		case KindTag:
+			err = s.applyTag(rec)
+		case KindNotebook:
+			err = s.applyNotebook(rec)
+		case KindSmartView:
+			err = s.applySmartView(rec)
+		case KindNote:
+			err = s.applyNote(rec)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("apply %s %s: %w", k.kind, k.id, err)
+	}
+
+	e, err := s.snapshotOne(k)
+	if err != nil {
+		return err
+	}
+	st := &state{vector: rec.Vector.Clone(), deleted: e == nil}
+	if e != nil {
+		st.hash = e.hash
+	}
+	return s.putState(k, st)
+}
+
+func (s *Service) applyDelete(k entityKey) error {
+	var err error
+	switch k.kind {
+	case KindTag:
+		err = s.cascade(k, func() error { return s.db.DeleteTagWithAssociations(k.id) })
+	case KindNotebook:
+		err = s.cascade(k, func() error { return s.db.DeleteNotebook(k.id) })
+	case KindSmartView:
+		err = s.db.DeleteSmartView(k.id)
+	case KindNote:
+		// 远端删除的笔记只移入回收站，永久删除由用户在本机确认。
+		// 回收站中的笔记以远端的版本向量记录，不会被当作本地修改推送回去
+		err = s.notes.SoftDelete(k.id)
+	}
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// cascade 执行删除标签或笔记本的操作 del。删除会连带修改引用它的笔记，
+// 远端在删除时也做了同样的修改，因此这些笔记如果没有未同步的本地修改，
+// 只更新快照哈希而不递增版本向量，避免被当作本地修改与远端冲突。
+func (s *Service) cascade(k entityKey, del func() error) error {
+	noteIDs, err := s.referencingNotes(k)
+	if err != nil {
+		return err
+	}
+
+	clean := make(map[string]*state)
+	for _, id := range noteIDs {
+		nk := entityKey{KindNote, id}
+		st, err := s.loadState(nk)
+		if err != nil || st == nil || st.deleted {
+			continue
+		}
+		if e, err := s.snapshotOne(nk); err == nil && e != nil && bytes.Equal(st.hash, e.hash) {
+			clean[id] = st
+		}
+	}
+
+	if err := del(); err != nil {
+		return err
+	}
+
+	for id, st := range clean {
+		nk := entityKey{KindNote, id}
+		e, err := s.snapshotOne(nk)
+		if err != nil || e == nil {
+			continue
+		}
+		st.hash = e.hash
+		if err := s.putState(nk, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referencingNotes 返回引用了标签或笔记本 k 的笔记（包括回收站中的）
+func (s *Service) referencingNotes(k entityKey) ([]string, error) {
+	metas, err := s.db.ListNotes(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	switch k.kind {
+	case KindNotebook:
+		for _, m := range metas {
+			if m.NotebookID != nil && *m.NotebookID == k.id {
+				ids = append(ids, m.ID)
+			}
+		}
+	case KindTag:
+		all := make([]string, len(metas))
+		for i, m := range metas {
+			all[i] = m.ID
+		}
+		tagsByNote, err := s.db.GetNoteTagsBatch(all)
+		if err != nil {
+			return nil, err
+		}
+		for id, tags := range tagsByNote {
+			for _, t := range tags {
+				if t.ID == k.id {
+					ids = append(ids, id)
+					break
+				}
+			}
+		}
+	}
+	return ids, nil
+}
+
+func (s *Service) applyTag(rec *Record) error {
+	var p tagPayload
+	if err := s.openPayload(rec, &p); err != nil {
+		return err
+	}
+	tag := &database.Tag{ID: rec.ID, Name: p.Name, Color: p.Color, EncryptedName: p.EncryptedName, NameIndex: p.NameIndex}
+
+	// 两台设备分别创建了同名标签：合并到远端的标签 ID。
+	// 旧版本推送的明文名称没有索引，解锁时加密名称才会合并
+	if p.NameIndex != nil {
+		if same, err := s.db.GetTagByNameIndex(p.NameIndex); err == nil && same.ID != rec.ID {
+			return s.db.ReplaceTag(same.ID, tag)
+		} else if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	if _, err := s.db.GetTag(rec.ID); err != nil {
+		if isNotFound(err) {
+			return s.db.CreateTag(tag)
+		}
+		return err
+	}
+	return s.db.UpdateTag(tag)
+}
+
+func (s *Service) applyNotebook(rec *Record) error {
+	var p notebookPayload
+	if err := s.openPayload(rec, &p); err != nil {
+		return err
+	}
+
+	nb, err := s.db.GetNotebook(rec.ID)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		sortOrder, err := s.db.GetNextNotebookSortOrder()
+		if err != nil {
+			sortOrder = 0
+		}
+		return s.db.CreateNotebook(&database.Notebook{
+			ID:            rec.ID,
+			Name:          p.Name,
+			Icon:          p.Icon,
+			SortOrder:     sortOrder,
+			Pinned:        p.Pinned,
+			CreatedAt:     p.CreatedAt,
+			UpdatedAt:     p.UpdatedAt,
+			EncryptedName: p.EncryptedName,
+			EncryptedIcon: p.EncryptedIcon,
+			KeySalt:       p.KeySalt,
+			KeyParams:     p.KeyParams,
+			EncryptedKey:  p.EncryptedKey,
+		})
+	}
+
+	nb.Name = p.Name
+	nb.Icon = p.Icon
+	nb.EncryptedName = p.EncryptedName
+	nb.EncryptedIcon = p.EncryptedIcon
+	nb.KeySalt = p.KeySalt
+	nb.KeyParams = p.KeyParams
+	nb.EncryptedKey = p.EncryptedKey
+	nb.Pinned = p.Pinned
+	nb.UpdatedAt = p.UpdatedAt
+	return s.db.UpdateNotebook(nb)
+}
+
+func (s *Service) applySmartView(rec *Record) error {
+	var p smartViewPayload
+	if err := s.openPayload(rec, &p); err != nil {
+		return err
+	}
+
+	sv, err := s.db.GetSmartView(rec.ID)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		sortOrder, err := s.db.GetNextSmartViewSortOrder()
+		if err != nil {
+			sortOrder = 0
+		}
+		return s.db.CreateSmartView(&database.SmartView{
+			ID:              rec.ID,
+			Name:            p.Name,
+			Icon:            p.Icon,
+			FilterJSON:      p.FilterJSON,
+			SortOrder:       sortOrder,
+			EncryptedName:   p.EncryptedName,
+			EncryptedIcon:   p.EncryptedIcon,
+			EncryptedFilter: p.EncryptedFilter,
+		})
+	}
+
+	sv.Name = p.Name
+	sv.Icon = p.Icon
+	sv.FilterJSON = p.FilterJSON
+	sv.EncryptedName = p.EncryptedName
+	sv.EncryptedIcon = p.EncryptedIcon
+	sv.EncryptedFilter = p.EncryptedFilter
+	return s.db.UpdateSmartView(sv)
+}
+
+func (s *Service) applyNote(rec *Record) error {
+	var p notePayload
+	if err := s.openPayload(rec, &p); err != nil {
+		return err
+	}
+
+	meta := &database.NoteMeta{
+		ID:               rec.ID,
+		CreatedAt:        p.CreatedAt,
+		UpdatedAt:        p.UpdatedAt,
+		Pinned:           p.Pinned,
+		DeletedAt:        p.DeletedAt,
+		NotebookID:       s.existingNotebook(p.NotebookID),
+		EncryptedTitle:   p.EncryptedTitle,
+		EncryptedPreview: p.EncryptedPreview,
+	}
+	if err := s.notes.PutEncrypted(meta, p.Ciphertext); err != nil {
+		return err
+	}
+	return s.db.SetNoteTags(rec.ID, s.existingTags(p.TagIDs))
+}
+
+// existingNotebook 在笔记本已被本地删除时返回 nil，避免违反外键约束
+func (s *Service) existingNotebook(id *string) *string {
+	if id == nil {
+		return nil
+	}
+	if _, err := s.db.GetNotebook(*id); err != nil {
+		return nil
+	}
+	return id
+}
+
+func (s *Service) existingTags(ids []string) []string {
+	existing := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := s.db.GetTag(id); err == nil {
+			existing = append(existing, id)
+		}
+	}
+	return existing
+}
+
+// createConflictCopy 把远端版本的笔记另存为一条新笔记，内容与本地相同时不创建。
+// 笔记在受保护的笔记本中时需要该笔记本已解锁
+func (s *Service) createConflictCopy(rec *Record) (bool, error) {
+	var p notePayload
+	if err := s.openPayload(rec, &p); err != nil {
+		return false, err
+	}
+	notebookID := s.existingNotebook(p.NotebookID)
+	remote, err := s.notes.DecryptContent(rec.ID, notebookID, p.Ciphertext)
+	if errors.Is(err, notebooks.ErrLocked) {
+		return false, fmt.Errorf("笔记 %s 有冲突，请解锁所在的笔记本后再同步: %w", rec.ID, err)
+	}
+	if err != nil {
+		return false, ErrKeyMismatch
+	}
+
+	if local, err := s.notes.Get(rec.ID); err == nil && local.Title == remote.Title && local.Content == remote.Content {
+		return false, nil
+	}
+
+	note, err := s.notes.Create(remote.Title+conflictSuffix, remote.Content)
+	if err != nil {
+		return false, err
+	}
+	if notebookID != nil {
+		if err := s.notes.SetNotebook(note.ID, notebookID); err != nil {
+			return true, err
+		}
+	}
+	return true, s.db.SetNoteTags(note.ID, s.existingTags(p.TagIDs))
+}
@@ -0,0 +1,151 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	folderInfoFile   = "locknote-sync.json"
+	folderRecordsDir = "records"
+	folderRecordExt  = ".json"
+)
+
+// FolderTransport 把记录保存在共享文件夹中（如网盘同步目录或 U 盘），
+// 每台设备与该文件夹同步即可交换数据。文件夹中只有密文与版本向量。
+type FolderTransport struct {
+	dir string
+}
+
+func NewFolderTransport(dir string) *FolderTransport {
+	return &FolderTransport{dir: dir}
+}
+
+func (t *FolderTransport) recordPath(kind, id string) string {
+	return filepath.Join(t.dir, folderRecordsDir, kind, id+folderRecordExt)
+}
+
+func (t *FolderTransport) Handshake(local *Info) (*Info, error) {
+	path := filepath.Join(t.dir, folderInfoFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var info Info
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, err
+		}
+		return &info, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// 空文件夹：由第一台同步的设备初始化
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(local)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+	return local, nil
+}
+
+func (t *FolderTransport) List() ([]*Header, error) {
+	var headers []*Header
+	for _, kind := range kindOrder {
+		entries, err := os.ReadDir(filepath.Join(t.dir, folderRecordsDir, kind))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, folderRecordExt) {
+				continue
+			}
+			id := strings.TrimSuffix(name, folderRecordExt)
+			if validateKey(kind, id) != nil {
+				continue
+			}
+
+			rec, err := t.Get(kind, id)
+			if err != nil {
+				// 其他设备可能正在写入，跳过损坏的记录，下次同步再处理
+				continue
+			}
+			headers = append(headers, &rec.Header)
+		}
+	}
+	return headers, nil
+}
+
+func (t *FolderTransport) Get(kind, id string) (*Record, error) {
+	if err := validateKey(kind, id); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(t.recordPath(kind, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	if rec.Kind != kind || rec.ID != id {
+		return nil, errors.New("sync: record does not match its file name")
+	}
+	return &rec, nil
+}
+
+func (t *FolderTransport) Put(rec *Record) error {
+	if err := validateKey(rec.Kind, rec.ID); err != nil {
+		return err
+	}
+
+	existing, err := t.Get(rec.Kind, rec.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if existing != nil && rec.Vector.Compare(existing.Vector) != After {
+		return ErrStale
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	path := t.recordPath(rec.Kind, rec.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package sync
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRecordBytes 限制单条记录的大小
+const maxRecordBytes = 64 << 20
+
+// NewHandler 通过 HTTP 提供 t（通常是本机的 Service）作为同步的另一端。
+// 请求需要带有 "Authorization: Bearer <token>"；token 为空时拒绝所有请求。
+//
+//	POST /handshake             交换 Info
+//	GET  /records               列出所有记录头
+//	GET  /records/{kind}/{id}   读取记录
+//	PUT  /records/{kind}/{id}   写入记录，不比已有版本新时返回 409
+func NewHandler(t Transport, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /handshake", func(w http.ResponseWriter, r *http.Request) {
+		var local Info
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBytes)).Decode(&local); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info, err := t.Handshake(&local)
+		writeResult(w, info, err)
+	})
+
+	mux.HandleFunc("GET /records", func(w http.ResponseWriter, r *http.Request) {
+		headers, err := t.List()
+		writeResult(w, headers, err)
+	})
+
+	mux.HandleFunc("GET /records/{kind}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rec, err := t.Get(r.PathValue("kind"), r.PathValue("id"))
+		writeResult(w, rec, err)
+	})
+
+	mux.HandleFunc("PUT /records/{kind}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBytes)).Decode(&rec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rec.Kind != r.PathValue("kind") || rec.ID != r.PathValue("id") {
+			http.Error(w, "record does not match path", http.StatusBadRequest)
+			return
+		}
+		if err := t.Put(&rec); err != nil {
+			writeResult(w, nil, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeResult(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrStale):
+			status = http.StatusConflict
+		case errors.Is(err, ErrNotFound):
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// HTTPTransport 是 NewHandler 的客户端
+type HTTPTransport struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func NewHTTPTransport(baseURL, token string) *HTTPTransport {
+	return &HTTPTransport{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (t *HTTPTransport) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, t.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return ErrStale
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sync: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxRecordBytes)).Decode(out)
+}
+
+func (t *HTTPTransport) Handshake(local *Info) (*Info, error) {
+	var info Info
+	if err := t.do(http.MethodPost, "/handshake", local, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (t *HTTPTransport) List() ([]*Header, error) {
+	var headers []*Header
+	if err := t.do(http.MethodGet, "/records", nil, &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+func (t *HTTPTransport) Get(kind, id string) (*Record, error) {
+	if err := validateKey(kind, id); err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := t.do(http.MethodGet, "/records/"+url.PathEscape(kind)+"/"+url.PathEscape(id), nil, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (t *HTTPTransport) Put(rec *Record) error {
+	if err := validateKey(rec.Kind, rec.ID); err != nil {
+		return err
+	}
+	return t.do(http.MethodPut, "/records/"+url.PathEscape(rec.Kind)+"/"+url.PathEscape(rec.ID), rec, nil)
+}
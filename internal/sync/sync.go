@@ -0,0 +1,655 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+
+// Package sync 在两个使用同一数据密钥的 LockNote 数据目录之间同步笔记、标签、笔记本与智能视图。
+//
+// 每个数据目录有一个设备 ID。每次同步前先扫描本地数据：内容摘要与上次记录不同的对象
+// 在本设备的版本向量分量上加一，消失的对象记为墓碑。随后与远端逐个比较版本向量：
+// 一方包含另一方时直接覆盖，并发修改时保留本地版本，并把远端的笔记另存为冲突副本。
+//
+// 传输层只接触 Record：正文保持原有密文，元数据用从数据密钥派生的同步密钥加密，
+// 因此共享文件夹或 HTTP 中转都不需要、也无法解密数据。记录头（类型、ID、版本向量、
+// 是否删除）与载荷一起由同步密钥派生的 MAC 认证，无法通过 MAC 校验的记录不会被应用。
+package sync
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"locknote/internal/crypto"
+	"locknote/internal/database"
+	"locknote/internal/notes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+
+	"github.com/google/uuid"
+)
+
+// 同步对象的类型
+const (
+	KindTag       = "tag"
+	KindNotebook  = "notebook"
+	KindSmartView = "smartview"
+	KindNote      = "note"
+)
+
+// kindOrder 也是应用远端记录的顺序：笔记引用的标签与笔记本需要先存在
+var kindOrder = []string{KindTag, KindNotebook, KindSmartView, KindNote}
+
+const (
+	syncKeyPurpose   = "locknote-sync-v1"
+	recordMACPurpose = "locknote-sync-record-mac-v1"
+	keyCheckData     = "locknote-sync-key-check"
+	deviceIDKey      = "device_id"
+)
+
+var (
+	// ErrStale 表示写入的记录并不比已有版本新，调用方应在下次同步时重新比较
+	ErrStale = errors.New("sync: record is not newer than the stored version")
+	// ErrNotFound 表示远端没有该记录
+	ErrNotFound = errors.New("sync: record not found")
+	// ErrKeyMismatch 表示两端使用了不同的数据密钥
+	ErrKeyMismatch = errors.New("两端的数据密钥不一致，无法同步")
+	// ErrUnauthenticated 表示记录没有 MAC 或 MAC 不正确，可能被篡改或来自旧版本
+	ErrUnauthenticated = errors.New("sync: record authentication failed")
+)
+
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// validateKey 校验对象类型与 ID，传输层用它们拼接路径
+func validateKey(kind, id string) error {
+	for _, k := range kindOrder {
+		if k == kind {
+			if !idPattern.MatchString(id) {
+				return errors.New("sync: invalid record id")
+			}
+			return nil
+		}
+	}
+	return errors.New("sync: invalid record kind")
+}
+
+// Header 是记录的明文部分，足以判断需要拉取还是推送
+type Header struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	Vector  Vector `json:"vector"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// Record 是在两端之间交换的对象；墓碑没有 Payload。MAC 认证记录头与 Payload
+type Record struct {
+	Header
+	Payload []byte `json:"payload,omitempty"`
+	MAC     []byte `json:"mac,omitempty"`
+}
+
+// Info 在握手时交换，用于确认两端使用同一数据密钥
+type Info struct {
+	KeyCheck []byte `json:"keyCheck"`
+}
+
+// Transport 是同步的另一端。Service 自身也实现了 Transport，可以直接与另一个 Core 同步。
+type Transport interface {
+	// Handshake 交换 Info；尚未初始化的远端（如空文件夹）应记住 local
+	Handshake(local *Info) (*Info, error)
+	List() ([]*Header, error)
+	Get(kind, id string) (*Record, error)
+	// Put 写入记录；已有版本不早于 rec 时返回 ErrStale
+	Put(rec *Record) error
+}
+
+// Report 汇总一次同步的结果
+type Report struct {
+	Pulled    int `json:"pulled"`
+	Pushed    int `json:"pushed"`
+	Conflicts int `json:"conflicts"`
+	Skipped   int `json:"skipped"`
+	Rejected  int `json:"rejected"` // 无法通过 MAC 校验而未应用的远端记录
+}
+
+type Service struct {
+	db        *database.DB
+	dataDir   string
+	notes     *notes.Service
+	crypto    *crypto.Service
+	masterKey []byte
+	keyMu     gosync.RWMutex
+	mu        gosync.Mutex // 串行化扫描、应用与同步
+}
+
+func NewService(db *database.DB, dataDir string, noteService *notes.Service) *Service {
+	return &Service{
+		db:      db,
+		dataDir: dataDir,
+		notes:   noteService,
+		crypto:  crypto.NewService(),
+	}
+}
+
+func (s *Service) SetMasterKey(key []byte) {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+	s.masterKey = key
+}
+
+func (s *Service) getMasterKey() ([]byte, error) {
+	s.keyMu.RLock()
+	defer s.keyMu.RUnlock()
+	if s.masterKey == nil {
+		return nil, errors.New("not unlocked")
+	}
+	return s.masterKey, nil
+}
+
+func (s *Service) syncKey() ([]byte, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	return s.crypto.DeriveSubKey(key, syncKeyPurpose), nil
+}
+
+func (s *Service) info() (*Info, error) {
+	key, err := s.syncKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Info{KeyCheck: s.crypto.HMAC(key, []byte(keyCheckData))}, nil
+}
+
+// recordMAC 计算记录头与载荷摘要的 MAC，版本向量按设备 ID 排序后编码
+func (s *Service) recordMAC(rec *Record) ([]byte, error) {
+	key, err := s.syncKey()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]string, 0, len(rec.Vector))
+	for device := range rec.Vector {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	vector := make([]string, len(devices))
+	for i, device := range devices {
+		vector[i] = device + "=" + strconv.FormatUint(rec.Vector[device], 10)
+	}
+	payloadHash := sha256.Sum256(rec.Payload)
+
+	var b bytes.Buffer
+	b.WriteString(rec.Kind)
+	b.WriteByte(0)
+	b.WriteString(rec.ID)
+	b.WriteByte(0)
+	b.WriteString(strings.Join(vector, ","))
+	b.WriteByte(0)
+	b.WriteString(strconv.FormatBool(rec.Deleted))
+	b.WriteByte(0)
+	b.Write(payloadHash[:])
+	return s.crypto.HMAC(s.crypto.DeriveSubKey(key, recordMACPurpose), b.Bytes()), nil
+}
+
+// sign 为本地导出的记录计算 MAC
+func (s *Service) sign(rec *Record) error {
+	mac, err := s.recordMAC(rec)
+	if err != nil {
+		return err
+	}
+	rec.MAC = mac
+	return nil
+}
+
+// verify 校验远端记录的 MAC，必须在修改记录之前调用
+func (s *Service) verify(rec *Record) error {
+	if err := validateKey(rec.Kind, rec.ID); err != nil {
+		return err
+	}
+	mac, err := s.recordMAC(rec)
+	if err != nil {
+		return err
+	}
+	if len(rec.MAC) == 0 || !hmac.Equal(mac, rec.MAC) {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+// DeviceID 返回本数据目录的设备 ID，首次调用时生成
+func (s *Service) DeviceID() (string, error) {
+	id, err := s.db.GetSyncMeta(deviceIDKey)
+	if err != nil || id != "" {
+		return id, err
+	}
+	id = uuid.New().String()
+	if err := s.db.SetSyncMeta(deviceIDKey, id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ============ 同步 ============
+
+// Sync 与 remote 双向同步
+func (s *Service) Sync(remote Transport) (*Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	local, err := s.info()
+	if err != nil {
+		return nil, err
+	}
+	remoteInfo, err := remote.Handshake(local)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(local.KeyCheck, remoteInfo.KeyCheck) {
+		return nil, ErrKeyMismatch
+	}
+
+	report := &Report{}
+	// 冲突副本是新建的本地笔记，需要再扫描一轮才能推送出去
+	for round := 0; round < 2; round++ {
+		if err := s.scan(); err != nil {
+			return report, err
+		}
+		copies, err := s.exchange(remote, report)
+		if err != nil {
+			return report, err
+		}
+		if copies == 0 {
+			break
+		}
+	}
+	return report, nil
+}
+
+// exchange 比较两端的版本向量并拉取、推送或解决冲突，返回新建的冲突副本数量
+func (s *Service) exchange(remote Transport, report *Report) (int, error) {
+	remoteHeaders, err := remote.List()
+	if err != nil {
+		return 0, err
+	}
+	remoteStates := make(map[entityKey]*Header, len(remoteHeaders))
+	for _, h := range remoteHeaders {
+		if validateKey(h.Kind, h.ID) == nil {
+			remoteStates[entityKey{h.Kind, h.ID}] = h
+		}
+	}
+
+	localStates, err := s.loadStates()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]entityKey, 0, len(localStates)+len(remoteStates))
+	for k := range localStates {
+		keys = append(keys, k)
+	}
+	for k := range remoteStates {
+		if _, ok := localStates[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sortKeys(keys)
+
+	copies := 0
+	for _, k := range keys {
+		l, r := localStates[k], remoteStates[k]
+
+		var ord Ordering
+		switch {
+		case r == nil:
+			ord = After
+		case l == nil:
+			ord = Before
+		default:
+			ord = l.vector.Compare(r.Vector)
+		}
+
+		switch ord {
+		case After:
+			if err := s.push(remote, k, l, report); err != nil {
+				return copies, err
+			}
+		case Before:
+			rec, err := remote.Get(k.kind, k.id)
+			if err != nil {
+				return copies, err
+			}
+			if s.verify(rec) != nil {
+				report.Rejected++
+				continue
+			}
+			// 列表中的记录头没有认证，以读取到的记录为准，避免旧记录被当作新版本应用
+			if l != nil && rec.Vector.Compare(l.vector) != After {
+				report.Skipped++
+				continue
+			}
+			if err := s.apply(rec); err != nil {
+				return copies, err
+			}
+			report.Pulled++
+		case Concurrent:
+			n, err := s.resolve(remote, k, l, report)
+			if err != nil {
+				return copies, err
+			}
+			copies += n
+		}
+	}
+
+	return copies, nil
+}
+
+func (s *Service) push(remote Transport, k entityKey, st *state, report *Report) error {
+	rec, err := s.export(k, st)
+	if err != nil {
+		return err
+	}
+	if err := remote.Put(rec); err != nil {
+		if errors.Is(err, ErrStale) {
+			report.Skipped++
+			return nil
+		}
+		return err
+	}
+	report.Pushed++
+	return nil
+}
+
+// resolve 处理并发修改：修改优先于删除；两边都修改时保留本地版本，远端笔记另存为冲突副本。
+// 合并后的版本向量包含两端，推送后远端也会采用本地的结果。
+func (s *Service) resolve(remote Transport, k entityKey, l *state, report *Report) (int, error) {
+	rec, err := remote.Get(k.kind, k.id)
+	if err != nil {
+		return 0, err
+	}
+	if s.verify(rec) != nil {
+		report.Rejected++
+		return 0, nil
+	}
+	if rec.Vector.Compare(l.vector) != Concurrent {
+		report.Skipped++
+		return 0, nil
+	}
+
+	device, err := s.DeviceID()
+	if err != nil {
+		return 0, err
+	}
+	merged := l.vector.Merge(rec.Vector)
+	merged.Increment(device)
+
+	copies := 0
+	switch {
+	case l.deleted && !rec.Deleted:
+		// 本地删除、远端修改：恢复远端版本
+		rec.Vector = merged
+		if err := s.apply(rec); err != nil {
+			return 0, err
+		}
+	default:
+		if !l.deleted && !rec.Deleted && k.kind == KindNote {
+			created, err := s.createConflictCopy(rec)
+			if err != nil {
+				return 0, err
+			}
+			if created {
+				copies++
+			}
+		}
+		if err := s.putState(k, &state{vector: merged, hash: l.hash, deleted: l.deleted}); err != nil {
+			return 0, err
+		}
+	}
+	report.Conflicts++
+
+	st, err := s.loadState(k)
+	if err != nil {
+		return copies, err
+	}
+	return copies, s.push(remote, k, st, report)
+}
+
+// ============ 本地状态 ============
+
+type entityKey struct {
+	kind string
+	id   string
+}
+
+// state 是 sync_entities 中记录的同步状态
+type state struct {
+	vector  Vector
+	hash    []byte
+	deleted bool
+}
+
+func sortKeys(keys []entityKey) {
+	rank := make(map[string]int, len(kindOrder))
+	for i, k := range kindOrder {
+		rank[k] = i
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return rank[keys[i].kind] < rank[keys[j].kind]
+		}
+		return keys[i].id < keys[j].id
+	})
+}
+
+func decodeState(e *database.SyncEntity) (*state, error) {
+	st := &state{hash: e.Hash, deleted: e.Deleted}
+	if err := json.Unmarshal([]byte(e.Vector), &st.vector); err != nil {
+		return nil, err
+	}
+	if st.vector == nil {
+		st.vector = Vector{}
+	}
+	return st, nil
+}
+
+func (s *Service) loadStates() (map[entityKey]*state, error) {
+	entities, err := s.db.ListSyncEntities()
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[entityKey]*state, len(entities))
+	for _, e := range entities {
+		st, err := decodeState(e)
+		if err != nil {
+			return nil, err
+		}
+		states[entityKey{e.Kind, e.ID}] = st
+	}
+	return states, nil
+}
+
+// loadState 返回单个对象的同步状态，没有记录时返回 nil
+func (s *Service) loadState(k entityKey) (*state, error) {
+	e, err := s.db.GetSyncEntity(k.kind, k.id)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeState(e)
+}
+
+// Forget 清除对象的同步状态。对象在本地被移除后不会被当作删除推送，
+// 下次同步时会从对端重新拉取。
+func (s *Service) Forget(kind, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.DeleteSyncEntity(kind, id)
+}
+
+func (s *Service) putState(k entityKey, st *state) error {
+	vector, err := json.Marshal(st.vector)
+	if err != nil {
+		return err
+	}
+	return s.db.PutSyncEntity(&database.SyncEntity{
+		Kind:    k.kind,
+		ID:      k.id,
+		Vector:  string(vector),
+		Hash:    st.hash,
+		Deleted: st.deleted,
+	})
+}
+
+// scan 把上次同步以来的本地修改记入版本向量
+func (s *Service) scan() error {
+	device, err := s.DeviceID()
+	if err != nil {
+		return err
+	}
+	current, unreadable, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	stored, err := s.loadStates()
+	if err != nil {
+		return err
+	}
+
+	for k, e := range current {
+		if err := s.recordChange(device, k, stored[k], e); err != nil {
+			return err
+		}
+	}
+	for k, st := range stored {
+		if _, ok := current[k]; ok || unreadable[k] {
+			continue
+		}
+		if err := s.recordChange(device, k, st, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanOne 只检查单个对象的本地修改
+func (s *Service) scanOne(k entityKey) error {
+	device, err := s.DeviceID()
+	if err != nil {
+		return err
+	}
+	e, err := s.snapshotOne(k)
+	if err != nil {
+		return err
+	}
+	st, err := s.loadState(k)
+	if err != nil {
+		return err
+	}
+	return s.recordChange(device, k, st, e)
+}
+
+// recordChange 比较当前快照 e（nil 表示对象已不存在）与同步状态 st，有变化时递增本设备的分量
+func (s *Service) recordChange(device string, k entityKey, st *state, e *entity) error {
+	switch {
+	case st == nil && e == nil:
+		return nil
+	case st == nil:
+		st = &state{vector: Vector{}}
+	case e == nil && st.deleted:
+		return nil
+	case e != nil && !st.deleted && bytes.Equal(st.hash, e.hash):
+		return nil
+	}
+
+	next := &state{vector: st.vector.Clone(), deleted: e == nil}
+	if e != nil {
+		next.hash = e.hash
+	}
+	next.vector.Increment(device)
+	return s.putState(k, next)
+}
+
+// ============ 作为 Transport 提供给另一端 ============
+
+func (s *Service) Handshake(local *Info) (*Info, error) {
+	return s.info()
+}
+
+func (s *Service) List() ([]*Header, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.getMasterKey(); err != nil {
+		return nil, err
+	}
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+	states, err := s.loadStates()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]entityKey, 0, len(states))
+	for k := range states {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+
+	headers := make([]*Header, len(keys))
+	for i, k := range keys {
+		st := states[k]
+		headers[i] = &Header{Kind: k.kind, ID: k.id, Vector: st.vector, Deleted: st.deleted}
+	}
+	return headers, nil
+}
+
+func (s *Service) Get(kind, id string) (*Record, error) {
+	if err := validateKey(kind, id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := entityKey{kind, id}
+	st, err := s.loadState(k)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, ErrNotFound
+	}
+	return s.export(k, st)
+}
+
+func (s *Service) Put(rec *Record) error {
+	if err := validateKey(rec.Kind, rec.ID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.verify(rec); err != nil {
+		return err
+	}
+
+	k := entityKey{rec.Kind, rec.ID}
+	if err := s.scanOne(k); err != nil {
+		return err
+	}
+	st, err := s.loadState(k)
+	if err != nil {
+		return err
+	}
+	if st != nil && rec.Vector.Compare(st.vector) != After {
+		return ErrStale
+	}
+	return s.apply(rec)
+}
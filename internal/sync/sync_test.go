@@ -0,0 +1,274 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"locknote/internal/crypto"
+	"locknote/internal/database"
+	"locknote/internal/notebooks"
+	"locknote/internal/notes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testDevice struct {
+	sync  *Service
+	notes *notes.Service
+}
+
+// newTestDevice 在临时目录中创建一台用 key 解锁的设备
+func newTestDevice(t *testing.T, key []byte) *testDevice {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"notes", "history", "attachments"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := database.New(filepath.Join(dir, "locknote.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	nb := notebooks.NewService(db)
+	nb.SetMasterKey(key)
+	ns := notes.NewService(db, dir, nb)
+	ns.SetMasterKey(key)
+	s := NewService(db, dir, ns)
+	s.SetMasterKey(key)
+	return &testDevice{sync: s, notes: ns}
+}
+
+func testSyncKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := crypto.NewService().GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustSync(t *testing.T, d *testDevice, remote Transport) *Report {
+	t.Helper()
+	report, err := d.sync.Sync(remote)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	return report
+}
+
+// editRecord 读取文件夹中的记录，交给 edit 修改后写回
+func editRecord(t *testing.T, folder *FolderTransport, kind, id string, edit func(*Record)) {
+	t.Helper()
+	rec, err := folder.Get(kind, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(rec)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(folder.recordPath(kind, id), data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncPullsNotes(t *testing.T) {
+	key := testSyncKey(t)
+	a, b := newTestDevice(t, key), newTestDevice(t, key)
+	folder := NewFolderTransport(t.TempDir())
+
+	note, err := a.notes.Create("Title", "Body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := mustSync(t, a, folder); r.Pushed != 1 {
+		t.Fatalf("pushed %d records, want 1", r.Pushed)
+	}
+	if r := mustSync(t, b, folder); r.Pulled != 1 || r.Rejected != 0 {
+		t.Fatalf("report %+v, want 1 pulled", r)
+	}
+
+	got, err := b.notes.Get(note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Title" || got.Content != "Body" {
+		t.Fatalf("got %q / %q", got.Title, got.Content)
+	}
+
+	if r := mustSync(t, b, folder); r.Pulled != 0 || r.Pushed != 0 {
+		t.Fatalf("second sync was not a no-op: %+v", r)
+	}
+}
+
+func TestSyncRejectsTamperedRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Record)
+	}{
+		{"missing mac", func(r *Record) { r.MAC = nil }},
+		{"vector", func(r *Record) {
+			for device := range r.Vector {
+				r.Vector[device] += 10
+			}
+		}},
+		{"payload", func(r *Record) { r.Payload[len(r.Payload)-1] ^= 0x01 }},
+		{"tombstone", func(r *Record) { r.Deleted = true; r.Payload = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := testSyncKey(t)
+			a, b := newTestDevice(t, key), newTestDevice(t, key)
+			folder := NewFolderTransport(t.TempDir())
+
+			note, err := a.notes.Create("Title", "Body")
+			if err != nil {
+				t.Fatal(err)
+			}
+			mustSync(t, a, folder)
+			editRecord(t, folder, KindNote, note.ID, tt.edit)
+
+			if r := mustSync(t, b, folder); r.Rejected != 1 || r.Pulled != 0 {
+				t.Fatalf("report %+v, want 1 rejected", r)
+			}
+			if _, err := b.notes.Get(note.ID); err == nil {
+				t.Fatal("tampered note was applied")
+			}
+
+			rec, err := folder.Get(KindNote, note.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.sync.Put(rec); !errors.Is(err, ErrUnauthenticated) {
+				t.Fatalf("Put = %v, want ErrUnauthenticated", err)
+			}
+		})
+	}
+}
+
+func TestSyncRejectsRecordsFromOtherKeys(t *testing.T) {
+	a := newTestDevice(t, testSyncKey(t))
+	b := newTestDevice(t, testSyncKey(t))
+
+	note, err := a.notes.Create("Title", "Body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// List 会先扫描本地修改
+	if _, err := a.sync.List(); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := a.sync.Get(KindNote, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.sync.Put(rec); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("Put = %v, want ErrUnauthenticated", err)
+	}
+}
+
+// inflatedHeaders 在列表中夸大版本向量，但 Get 返回的仍是原来的记录
+type inflatedHeaders struct {
+	*FolderTransport
+}
+
+func (t inflatedHeaders) List() ([]*Header, error) {
+	headers, err := t.FolderTransport.List()
+	for _, h := range headers {
+		h.Vector = h.Vector.Clone()
+		h.Vector.Increment("forged")
+	}
+	return headers, err
+}
+
+func TestSyncIgnoresReplayedRecords(t *testing.T) {
+	key := testSyncKey(t)
+	a, b := newTestDevice(t, key), newTestDevice(t, key)
+	folder := NewFolderTransport(t.TempDir())
+
+	note, err := a.notes.Create("Title", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, a, folder)
+	mustSync(t, b, folder)
+	old, err := folder.Get(KindNote, note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.notes.Update(note.ID, "Title", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, a, folder)
+	mustSync(t, b, folder)
+
+	// 用旧的有效记录替换新记录，并在列表中声称它更新
+	data, err := json.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(folder.recordPath(KindNote, note.ID), data); err != nil {
+		t.Fatal(err)
+	}
+	if r := mustSync(t, b, inflatedHeaders{folder}); r.Pulled != 0 {
+		t.Fatalf("replayed record was applied: %+v", r)
+	}
+	got, err := b.notes.Get(note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Content != "v2" {
+		t.Fatalf("content = %q, want v2", got.Content)
+	}
+	if err := b.sync.Put(old); !errors.Is(err, ErrStale) {
+		t.Fatalf("Put = %v, want ErrStale", err)
+	}
+}
+
+func TestSyncRemoteDeleteMovesNoteToTrash(t *testing.T) {
+	key := testSyncKey(t)
+	a, b := newTestDevice(t, key), newTestDevice(t, key)
+	folder := NewFolderTransport(t.TempDir())
+
+	note, err := a.notes.Create("Title", "Body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, a, folder)
+	mustSync(t, b, folder)
+
+	if err := a.notes.Delete(note.ID); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, a, folder)
+	if r := mustSync(t, b, folder); r.Pulled != 1 {
+		t.Fatalf("report %+v, want the tombstone pulled", r)
+	}
+
+	got, err := b.notes.Get(note.ID)
+	if err != nil {
+		t.Fatalf("note was removed instead of trashed: %v", err)
+	}
+	if got.DeletedAt == nil {
+		t.Fatal("note is not in the trash")
+	}
+
+	// 移入回收站不是本地修改，不会推送回去让另一端恢复
+	if r := mustSync(t, b, folder); r.Pushed != 0 || r.Conflicts != 0 {
+		t.Fatalf("trashing was synced back: %+v", r)
+	}
+	if r := mustSync(t, a, folder); r.Pulled != 0 {
+		t.Fatalf("deleted note came back: %+v", r)
+	}
+	if _, err := a.notes.Get(note.ID); err == nil {
+		t.Fatal("deleted note came back")
+	}
+}
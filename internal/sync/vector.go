@@ -0,0 +1,69 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package sync
+
+// Vector 是版本向量：设备 ID -> 该设备对对象做过的修改次数
+type Vector map[string]uint64
+
+// Ordering 是两个版本向量之间的先后关系
+type Ordering int
+
+const (
+	Equal Ordering = iota
+	Before
+	After
+	Concurrent
+)
+
+// Compare 返回 v 相对于 o 的关系：Before 表示 v 被 o 包含，After 表示 v 包含 o
+func (v Vector) Compare(o Vector) Ordering {
+	less, greater := false, false
+	for device, n := range v {
+		if m := o[device]; n > m {
+			greater = true
+		} else if n < m {
+			less = true
+		}
+	}
+	for device, m := range o {
+		if _, ok := v[device]; !ok && m > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return Concurrent
+	case greater:
+		return After
+	case less:
+		return Before
+	default:
+		return Equal
+	}
+}
+
+// Merge 返回两个向量逐项取最大值的结果
+func (v Vector) Merge(o Vector) Vector {
+	merged := v.Clone()
+	for device, m := range o {
+		if m > merged[device] {
+			merged[device] = m
+		}
+	}
+	return merged
+}
+
+func (v Vector) Clone() Vector {
+	c := make(Vector, len(v))
+	for device, n := range v {
+		c[device] = n
+	}
+	return c
+}
+
+// Increment 记录 device 上的一次修改
+func (v Vector) Increment(device string) {
+	v[device]++
+}
@@ -0,0 +1,54 @@
+// https://github.com/JackyZhang8/locknote
+// 一个简单、可靠、离线优先的桌面加密笔记软件。
+// A simple, reliable, offline-first encrypted note-taking desktop app.
+package sync
+
+import "testing"
+
+func TestVectorCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		v, o Vector
+		want Ordering
+	}{
+		{"both empty", Vector{}, Vector{}, Equal},
+		{"nil and empty", nil, Vector{}, Equal},
+		{"zero entries", Vector{"a": 0}, Vector{"b": 0}, Equal},
+		{"equal", Vector{"a": 2, "b": 1}, Vector{"a": 2, "b": 1}, Equal},
+		{"after", Vector{"a": 3, "b": 1}, Vector{"a": 2, "b": 1}, After},
+		{"after with new device", Vector{"a": 2, "b": 1}, Vector{"a": 2}, After},
+		{"before", Vector{"a": 1}, Vector{"a": 2}, Before},
+		{"before missing device", Vector{"a": 2}, Vector{"a": 2, "b": 1}, Before},
+		{"concurrent", Vector{"a": 2, "b": 1}, Vector{"a": 1, "b": 2}, Concurrent},
+		{"concurrent disjoint", Vector{"a": 1}, Vector{"b": 1}, Concurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.v.Compare(tt.o); got != tt.want {
+				t.Fatalf("Compare = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorMerge(t *testing.T) {
+	v := Vector{"a": 3, "b": 1}
+	o := Vector{"a": 1, "b": 4, "c": 2}
+
+	merged := v.Merge(o)
+	want := Vector{"a": 3, "b": 4, "c": 2}
+	if merged.Compare(want) != Equal || len(merged) != len(want) {
+		t.Fatalf("Merge = %v, want %v", merged, want)
+	}
+	if merged.Compare(v) != After || merged.Compare(o) != After {
+		t.Fatal("merged vector does not dominate its inputs")
+	}
+	if v["b"] != 1 || len(v) != 2 {
+		t.Fatalf("Merge modified its receiver: %v", v)
+	}
+
+	merged.Increment("a")
+	if merged["a"] != 4 || v["a"] != 3 {
+		t.Fatalf("Increment = %v, receiver %v", merged, v)
+	}
+}
@@ -4,14 +4,27 @@
 package tags
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
+	"locknote/internal/crypto"
 	"locknote/internal/database"
+	"sort"
+	"sync"
 
 	"github.com/google/uuid"
 )
 
+// 标签名称用数据密钥加密并绑定标签 ID；名称的唯一性由 name_index 保证，
+// 它是名称经数据密钥派生的子密钥计算的 HMAC，不泄露名称本身
+const nameIndexPurpose = "locknote-tag-name-index-v1"
+
 type Service struct {
-	db *database.DB
+	db        *database.DB
+	crypto    *crypto.Service
+	masterKey []byte
+	mu        sync.RWMutex
 }
 
 type Tag struct {
@@ -21,19 +34,80 @@ type Tag struct {
 }
 
 func NewService(db *database.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, crypto: crypto.NewService()}
+}
+
+func (s *Service) SetMasterKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.masterKey = key
+}
+
+func (s *Service) getMasterKey() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.masterKey == nil {
+		return nil, errors.New("not unlocked")
+	}
+	return s.masterKey, nil
+}
+
+func nameAAD(id string) []byte {
+	return []byte("locknote-tag\x00name\x00" + id)
+}
+
+// OpenName 返回数据库中标签的名称，加密之前的旧数据直接返回明文
+func OpenName(c *crypto.Service, key []byte, t *database.Tag) (string, error) {
+	if t.EncryptedName == nil {
+		return t.Name, nil
+	}
+	name, err := c.DecryptWithAAD(key, t.EncryptedName, nameAAD(t.ID))
+	if err != nil {
+		return "", fmt.Errorf("标签名称无法解密 (id=%s): %w", t.ID, err)
+	}
+	return string(name), nil
+}
+
+func (s *Service) nameIndex(key []byte, name string) []byte {
+	return s.crypto.HMAC(s.crypto.DeriveSubKey(key, nameIndexPurpose), []byte(name))
+}
+
+// seal 加密 name 并写入 t 的加密字段与名称索引
+func (s *Service) seal(key []byte, t *database.Tag, name string) error {
+	encrypted, err := s.crypto.EncryptWithAAD(key, []byte(name), nameAAD(t.ID))
+	if err != nil {
+		return err
+	}
+	t.Name = ""
+	t.EncryptedName = encrypted
+	t.NameIndex = s.nameIndex(key, name)
+	return nil
+}
+
+func (s *Service) open(key []byte, t *database.Tag) (*Tag, error) {
+	name, err := OpenName(s.crypto, key, t)
+	if err != nil {
+		return nil, err
+	}
+	return &Tag{ID: t.ID, Name: name, Color: t.Color}, nil
 }
 
 func (s *Service) Create(name, color string) (*Tag, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
 	if color == "" {
 		color = "#10b981"
 	}
 
 	tag := &database.Tag{
 		ID:    uuid.New().String(),
-		Name:  name,
 		Color: color,
 	}
+	if err := s.seal(key, tag, name); err != nil {
+		return nil, err
+	}
 
 	if err := s.db.CreateTag(tag); err != nil {
 		return nil, err
@@ -41,17 +115,24 @@ func (s *Service) Create(name, color string) (*Tag, error) {
 
 	return &Tag{
 		ID:    tag.ID,
-		Name:  tag.Name,
+		Name:  name,
 		Color: tag.Color,
 	}, nil
 }
 
 func (s *Service) Update(id, name, color string) (*Tag, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
 	tag := &database.Tag{
 		ID:    id,
-		Name:  name,
 		Color: color,
 	}
+	if err := s.seal(key, tag, name); err != nil {
+		return nil, err
+	}
 
 	if err := s.db.UpdateTag(tag); err != nil {
 		return nil, err
@@ -59,7 +140,7 @@ func (s *Service) Update(id, name, color string) (*Tag, error) {
 
 	return &Tag{
 		ID:    tag.ID,
-		Name:  tag.Name,
+		Name:  name,
 		Color: tag.Color,
 	}, nil
 }
@@ -71,7 +152,13 @@ func (s *Service) Delete(id string) error {
 	return nil
 }
 
+// List 返回全部标签，按名称排序
 func (s *Service) List() ([]*Tag, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
 	dbTags, err := s.db.ListTags()
 	if err != nil {
 		return nil, err
@@ -79,16 +166,75 @@ func (s *Service) List() ([]*Tag, error) {
 
 	tags := make([]*Tag, len(dbTags))
 	for i, t := range dbTags {
-		tags[i] = &Tag{
-			ID:    t.ID,
-			Name:  t.Name,
-			Color: t.Color,
+		if tags[i], err = s.open(key, t); err != nil {
+			return nil, err
 		}
 	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
 
 	return tags, nil
 }
 
+func (s *Service) Get(id string) (*Tag, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.db.GetTag(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(key, t)
+}
+
+// GetByName 按完整名称查找标签，不存在时返回 sql.ErrNoRows
+func (s *Service) GetByName(name string) (*Tag, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.db.GetTagByNameIndex(s.nameIndex(key, name))
+	if err != nil {
+		return nil, err
+	}
+	return s.open(key, t)
+}
+
+// NoteTags 返回笔记的标签，按名称排序
+func (s *Service) NoteTags(noteID string) ([]*Tag, error) {
+	result, err := s.NoteTagsBatch([]string{noteID})
+	if err != nil {
+		return nil, err
+	}
+	return result[noteID], nil
+}
+
+// NoteTagsBatch 批量返回多篇笔记的标签，键为笔记 ID，每篇的标签按名称排序
+func (s *Service) NoteTagsBatch(noteIDs []string) (map[string][]*Tag, error) {
+	key, err := s.getMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	dbTags, err := s.db.GetNoteTagsBatch(noteIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]*Tag, len(dbTags))
+	for noteID, list := range dbTags {
+		tags := make([]*Tag, len(list))
+		for i, t := range list {
+			if tags[i], err = s.open(key, t); err != nil {
+				return nil, err
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+		result[noteID] = tags
+	}
+	return result, nil
+}
+
 func (s *Service) AddToNote(noteID, tagID string) error {
 	return s.db.AddNoteTag(noteID, tagID)
 }
@@ -96,3 +242,44 @@ func (s *Service) AddToNote(noteID, tagID string) error {
 func (s *Service) RemoveFromNote(noteID, tagID string) error {
 	return s.db.RemoveNoteTag(noteID, tagID)
 }
+
+// Rekey 把标签名称从 oldKey 重新加密为 newKey 并重新计算名称索引，返回改写的标签数。
+// 明文的旧数据直接加密；已经能用 newKey 解密且索引一致的标签跳过，因此可以重复调用，
+// oldKey 与 newKey 相同时只加密旧数据。两个密钥都无法解密的标签保持原样
+func (s *Service) Rekey(oldKey, newKey []byte) (int, error) {
+	dbTags, err := s.db.ListTags()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, t := range dbTags {
+		name, err := OpenName(s.crypto, newKey, t)
+		if err == nil && t.EncryptedName != nil && bytes.Equal(t.NameIndex, s.nameIndex(newKey, name)) {
+			continue
+		}
+		if err != nil {
+			if name, err = OpenName(s.crypto, oldKey, t); err != nil {
+				continue
+			}
+		}
+		if err := s.seal(newKey, t, name); err != nil {
+			return count, err
+		}
+		// 旧版本同步来的明文标签可能与已加密的标签同名，合并到已加密的标签
+		if same, err := s.db.GetTagByNameIndex(t.NameIndex); err == nil && same.ID != t.ID {
+			if err := s.db.ReplaceTag(t.ID, same); err != nil {
+				return count, err
+			}
+			count++
+			continue
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return count, err
+		}
+		if err := s.db.UpdateTag(t); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
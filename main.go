@@ -25,7 +25,8 @@ func main() {
 		Width:  1200,
 		Height: 800,
 		AssetServer: &assetserver.Options{
-			Assets: assets,
+			Assets:  assets,
+			Handler: &attachmentHandler{app: app},
 		},
 		BackgroundColour: &options.RGBA{R: 244, G: 251, B: 246, A: 1},
 		OnStartup:        app.startup,